@@ -2,40 +2,72 @@
 package admin
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"log"
 	"net/http"
-	"sync/atomic"
 
+	"github.com/bailey4770/chirpy/internal/analytics"
+	"github.com/bailey4770/chirpy/internal/audit"
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/blob"
 	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/filter"
+	"github.com/bailey4770/chirpy/internal/jobs"
+	"github.com/bailey4770/chirpy/internal/mailer"
+	"github.com/bailey4770/chirpy/internal/problem"
+	"github.com/google/uuid"
 )
 
-type State struct {
-	fileserverHits atomic.Int32
-	IsAdmin        bool
-	DB             *database.Queries
+// errNothingChanged is returned from an audited action that found nothing to act on, so no event is recorded
+var errNothingChanged = errors.New("nothing changed")
+
+// Store is the database the admin handlers use. *audit.Store implements it. Each part is declared
+// alongside the handlers that need it, so tests can stand in for the queries they exercise.
+type Store interface {
+	auditRecorder
+	userGetter
+	ClearAuthThrottle(ctx context.Context, key string) error
+	analyticsReader
+	auditLogReader
+	dashboardReader
+	filterStore
+	moderationStore
+	resetStore
+	SetUserRole(ctx context.Context, arg database.SetUserRoleParams) (int64, error)
+	suspensionStore
+	userManagementStore
 }
 
-const (
-	metricsMsg = `<html>
-  <body>
-    <h1>Welcome, Chirpy Admin</h1>
-    <p>Chirpy has been visited %d times!</p>
-  </body>
-</html>`
-)
+type auditRecorder interface {
+	// RecordAudit runs action and records event in one transaction. Queries in action must use the context it is passed.
+	RecordAudit(ctx context.Context, event audit.Event, action func(ctx context.Context) error) error
+}
 
-func (s *State) MiddlewareMetricsInc(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		s.fileserverHits.Add(1)
-		next.ServeHTTP(w, req)
-	})
+type userGetter interface {
+	GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error)
+}
+
+type State struct {
+	IsAdmin bool
+	DB      Store
+	Secret  string
+	Mailer  mailer.Mailer
+	Filter  *filter.Engine
+	// Background sends the mail a handler triggers, so the response does not wait on it
+	Background *jobs.Background
+	// Blobs holds uploaded media, whose files a reset deletes along with their rows
+	Blobs blob.Store
+	// Platform is where the server runs. Some actions are only allowed on PlatformDev.
+	Platform string
+	// TestTenantDomains are the email domains of accounts HandlerResetTestTenants may delete
+	TestTenantDomains []string
 }
 
 func (s *State) MiddlewareCheckAdminCreds(f http.HandlerFunc) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		if !s.IsAdmin {
-			http.Error(w, "non-admins cannot access admin API", http.StatusForbidden)
+			problem.Error(w, "non-admins cannot access admin API", http.StatusForbidden)
 			return
 		}
 
@@ -43,25 +75,45 @@ func (s *State) MiddlewareCheckAdminCreds(f http.HandlerFunc) http.Handler {
 	})
 }
 
+// HandlerMetrics shows the page views counted by every server, up to their last flush
 func (s *State) HandlerMetrics(w http.ResponseWriter, req *http.Request) {
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-
-	msg := fmt.Sprintf(metricsMsg, s.fileserverHits.Load())
-	if _, err := w.Write([]byte(msg)); err != nil {
-		log.Printf("Error: could not write body to healthz response: %v", err)
+	views, err := s.DB.GetAnalyticsTotal(req.Context(), analytics.MetricPageView)
+	if err != nil {
+		log.Printf("Error: could not count page views: %v", err)
+		problem.Error(w, "could not count page views", http.StatusInternalServerError)
+		return
 	}
+
+	renderHTML(w, metricsTemplate, views)
 }
 
-func (s *State) HandlerReset(w http.ResponseWriter, req *http.Request) {
-	if err := s.DB.DeleteAllUsers(req.Context()); err != nil {
-		log.Printf("Error: could not delete all users from db: %v", err)
+func (s *State) HandlerUnlockUser(w http.ResponseWriter, req *http.Request) {
+	staff, ok := s.requireRole(w, req, RoleAdmin)
+	if !ok {
+		return
 	}
 
-	log.Print("Warning: Successfully delted all users from DB")
+	userID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		problem.Error(w, "could not parse user ID to uuid", http.StatusBadRequest)
+		return
+	}
 
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write([]byte("Successfully deleted all users from db\n")); err != nil {
-		log.Printf("Error: could not write to response body: %v", err)
+	dbUser, err := s.DB.GetUserByID(req.Context(), userID)
+	if err != nil {
+		problem.Error(w, "could not find user", http.StatusNotFound)
+		return
 	}
+
+	event := audit.Event{ActorID: staff.ID, Action: audit.ActionUnlock, TargetType: audit.TargetUser, TargetID: userID.String()}
+	if err := s.DB.RecordAudit(req.Context(), event, func(ctx context.Context) error {
+		return s.DB.ClearAuthThrottle(ctx, auth.LoginAccountThrottleKey(dbUser.Email))
+	}); err != nil {
+		log.Printf("Error: could not clear login throttle for user %v: %v", userID, err)
+		problem.Error(w, "could not unlock user", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Warning: admin %v unlocked login for user %v", staff.ID, userID)
+	w.WriteHeader(http.StatusNoContent)
 }
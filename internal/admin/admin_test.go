@@ -0,0 +1,250 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/audit"
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const testSecret = "test-secret"
+
+// mockAdminDB holds the rows the admin handlers act on. Queries no test needs are left to the nil
+// Store it embeds, so calling one panics rather than passing silently.
+type mockAdminDB struct {
+	Store
+	users map[uuid.UUID]database.User
+	cases map[uuid.UUID]database.ModerationCase
+	rules []database.FilterRule
+	media []database.MediaAttachment
+	// resolveConflict makes ResolveModerationCase find its case already resolved, as when another
+	// moderator resolves it between the handler reading the case and acting on it
+	resolveConflict bool
+	// reporters are the emails of everyone who reported each case
+	reporters map[uuid.UUID][]string
+	hidden    []uuid.UUID
+	revoked   []uuid.UUID
+	locked    bool
+	events    []audit.Event
+}
+
+func newMockAdminDB(users ...database.User) *mockAdminDB {
+	m := &mockAdminDB{users: map[uuid.UUID]database.User{}, cases: map[uuid.UUID]database.ModerationCase{}}
+	for _, u := range users {
+		m.users[u.ID] = u
+	}
+	return m
+}
+
+func (m *mockAdminDB) RecordAudit(ctx context.Context, event audit.Event, action func(ctx context.Context) error) error {
+	if action != nil {
+		if err := action(ctx); err != nil {
+			return err
+		}
+	}
+	m.events = append(m.events, event)
+	return nil
+}
+
+func (m *mockAdminDB) GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error) {
+	if u, ok := m.users[id]; ok {
+		return u, nil
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (m *mockAdminDB) SetUserRole(ctx context.Context, arg database.SetUserRoleParams) (int64, error) {
+	u, ok := m.users[arg.ID]
+	if !ok {
+		return 0, nil
+	}
+	u.Role = arg.Role
+	m.users[arg.ID] = u
+	return 1, nil
+}
+
+func (m *mockAdminDB) RevokeAllRefreshTokensForUser(ctx context.Context, userID uuid.UUID) error {
+	m.revoked = append(m.revoked, userID)
+	return nil
+}
+
+func (m *mockAdminDB) RevokeAllPersonalAccessTokensForUser(ctx context.Context, userID uuid.UUID) error {
+	m.revoked = append(m.revoked, userID)
+	return nil
+}
+
+func newUser(role string) database.User {
+	return database.User{ID: uuid.New(), Email: role + "@test.com", Role: role}
+}
+
+// staffRequest makes a request with a session token for userID, with the path values set as the
+// router would
+func staffRequest(t *testing.T, method, target string, userID uuid.UUID, body any, pathValues map[string]string) *http.Request {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatalf("Error: could not encode request body: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest(method, target, &buf)
+	if userID != uuid.Nil {
+		token, err := auth.MakeJWT(userID, testSecret)
+		if err != nil {
+			t.Fatalf("Error: could not make JWT: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for k, v := range pathValues {
+		req.SetPathValue(k, v)
+	}
+	return req
+}
+
+func TestRequireRole(t *testing.T) {
+	user := newUser(RoleUser)
+	moderator := newUser(RoleModerator)
+	admin := newUser(RoleAdmin)
+	suspendedAdmin := newUser(RoleAdmin)
+	suspendedAdmin.SuspendedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	suspendedAdmin.SuspensionKind = auth.SuspensionReadOnly
+	expiredAdmin := newUser(RoleAdmin)
+	expiredAdmin.SuspendedAt = sql.NullTime{Time: time.Now().Add(-2 * time.Hour), Valid: true}
+	expiredAdmin.SuspendedUntil = sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true}
+
+	db := newMockAdminDB(user, moderator, admin, suspendedAdmin, expiredAdmin)
+	s := &State{DB: db, Secret: testSecret}
+
+	clientToken, _ := auth.MakeClientJWT(admin.ID, uuid.New(), []string{auth.ScopeChirpsRead}, testSecret)
+	otherSecretToken, _ := auth.MakeJWT(admin.ID, "other-secret")
+
+	type testCase struct {
+		testName       string
+		token          string
+		userID         uuid.UUID
+		role           string
+		expectedStatus int
+	}
+
+	testCases := []testCase{
+		{testName: "no token", role: RoleModerator, expectedStatus: http.StatusUnauthorized},
+		{testName: "token signed with another secret", token: otherSecretToken, role: RoleModerator, expectedStatus: http.StatusUnauthorized},
+		{testName: "OAuth client token", token: clientToken, role: RoleModerator, expectedStatus: http.StatusUnauthorized},
+		{testName: "unknown user", userID: uuid.New(), role: RoleModerator, expectedStatus: http.StatusUnauthorized},
+		{testName: "user for moderator action", userID: user.ID, role: RoleModerator, expectedStatus: http.StatusForbidden},
+		{testName: "moderator for admin action", userID: moderator.ID, role: RoleAdmin, expectedStatus: http.StatusForbidden},
+		{testName: "suspended admin", userID: suspendedAdmin.ID, role: RoleModerator, expectedStatus: http.StatusForbidden},
+		{testName: "moderator for moderator action", userID: moderator.ID, role: RoleModerator, expectedStatus: http.StatusOK},
+		{testName: "admin for moderator action", userID: admin.ID, role: RoleModerator, expectedStatus: http.StatusOK},
+		{testName: "admin whose suspension expired", userID: expiredAdmin.ID, role: RoleAdmin, expectedStatus: http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			req := staffRequest(t, http.MethodGet, "/admin/users", tc.userID, nil, nil)
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			w := httptest.NewRecorder()
+
+			staff, ok := s.requireRole(w, req, tc.role)
+			if tc.expectedStatus == http.StatusOK {
+				if !ok || staff.ID != tc.userID {
+					t.Fatalf("Fail: expected user %v to be allowed, got %v with status %d", tc.userID, staff.ID, w.Code)
+				}
+				return
+			}
+
+			if ok {
+				t.Fatal("Fail: expected the request to be refused")
+			}
+			if w.Code != tc.expectedStatus {
+				t.Fatalf("Fail: expected status %d but received %d with message: \n%s", tc.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandlerSetUserRole(t *testing.T) {
+	type testCase struct {
+		testName       string
+		caller         string
+		self           bool
+		target         string
+		userID         string
+		body           any
+		expectedStatus int
+	}
+
+	testCases := []testCase{
+		{testName: "moderator cannot set roles", caller: RoleModerator, target: RoleUser, body: roleParams{Role: RoleModerator}, expectedStatus: http.StatusForbidden},
+		{testName: "bad user ID", caller: RoleAdmin, userID: "not-a-uuid", body: roleParams{Role: RoleModerator}, expectedStatus: http.StatusBadRequest},
+		{testName: "invalid body", caller: RoleAdmin, target: RoleUser, body: "moderator", expectedStatus: http.StatusBadRequest},
+		{testName: "unknown role", caller: RoleAdmin, target: RoleUser, body: roleParams{Role: "owner"}, expectedStatus: http.StatusBadRequest},
+		{testName: "admin cannot demote themselves", caller: RoleAdmin, self: true, body: roleParams{Role: RoleUser}, expectedStatus: http.StatusBadRequest},
+		{testName: "unknown user", caller: RoleAdmin, userID: uuid.NewString(), body: roleParams{Role: RoleModerator}, expectedStatus: http.StatusNotFound},
+		{testName: "promote user", caller: RoleAdmin, target: RoleUser, body: roleParams{Role: RoleModerator}, expectedStatus: http.StatusNoContent},
+		{testName: "demote admin", caller: RoleAdmin, target: RoleAdmin, body: roleParams{Role: RoleUser}, expectedStatus: http.StatusNoContent},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			caller := newUser(tc.caller)
+			db := newMockAdminDB(caller)
+			userID := tc.userID
+			var target database.User
+			if tc.self {
+				target, userID = caller, caller.ID.String()
+			} else if tc.target != "" {
+				target = newUser(tc.target)
+				db.users[target.ID] = target
+				userID = target.ID.String()
+			}
+			s := &State{DB: db, Secret: testSecret}
+
+			req := staffRequest(t, http.MethodPut, "/admin/users/"+userID+"/role", caller.ID, tc.body, map[string]string{"userID": userID})
+			w := httptest.NewRecorder()
+			s.HandlerSetUserRole(w, req)
+
+			if w.Code != tc.expectedStatus {
+				t.Fatalf("Fail: expected status %d but received %d with message: \n%s", tc.expectedStatus, w.Code, w.Body.String())
+			}
+			if tc.expectedStatus != http.StatusNoContent {
+				if len(db.events) != 0 {
+					t.Fatalf("Fail: expected nothing to be audited, got %+v", db.events)
+				}
+				return
+			}
+
+			role := tc.body.(roleParams).Role
+			if db.users[target.ID].Role != role {
+				t.Fatalf("Fail: expected the role to be %s, got %s", role, db.users[target.ID].Role)
+			}
+			if len(db.events) != 1 || db.events[0].Action != audit.ActionRoleChange || db.events[0].ActorID != caller.ID {
+				t.Fatalf("Fail: expected one role change by %v to be audited, got %+v", caller.ID, db.events)
+			}
+		})
+	}
+}
+
+func decodeJSON[T any](t *testing.T, w *httptest.ResponseRecorder) T {
+	t.Helper()
+
+	var v T
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+		t.Fatalf("Error: could not unmarshal response %q: %v", strings.TrimSpace(w.Body.String()), err)
+	}
+	return v
+}
@@ -0,0 +1,168 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/analytics"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/problem"
+)
+
+const (
+	// analyticsMaxPoints bounds the buckets one query can return. A longer range needs a coarser granularity.
+	analyticsMaxPoints = 1500
+	analyticsTopKeys   = 10
+)
+
+// analyticsSteps are the length of a bucket and the range returned when from is not given, per granularity
+var analyticsSteps = map[string]struct{ step, defaultRange time.Duration }{
+	analytics.GranularityMinute: {time.Minute, time.Hour},
+	analytics.GranularityHour:   {time.Hour, 24 * time.Hour},
+	analytics.GranularityDay:    {24 * time.Hour, 30 * 24 * time.Hour},
+}
+
+type analyticsReader interface {
+	GetAnalyticsTotal(ctx context.Context, metric string) (int64, error)
+	ListAnalyticsSeries(ctx context.Context, arg database.ListAnalyticsSeriesParams) ([]database.ListAnalyticsSeriesRow, error)
+	ListTopAnalyticsKeys(ctx context.Context, arg database.ListTopAnalyticsKeysParams) ([]database.ListTopAnalyticsKeysRow, error)
+}
+
+type apiAnalyticsPoint struct {
+	Bucket time.Time `json:"bucket"`
+	Count  int64     `json:"count"`
+}
+
+type apiAnalyticsKey struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+}
+
+type apiAnalyticsSeries struct {
+	Metric      string    `json:"metric"`
+	Granularity string    `json:"granularity"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Key         string    `json:"key,omitempty"`
+	Total       int64     `json:"total"`
+	// Points has one entry per bucket from From up to To, including buckets with no counts
+	Points []apiAnalyticsPoint `json:"points"`
+	// TopKeys are the keys with the most counts over the whole range, ignoring Key
+	TopKeys []apiAnalyticsKey `json:"top_keys"`
+}
+
+// analyticsSeries returns the counts in every bucket in [from, to), filling buckets with no row with zero
+func (s *State) analyticsSeries(ctx context.Context, params database.ListAnalyticsSeriesParams) ([]apiAnalyticsPoint, error) {
+	rows, err := s.DB.ListAnalyticsSeries(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[int64]int64{}
+	for _, r := range rows {
+		counts[r.Bucket.Unix()] = r.Count
+	}
+
+	step := analyticsSteps[params.Granularity].step
+	points := []apiAnalyticsPoint{}
+	for bucket := params.FromBucket; bucket.Before(params.ToBucket); bucket = bucket.Add(step) {
+		points = append(points, apiAnalyticsPoint{Bucket: bucket, Count: counts[bucket.Unix()]})
+	}
+	return points, nil
+}
+
+// HandlerGetAnalytics returns a time series of page views or API requests. metric is page_view or
+// api_request, granularity is minute, hour (the default) or day, and from and to are RFC 3339 times.
+// key limits the series to one page or route.
+func (s *State) HandlerGetAnalytics(w http.ResponseWriter, req *http.Request) {
+	if _, ok := s.requireRole(w, req, RoleAdmin); !ok {
+		return
+	}
+
+	query := req.URL.Query()
+	params := database.ListAnalyticsSeriesParams{
+		Metric:      query.Get("metric"),
+		Granularity: query.Get("granularity"),
+		Key:         sql.NullString{String: query.Get("key"), Valid: query.Get("key") != ""},
+	}
+
+	if params.Metric != analytics.MetricPageView && params.Metric != analytics.MetricAPIRequest {
+		problem.Error(w, fmt.Sprintf("metric must be %s or %s", analytics.MetricPageView, analytics.MetricAPIRequest), http.StatusBadRequest)
+		return
+	}
+
+	if params.Granularity == "" {
+		params.Granularity = analytics.GranularityHour
+	}
+	steps, ok := analyticsSteps[params.Granularity]
+	if !ok {
+		problem.Error(w, "granularity must be minute, hour or day", http.StatusBadRequest)
+		return
+	}
+
+	params.ToBucket = time.Now().UTC()
+	params.FromBucket = params.ToBucket.Add(-steps.defaultRange)
+	for name, dst := range map[string]*time.Time{"from": &params.FromBucket, "to": &params.ToBucket} {
+		if v := query.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				problem.Error(w, name+" must be an RFC 3339 time", http.StatusBadRequest)
+				return
+			}
+			*dst = t.UTC()
+		}
+	}
+
+	// buckets are in UTC, and a day starts at midnight UTC
+	params.FromBucket = params.FromBucket.Truncate(steps.step)
+	if !params.FromBucket.Before(params.ToBucket) {
+		problem.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+	if params.ToBucket.Sub(params.FromBucket) > analyticsMaxPoints*steps.step {
+		problem.Error(w, fmt.Sprintf("at most %d %s buckets can be returned at once", analyticsMaxPoints, params.Granularity), http.StatusBadRequest)
+		return
+	}
+
+	points, err := s.analyticsSeries(req.Context(), params)
+	if err != nil {
+		log.Printf("Error: could not list %s analytics: %v", params.Metric, err)
+		problem.Error(w, "could not get analytics", http.StatusInternalServerError)
+		return
+	}
+
+	topKeys, err := s.DB.ListTopAnalyticsKeys(req.Context(), database.ListTopAnalyticsKeysParams{
+		Granularity: params.Granularity,
+		Metric:      params.Metric,
+		FromBucket:  params.FromBucket,
+		ToBucket:    params.ToBucket,
+		PageSize:    analyticsTopKeys,
+	})
+	if err != nil {
+		log.Printf("Error: could not list top %s analytics keys: %v", params.Metric, err)
+		problem.Error(w, "could not get analytics", http.StatusInternalServerError)
+		return
+	}
+
+	resp := apiAnalyticsSeries{
+		Metric:      params.Metric,
+		Granularity: params.Granularity,
+		From:        params.FromBucket,
+		To:          params.ToBucket,
+		Key:         params.Key.String,
+		Points:      points,
+		TopKeys:     []apiAnalyticsKey{},
+	}
+	for _, p := range points {
+		resp.Total += p.Count
+	}
+	for _, k := range topKeys {
+		resp.TopKeys = append(resp.TopKeys, apiAnalyticsKey(k))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
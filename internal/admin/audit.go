@@ -0,0 +1,186 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/audit"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/problem"
+	"github.com/google/uuid"
+)
+
+// the chain is verified this many events at a time
+const auditVerifyBatchSize = 1000
+
+type auditLogReader interface {
+	ListAuditEvents(ctx context.Context, arg database.ListAuditEventsParams) ([]database.AuditEvent, error)
+	ListAuditEventsAfter(ctx context.Context, arg database.ListAuditEventsAfterParams) ([]database.AuditEvent, error)
+}
+
+type apiAuditEvent struct {
+	Seq        int64             `json:"seq"`
+	CreatedAt  time.Time         `json:"created_at"`
+	ActorID    *uuid.UUID        `json:"actor_id"`
+	Action     string            `json:"action"`
+	TargetType string            `json:"target_type,omitempty"`
+	TargetID   string            `json:"target_id,omitempty"`
+	IP         string            `json:"ip,omitempty"`
+	RequestID  string            `json:"request_id,omitempty"`
+	Metadata   map[string]string `json:"metadata"`
+	Hash       string            `json:"hash"`
+}
+
+type apiAuditPage struct {
+	Events []apiAuditEvent `json:"events"`
+	// NextBefore is passed as before to fetch the next page. It is omitted on the last page.
+	NextBefore int64 `json:"next_before,omitempty"`
+}
+
+func dbEventToAPIEvent(e database.AuditEvent) apiAuditEvent {
+	resp := apiAuditEvent{
+		Seq:        e.Seq,
+		CreatedAt:  e.CreatedAt,
+		Action:     e.Action,
+		TargetType: e.TargetType,
+		TargetID:   e.TargetID,
+		IP:         e.Ip,
+		RequestID:  e.RequestID,
+		Metadata:   map[string]string{},
+		Hash:       e.Hash,
+	}
+	if e.ActorID.Valid {
+		resp.ActorID = &e.ActorID.UUID
+	}
+	if err := json.Unmarshal(e.Metadata, &resp.Metadata); err != nil {
+		log.Printf("Warning: audit event %d has unreadable metadata: %v", e.Seq, err)
+	}
+	return resp
+}
+
+// HandlerListAuditEvents returns audit events newest first. They can be filtered by actor_id, action,
+// target_id, and a since and until time, and are paged with limit and before.
+func (s *State) HandlerListAuditEvents(w http.ResponseWriter, req *http.Request) {
+	if _, ok := s.requireRole(w, req, RoleAdmin); !ok {
+		return
+	}
+
+	query := req.URL.Query()
+	params := database.ListAuditEventsParams{
+		Action:   sql.NullString{String: query.Get("action"), Valid: query.Get("action") != ""},
+		TargetID: sql.NullString{String: query.Get("target_id"), Valid: query.Get("target_id") != ""},
+	}
+
+	if v := query.Get("actor_id"); v != "" {
+		actorID, err := uuid.Parse(v)
+		if err != nil {
+			problem.Error(w, "could not parse actor_id to uuid", http.StatusBadRequest)
+			return
+		}
+		params.ActorID = uuid.NullUUID{UUID: actorID, Valid: true}
+	}
+
+	for name, dst := range map[string]*sql.NullTime{"since": &params.Since, "until": &params.Until} {
+		if v := query.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				problem.Error(w, name+" must be an RFC 3339 time", http.StatusBadRequest)
+				return
+			}
+			*dst = sql.NullTime{Time: t.UTC(), Valid: true}
+		}
+	}
+
+	if v := query.Get("before"); v != "" {
+		before, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || before < 1 {
+			problem.Error(w, "before must be a positive number", http.StatusBadRequest)
+			return
+		}
+		params.BeforeSeq = sql.NullInt64{Int64: before, Valid: true}
+	}
+
+	limit, _, err := pageParams(query.Get("limit"), "")
+	if err != nil {
+		problem.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	params.PageSize = limit
+
+	events, err := s.DB.ListAuditEvents(req.Context(), params)
+	if err != nil {
+		log.Printf("Error: could not list audit events: %v", err)
+		problem.Error(w, "could not list audit events", http.StatusInternalServerError)
+		return
+	}
+
+	resp := apiAuditPage{Events: []apiAuditEvent{}}
+	for _, e := range events {
+		resp.Events = append(resp.Events, dbEventToAPIEvent(e))
+	}
+	if len(events) == int(limit) {
+		resp.NextBefore = events[len(events)-1].Seq
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type apiAuditVerification struct {
+	Valid bool `json:"valid"`
+	// Events is the number of events verified, up to any break
+	Events int64 `json:"events"`
+	// BrokenAt is the first event that does not follow from the one before it
+	BrokenAt int64 `json:"broken_at,omitempty"`
+	// HeadSeq and HeadHash identify the last verified event. Keeping a copy elsewhere lets events
+	// removed from the end of the log be noticed, which the chain alone cannot show.
+	HeadSeq  int64  `json:"head_seq"`
+	HeadHash string `json:"head_hash"`
+}
+
+// HandlerVerifyAuditLog recomputes the hash of every event, oldest first, and reports where the chain breaks
+func (s *State) HandlerVerifyAuditLog(w http.ResponseWriter, req *http.Request) {
+	if _, ok := s.requireRole(w, req, RoleAdmin); !ok {
+		return
+	}
+
+	resp := apiAuditVerification{Valid: true}
+	for {
+		events, err := s.DB.ListAuditEventsAfter(req.Context(), database.ListAuditEventsAfterParams{
+			Seq:   resp.HeadSeq,
+			Limit: auditVerifyBatchSize,
+		})
+		if err != nil {
+			log.Printf("Error: could not read audit events after %d: %v", resp.HeadSeq, err)
+			problem.Error(w, "could not verify audit log", http.StatusInternalServerError)
+			return
+		}
+		if len(events) == 0 {
+			break
+		}
+
+		if brokenAt, ok := audit.Verify(resp.HeadSeq, resp.HeadHash, events); !ok {
+			for _, e := range events {
+				if e.Seq == brokenAt {
+					break
+				}
+				resp.Events++
+				resp.HeadSeq, resp.HeadHash = e.Seq, e.Hash
+			}
+			resp.Valid = false
+			resp.BrokenAt = brokenAt
+			log.Printf("Warning: audit log chain is broken at event %d", brokenAt)
+			break
+		}
+
+		last := events[len(events)-1]
+		resp.Events += int64(len(events))
+		resp.HeadSeq, resp.HeadHash = last.Seq, last.Hash
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
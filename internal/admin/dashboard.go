@@ -0,0 +1,244 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/analytics"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/problem"
+)
+
+const (
+	dashboardRows        = 50
+	healthCheckTimeout   = 2 * time.Second
+	dashboardContentType = "text/html; charset=utf-8"
+	// the pages have no scripts, and their only styles are inline
+	dashboardCSP = "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var (
+	metricsTemplate = template.Must(template.ParseFS(templateFS, "templates/metrics.html"))
+	dashboardPages  = parseDashboardPages("traffic", "signups", "moderation", "webhooks", "health")
+)
+
+// startedAt is roughly when the server started, for the uptime on the health page
+var startedAt = time.Now()
+
+// parseDashboardPages pairs each page's content template with the shared layout
+func parseDashboardPages(names ...string) map[string]*template.Template {
+	pages := map[string]*template.Template{}
+	for _, name := range names {
+		pages[name] = template.Must(template.ParseFS(templateFS, "templates/layout.html", "templates/"+name+".html"))
+	}
+	return pages
+}
+
+type dashboardReader interface {
+	GetLatestAuditEvent(ctx context.Context) (database.AuditEvent, error)
+	ListWebhookDeliveries(ctx context.Context, limit int32) ([]database.WebhookDelivery, error)
+	PingContext(ctx context.Context) error
+}
+
+type dashboardPage struct {
+	Page       string
+	Title      string
+	RenderedAt time.Time
+	Data       any
+}
+
+// renderHTML executes t into a buffer first, so a template error becomes a 500 rather than half a page
+func renderHTML(w http.ResponseWriter, t *template.Template, data any) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		log.Printf("Error: could not render %s: %v", t.Name(), err)
+		problem.Error(w, "could not render page", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", dashboardContentType)
+	w.Header().Set("Content-Security-Policy", dashboardCSP)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		log.Printf("Error: could not write %s to response body: %v", t.Name(), err)
+	}
+}
+
+func (s *State) renderDashboard(w http.ResponseWriter, page, title string, data any) {
+	renderHTML(w, dashboardPages[page], dashboardPage{Page: page, Title: title, RenderedAt: time.Now(), Data: data})
+}
+
+type trafficBar struct {
+	apiAnalyticsPoint
+	// Percent is the bar's height relative to the busiest minute
+	Percent int64
+}
+
+type trafficData struct {
+	Total    int64
+	LastHour int64
+	Peak     int64
+	Bars     []trafficBar
+}
+
+// HandlerDashboardTraffic shows page views per minute over the last hour
+func (s *State) HandlerDashboardTraffic(w http.ResponseWriter, req *http.Request) {
+	if _, ok := s.requireRole(w, req, RoleAdmin); !ok {
+		return
+	}
+
+	total, err := s.DB.GetAnalyticsTotal(req.Context(), analytics.MetricPageView)
+	if err != nil {
+		log.Printf("Error: could not count page views: %v", err)
+		problem.Error(w, "could not count page views", http.StatusInternalServerError)
+		return
+	}
+
+	// the current minute is included, so the chart ends with the counts flushed so far
+	now := time.Now().UTC()
+	points, err := s.analyticsSeries(req.Context(), database.ListAnalyticsSeriesParams{
+		Granularity: analytics.GranularityMinute,
+		Metric:      analytics.MetricPageView,
+		FromBucket:  now.Add(-time.Hour).Truncate(time.Minute).Add(time.Minute),
+		ToBucket:    now,
+	})
+	if err != nil {
+		log.Printf("Error: could not list page views: %v", err)
+		problem.Error(w, "could not list page views", http.StatusInternalServerError)
+		return
+	}
+
+	data := trafficData{Total: total}
+	for _, p := range points {
+		data.LastHour += p.Count
+		data.Peak = max(data.Peak, p.Count)
+	}
+	for _, p := range points {
+		bar := trafficBar{apiAnalyticsPoint: p}
+		if data.Peak > 0 {
+			bar.Percent = p.Count * 100 / data.Peak
+		}
+		data.Bars = append(data.Bars, bar)
+	}
+
+	s.renderDashboard(w, "traffic", "Traffic", data)
+}
+
+// HandlerDashboardSignups lists the newest users
+func (s *State) HandlerDashboardSignups(w http.ResponseWriter, req *http.Request) {
+	if _, ok := s.requireRole(w, req, RoleAdmin); !ok {
+		return
+	}
+
+	users, err := s.DB.ListUsers(req.Context(), database.ListUsersParams{Limit: dashboardRows})
+	if err != nil {
+		log.Printf("Error: could not list users: %v", err)
+		problem.Error(w, "could not list users", http.StatusInternalServerError)
+		return
+	}
+
+	signups := []apiUser{}
+	for _, u := range users {
+		signups = append(signups, dbUserToAPIUser(u))
+	}
+
+	s.renderDashboard(w, "signups", "Recent signups", signups)
+}
+
+// HandlerDashboardModeration shows the open cases in the moderation queue, most reported first
+func (s *State) HandlerDashboardModeration(w http.ResponseWriter, req *http.Request) {
+	if _, ok := s.requireRole(w, req, RoleAdmin); !ok {
+		return
+	}
+
+	cases, err := s.DB.ListModerationCases(req.Context(), database.ListModerationCasesParams{
+		Status: caseStatusOpen,
+		Limit:  dashboardRows,
+	})
+	if err != nil {
+		log.Printf("Error: could not list moderation cases: %v", err)
+		problem.Error(w, "could not list reports", http.StatusInternalServerError)
+		return
+	}
+
+	s.renderDashboard(w, "moderation", "Moderation queue", cases)
+}
+
+// HandlerDashboardWebhooks lists the latest webhook deliveries and how they were answered
+func (s *State) HandlerDashboardWebhooks(w http.ResponseWriter, req *http.Request) {
+	if _, ok := s.requireRole(w, req, RoleAdmin); !ok {
+		return
+	}
+
+	deliveries, err := s.DB.ListWebhookDeliveries(req.Context(), dashboardRows)
+	if err != nil {
+		log.Printf("Error: could not list webhook deliveries: %v", err)
+		problem.Error(w, "could not list webhook deliveries", http.StatusInternalServerError)
+		return
+	}
+
+	s.renderDashboard(w, "webhooks", "Webhook deliveries", deliveries)
+}
+
+type healthData struct {
+	DatabaseLatency  time.Duration
+	DatabaseError    string
+	AuditEvents      int64
+	MailerConfigured bool
+	Platform         string
+	Uptime           time.Duration
+	GoVersion        string
+	Goroutines       int
+	HeapMiB          uint64
+}
+
+// HandlerDashboardHealth checks the database and reports on the running process. A failed check is
+// shown on the page rather than failing the request.
+func (s *State) HandlerDashboardHealth(w http.ResponseWriter, req *http.Request) {
+	if _, ok := s.requireRole(w, req, RoleAdmin); !ok {
+		return
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	data := healthData{
+		MailerConfigured: s.Mailer != nil,
+		Platform:         s.Platform,
+		Uptime:           time.Since(startedAt).Round(time.Second),
+		GoVersion:        runtime.Version(),
+		Goroutines:       runtime.NumGoroutine(),
+		HeapMiB:          mem.HeapInuse >> 20,
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	if err := s.DB.PingContext(ctx); err != nil {
+		log.Printf("Error: health check could not reach the database: %v", err)
+		data.DatabaseError = err.Error()
+	} else {
+		data.DatabaseLatency = time.Since(start).Round(time.Microsecond)
+
+		latest, err := s.DB.GetLatestAuditEvent(ctx)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error: health check could not read the audit log: %v", err)
+		}
+		data.AuditEvents = latest.Seq
+	}
+
+	s.renderDashboard(w, "health", "System health", data)
+}
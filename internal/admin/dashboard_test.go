@@ -0,0 +1,54 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestDashboardPagesRender(t *testing.T) {
+	now := time.Now()
+	userID := uuid.New()
+
+	pages := map[string]any{
+		"traffic": trafficData{Total: 3, LastHour: 3, Peak: 2, Bars: []trafficBar{{apiAnalyticsPoint{Bucket: now, Count: 2}, 100}}},
+		"signups": []apiUser{{ID: userID, CreatedAt: now, Email: "<script>@test.com", Role: RoleUser, Suspension: "full"}},
+		"moderation": []database.ListModerationCasesRow{{
+			ID: uuid.New(), CreatedAt: now, ChirpBody: "reported", ReportCount: 2, Categories: []string{"spam", "abuse"},
+		}},
+		"webhooks": []database.WebhookDelivery{
+			{ReceivedAt: now, Source: "polka", Event: "user.upgraded", UserID: uuid.NullUUID{UUID: userID, Valid: true}, StatusCode: 204},
+			{ReceivedAt: now, Source: "polka", Event: "user.upgraded", StatusCode: 404, Error: "no such user"},
+		},
+		"health": healthData{DatabaseError: "connection refused", Uptime: time.Minute, GoVersion: "go1.25"},
+	}
+
+	for page, data := range pages {
+		t.Run(page, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			(&State{}).renderDashboard(w, page, page, data)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Fail: expected status 200 but received %d with message: \n%s", w.Code, w.Body.String())
+			}
+			if csp := w.Header().Get("Content-Security-Policy"); csp != dashboardCSP {
+				t.Fatalf("Fail: expected the page to be sent with a content security policy, got %q", csp)
+			}
+			if strings.Contains(w.Body.String(), "<script>") {
+				t.Fatal("Fail: expected user content to be escaped")
+			}
+		})
+	}
+
+	// empty pages say so rather than showing an empty table
+	w := httptest.NewRecorder()
+	(&State{}).renderDashboard(w, "webhooks", "Webhooks", []database.WebhookDelivery{})
+	if !strings.Contains(w.Body.String(), "No webhooks have been delivered") {
+		t.Fatalf("Fail: expected an empty webhook page to say so, got:\n%s", w.Body.String())
+	}
+}
@@ -0,0 +1,238 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/audit"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/filter"
+	"github.com/bailey4770/chirpy/internal/problem"
+	"github.com/google/uuid"
+)
+
+type filterStore interface {
+	CreateFilterRule(ctx context.Context, arg database.CreateFilterRuleParams) (database.FilterRule, error)
+	DeleteFilterRule(ctx context.Context, id uuid.UUID) (int64, error)
+	ListFilterRules(ctx context.Context) ([]database.FilterRule, error)
+}
+
+type apiFilterRule struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	Pattern   string     `json:"pattern"`
+	Severity  string     `json:"severity"`
+	Action    string     `json:"action"`
+	CreatedBy *uuid.UUID `json:"created_by,omitempty"`
+}
+
+func dbRuleToAPIRule(r database.FilterRule) apiFilterRule {
+	resp := apiFilterRule{
+		ID:        r.ID,
+		CreatedAt: r.CreatedAt,
+		Pattern:   r.Pattern,
+		Severity:  r.Severity,
+		Action:    r.Action,
+	}
+	if r.CreatedBy.Valid {
+		resp.CreatedBy = &r.CreatedBy.UUID
+	}
+	return resp
+}
+
+// reloadFilter applies the rules in the database to this instance straight away. Other instances
+// pick them up on their next scheduled reload.
+func (s *State) reloadFilter(ctx context.Context) {
+	if s.Filter == nil {
+		return
+	}
+
+	rules, err := s.DB.ListFilterRules(ctx)
+	if err != nil {
+		log.Printf("Error: could not reload filter rules: %v", err)
+		return
+	}
+
+	filterRules := make([]filter.Rule, 0, len(rules))
+	for _, r := range rules {
+		filterRules = append(filterRules, filter.Rule{Pattern: r.Pattern, Severity: r.Severity, Action: r.Action})
+	}
+	s.Filter.Set(filterRules)
+}
+
+// HandlerListFilterRules returns every content filter rule, oldest first
+func (s *State) HandlerListFilterRules(w http.ResponseWriter, req *http.Request) {
+	if _, ok := s.requireRole(w, req, RoleModerator); !ok {
+		return
+	}
+
+	rules, err := s.DB.ListFilterRules(req.Context())
+	if err != nil {
+		log.Printf("Error: could not list filter rules: %v", err)
+		problem.Error(w, "could not list filter rules", http.StatusInternalServerError)
+		return
+	}
+
+	resp := []apiFilterRule{}
+	for _, r := range rules {
+		resp = append(resp, dbRuleToAPIRule(r))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type filterRuleParams struct {
+	Pattern  string `json:"pattern"`
+	Severity string `json:"severity"`
+	Action   string `json:"action"`
+}
+
+// HandlerCreateFilterRule adds a word or phrase to the content filter. Only admins may do it.
+func (s *State) HandlerCreateFilterRule(w http.ResponseWriter, req *http.Request) {
+	staff, ok := s.requireRole(w, req, RoleAdmin)
+	if !ok {
+		return
+	}
+
+	var params filterRuleParams
+	if err := json.NewDecoder(req.Body).Decode(&params); err != nil {
+		problem.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	rule := filter.Rule{Pattern: strings.TrimSpace(params.Pattern), Severity: params.Severity, Action: params.Action}
+	if err := rule.Validate(); err != nil {
+		problem.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var created database.FilterRule
+	event := audit.Event{
+		ActorID:    staff.ID,
+		Action:     audit.ActionFilterRuleCreate,
+		TargetType: audit.TargetFilterRule,
+		TargetID:   rule.Pattern,
+		Metadata:   map[string]string{"severity": rule.Severity, "action": rule.Action},
+	}
+	err := s.DB.RecordAudit(req.Context(), event, func(ctx context.Context) error {
+		var err error
+		created, err = s.DB.CreateFilterRule(ctx, database.CreateFilterRuleParams{
+			Pattern:   rule.Pattern,
+			Severity:  rule.Severity,
+			Action:    rule.Action,
+			CreatedBy: uuid.NullUUID{UUID: staff.ID, Valid: true},
+		})
+		return err
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// the insert returns no row when the pattern is already listed
+		problem.Error(w, fmt.Sprintf("a rule for %q already exists", rule.Pattern), http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("Error: could not create filter rule %q: %v", rule.Pattern, err)
+		problem.Error(w, "could not create filter rule", http.StatusInternalServerError)
+		return
+	}
+
+	s.reloadFilter(req.Context())
+	log.Printf("Warning: admin %v added filter rule %q (%s, %s)", staff.ID, rule.Pattern, rule.Severity, rule.Action)
+	writeJSON(w, http.StatusCreated, dbRuleToAPIRule(created))
+}
+
+// HandlerDeleteFilterRule removes a rule from the content filter. Only admins may do it.
+func (s *State) HandlerDeleteFilterRule(w http.ResponseWriter, req *http.Request) {
+	staff, ok := s.requireRole(w, req, RoleAdmin)
+	if !ok {
+		return
+	}
+
+	ruleID, err := uuid.Parse(req.PathValue("ruleID"))
+	if err != nil {
+		problem.Error(w, "could not parse rule ID to uuid", http.StatusBadRequest)
+		return
+	}
+
+	event := audit.Event{ActorID: staff.ID, Action: audit.ActionFilterRuleDelete, TargetType: audit.TargetFilterRule, TargetID: ruleID.String()}
+	err = s.DB.RecordAudit(req.Context(), event, func(ctx context.Context) error {
+		deleted, err := s.DB.DeleteFilterRule(ctx, ruleID)
+		if err == nil && deleted == 0 {
+			return errNothingChanged
+		}
+		return err
+	})
+	if errors.Is(err, errNothingChanged) {
+		problem.Error(w, "could not find filter rule", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error: could not delete filter rule %v: %v", ruleID, err)
+		problem.Error(w, "could not delete filter rule", http.StatusInternalServerError)
+		return
+	}
+
+	s.reloadFilter(req.Context())
+	log.Printf("Warning: admin %v deleted filter rule %v", staff.ID, ruleID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type filterTestParams struct {
+	Text string `json:"text"`
+}
+
+type apiFilterMatch struct {
+	Pattern  string `json:"pattern"`
+	Severity string `json:"severity"`
+	Action   string `json:"action"`
+	Matched  string `json:"matched"`
+}
+
+type apiFilterResult struct {
+	Text     string           `json:"text"`
+	Rejected bool             `json:"rejected"`
+	Flagged  bool             `json:"flagged"`
+	Severity string           `json:"severity,omitempty"`
+	Matches  []apiFilterMatch `json:"matches"`
+}
+
+// HandlerTestFilter shows what the current filter would do to a chirp, without posting anything
+func (s *State) HandlerTestFilter(w http.ResponseWriter, req *http.Request) {
+	if _, ok := s.requireRole(w, req, RoleModerator); !ok {
+		return
+	}
+
+	var params filterTestParams
+	if err := json.NewDecoder(req.Body).Decode(&params); err != nil {
+		problem.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	engine := s.Filter
+	if engine == nil {
+		engine = filter.NewEngine(filter.DefaultRules)
+	}
+	result := engine.Apply(params.Text)
+
+	resp := apiFilterResult{
+		Text:     result.Text,
+		Rejected: result.Rejected,
+		Flagged:  result.Flagged,
+		Severity: result.Severity,
+		Matches:  []apiFilterMatch{},
+	}
+	for _, m := range result.Matches {
+		resp.Matches = append(resp.Matches, apiFilterMatch{
+			Pattern:  m.Rule.Pattern,
+			Severity: m.Rule.Severity,
+			Action:   m.Rule.Action,
+			Matched:  params.Text[m.Start:m.End],
+		})
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,117 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bailey4770/chirpy/internal/audit"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/filter"
+	"github.com/google/uuid"
+)
+
+func (m *mockAdminDB) ListFilterRules(ctx context.Context) ([]database.FilterRule, error) {
+	return m.rules, nil
+}
+
+func (m *mockAdminDB) CreateFilterRule(ctx context.Context, arg database.CreateFilterRuleParams) (database.FilterRule, error) {
+	for _, r := range m.rules {
+		if r.Pattern == arg.Pattern {
+			return database.FilterRule{}, sql.ErrNoRows
+		}
+	}
+	rule := database.FilterRule{ID: uuid.New(), Pattern: arg.Pattern, Severity: arg.Severity, Action: arg.Action, CreatedBy: arg.CreatedBy}
+	m.rules = append(m.rules, rule)
+	return rule, nil
+}
+
+func (m *mockAdminDB) DeleteFilterRule(ctx context.Context, id uuid.UUID) (int64, error) {
+	for i, r := range m.rules {
+		if r.ID == id {
+			m.rules = append(m.rules[:i], m.rules[i+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func TestFilterRuleCRUD(t *testing.T) {
+	moderator, admin := newUser(RoleModerator), newUser(RoleAdmin)
+	db := newMockAdminDB(moderator, admin)
+	engine := filter.NewEngine(nil)
+	s := &State{DB: db, Secret: testSecret, Filter: engine}
+
+	type testCase struct {
+		testName       string
+		caller         uuid.UUID
+		body           any
+		expectedStatus int
+	}
+
+	createCases := []testCase{
+		{testName: "moderator cannot create", caller: moderator.ID, body: filterRuleParams{Pattern: "frack", Severity: filter.SeverityLow, Action: filter.ActionMask}, expectedStatus: http.StatusForbidden},
+		{testName: "invalid severity", caller: admin.ID, body: filterRuleParams{Pattern: "frack", Severity: "extreme", Action: filter.ActionMask}, expectedStatus: http.StatusBadRequest},
+		{testName: "empty pattern", caller: admin.ID, body: filterRuleParams{Pattern: "  ", Severity: filter.SeverityLow, Action: filter.ActionMask}, expectedStatus: http.StatusBadRequest},
+		{testName: "create", caller: admin.ID, body: filterRuleParams{Pattern: " frack ", Severity: filter.SeverityLow, Action: filter.ActionMask}, expectedStatus: http.StatusCreated},
+		{testName: "duplicate", caller: admin.ID, body: filterRuleParams{Pattern: "frack", Severity: filter.SeverityHigh, Action: filter.ActionReject}, expectedStatus: http.StatusConflict},
+	}
+
+	for _, tc := range createCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s.HandlerCreateFilterRule(w, staffRequest(t, http.MethodPost, "/admin/filters", tc.caller, tc.body, nil))
+
+			if w.Code != tc.expectedStatus {
+				t.Fatalf("Fail: expected status %d but received %d with message: \n%s", tc.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	if len(db.rules) != 1 || db.rules[0].Pattern != "frack" || db.rules[0].CreatedBy.UUID != admin.ID {
+		t.Fatalf("Fail: expected one trimmed rule created by %v, got %+v", admin.ID, db.rules)
+	}
+	if result := engine.Apply("what the frack"); len(result.Matches) != 1 {
+		t.Fatal("Fail: expected the new rule to be applied at once")
+	}
+
+	w := httptest.NewRecorder()
+	s.HandlerListFilterRules(w, staffRequest(t, http.MethodGet, "/admin/filters", moderator.ID, nil, nil))
+	if rules := decodeJSON[[]apiFilterRule](t, w); w.Code != http.StatusOK || len(rules) != 1 || rules[0].ID != db.rules[0].ID {
+		t.Fatalf("Fail: expected moderators to list the rule, got status %d and %+v", w.Code, rules)
+	}
+
+	ruleID := db.rules[0].ID.String()
+	deleteCases := []struct {
+		testName       string
+		caller         uuid.UUID
+		ruleID         string
+		expectedStatus int
+	}{
+		{testName: "moderator cannot delete", caller: moderator.ID, ruleID: ruleID, expectedStatus: http.StatusForbidden},
+		{testName: "bad rule ID", caller: admin.ID, ruleID: "not-a-uuid", expectedStatus: http.StatusBadRequest},
+		{testName: "unknown rule", caller: admin.ID, ruleID: uuid.NewString(), expectedStatus: http.StatusNotFound},
+		{testName: "delete", caller: admin.ID, ruleID: ruleID, expectedStatus: http.StatusNoContent},
+		{testName: "already deleted", caller: admin.ID, ruleID: ruleID, expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tc := range deleteCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s.HandlerDeleteFilterRule(w, staffRequest(t, http.MethodDelete, "/admin/filters/"+tc.ruleID, tc.caller, nil, map[string]string{"ruleID": tc.ruleID}))
+
+			if w.Code != tc.expectedStatus {
+				t.Fatalf("Fail: expected status %d but received %d with message: \n%s", tc.expectedStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	if result := engine.Apply("what the frack"); len(result.Matches) != 0 {
+		t.Fatal("Fail: expected the deleted rule to stop applying at once")
+	}
+	if len(db.events) != 2 || db.events[0].Action != audit.ActionFilterRuleCreate || db.events[1].Action != audit.ActionFilterRuleDelete {
+		t.Fatalf("Fail: expected a create and a delete to be audited, got %+v", db.events)
+	}
+}
@@ -0,0 +1,386 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/audit"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/mailer"
+	"github.com/bailey4770/chirpy/internal/problem"
+	"github.com/google/uuid"
+)
+
+const (
+	caseStatusOpen     = "open"
+	caseStatusResolved = "resolved"
+
+	ActionDismiss     = "dismiss"
+	ActionHideChirp   = "hide_chirp"
+	ActionDeleteChirp = "delete_chirp"
+	ActionSuspendUser = "suspend_user"
+
+	defaultQueuePageSize = 50
+	maxQueuePageSize     = 200
+)
+
+type moderationStore interface {
+	DeleteChirp(ctx context.Context, id uuid.UUID) error
+	GetModerationCase(ctx context.Context, id uuid.UUID) (database.ModerationCase, error)
+	HideChirp(ctx context.Context, id uuid.UUID) (int64, error)
+	ListModerationCases(ctx context.Context, arg database.ListModerationCasesParams) ([]database.ListModerationCasesRow, error)
+	ListReporterEmailsForCase(ctx context.Context, caseID uuid.UUID) ([]string, error)
+	ListReportsForCase(ctx context.Context, caseID uuid.UUID) ([]database.ChirpReport, error)
+	ResolveModerationCase(ctx context.Context, arg database.ResolveModerationCaseParams) (int64, error)
+}
+
+type apiModerationCase struct {
+	ID               uuid.UUID   `json:"id"`
+	CreatedAt        time.Time   `json:"created_at"`
+	ChirpID          uuid.UUID   `json:"chirp_id"`
+	ChirpAuthorID    uuid.UUID   `json:"chirp_author_id"`
+	ChirpBody        string      `json:"chirp_body"`
+	Status           string      `json:"status"`
+	ReportCount      int64       `json:"report_count,omitempty"`
+	Categories       []string    `json:"categories,omitempty"`
+	Action           string      `json:"action,omitempty"`
+	ActorID          *uuid.UUID  `json:"actor_id,omitempty"`
+	ResolutionReason string      `json:"resolution_reason,omitempty"`
+	ResolvedAt       *time.Time  `json:"resolved_at,omitempty"`
+	Reports          []apiReport `json:"reports,omitempty"`
+}
+
+type apiReport struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	// ReporterID is empty for chirps flagged by the content filter
+	ReporterID *uuid.UUID `json:"reporter_id"`
+	Category   string     `json:"category"`
+	Comment    string     `json:"comment"`
+}
+
+func dbCaseToAPICase(c database.ModerationCase) apiModerationCase {
+	resp := apiModerationCase{
+		ID:               c.ID,
+		CreatedAt:        c.CreatedAt,
+		ChirpID:          c.ChirpID,
+		ChirpAuthorID:    c.ChirpAuthorID,
+		ChirpBody:        c.ChirpBody,
+		Status:           c.Status,
+		Action:           c.Action,
+		ResolutionReason: c.ResolutionReason,
+	}
+	if c.ActorID.Valid {
+		resp.ActorID = &c.ActorID.UUID
+	}
+	if c.ResolvedAt.Valid {
+		resp.ResolvedAt = &c.ResolvedAt.Time
+	}
+	return resp
+}
+
+// HandlerListReports returns the moderation queue: one case per reported chirp, most reported first
+func (s *State) HandlerListReports(w http.ResponseWriter, req *http.Request) {
+	if _, ok := s.requireRole(w, req, RoleModerator); !ok {
+		return
+	}
+
+	query := req.URL.Query()
+	status := query.Get("status")
+	if status == "" {
+		status = caseStatusOpen
+	}
+	if status != caseStatusOpen && status != caseStatusResolved {
+		problem.Error(w, "status must be open or resolved", http.StatusBadRequest)
+		return
+	}
+
+	limit, offset, err := pageParams(query.Get("limit"), query.Get("offset"))
+	if err != nil {
+		problem.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := s.DB.ListModerationCases(req.Context(), database.ListModerationCasesParams{
+		Status: status,
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		log.Printf("Error: could not list moderation cases: %v", err)
+		problem.Error(w, "could not list reports", http.StatusInternalServerError)
+		return
+	}
+
+	cases := []apiModerationCase{}
+	for _, row := range rows {
+		c := dbCaseToAPICase(database.ModerationCase{
+			ID:               row.ID,
+			CreatedAt:        row.CreatedAt,
+			UpdatedAt:        row.UpdatedAt,
+			ChirpID:          row.ChirpID,
+			ChirpAuthorID:    row.ChirpAuthorID,
+			ChirpBody:        row.ChirpBody,
+			Status:           row.Status,
+			Action:           row.Action,
+			ActorID:          row.ActorID,
+			ResolutionReason: row.ResolutionReason,
+			ResolvedAt:       row.ResolvedAt,
+		})
+		c.ReportCount = row.ReportCount
+		c.Categories = row.Categories
+		cases = append(cases, c)
+	}
+
+	writeJSON(w, http.StatusOK, cases)
+}
+
+func pageParams(limitString, offsetString string) (int32, int32, error) {
+	limit, offset := int64(defaultQueuePageSize), int64(0)
+	var err error
+
+	if limitString != "" {
+		if limit, err = strconv.ParseInt(limitString, 10, 32); err != nil || limit < 1 || limit > maxQueuePageSize {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxQueuePageSize)
+		}
+	}
+	if offsetString != "" {
+		if offset, err = strconv.ParseInt(offsetString, 10, 32); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("offset must be a non-negative number")
+		}
+	}
+
+	return int32(limit), int32(offset), nil
+}
+
+// HandlerGetReport returns a case with every report filed in it
+func (s *State) HandlerGetReport(w http.ResponseWriter, req *http.Request) {
+	if _, ok := s.requireRole(w, req, RoleModerator); !ok {
+		return
+	}
+
+	caseID, err := uuid.Parse(req.PathValue("caseID"))
+	if err != nil {
+		problem.Error(w, "could not parse case ID to uuid", http.StatusBadRequest)
+		return
+	}
+
+	modCase, err := s.DB.GetModerationCase(req.Context(), caseID)
+	if err != nil {
+		problem.Error(w, "could not find case", http.StatusNotFound)
+		return
+	}
+
+	reports, err := s.DB.ListReportsForCase(req.Context(), caseID)
+	if err != nil {
+		log.Printf("Error: could not list reports for case %v: %v", caseID, err)
+		problem.Error(w, "could not list reports", http.StatusInternalServerError)
+		return
+	}
+
+	resp := dbCaseToAPICase(modCase)
+	resp.ReportCount = int64(len(reports))
+	for _, r := range reports {
+		report := apiReport{
+			ID:        r.ID,
+			CreatedAt: r.CreatedAt,
+			Category:  r.Category,
+			Comment:   r.Comment,
+		}
+		if r.ReporterID.Valid {
+			report.ReporterID = &r.ReporterID.UUID
+		}
+		resp.Reports = append(resp.Reports, report)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+type resolveParams struct {
+	Action string `json:"action"`
+	Reason string `json:"reason"`
+	// SuspensionKind and SuspendedUntil only apply to ActionSuspendUser
+	SuspensionKind string     `json:"suspension_kind"`
+	SuspendedUntil *time.Time `json:"suspended_until"`
+}
+
+// HandlerResolveReport closes an open case with one of the moderator actions, recording who took it and why,
+// and lets every reporter know the outcome
+func (s *State) HandlerResolveReport(w http.ResponseWriter, req *http.Request) {
+	moderator, ok := s.requireRole(w, req, RoleModerator)
+	if !ok {
+		return
+	}
+
+	caseID, err := uuid.Parse(req.PathValue("caseID"))
+	if err != nil {
+		problem.Error(w, "could not parse case ID to uuid", http.StatusBadRequest)
+		return
+	}
+
+	var params resolveParams
+	if err := json.NewDecoder(req.Body).Decode(&params); err != nil {
+		problem.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	params.Reason = strings.TrimSpace(params.Reason)
+	if params.Reason == "" {
+		problem.Error(w, "a reason is required", http.StatusBadRequest)
+		return
+	}
+
+	modCase, err := s.DB.GetModerationCase(req.Context(), caseID)
+	if err != nil {
+		problem.Error(w, "could not find case", http.StatusNotFound)
+		return
+	}
+	if modCase.Status != caseStatusOpen {
+		problem.Error(w, "case has already been resolved", http.StatusConflict)
+		return
+	}
+
+	suspension := suspensionParams{Kind: params.SuspensionKind, Reason: params.Reason, Until: params.SuspendedUntil}
+	if params.Action == ActionSuspendUser {
+		if err := suspension.validate(); err != nil {
+			problem.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		author, err := s.DB.GetUserByID(req.Context(), modCase.ChirpAuthorID)
+		if err != nil {
+			problem.Error(w, "could not find the author of the chirp", http.StatusNotFound)
+			return
+		}
+		if roleRank[author.Role] >= roleRank[moderator.Role] {
+			problem.Error(w, "you can only suspend users with a lower role than yours", http.StatusForbidden)
+			return
+		}
+	}
+
+	switch params.Action {
+	case ActionDismiss, ActionHideChirp, ActionDeleteChirp, ActionSuspendUser:
+	default:
+		problem.Error(w, "action must be one of: dismiss, hide_chirp, delete_chirp, suspend_user", http.StatusBadRequest)
+		return
+	}
+
+	event := audit.Event{
+		ActorID:    moderator.ID,
+		Action:     audit.ActionResolveReport,
+		TargetType: audit.TargetModerationCase,
+		TargetID:   caseID.String(),
+		Metadata: map[string]string{
+			"action":    params.Action,
+			"chirp_id":  modCase.ChirpID.String(),
+			"author_id": modCase.ChirpAuthorID.String(),
+			"reason":    params.Reason,
+		},
+	}
+	if params.Action == ActionSuspendUser {
+		event.Metadata["suspension_kind"] = suspension.Kind
+	}
+
+	// the action and the resolution share a transaction, so if two moderators act at once
+	// the second finds the case resolved and everything it did is rolled back
+	err = s.DB.RecordAudit(req.Context(), event, func(ctx context.Context) error {
+		var err error
+		switch params.Action {
+		case ActionHideChirp:
+			err = s.hideChirp(ctx, modCase.ChirpID)
+		case ActionDeleteChirp:
+			err = s.DB.DeleteChirp(ctx, modCase.ChirpID)
+		case ActionSuspendUser:
+			err = s.suspendAuthor(ctx, modCase, suspension)
+		}
+		if err != nil {
+			return fmt.Errorf("could not %s: %v", params.Action, err)
+		}
+
+		resolved, err := s.DB.ResolveModerationCase(ctx, database.ResolveModerationCaseParams{
+			ID:               caseID,
+			Action:           params.Action,
+			ActorID:          uuid.NullUUID{UUID: moderator.ID, Valid: true},
+			ResolutionReason: params.Reason,
+		})
+		if err != nil {
+			return fmt.Errorf("could not resolve case: %v", err)
+		}
+		if resolved == 0 {
+			return errNothingChanged
+		}
+		return nil
+	})
+	if errors.Is(err, errNothingChanged) {
+		problem.Error(w, "case has already been resolved", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("Error: could not resolve case %v with %s: %v", caseID, params.Action, err)
+		problem.Error(w, "could not apply moderation action", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Warning: moderator %v resolved case %v on chirp %v with %s: %s", moderator.ID, caseID, modCase.ChirpID, params.Action, params.Reason)
+	s.Background.Go(func(ctx context.Context) {
+		s.notifyReporters(ctx, caseID, params.Action)
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *State) hideChirp(ctx context.Context, chirpID uuid.UUID) error {
+	_, err := s.DB.HideChirp(ctx, chirpID)
+	return err
+}
+
+// suspendAuthor suspends the author of the reported chirp and hides the chirp
+func (s *State) suspendAuthor(ctx context.Context, modCase database.ModerationCase, suspension suspensionParams) error {
+	if _, err := s.suspend(ctx, modCase.ChirpAuthorID, suspension); err != nil {
+		return err
+	}
+	if err := s.hideChirp(ctx, modCase.ChirpID); err != nil {
+		return fmt.Errorf("could not hide chirp: %v", err)
+	}
+	return nil
+}
+
+var outcomeMessages = map[string]string{
+	ActionDismiss:     "found that it does not break our rules, so it has been left up",
+	ActionHideChirp:   "found that it breaks our rules, so it has been hidden",
+	ActionDeleteChirp: "found that it breaks our rules, so it has been removed",
+	ActionSuspendUser: "found that it breaks our rules, so it has been removed and its author suspended",
+}
+
+// notifyReporters emails everyone who reported the chirp in a case. The moderator's reason is
+// internal and is not shared.
+func (s *State) notifyReporters(ctx context.Context, caseID uuid.UUID, action string) {
+	if s.Mailer == nil {
+		return
+	}
+
+	emails, err := s.DB.ListReporterEmailsForCase(ctx, caseID)
+	if err != nil {
+		log.Printf("Error: could not list reporters for case %v: %v", caseID, err)
+		return
+	}
+
+	for _, email := range emails {
+		if err := s.Mailer.Send(ctx, mailer.Message{
+			To:      email,
+			Subject: "An update on your Chirpy report",
+			Body: fmt.Sprintf(
+				"Thank you for reporting a chirp. A moderator has reviewed it and %s.\n\nReports like yours help keep Chirpy safe.",
+				outcomeMessages[action],
+			),
+		}); err != nil {
+			log.Printf("Error: could not send report outcome for case %v: %v", caseID, err)
+		}
+	}
+}
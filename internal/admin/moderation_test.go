@@ -0,0 +1,178 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/audit"
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/jobs"
+	"github.com/bailey4770/chirpy/internal/mailer"
+	"github.com/google/uuid"
+)
+
+func (m *mockAdminDB) GetModerationCase(ctx context.Context, id uuid.UUID) (database.ModerationCase, error) {
+	if c, ok := m.cases[id]; ok {
+		return c, nil
+	}
+	return database.ModerationCase{}, sql.ErrNoRows
+}
+
+func (m *mockAdminDB) ResolveModerationCase(ctx context.Context, arg database.ResolveModerationCaseParams) (int64, error) {
+	c, ok := m.cases[arg.ID]
+	if !ok || c.Status != caseStatusOpen || m.resolveConflict {
+		return 0, nil
+	}
+	c.Status, c.Action, c.ActorID = caseStatusResolved, arg.Action, arg.ActorID
+	m.cases[arg.ID] = c
+	return 1, nil
+}
+
+func (m *mockAdminDB) HideChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	m.hidden = append(m.hidden, id)
+	return 1, nil
+}
+
+func (m *mockAdminDB) SuspendUser(ctx context.Context, arg database.SuspendUserParams) (int64, error) {
+	u, ok := m.users[arg.ID]
+	if !ok {
+		return 0, nil
+	}
+	u.SuspendedAt = sql.NullTime{Valid: true}
+	u.SuspensionKind, u.SuspensionReason, u.SuspendedUntil = arg.SuspensionKind, arg.SuspensionReason, arg.SuspendedUntil
+	m.users[arg.ID] = u
+	return 1, nil
+}
+
+func (m *mockAdminDB) ListReporterEmailsForCase(ctx context.Context, caseID uuid.UUID) ([]string, error) {
+	return m.reporters[caseID], nil
+}
+
+type captureMailer struct {
+	mu   sync.Mutex
+	sent []mailer.Message
+}
+
+func (m *captureMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestHandlerResolveReport(t *testing.T) {
+	type testCase struct {
+		testName        string
+		caller          string
+		author          string
+		caseStatus      string
+		caseID          string
+		resolveConflict bool
+		body            any
+		expectedStatus  int
+		expectSuspended bool
+	}
+
+	testCases := []testCase{
+		{testName: "user cannot resolve", caller: RoleUser, author: RoleUser, body: resolveParams{Action: ActionDismiss, Reason: "fine"}, expectedStatus: http.StatusForbidden},
+		{testName: "bad case ID", caller: RoleModerator, author: RoleUser, caseID: "not-a-uuid", body: resolveParams{Action: ActionDismiss, Reason: "fine"}, expectedStatus: http.StatusBadRequest},
+		{testName: "unknown case", caller: RoleModerator, author: RoleUser, caseID: uuid.NewString(), body: resolveParams{Action: ActionDismiss, Reason: "fine"}, expectedStatus: http.StatusNotFound},
+		{testName: "missing reason", caller: RoleModerator, author: RoleUser, body: resolveParams{Action: ActionDismiss, Reason: "  "}, expectedStatus: http.StatusBadRequest},
+		{testName: "unknown action", caller: RoleModerator, author: RoleUser, body: resolveParams{Action: "ban", Reason: "spam"}, expectedStatus: http.StatusBadRequest},
+		{testName: "already resolved", caller: RoleModerator, author: RoleUser, caseStatus: caseStatusResolved, body: resolveParams{Action: ActionDismiss, Reason: "fine"}, expectedStatus: http.StatusConflict},
+		{testName: "resolved by another moderator at the same time", caller: RoleModerator, author: RoleUser, resolveConflict: true, body: resolveParams{Action: ActionHideChirp, Reason: "spam"}, expectedStatus: http.StatusConflict},
+		{testName: "invalid suspension kind", caller: RoleModerator, author: RoleUser, body: resolveParams{Action: ActionSuspendUser, Reason: "spam", SuspensionKind: "forever"}, expectedStatus: http.StatusBadRequest},
+		{testName: "moderator cannot suspend a moderator", caller: RoleModerator, author: RoleModerator, body: resolveParams{Action: ActionSuspendUser, Reason: "spam"}, expectedStatus: http.StatusForbidden},
+		{testName: "moderator cannot suspend an admin", caller: RoleModerator, author: RoleAdmin, body: resolveParams{Action: ActionSuspendUser, Reason: "spam"}, expectedStatus: http.StatusForbidden},
+		{testName: "dismiss", caller: RoleModerator, author: RoleUser, body: resolveParams{Action: ActionDismiss, Reason: "fine"}, expectedStatus: http.StatusNoContent},
+		{testName: "hide chirp", caller: RoleModerator, author: RoleUser, body: resolveParams{Action: ActionHideChirp, Reason: "spam"}, expectedStatus: http.StatusNoContent},
+		{testName: "moderator suspends a user", caller: RoleModerator, author: RoleUser, body: resolveParams{Action: ActionSuspendUser, Reason: "spam"}, expectedStatus: http.StatusNoContent, expectSuspended: true},
+		{testName: "admin suspends a moderator", caller: RoleAdmin, author: RoleModerator, body: resolveParams{Action: ActionSuspendUser, Reason: "spam", SuspensionKind: auth.SuspensionReadOnly}, expectedStatus: http.StatusNoContent, expectSuspended: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			caller, author := newUser(tc.caller), newUser(tc.author)
+			db := newMockAdminDB(caller, author)
+			db.resolveConflict = tc.resolveConflict
+
+			modCase := database.ModerationCase{ID: uuid.New(), ChirpID: uuid.New(), ChirpAuthorID: author.ID, Status: caseStatusOpen}
+			if tc.caseStatus != "" {
+				modCase.Status = tc.caseStatus
+			}
+			db.cases[modCase.ID] = modCase
+			caseID := modCase.ID.String()
+			if tc.caseID != "" {
+				caseID = tc.caseID
+			}
+			s := &State{DB: db, Secret: testSecret}
+
+			req := staffRequest(t, http.MethodPost, "/admin/reports/"+caseID+"/resolve", caller.ID, tc.body, map[string]string{"caseID": caseID})
+			w := httptest.NewRecorder()
+			s.HandlerResolveReport(w, req)
+
+			if w.Code != tc.expectedStatus {
+				t.Fatalf("Fail: expected status %d but received %d with message: \n%s", tc.expectedStatus, w.Code, w.Body.String())
+			}
+
+			suspended := db.users[author.ID].SuspendedAt.Valid
+			if suspended != tc.expectSuspended {
+				t.Fatalf("Fail: expected author suspended to be %v, got %v", tc.expectSuspended, suspended)
+			}
+
+			if tc.expectedStatus != http.StatusNoContent {
+				if len(db.events) != 0 {
+					t.Fatalf("Fail: expected nothing to be audited, got %+v", db.events)
+				}
+				return
+			}
+
+			if db.cases[modCase.ID].Status != caseStatusResolved || db.cases[modCase.ID].ActorID.UUID != caller.ID {
+				t.Fatalf("Fail: expected the case to be resolved by %v, got %+v", caller.ID, db.cases[modCase.ID])
+			}
+			if len(db.events) != 1 || db.events[0].Action != audit.ActionResolveReport || db.events[0].ActorID != caller.ID {
+				t.Fatalf("Fail: expected one resolution by %v to be audited, got %+v", caller.ID, db.events)
+			}
+		})
+	}
+}
+
+func TestResolveReportNotifiesReporters(t *testing.T) {
+	moderator, author := newUser(RoleModerator), newUser(RoleUser)
+	db := newMockAdminDB(moderator, author)
+	modCase := database.ModerationCase{ID: uuid.New(), ChirpID: uuid.New(), ChirpAuthorID: author.ID, Status: caseStatusOpen}
+	db.cases[modCase.ID] = modCase
+	db.reporters = map[uuid.UUID][]string{modCase.ID: {"a@test.com", "b@test.com"}}
+
+	mail := &captureMailer{}
+	background := jobs.NewBackground(context.Background())
+	s := &State{DB: db, Secret: testSecret, Mailer: mail, Background: background}
+
+	caseID := modCase.ID.String()
+	req := staffRequest(t, http.MethodPost, "/admin/reports/"+caseID+"/resolve", moderator.ID, resolveParams{Action: ActionHideChirp, Reason: "spam"}, map[string]string{"caseID": caseID})
+	w := httptest.NewRecorder()
+	s.HandlerResolveReport(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Fail: expected status %d but received %d with message: \n%s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := background.Wait(ctx); err != nil {
+		t.Fatalf("Error: notifications did not finish: %v", err)
+	}
+
+	if len(mail.sent) != 2 || mail.sent[0].To != "a@test.com" || mail.sent[1].To != "b@test.com" {
+		t.Fatalf("Fail: expected both reporters to be emailed, got %+v", mail.sent)
+	}
+	if strings.Contains(mail.sent[0].Body, "spam") {
+		t.Fatal("Fail: expected the moderator's reason to stay internal")
+	}
+}
@@ -0,0 +1,422 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/audit"
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/problem"
+	"github.com/google/uuid"
+)
+
+const (
+	// PlatformDev is the only platform POST /admin/reset works on
+	PlatformDev = "dev"
+
+	// FixtureEmailDomain is the email domain of users created by seed data, so they can be reset on their own
+	FixtureEmailDomain = "fixtures.chirpy.test"
+
+	resetConfirmationTTL = 5 * time.Minute
+)
+
+type resetStore interface {
+	CountOAuthRefreshTokens(ctx context.Context) (int64, error)
+	CountResettableRows(ctx context.Context) (database.CountResettableRowsRow, error)
+	CountResettableRowsByEmailDomain(ctx context.Context, domains []string) (database.CountResettableRowsByEmailDomainRow, error)
+	DeleteUsersByEmailDomain(ctx context.Context, domains []string) (int64, error)
+	ListMediaAttachments(ctx context.Context) ([]database.MediaAttachment, error)
+	ListMediaAttachmentsByEmailDomain(ctx context.Context, domains []string) ([]database.MediaAttachment, error)
+	LockResettableTables(ctx context.Context) error
+	tableResetter
+}
+
+// tableResetter deletes every row of one table, returning how many it deleted
+type tableResetter interface {
+	ResetAnalyticsCounts(ctx context.Context) (int64, error)
+	ResetAuthThrottles(ctx context.Context) (int64, error)
+	ResetChirpImpressionViewers(ctx context.Context) (int64, error)
+	ResetChirpImpressions(ctx context.Context) (int64, error)
+	ResetChirpReports(ctx context.Context) (int64, error)
+	ResetChirps(ctx context.Context) (int64, error)
+	ResetDataExports(ctx context.Context) (int64, error)
+	ResetFilterRules(ctx context.Context) (int64, error)
+	ResetMediaAttachments(ctx context.Context) (int64, error)
+	ResetModerationCases(ctx context.Context) (int64, error)
+	ResetOAuthAuthorizationCodes(ctx context.Context) (int64, error)
+	ResetOAuthClients(ctx context.Context) (int64, error)
+	ResetPersonalAccessTokens(ctx context.Context) (int64, error)
+	ResetRateLimitBuckets(ctx context.Context) (int64, error)
+	ResetRecoveryCodes(ctx context.Context) (int64, error)
+	ResetRefreshTokens(ctx context.Context) (int64, error)
+	ResetUserBlocks(ctx context.Context) (int64, error)
+	ResetUserMutes(ctx context.Context) (int64, error)
+	ResetUserTokens(ctx context.Context) (int64, error)
+	ResetUsers(ctx context.Context) (int64, error)
+	ResetWebhookDeliveries(ctx context.Context) (int64, error)
+}
+
+// resetTables are the tables a reset can be limited to. Rows in other tables that depend on them are
+// deleted with them.
+var resetTables = map[string]func(tableResetter, context.Context) (int64, error){
+	"analytics_counts":          tableResetter.ResetAnalyticsCounts,
+	"auth_throttles":            tableResetter.ResetAuthThrottles,
+	"chirp_impression_viewers":  tableResetter.ResetChirpImpressionViewers,
+	"chirp_impressions":         tableResetter.ResetChirpImpressions,
+	"chirp_reports":             tableResetter.ResetChirpReports,
+	"chirps":                    tableResetter.ResetChirps,
+	"data_exports":              tableResetter.ResetDataExports,
+	"filter_rules":              tableResetter.ResetFilterRules,
+	"media_attachments":         tableResetter.ResetMediaAttachments,
+	"moderation_cases":          tableResetter.ResetModerationCases,
+	"oauth_authorization_codes": tableResetter.ResetOAuthAuthorizationCodes,
+	"oauth_clients":             tableResetter.ResetOAuthClients,
+	"personal_access_tokens":    tableResetter.ResetPersonalAccessTokens,
+	"rate_limit_buckets":        tableResetter.ResetRateLimitBuckets,
+	"recovery_codes":            tableResetter.ResetRecoveryCodes,
+	"refresh_tokens":            tableResetter.ResetRefreshTokens,
+	"user_blocks":               tableResetter.ResetUserBlocks,
+	"user_mutes":                tableResetter.ResetUserMutes,
+	"user_tokens":               tableResetter.ResetUserTokens,
+	"users":                     tableResetter.ResetUsers,
+	"webhook_deliveries":        tableResetter.ResetWebhookDeliveries,
+}
+
+func rowCounts(r database.CountResettableRowsRow) map[string]int64 {
+	return map[string]int64{
+		"analytics_counts":          r.AnalyticsCounts,
+		"auth_throttles":            r.AuthThrottles,
+		"chirp_impression_viewers":  r.ChirpImpressionViewers,
+		"chirp_impressions":         r.ChirpImpressions,
+		"chirp_reports":             r.ChirpReports,
+		"chirps":                    r.Chirps,
+		"data_exports":              r.DataExports,
+		"filter_rules":              r.FilterRules,
+		"media_attachments":         r.MediaAttachments,
+		"moderation_cases":          r.ModerationCases,
+		"oauth_authorization_codes": r.OauthAuthorizationCodes,
+		"oauth_clients":             r.OauthClients,
+		"personal_access_tokens":    r.PersonalAccessTokens,
+		"rate_limit_buckets":        r.RateLimitBuckets,
+		"recovery_codes":            r.RecoveryCodes,
+		"refresh_tokens":            r.RefreshTokens,
+		"user_blocks":               r.UserBlocks,
+		"user_mutes":                r.UserMutes,
+		"user_tokens":               r.UserTokens,
+		"users":                     r.Users,
+		"webhook_deliveries":        r.WebhookDeliveries,
+	}
+}
+
+// resetCascades maps each table to the tables that lose every row when all of its rows are deleted,
+// because their foreign keys to it cascade and cannot be null
+var resetCascades = map[string][]string{
+	"chirps":           {"chirp_impression_viewers", "chirp_impressions"},
+	"moderation_cases": {"chirp_reports"},
+	"oauth_clients":    {"oauth_authorization_codes"},
+	"users": {
+		"chirps", "data_exports", "media_attachments", "moderation_cases", "oauth_clients", "personal_access_tokens",
+		"recovery_codes", "refresh_tokens", "user_blocks", "user_mutes", "user_tokens",
+	},
+}
+
+// cascadeClosure is every table that loses all of its rows when tables are reset
+func cascadeClosure(tables []string) map[string]bool {
+	closure := map[string]bool{}
+	pending := slices.Clone(tables)
+	for len(pending) > 0 {
+		table := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if closure[table] {
+			continue
+		}
+		closure[table] = true
+		pending = append(pending, resetCascades[table]...)
+	}
+	return closure
+}
+
+type confirmationParams struct {
+	// ConfirmationToken is returned by the same request without one, and confirms exactly what it described
+	ConfirmationToken string `json:"confirmation_token"`
+}
+
+type resetParams struct {
+	confirmationParams
+	// Tables limits the reset to these tables. Every table is reset if it is empty and Fixtures is false.
+	Tables []string `json:"tables"`
+	// Fixtures limits the reset to users created by seed data and everything they own
+	Fixtures bool `json:"fixtures"`
+}
+
+type apiResetResult struct {
+	Scope  string `json:"scope"`
+	DryRun bool   `json:"dry_run"`
+	// Deleted is the number of rows removed from each table, including by cascading deletes
+	Deleted map[string]int64 `json:"deleted"`
+	// ConfirmationToken is only set on a dry run. Sending it back within ExpiresAt performs the reset.
+	ConfirmationToken string     `json:"confirmation_token,omitempty"`
+	ExpiresAt         *time.Time `json:"expires_at,omitempty"`
+}
+
+// HandlerReset deletes test data on the dev platform. It can be limited to some tables or to fixtures,
+// and does nothing until confirmed.
+func (s *State) HandlerReset(w http.ResponseWriter, req *http.Request) {
+	if s.Platform != PlatformDev {
+		problem.Error(w, "reset is only available on the dev platform", http.StatusForbidden)
+		return
+	}
+
+	var params resetParams
+	if err := json.NewDecoder(req.Body).Decode(&params); err != nil && !errors.Is(err, io.EOF) {
+		problem.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if params.Fixtures && len(params.Tables) > 0 {
+		problem.Error(w, "tables and fixtures cannot be combined", http.StatusBadRequest)
+		return
+	}
+
+	var plan resetPlan
+
+	switch {
+	case params.Fixtures:
+		plan = s.domainResetPlan("fixtures", []string{FixtureEmailDomain})
+
+	case len(params.Tables) > 0:
+		tables := slices.Clone(params.Tables)
+		for _, table := range tables {
+			if _, ok := resetTables[table]; !ok {
+				problem.Error(w, fmt.Sprintf("%q cannot be reset", table), http.StatusBadRequest)
+				return
+			}
+		}
+		slices.Sort(tables)
+		tables = slices.Compact(tables)
+		plan = s.tablesResetPlan("tables:"+strings.Join(tables, ","), tables)
+
+	default:
+		plan = s.tablesResetPlan("all", slices.Sorted(maps.Keys(resetTables)))
+	}
+
+	s.confirmedReset(w, req, uuid.Nil, plan, params.ConfirmationToken)
+}
+
+// resetPlan describes one kind of reset
+type resetPlan struct {
+	scope string
+	// preview counts the rows the reset would delete from each table, without locking or changing anything
+	preview func(ctx context.Context) (map[string]int64, error)
+	// media lists the uploads the reset deletes, whose files are removed once it has committed
+	media func(ctx context.Context) ([]database.MediaAttachment, error)
+	reset func(ctx context.Context) error
+}
+
+// tablesResetPlan deletes every row of tables, and of the tables that cascade from them
+func (s *State) tablesResetPlan(scope string, tables []string) resetPlan {
+	closure := cascadeClosure(tables)
+
+	return resetPlan{
+		scope: scope,
+		preview: func(ctx context.Context) (map[string]int64, error) {
+			counts, err := s.DB.CountResettableRows(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			deleted := map[string]int64{}
+			for table, n := range rowCounts(counts) {
+				if closure[table] {
+					deleted[table] = n
+				} else {
+					deleted[table] = 0
+				}
+			}
+
+			// client_id is the one cascading foreign key that can be null
+			if closure["oauth_clients"] && !closure["refresh_tokens"] {
+				if deleted["refresh_tokens"], err = s.DB.CountOAuthRefreshTokens(ctx); err != nil {
+					return nil, err
+				}
+			}
+			return deleted, nil
+		},
+		media: func(ctx context.Context) ([]database.MediaAttachment, error) {
+			if !closure["media_attachments"] {
+				return nil, nil
+			}
+			return s.DB.ListMediaAttachments(ctx)
+		},
+		reset: func(ctx context.Context) error {
+			for _, table := range tables {
+				if _, err := resetTables[table](s.DB, ctx); err != nil {
+					return fmt.Errorf("could not reset %s: %v", table, err)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// domainResetPlan deletes the users with email addresses in domains, and everything they own
+func (s *State) domainResetPlan(scope string, domains []string) resetPlan {
+	return resetPlan{
+		scope: scope,
+		preview: func(ctx context.Context) (map[string]int64, error) {
+			r, err := s.DB.CountResettableRowsByEmailDomain(ctx, domains)
+			if err != nil {
+				return nil, err
+			}
+
+			deleted := map[string]int64{}
+			for table := range resetTables {
+				deleted[table] = 0
+			}
+			maps.Copy(deleted, map[string]int64{
+				"chirp_impression_viewers":  r.ChirpImpressionViewers,
+				"chirp_impressions":         r.ChirpImpressions,
+				"chirp_reports":             r.ChirpReports,
+				"chirps":                    r.Chirps,
+				"data_exports":              r.DataExports,
+				"media_attachments":         r.MediaAttachments,
+				"moderation_cases":          r.ModerationCases,
+				"oauth_authorization_codes": r.OauthAuthorizationCodes,
+				"oauth_clients":             r.OauthClients,
+				"personal_access_tokens":    r.PersonalAccessTokens,
+				"recovery_codes":            r.RecoveryCodes,
+				"refresh_tokens":            r.RefreshTokens,
+				"user_blocks":               r.UserBlocks,
+				"user_mutes":                r.UserMutes,
+				"user_tokens":               r.UserTokens,
+				"users":                     r.Users,
+			})
+			return deleted, nil
+		},
+		media: func(ctx context.Context) ([]database.MediaAttachment, error) {
+			return s.DB.ListMediaAttachmentsByEmailDomain(ctx, domains)
+		},
+		reset: func(ctx context.Context) error {
+			_, err := s.DB.DeleteUsersByEmailDomain(ctx, domains)
+			return err
+		},
+	}
+}
+
+// HandlerResetTestTenants deletes the users whose email addresses are in TestTenantDomains, and everything
+// they own. Unlike HandlerReset it is meant for production, so it needs an admin rather than the dev platform.
+func (s *State) HandlerResetTestTenants(w http.ResponseWriter, req *http.Request) {
+	staff, ok := s.requireRole(w, req, RoleAdmin)
+	if !ok {
+		return
+	}
+
+	if len(s.TestTenantDomains) == 0 {
+		problem.Error(w, "no test tenants are configured", http.StatusNotFound)
+		return
+	}
+
+	var params confirmationParams
+	if err := json.NewDecoder(req.Body).Decode(&params); err != nil && !errors.Is(err, io.EOF) {
+		problem.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	plan := s.domainResetPlan("test_tenants:"+strings.Join(s.TestTenantDomains, ","), s.TestTenantDomains)
+	s.confirmedReset(w, req, staff.ID, plan, params.ConfirmationToken)
+}
+
+// confirmedReset previews plan with plain counts and returns a token confirming its scope. Given that
+// token, it runs the reset in one transaction, reports the rows it deleted from each table, and then
+// removes the files of the media it deleted.
+func (s *State) confirmedReset(w http.ResponseWriter, req *http.Request, actorID uuid.UUID, plan resetPlan, token string) {
+	if token == "" {
+		deleted, err := plan.preview(req.Context())
+		if err != nil {
+			log.Printf("Error: could not preview reset %s: %v", plan.scope, err)
+			problem.Error(w, "could not count rows", http.StatusInternalServerError)
+			return
+		}
+
+		expiresAt := time.Now().Add(resetConfirmationTTL).Truncate(time.Second)
+		writeJSON(w, http.StatusOK, apiResetResult{
+			Scope:             plan.scope,
+			DryRun:            true,
+			Deleted:           deleted,
+			ConfirmationToken: auth.MakeConfirmationToken("reset:"+plan.scope, expiresAt, s.Secret),
+			ExpiresAt:         &expiresAt,
+		})
+		return
+	}
+
+	if err := auth.ValidateConfirmationToken(token, "reset:"+plan.scope, s.Secret); err != nil {
+		problem.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := apiResetResult{Scope: plan.scope, Deleted: map[string]int64{}}
+	var media []database.MediaAttachment
+
+	// the metadata is filled in by the action, which runs before the event is appended
+	event := audit.Event{ActorID: actorID, Action: audit.ActionReset, Metadata: map[string]string{"scope": plan.scope}}
+	err := s.DB.RecordAudit(req.Context(), event, func(ctx context.Context) error {
+		if err := s.DB.LockResettableTables(ctx); err != nil {
+			return fmt.Errorf("could not lock tables: %v", err)
+		}
+
+		before, err := s.DB.CountResettableRows(ctx)
+		if err != nil {
+			return fmt.Errorf("could not count rows: %v", err)
+		}
+
+		if media, err = plan.media(ctx); err != nil {
+			return fmt.Errorf("could not list media: %v", err)
+		}
+
+		if err := plan.reset(ctx); err != nil {
+			return err
+		}
+
+		after, err := s.DB.CountResettableRows(ctx)
+		if err != nil {
+			return fmt.Errorf("could not count rows: %v", err)
+		}
+
+		afterCounts := rowCounts(after)
+		for table, n := range rowCounts(before) {
+			resp.Deleted[table] = n - afterCounts[table]
+			if resp.Deleted[table] > 0 {
+				event.Metadata["rows."+table] = strconv.FormatInt(resp.Deleted[table], 10)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error: could not reset %s: %v", plan.scope, err)
+		problem.Error(w, "could not reset", http.StatusInternalServerError)
+		return
+	}
+
+	// a file left behind is only wasted space, so failures do not undo the reset
+	for _, m := range media {
+		for _, key := range []string{m.OriginalKey, m.ThumbnailKey} {
+			if err := s.Blobs.Delete(req.Context(), key); err != nil {
+				log.Printf("Error: could not delete blob of reset media %v: %v", m.ID, err)
+			}
+		}
+	}
+
+	log.Printf("Warning: reset %s, deleting %v", plan.scope, resp.Deleted)
+	writeJSON(w, http.StatusOK, resp)
+}
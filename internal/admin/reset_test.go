@@ -0,0 +1,225 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/audit"
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/blob"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (m *mockAdminDB) inDomains(userID uuid.UUID, domains []string) bool {
+	_, domain, _ := strings.Cut(m.users[userID].Email, "@")
+	return slices.Contains(domains, domain)
+}
+
+func (m *mockAdminDB) LockResettableTables(ctx context.Context) error {
+	m.locked = true
+	return nil
+}
+
+func (m *mockAdminDB) CountResettableRows(ctx context.Context) (database.CountResettableRowsRow, error) {
+	return database.CountResettableRowsRow{Users: int64(len(m.users)), MediaAttachments: int64(len(m.media))}, nil
+}
+
+func (m *mockAdminDB) CountResettableRowsByEmailDomain(ctx context.Context, domains []string) (database.CountResettableRowsByEmailDomainRow, error) {
+	var r database.CountResettableRowsByEmailDomainRow
+	for id := range m.users {
+		if m.inDomains(id, domains) {
+			r.Users++
+		}
+	}
+	for _, media := range m.media {
+		if m.inDomains(media.UserID, domains) {
+			r.MediaAttachments++
+		}
+	}
+	return r, nil
+}
+
+func (m *mockAdminDB) ListMediaAttachmentsByEmailDomain(ctx context.Context, domains []string) ([]database.MediaAttachment, error) {
+	var media []database.MediaAttachment
+	for _, a := range m.media {
+		if m.inDomains(a.UserID, domains) {
+			media = append(media, a)
+		}
+	}
+	return media, nil
+}
+
+func (m *mockAdminDB) DeleteUsersByEmailDomain(ctx context.Context, domains []string) (int64, error) {
+	var deleted int64
+	for id := range m.users {
+		if m.inDomains(id, domains) {
+			delete(m.users, id)
+			deleted++
+		}
+	}
+	m.media = slices.DeleteFunc(m.media, func(a database.MediaAttachment) bool {
+		_, ok := m.users[a.UserID]
+		return !ok
+	})
+	return deleted, nil
+}
+
+func TestHandlerResetTestTenants(t *testing.T) {
+	ctx := context.Background()
+	admin, moderator := newUser(RoleAdmin), newUser(RoleModerator)
+	tenant := database.User{ID: uuid.New(), Email: "alice@tenant.test", Role: RoleUser}
+	customer := database.User{ID: uuid.New(), Email: "bob@example.com", Role: RoleUser}
+
+	db := newMockAdminDB(admin, moderator, tenant, customer)
+	blobs, err := blob.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Error: could not create blob store: %v", err)
+	}
+	media := database.MediaAttachment{ID: uuid.New(), UserID: tenant.ID, OriginalKey: "tenant/original.png", ThumbnailKey: "tenant/thumb.jpg"}
+	kept := database.MediaAttachment{ID: uuid.New(), UserID: customer.ID, OriginalKey: "customer/original.png", ThumbnailKey: "customer/thumb.jpg"}
+	db.media = []database.MediaAttachment{media, kept}
+	for _, key := range []string{media.OriginalKey, media.ThumbnailKey, kept.OriginalKey, kept.ThumbnailKey} {
+		if err := blobs.Put(ctx, key, strings.NewReader("image")); err != nil {
+			t.Fatalf("Error: could not store blob: %v", err)
+		}
+	}
+
+	s := &State{DB: db, Secret: testSecret, Blobs: blobs, TestTenantDomains: []string{"tenant.test"}}
+	scope := "test_tenants:tenant.test"
+
+	reset := func(caller uuid.UUID, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.HandlerResetTestTenants(w, staffRequest(t, http.MethodPost, "/admin/reset/test-tenants", caller, confirmationParams{ConfirmationToken: token}, nil))
+		return w
+	}
+
+	if w := reset(moderator.ID, ""); w.Code != http.StatusForbidden {
+		t.Fatalf("Fail: expected moderators to be refused, got status %d", w.Code)
+	}
+
+	// a dry run counts what would go, without locking or deleting anything
+	w := reset(admin.ID, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Fail: expected status 200 but received %d with message: \n%s", w.Code, w.Body.String())
+	}
+	preview := decodeJSON[apiResetResult](t, w)
+	if !preview.DryRun || preview.Scope != scope || preview.ConfirmationToken == "" || preview.Deleted["users"] != 1 || preview.Deleted["media_attachments"] != 1 {
+		t.Fatalf("Fail: expected a dry run deleting one user and their media, got %+v", preview)
+	}
+	if !slices.Equal(slices.Sorted(maps.Keys(preview.Deleted)), slices.Sorted(maps.Keys(resetTables))) {
+		t.Fatalf("Fail: expected a count for every table, got %v", preview.Deleted)
+	}
+	if db.locked || len(db.users) != 4 || len(db.events) != 0 {
+		t.Fatal("Fail: expected a dry run to leave the database alone")
+	}
+
+	type testCase struct {
+		testName string
+		token    string
+	}
+
+	rejected := []testCase{
+		{testName: "malformed token", token: "not-a-token"},
+		{testName: "token for another scope", token: auth.MakeConfirmationToken("reset:all", time.Now().Add(time.Minute), testSecret)},
+		{testName: "token signed with another secret", token: auth.MakeConfirmationToken("reset:"+scope, time.Now().Add(time.Minute), "other-secret")},
+		{testName: "expired token", token: auth.MakeConfirmationToken("reset:"+scope, time.Now().Add(-time.Minute), testSecret)},
+	}
+
+	for _, tc := range rejected {
+		t.Run(tc.testName, func(t *testing.T) {
+			if w := reset(admin.ID, tc.token); w.Code != http.StatusBadRequest {
+				t.Fatalf("Fail: expected status 400 but received %d with message: \n%s", w.Code, w.Body.String())
+			}
+			if db.locked || len(db.users) != 4 {
+				t.Fatal("Fail: expected a rejected token to leave the database alone")
+			}
+		})
+	}
+
+	w = reset(admin.ID, preview.ConfirmationToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Fail: expected status 200 but received %d with message: \n%s", w.Code, w.Body.String())
+	}
+	result := decodeJSON[apiResetResult](t, w)
+	if result.DryRun || result.Deleted["users"] != 1 || result.Deleted["media_attachments"] != 1 {
+		t.Fatalf("Fail: expected one user and their media to be deleted, got %+v", result)
+	}
+	if _, ok := db.users[tenant.ID]; ok || !db.locked {
+		t.Fatal("Fail: expected the tenant to be deleted with the tables locked")
+	}
+	if _, ok := db.users[customer.ID]; !ok {
+		t.Fatal("Fail: expected users outside the test tenants to be kept")
+	}
+	if len(db.events) != 1 || db.events[0].Action != audit.ActionReset || db.events[0].ActorID != admin.ID || db.events[0].Metadata["rows.users"] != "1" {
+		t.Fatalf("Fail: expected the reset by %v to be audited, got %+v", admin.ID, db.events)
+	}
+
+	for _, key := range []string{media.OriginalKey, media.ThumbnailKey} {
+		if _, err := blobs.Get(ctx, key); !errors.Is(err, blob.ErrNotFound) {
+			t.Fatalf("Fail: expected the file %s of reset media to be deleted, got %v", key, err)
+		}
+	}
+	for _, key := range []string{kept.OriginalKey, kept.ThumbnailKey} {
+		r, err := blobs.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("Fail: expected the file %s of other media to be kept, got %v", key, err)
+		}
+		r.Close()
+	}
+}
+
+func TestHandlerReset(t *testing.T) {
+	type testCase struct {
+		testName       string
+		platform       string
+		body           any
+		expectedStatus int
+		expectedScope  string
+		expectedUsers  int64
+	}
+
+	testCases := []testCase{
+		{testName: "not on dev", platform: "prod", expectedStatus: http.StatusForbidden},
+		{testName: "unknown table", platform: PlatformDev, body: resetParams{Tables: []string{"pg_user"}}, expectedStatus: http.StatusBadRequest},
+		{testName: "tables with fixtures", platform: PlatformDev, body: resetParams{Tables: []string{"chirps"}, Fixtures: true}, expectedStatus: http.StatusBadRequest},
+		{testName: "everything", platform: PlatformDev, expectedStatus: http.StatusOK, expectedScope: "all", expectedUsers: 2},
+		{testName: "tables are sorted and deduplicated", platform: PlatformDev, body: resetParams{Tables: []string{"users", "chirps", "users"}}, expectedStatus: http.StatusOK, expectedScope: "tables:chirps,users", expectedUsers: 2},
+		{testName: "tables that users do not cascade from", platform: PlatformDev, body: resetParams{Tables: []string{"chirps"}}, expectedStatus: http.StatusOK, expectedScope: "tables:chirps"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			db := newMockAdminDB(newUser(RoleUser), newUser(RoleUser))
+			s := &State{DB: db, Secret: testSecret, Platform: tc.platform}
+
+			w := httptest.NewRecorder()
+			s.HandlerReset(w, staffRequest(t, http.MethodPost, "/admin/reset", uuid.Nil, tc.body, nil))
+
+			if w.Code != tc.expectedStatus {
+				t.Fatalf("Fail: expected status %d but received %d with message: \n%s", tc.expectedStatus, w.Code, w.Body.String())
+			}
+			if db.locked || len(db.users) != 2 {
+				t.Fatal("Fail: expected a request without a confirmation token to leave the database alone")
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+
+			preview := decodeJSON[apiResetResult](t, w)
+			if !preview.DryRun || preview.Scope != tc.expectedScope || preview.Deleted["users"] != tc.expectedUsers {
+				t.Fatalf("Fail: expected a dry run of %s deleting %d users, got %+v", tc.expectedScope, tc.expectedUsers, preview)
+			}
+			if err := auth.ValidateConfirmationToken(preview.ConfirmationToken, "reset:"+tc.expectedScope, testSecret); err != nil {
+				t.Fatalf("Fail: expected a token confirming %s: %v", tc.expectedScope, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/audit"
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/problem"
+	"github.com/google/uuid"
+)
+
+// Roles a user can hold, in increasing order of privilege
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var roleRank = map[string]int{RoleUser: 0, RoleModerator: 1, RoleAdmin: 2}
+
+// requireRole authenticates req as a logged-in user holding at least role, writing the error
+// response itself if that fails. Staff actions need a first-party session, so personal access
+// tokens and OAuth client tokens are never accepted.
+func (s *State) requireRole(w http.ResponseWriter, req *http.Request, role string) (database.User, bool) {
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		problem.Error(w, "could not get bearer token from header", http.StatusUnauthorized)
+		return database.User{}, false
+	}
+
+	accessToken, err := auth.ParseAccessToken(token, s.Secret)
+	if err != nil || accessToken.Scopes != nil {
+		problem.Error(w, "could not validate JWT", http.StatusUnauthorized)
+		return database.User{}, false
+	}
+
+	staff, err := s.DB.GetUserByID(req.Context(), accessToken.UserID)
+	if err != nil {
+		problem.Error(w, "could not find user", http.StatusUnauthorized)
+		return database.User{}, false
+	}
+
+	suspended := auth.ActiveSuspension(staff.SuspensionKind, staff.SuspendedAt, staff.SuspendedUntil, time.Now()) != ""
+	if roleRank[staff.Role] < roleRank[role] || suspended {
+		log.Printf("Warning: user %v with role %s was refused a %s action", staff.ID, staff.Role, role)
+		problem.Error(w, "you do not have permission to do this", http.StatusForbidden)
+		return database.User{}, false
+	}
+
+	return staff, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		problem.Error(w, "could not marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(data); err != nil {
+		log.Printf("Error: could not write response to http body: %v", err)
+	}
+}
+
+type roleParams struct {
+	Role string `json:"role"`
+}
+
+// HandlerSetUserRole makes a user a moderator or admin, or takes that away. Only admins may do it.
+func (s *State) HandlerSetUserRole(w http.ResponseWriter, req *http.Request) {
+	staff, ok := s.requireRole(w, req, RoleAdmin)
+	if !ok {
+		return
+	}
+
+	userID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		problem.Error(w, "could not parse user ID to uuid", http.StatusBadRequest)
+		return
+	}
+
+	var params roleParams
+	if err := json.NewDecoder(req.Body).Decode(&params); err != nil {
+		problem.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := roleRank[params.Role]; !ok {
+		problem.Error(w, "role must be one of: user, moderator, admin", http.StatusBadRequest)
+		return
+	}
+
+	if userID == staff.ID && params.Role != RoleAdmin {
+		problem.Error(w, "admins cannot demote themselves", http.StatusBadRequest)
+		return
+	}
+
+	event := audit.Event{
+		ActorID:    staff.ID,
+		Action:     audit.ActionRoleChange,
+		TargetType: audit.TargetUser,
+		TargetID:   userID.String(),
+		Metadata:   map[string]string{"role": params.Role},
+	}
+	err = s.DB.RecordAudit(req.Context(), event, func(ctx context.Context) error {
+		updated, err := s.DB.SetUserRole(ctx, database.SetUserRoleParams{ID: userID, Role: params.Role})
+		if err == nil && updated == 0 {
+			return errNothingChanged
+		}
+		return err
+	})
+	if errors.Is(err, errNothingChanged) {
+		problem.Error(w, "could not find user", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error: could not set role of user %v: %v", userID, err)
+		problem.Error(w, "could not set role", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Warning: admin %v set the role of user %v to %s", staff.ID, userID, params.Role)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,197 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/audit"
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/problem"
+	"github.com/google/uuid"
+)
+
+type suspensionStore interface {
+	LiftSuspension(ctx context.Context, id uuid.UUID) (int64, error)
+	SuspendUser(ctx context.Context, arg database.SuspendUserParams) (int64, error)
+	sessionRevoker
+}
+
+// sessionRevoker ends every session and personal access token of a user
+type sessionRevoker interface {
+	RevokeAllPersonalAccessTokensForUser(ctx context.Context, userID uuid.UUID) error
+	RevokeAllRefreshTokensForUser(ctx context.Context, userID uuid.UUID) error
+}
+
+type suspensionParams struct {
+	Kind   string `json:"kind"`
+	Reason string `json:"reason"`
+	// Until is when the suspension ends by itself. It lasts until lifted if omitted.
+	Until *time.Time `json:"until"`
+}
+
+// validate checks the parameters, filling in a full suspension if no kind was given
+func (p *suspensionParams) validate() error {
+	if p.Kind == "" {
+		p.Kind = auth.SuspensionFull
+	}
+	if !auth.ValidSuspensionKind(p.Kind) {
+		return fmt.Errorf("kind must be one of: %s", strings.Join(auth.SuspensionKinds, ", "))
+	}
+
+	p.Reason = strings.TrimSpace(p.Reason)
+	if p.Reason == "" {
+		return fmt.Errorf("a reason is required")
+	}
+
+	if p.Until != nil && !p.Until.After(time.Now()) {
+		return fmt.Errorf("until must be in the future")
+	}
+	return nil
+}
+
+// suspend places a suspension on a user. A full suspension also ends every session they have; the other
+// kinds leave them logged in, and a shadow-banned user must not be able to tell anything has changed.
+func (s *State) suspend(ctx context.Context, userID uuid.UUID, params suspensionParams) (bool, error) {
+	until := sql.NullTime{}
+	if params.Until != nil {
+		until = sql.NullTime{Time: params.Until.UTC(), Valid: true}
+	}
+
+	updated, err := s.DB.SuspendUser(ctx, database.SuspendUserParams{
+		ID:               userID,
+		SuspensionKind:   params.Kind,
+		SuspensionReason: params.Reason,
+		SuspendedUntil:   until,
+	})
+	if err != nil {
+		return false, fmt.Errorf("could not suspend user: %v", err)
+	}
+	if updated == 0 {
+		return false, nil
+	}
+
+	if params.Kind == auth.SuspensionFull {
+		if err := s.DB.RevokeAllRefreshTokensForUser(ctx, userID); err != nil {
+			return true, fmt.Errorf("could not revoke refresh tokens: %v", err)
+		}
+		if err := s.DB.RevokeAllPersonalAccessTokensForUser(ctx, userID); err != nil {
+			return true, fmt.Errorf("could not revoke personal access tokens: %v", err)
+		}
+	}
+	return true, nil
+}
+
+// suspensionTarget resolves the user in the path, who must rank below the staff member acting on them
+func (s *State) suspensionTarget(w http.ResponseWriter, req *http.Request, staff database.User) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		problem.Error(w, "could not parse user ID to uuid", http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+
+	target, err := s.DB.GetUserByID(req.Context(), userID)
+	if err != nil {
+		problem.Error(w, "could not find user", http.StatusNotFound)
+		return uuid.Nil, false
+	}
+
+	if roleRank[target.Role] >= roleRank[staff.Role] {
+		problem.Error(w, "you can only suspend users with a lower role than yours", http.StatusForbidden)
+		return uuid.Nil, false
+	}
+
+	return userID, true
+}
+
+// HandlerSuspendUser suspends a user, replacing any suspension they are already under
+func (s *State) HandlerSuspendUser(w http.ResponseWriter, req *http.Request) {
+	staff, ok := s.requireRole(w, req, RoleModerator)
+	if !ok {
+		return
+	}
+
+	userID, ok := s.suspensionTarget(w, req, staff)
+	if !ok {
+		return
+	}
+
+	var params suspensionParams
+	if err := json.NewDecoder(req.Body).Decode(&params); err != nil {
+		problem.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := params.validate(); err != nil {
+		problem.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	event := audit.Event{
+		ActorID:    staff.ID,
+		Action:     audit.ActionSuspend,
+		TargetType: audit.TargetUser,
+		TargetID:   userID.String(),
+		Metadata:   map[string]string{"kind": params.Kind, "reason": params.Reason},
+	}
+	if params.Until != nil {
+		event.Metadata["until"] = params.Until.UTC().Format(time.RFC3339)
+	}
+	err := s.DB.RecordAudit(req.Context(), event, func(ctx context.Context) error {
+		found, err := s.suspend(ctx, userID, params)
+		if err == nil && !found {
+			return errNothingChanged
+		}
+		return err
+	})
+	if errors.Is(err, errNothingChanged) {
+		problem.Error(w, "could not find user", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error: could not suspend user %v: %v", userID, err)
+		problem.Error(w, "could not suspend user", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Warning: %s %v placed a %s suspension on user %v: %s", staff.Role, staff.ID, params.Kind, userID, params.Reason)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandlerLiftSuspension ends a user's suspension early
+func (s *State) HandlerLiftSuspension(w http.ResponseWriter, req *http.Request) {
+	staff, ok := s.requireRole(w, req, RoleModerator)
+	if !ok {
+		return
+	}
+
+	userID, ok := s.suspensionTarget(w, req, staff)
+	if !ok {
+		return
+	}
+
+	event := audit.Event{ActorID: staff.ID, Action: audit.ActionLiftSuspension, TargetType: audit.TargetUser, TargetID: userID.String()}
+	err := s.DB.RecordAudit(req.Context(), event, func(ctx context.Context) error {
+		lifted, err := s.DB.LiftSuspension(ctx, userID)
+		if err == nil && lifted == 0 {
+			return errNothingChanged
+		}
+		return err
+	})
+	if errors.Is(err, errNothingChanged) {
+		problem.Error(w, "user is not suspended", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error: could not lift suspension of user %v: %v", userID, err)
+		problem.Error(w, "could not lift suspension", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Warning: %s %v lifted the suspension of user %v", staff.Role, staff.ID, userID)
+	w.WriteHeader(http.StatusNoContent)
+}
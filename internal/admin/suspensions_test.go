@@ -0,0 +1,146 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/audit"
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+func (m *mockAdminDB) LiftSuspension(ctx context.Context, id uuid.UUID) (int64, error) {
+	u, ok := m.users[id]
+	if !ok || !u.SuspendedAt.Valid {
+		return 0, nil
+	}
+	u.SuspendedAt, u.SuspensionKind = sql.NullTime{}, ""
+	m.users[id] = u
+	return 1, nil
+}
+
+func TestHandlerSuspendUser(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+
+	type testCase struct {
+		testName       string
+		caller         string
+		target         string
+		userID         string
+		body           any
+		expectedStatus int
+		expectRevoked  bool
+	}
+
+	testCases := []testCase{
+		{testName: "user cannot suspend", caller: RoleUser, target: RoleUser, body: suspensionParams{Reason: "spam"}, expectedStatus: http.StatusForbidden},
+		{testName: "bad user ID", caller: RoleModerator, userID: "not-a-uuid", body: suspensionParams{Reason: "spam"}, expectedStatus: http.StatusBadRequest},
+		{testName: "unknown user", caller: RoleModerator, userID: uuid.NewString(), body: suspensionParams{Reason: "spam"}, expectedStatus: http.StatusNotFound},
+		{testName: "moderator cannot suspend a moderator", caller: RoleModerator, target: RoleModerator, body: suspensionParams{Reason: "spam"}, expectedStatus: http.StatusForbidden},
+		{testName: "moderator cannot suspend an admin", caller: RoleModerator, target: RoleAdmin, body: suspensionParams{Reason: "spam"}, expectedStatus: http.StatusForbidden},
+		{testName: "admin cannot suspend an admin", caller: RoleAdmin, target: RoleAdmin, body: suspensionParams{Reason: "spam"}, expectedStatus: http.StatusForbidden},
+		{testName: "missing reason", caller: RoleModerator, target: RoleUser, body: suspensionParams{Kind: auth.SuspensionFull}, expectedStatus: http.StatusBadRequest},
+		{testName: "unknown kind", caller: RoleModerator, target: RoleUser, body: suspensionParams{Kind: "forever", Reason: "spam"}, expectedStatus: http.StatusBadRequest},
+		{testName: "until in the past", caller: RoleModerator, target: RoleUser, body: suspensionParams{Reason: "spam", Until: &past}, expectedStatus: http.StatusBadRequest},
+		{testName: "full suspension ends sessions", caller: RoleModerator, target: RoleUser, body: suspensionParams{Reason: "spam"}, expectedStatus: http.StatusNoContent, expectRevoked: true},
+		{testName: "read only suspension keeps sessions", caller: RoleModerator, target: RoleUser, body: suspensionParams{Kind: auth.SuspensionReadOnly, Reason: "spam"}, expectedStatus: http.StatusNoContent},
+		{testName: "shadow ban keeps sessions", caller: RoleModerator, target: RoleUser, body: suspensionParams{Kind: auth.SuspensionShadowBan, Reason: "spam"}, expectedStatus: http.StatusNoContent},
+		{testName: "admin suspends a moderator", caller: RoleAdmin, target: RoleModerator, body: suspensionParams{Kind: auth.SuspensionFull, Reason: "abuse"}, expectedStatus: http.StatusNoContent, expectRevoked: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			caller := newUser(tc.caller)
+			db := newMockAdminDB(caller)
+			userID := tc.userID
+			var target uuid.UUID
+			if tc.target != "" {
+				u := newUser(tc.target)
+				db.users[u.ID] = u
+				target, userID = u.ID, u.ID.String()
+			}
+			s := &State{DB: db, Secret: testSecret}
+
+			req := staffRequest(t, http.MethodPost, "/admin/users/"+userID+"/suspension", caller.ID, tc.body, map[string]string{"userID": userID})
+			w := httptest.NewRecorder()
+			s.HandlerSuspendUser(w, req)
+
+			if w.Code != tc.expectedStatus {
+				t.Fatalf("Fail: expected status %d but received %d with message: \n%s", tc.expectedStatus, w.Code, w.Body.String())
+			}
+
+			if revoked := len(db.revoked) > 0; revoked != tc.expectRevoked {
+				t.Fatalf("Fail: expected sessions revoked to be %v, got %v", tc.expectRevoked, db.revoked)
+			}
+			for _, id := range db.revoked {
+				if id != target {
+					t.Fatalf("Fail: expected only the sessions of %v to be revoked, got %v", target, id)
+				}
+			}
+
+			if tc.expectedStatus != http.StatusNoContent {
+				if len(db.events) != 0 {
+					t.Fatalf("Fail: expected nothing to be audited, got %+v", db.events)
+				}
+				return
+			}
+
+			if !db.users[target].SuspendedAt.Valid {
+				t.Fatal("Fail: expected the user to be suspended")
+			}
+			if len(db.events) != 1 || db.events[0].Action != audit.ActionSuspend || db.events[0].ActorID != caller.ID {
+				t.Fatalf("Fail: expected one suspension by %v to be audited, got %+v", caller.ID, db.events)
+			}
+		})
+	}
+}
+
+func TestHandlerLiftSuspension(t *testing.T) {
+	type testCase struct {
+		testName       string
+		caller         string
+		target         string
+		suspended      bool
+		expectedStatus int
+	}
+
+	testCases := []testCase{
+		{testName: "user cannot lift", caller: RoleUser, target: RoleUser, suspended: true, expectedStatus: http.StatusForbidden},
+		{testName: "moderator cannot lift for a moderator", caller: RoleModerator, target: RoleModerator, suspended: true, expectedStatus: http.StatusForbidden},
+		{testName: "not suspended", caller: RoleModerator, target: RoleUser, expectedStatus: http.StatusNotFound},
+		{testName: "lift", caller: RoleModerator, target: RoleUser, suspended: true, expectedStatus: http.StatusNoContent},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			caller, target := newUser(tc.caller), newUser(tc.target)
+			if tc.suspended {
+				target.SuspendedAt = sql.NullTime{Time: time.Now(), Valid: true}
+				target.SuspensionKind = auth.SuspensionFull
+			}
+			db := newMockAdminDB(caller, target)
+			s := &State{DB: db, Secret: testSecret}
+
+			userID := target.ID.String()
+			req := staffRequest(t, http.MethodDelete, "/admin/users/"+userID+"/suspension", caller.ID, nil, map[string]string{"userID": userID})
+			w := httptest.NewRecorder()
+			s.HandlerLiftSuspension(w, req)
+
+			if w.Code != tc.expectedStatus {
+				t.Fatalf("Fail: expected status %d but received %d with message: \n%s", tc.expectedStatus, w.Code, w.Body.String())
+			}
+
+			lifted := tc.expectedStatus == http.StatusNoContent
+			if tc.suspended && db.users[target.ID].SuspendedAt.Valid == lifted {
+				t.Fatalf("Fail: expected the suspension lifted to be %v", lifted)
+			}
+			if lifted != (len(db.events) == 1) {
+				t.Fatalf("Fail: expected an audit event only when the suspension is lifted, got %+v", db.events)
+			}
+		})
+	}
+}
@@ -0,0 +1,386 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/audit"
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/mailer"
+	"github.com/bailey4770/chirpy/internal/problem"
+	"github.com/google/uuid"
+)
+
+// likeEscaper stops a search term's own % and _ from acting as wildcards
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+type userManagementStore interface {
+	ClearPassword(ctx context.Context, id uuid.UUID) (int64, error)
+	CountActiveRefreshTokensForUser(ctx context.Context, userID uuid.UUID) (int64, error)
+	CountChirpsForUser(ctx context.Context, userID uuid.UUID) (int64, error)
+	ListUsers(ctx context.Context, arg database.ListUsersParams) ([]database.User, error)
+	SetChirpyRed(ctx context.Context, arg database.SetChirpyRedParams) (int64, error)
+	sessionRevoker
+}
+
+type apiUser struct {
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	DisplayName   string    `json:"display_name"`
+	Role          string    `json:"role"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	MFAEnabled    bool      `json:"mfa_enabled"`
+	// Suspension is the kind of suspension in force, if any. Expired suspensions are left out.
+	Suspension       string     `json:"suspension,omitempty"`
+	SuspensionReason string     `json:"suspension_reason,omitempty"`
+	SuspendedUntil   *time.Time `json:"suspended_until,omitempty"`
+	DeleteAfter      *time.Time `json:"delete_after,omitempty"`
+}
+
+type apiUserDetail struct {
+	apiUser
+	// ActiveSessions counts refresh tokens that are neither revoked nor expired, including those of OAuth clients
+	ActiveSessions int64 `json:"active_sessions"`
+	Chirps         int64 `json:"chirps"`
+}
+
+func dbUserToAPIUser(u database.User) apiUser {
+	resp := apiUser{
+		ID:            u.ID,
+		CreatedAt:     u.CreatedAt,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerified,
+		DisplayName:   u.DisplayName,
+		Role:          u.Role,
+		IsChirpyRed:   u.IsChirpyRed,
+		MFAEnabled:    u.TotpEnabled,
+		Suspension:    auth.ActiveSuspension(u.SuspensionKind, u.SuspendedAt, u.SuspendedUntil, time.Now()),
+	}
+	if resp.Suspension != "" {
+		resp.SuspensionReason = u.SuspensionReason
+		if u.SuspendedUntil.Valid {
+			resp.SuspendedUntil = &u.SuspendedUntil.Time
+		}
+	}
+	if u.DeleteAfter.Valid {
+		resp.DeleteAfter = &u.DeleteAfter.Time
+	}
+	return resp
+}
+
+// HandlerListUsers returns users newest first. They can be searched by email or display name with q,
+// filtered by red, suspended and role, and are paged with limit and offset.
+func (s *State) HandlerListUsers(w http.ResponseWriter, req *http.Request) {
+	if _, ok := s.requireRole(w, req, RoleModerator); !ok {
+		return
+	}
+
+	query := req.URL.Query()
+	params := database.ListUsersParams{}
+
+	if q := strings.TrimSpace(query.Get("q")); q != "" {
+		params.Search = sql.NullString{String: likeEscaper.Replace(q), Valid: true}
+	}
+
+	for name, dst := range map[string]*sql.NullBool{"red": &params.IsChirpyRed, "suspended": &params.Suspended} {
+		if v := query.Get(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				problem.Error(w, name+" must be true or false", http.StatusBadRequest)
+				return
+			}
+			*dst = sql.NullBool{Bool: b, Valid: true}
+		}
+	}
+
+	if role := query.Get("role"); role != "" {
+		if _, ok := roleRank[role]; !ok {
+			problem.Error(w, "role must be one of: user, moderator, admin", http.StatusBadRequest)
+			return
+		}
+		params.Role = sql.NullString{String: role, Valid: true}
+	}
+
+	limit, offset, err := pageParams(query.Get("limit"), query.Get("offset"))
+	if err != nil {
+		problem.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	params.Limit, params.Offset = limit, offset
+
+	users, err := s.DB.ListUsers(req.Context(), params)
+	if err != nil {
+		log.Printf("Error: could not list users: %v", err)
+		problem.Error(w, "could not list users", http.StatusInternalServerError)
+		return
+	}
+
+	resp := []apiUser{}
+	for _, u := range users {
+		resp = append(resp, dbUserToAPIUser(u))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// HandlerGetUser returns a user with counts of their active sessions and chirps
+func (s *State) HandlerGetUser(w http.ResponseWriter, req *http.Request) {
+	if _, ok := s.requireRole(w, req, RoleModerator); !ok {
+		return
+	}
+
+	userID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		problem.Error(w, "could not parse user ID to uuid", http.StatusBadRequest)
+		return
+	}
+
+	dbUser, err := s.DB.GetUserByID(req.Context(), userID)
+	if err != nil {
+		problem.Error(w, "could not find user", http.StatusNotFound)
+		return
+	}
+
+	resp := apiUserDetail{apiUser: dbUserToAPIUser(dbUser)}
+
+	if resp.ActiveSessions, err = s.DB.CountActiveRefreshTokensForUser(req.Context(), userID); err != nil {
+		log.Printf("Error: could not count sessions of user %v: %v", userID, err)
+		problem.Error(w, "could not get user", http.StatusInternalServerError)
+		return
+	}
+
+	if resp.Chirps, err = s.DB.CountChirpsForUser(req.Context(), userID); err != nil {
+		log.Printf("Error: could not count chirps of user %v: %v", userID, err)
+		problem.Error(w, "could not get user", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// managedUser resolves the user in the path, who must rank below the staff member managing their account
+func (s *State) managedUser(w http.ResponseWriter, req *http.Request, staff database.User) (database.User, bool) {
+	userID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		problem.Error(w, "could not parse user ID to uuid", http.StatusBadRequest)
+		return database.User{}, false
+	}
+
+	target, err := s.DB.GetUserByID(req.Context(), userID)
+	if err != nil {
+		problem.Error(w, "could not find user", http.StatusNotFound)
+		return database.User{}, false
+	}
+
+	if roleRank[target.Role] >= roleRank[staff.Role] {
+		problem.Error(w, "you can only manage users with a lower role than yours", http.StatusForbidden)
+		return database.User{}, false
+	}
+
+	return target, true
+}
+
+// HandlerForcePasswordReset removes a user's password and ends their sessions and personal access tokens,
+// so the account can only be used again once its owner resets the password by email
+func (s *State) HandlerForcePasswordReset(w http.ResponseWriter, req *http.Request) {
+	staff, ok := s.requireRole(w, req, RoleAdmin)
+	if !ok {
+		return
+	}
+
+	target, ok := s.managedUser(w, req, staff)
+	if !ok {
+		return
+	}
+
+	event := audit.Event{ActorID: staff.ID, Action: audit.ActionForcePasswordReset, TargetType: audit.TargetUser, TargetID: target.ID.String()}
+	err := s.DB.RecordAudit(req.Context(), event, func(ctx context.Context) error {
+		updated, err := s.DB.ClearPassword(ctx, target.ID)
+		if err != nil {
+			return fmt.Errorf("could not clear password: %v", err)
+		} else if updated == 0 {
+			return errNothingChanged
+		}
+
+		if err := s.DB.RevokeAllRefreshTokensForUser(ctx, target.ID); err != nil {
+			return fmt.Errorf("could not revoke refresh tokens: %v", err)
+		}
+		if err := s.DB.RevokeAllPersonalAccessTokensForUser(ctx, target.ID); err != nil {
+			return fmt.Errorf("could not revoke personal access tokens: %v", err)
+		}
+		return nil
+	})
+	if errors.Is(err, errNothingChanged) {
+		problem.Error(w, "could not find user", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error: could not force a password reset for user %v: %v", target.ID, err)
+		problem.Error(w, "could not force password reset", http.StatusInternalServerError)
+		return
+	}
+
+	if s.Mailer != nil {
+		if err := s.Mailer.Send(req.Context(), mailer.Message{
+			To:      target.Email,
+			Subject: "Your Chirpy password has been reset",
+			Body:    "An administrator has reset the password for your Chirpy account and logged you out everywhere. Use \"Forgot password\" on the login page to choose a new one.",
+		}); err != nil {
+			log.Printf("Error: could not tell user %v their password was reset: %v", target.ID, err)
+		}
+	}
+
+	log.Printf("Warning: admin %v forced a password reset for user %v", staff.ID, target.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandlerRevokeUserSessions revokes every refresh token a user has, logging them out everywhere once their
+// access tokens expire. Personal access tokens are left alone.
+func (s *State) HandlerRevokeUserSessions(w http.ResponseWriter, req *http.Request) {
+	staff, ok := s.requireRole(w, req, RoleAdmin)
+	if !ok {
+		return
+	}
+
+	target, ok := s.managedUser(w, req, staff)
+	if !ok {
+		return
+	}
+
+	event := audit.Event{ActorID: staff.ID, Action: audit.ActionRevokeSessions, TargetType: audit.TargetUser, TargetID: target.ID.String()}
+	if err := s.DB.RecordAudit(req.Context(), event, func(ctx context.Context) error {
+		return s.DB.RevokeAllRefreshTokensForUser(ctx, target.ID)
+	}); err != nil {
+		log.Printf("Error: could not revoke sessions of user %v: %v", target.ID, err)
+		problem.Error(w, "could not revoke sessions", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Warning: admin %v revoked every session of user %v", staff.ID, target.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type chirpyRedParams struct {
+	IsChirpyRed bool `json:"is_chirpy_red"`
+}
+
+// HandlerSetChirpyRed gives a user Chirpy Red or takes it away by hand, such as when a payment webhook was missed
+func (s *State) HandlerSetChirpyRed(w http.ResponseWriter, req *http.Request) {
+	staff, ok := s.requireRole(w, req, RoleAdmin)
+	if !ok {
+		return
+	}
+
+	userID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		problem.Error(w, "could not parse user ID to uuid", http.StatusBadRequest)
+		return
+	}
+
+	var params chirpyRedParams
+	if err := json.NewDecoder(req.Body).Decode(&params); err != nil {
+		problem.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	event := audit.Event{
+		ActorID:    staff.ID,
+		Action:     audit.ActionSetChirpyRed,
+		TargetType: audit.TargetUser,
+		TargetID:   userID.String(),
+		Metadata:   map[string]string{"is_chirpy_red": strconv.FormatBool(params.IsChirpyRed)},
+	}
+	err = s.DB.RecordAudit(req.Context(), event, func(ctx context.Context) error {
+		updated, err := s.DB.SetChirpyRed(ctx, database.SetChirpyRedParams{ID: userID, IsChirpyRed: params.IsChirpyRed})
+		if err == nil && updated == 0 {
+			return errNothingChanged
+		}
+		return err
+	})
+	if errors.Is(err, errNothingChanged) {
+		problem.Error(w, "could not find user", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error: could not set Chirpy Red for user %v: %v", userID, err)
+		problem.Error(w, "could not set Chirpy Red", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Warning: admin %v set Chirpy Red to %v for user %v", staff.ID, params.IsChirpyRed, userID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type impersonationParams struct {
+	// Reason is required, and kept in the audit log so every impersonation can be accounted for
+	Reason string `json:"reason"`
+}
+
+type apiImpersonationToken struct {
+	Token     string    `json:"token"`
+	UserID    uuid.UUID `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// HandlerImpersonateUser issues a short-lived access token that lets support act as a user. Every audit
+// event recorded with it names the admin who asked for it, and it cannot change the user's credentials.
+func (s *State) HandlerImpersonateUser(w http.ResponseWriter, req *http.Request) {
+	staff, ok := s.requireRole(w, req, RoleAdmin)
+	if !ok {
+		return
+	}
+
+	target, ok := s.managedUser(w, req, staff)
+	if !ok {
+		return
+	}
+
+	var params impersonationParams
+	if err := json.NewDecoder(req.Body).Decode(&params); err != nil {
+		problem.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	params.Reason = strings.TrimSpace(params.Reason)
+	if params.Reason == "" {
+		problem.Error(w, "a reason is required", http.StatusBadRequest)
+		return
+	}
+
+	token, err := auth.MakeImpersonationJWT(target.ID, staff.ID, s.Secret)
+	if err != nil {
+		log.Printf("Error: could not make impersonation token: %v", err)
+		problem.Error(w, "could not make impersonation token", http.StatusInternalServerError)
+		return
+	}
+
+	event := audit.Event{
+		ActorID:    staff.ID,
+		Action:     audit.ActionImpersonate,
+		TargetType: audit.TargetUser,
+		TargetID:   target.ID.String(),
+		Metadata:   map[string]string{"reason": params.Reason},
+	}
+	// the token is only handed out once the impersonation is on record
+	if err := s.DB.RecordAudit(req.Context(), event, nil); err != nil {
+		log.Printf("Error: could not record impersonation of user %v: %v", target.ID, err)
+		problem.Error(w, "could not make impersonation token", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Warning: admin %v is impersonating user %v: %s", staff.ID, target.ID, params.Reason)
+	writeJSON(w, http.StatusCreated, apiImpersonationToken{
+		Token:     token,
+		UserID:    target.ID,
+		ExpiresAt: time.Now().Add(auth.ImpersonationTokenTTL).UTC().Truncate(time.Second),
+	})
+}
@@ -0,0 +1,77 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bailey4770/chirpy/internal/audit"
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+func TestHandlerImpersonateUser(t *testing.T) {
+	type testCase struct {
+		testName       string
+		caller         string
+		target         string
+		userID         string
+		body           any
+		expectedStatus int
+	}
+
+	testCases := []testCase{
+		{testName: "moderator cannot impersonate", caller: RoleModerator, target: RoleUser, body: impersonationParams{Reason: "ticket 42"}, expectedStatus: http.StatusForbidden},
+		{testName: "bad user ID", caller: RoleAdmin, userID: "not-a-uuid", body: impersonationParams{Reason: "ticket 42"}, expectedStatus: http.StatusBadRequest},
+		{testName: "unknown user", caller: RoleAdmin, userID: uuid.NewString(), body: impersonationParams{Reason: "ticket 42"}, expectedStatus: http.StatusNotFound},
+		{testName: "admin cannot impersonate an admin", caller: RoleAdmin, target: RoleAdmin, body: impersonationParams{Reason: "ticket 42"}, expectedStatus: http.StatusForbidden},
+		{testName: "missing reason", caller: RoleAdmin, target: RoleUser, body: impersonationParams{Reason: " "}, expectedStatus: http.StatusBadRequest},
+		{testName: "invalid body", caller: RoleAdmin, target: RoleUser, body: "ticket 42", expectedStatus: http.StatusBadRequest},
+		{testName: "impersonate a moderator", caller: RoleAdmin, target: RoleModerator, body: impersonationParams{Reason: "ticket 42"}, expectedStatus: http.StatusCreated},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			caller := newUser(tc.caller)
+			db := newMockAdminDB(caller)
+			userID := tc.userID
+			var target uuid.UUID
+			if tc.target != "" {
+				u := newUser(tc.target)
+				db.users[u.ID] = u
+				target, userID = u.ID, u.ID.String()
+			}
+			s := &State{DB: db, Secret: testSecret}
+
+			req := staffRequest(t, http.MethodPost, "/admin/users/"+userID+"/impersonate", caller.ID, tc.body, map[string]string{"userID": userID})
+			w := httptest.NewRecorder()
+			s.HandlerImpersonateUser(w, req)
+
+			if w.Code != tc.expectedStatus {
+				t.Fatalf("Fail: expected status %d but received %d with message: \n%s", tc.expectedStatus, w.Code, w.Body.String())
+			}
+			if tc.expectedStatus != http.StatusCreated {
+				if len(db.events) != 0 {
+					t.Fatalf("Fail: expected nothing to be audited, got %+v", db.events)
+				}
+				return
+			}
+
+			resp := decodeJSON[apiImpersonationToken](t, w)
+			accessToken, err := auth.ParseAccessToken(resp.Token, testSecret)
+			if err != nil {
+				t.Fatalf("Error: could not parse impersonation token: %v", err)
+			}
+			if accessToken.UserID != target || accessToken.ImpersonatorID != caller.ID || resp.UserID != target {
+				t.Fatalf("Fail: expected a token for %v impersonated by %v, got %+v", target, caller.ID, accessToken)
+			}
+			if accessToken.ExpiresAt.After(accessToken.IssuedAt.Add(auth.ImpersonationTokenTTL)) {
+				t.Fatalf("Fail: expected the token to last at most %v, got until %v", auth.ImpersonationTokenTTL, accessToken.ExpiresAt)
+			}
+
+			if len(db.events) != 1 || db.events[0].Action != audit.ActionImpersonate || db.events[0].ActorID != caller.ID || db.events[0].Metadata["reason"] != "ticket 42" {
+				t.Fatalf("Fail: expected the impersonation and its reason to be audited, got %+v", db.events)
+			}
+		})
+	}
+}
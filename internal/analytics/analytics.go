@@ -0,0 +1,199 @@
+// Package analytics counts page views and API requests in memory and adds them to per-minute, hourly
+// and daily totals in the database in batches
+package analytics
+
+import (
+	"cmp"
+	"context"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/database"
+)
+
+const (
+	// MetricPageView counts HTML pages served by the fileserver, keyed by path
+	MetricPageView = "page_view"
+	// MetricAPIRequest counts requests to the API, keyed by the route pattern they matched
+	MetricAPIRequest = "api_request"
+
+	GranularityMinute = "minute"
+	GranularityHour   = "hour"
+	GranularityDay    = "day"
+
+	// unmatchedKey stands in for the pattern of requests no route matched, so probing for
+	// random paths cannot create a key per path
+	unmatchedKey = "unmatched"
+
+	fileserverPrefix = "/app/"
+
+	// maxPending bounds the distinct counts held between flushes. Counts for anything new past it are
+	// dropped, and the drop is logged.
+	maxPending = 50_000
+)
+
+type countAdder interface {
+	AddAnalyticsCounts(ctx context.Context, arg database.AddAnalyticsCountsParams) error
+}
+
+type countKey struct {
+	// minute is the Unix time divided by 60
+	minute int64
+	metric string
+	key    string
+}
+
+// Recorder adds up counts in memory until they are flushed. Each flush only adds this server's counts to
+// the stored totals, so any number of servers can record into the same database.
+type Recorder struct {
+	db countAdder
+
+	mu      sync.Mutex
+	pending map[countKey]int64
+	dropped int64
+}
+
+func NewRecorder(db countAdder) *Recorder {
+	return &Recorder{db: db, pending: map[countKey]int64{}}
+}
+
+// Record counts one metric event for key in the current minute
+func (r *Recorder) Record(metric, key string) {
+	r.add(countKey{minute: time.Now().Unix() / 60, metric: metric, key: key}, 1)
+}
+
+func (r *Recorder) add(k countKey, n int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.pending[k]; !ok && len(r.pending) >= maxPending {
+		r.dropped += n
+		return
+	}
+	r.pending[k] += n
+}
+
+// Flush writes every pending count in one statement. If it fails the counts are kept for the next flush.
+func (r *Recorder) Flush(ctx context.Context) error {
+	r.mu.Lock()
+	pending, dropped := r.pending, r.dropped
+	r.pending, r.dropped = map[countKey]int64{}, 0
+	r.mu.Unlock()
+
+	if dropped > 0 {
+		log.Printf("Warning: dropped %d analytics counts while too many were waiting to be flushed", dropped)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	keys := make([]countKey, 0, len(pending))
+	for k := range pending {
+		keys = append(keys, k)
+	}
+	// sorted, so the rows are always written in the same order
+	slices.SortFunc(keys, func(a, b countKey) int {
+		return cmp.Or(cmp.Compare(a.minute, b.minute), cmp.Compare(a.metric, b.metric), cmp.Compare(a.key, b.key))
+	})
+
+	params := database.AddAnalyticsCountsParams{}
+	for _, k := range keys {
+		params.Minutes = append(params.Minutes, k.minute)
+		params.Metrics = append(params.Metrics, k.metric)
+		params.Keys = append(params.Keys, k.key)
+		params.Counts = append(params.Counts, pending[k])
+	}
+
+	if err := r.db.AddAnalyticsCounts(ctx, params); err != nil {
+		for k, n := range pending {
+			r.add(k, n)
+		}
+		return err
+	}
+	return nil
+}
+
+// Run flushes every interval until ctx is cancelled. The caller should Flush once more after that,
+// once nothing else is being recorded.
+func (r *Recorder) Run(ctx context.Context, interval time.Duration) {
+	flushEvery(ctx, interval, "analytics", r.Flush)
+}
+
+func flushEvery(ctx context.Context, interval time.Duration, name string, flush func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := flush(ctx); err != nil {
+			log.Printf("Error: could not flush %s: %v", name, err)
+		}
+	}
+}
+
+// statusWriter remembers the status code a handler responded with
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// MiddlewarePageViews counts a page view for each HTML page next serves successfully. Stylesheets,
+// images and missing files are not counted.
+func MiddlewarePageViews(r *Recorder, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, req)
+
+		if sw.status >= http.StatusBadRequest || req.Method != http.MethodGet {
+			return
+		}
+		if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+			return
+		}
+		r.Record(MetricPageView, req.URL.Path)
+	})
+}
+
+// MiddlewareAPIUsage counts each request outside the fileserver under the route pattern it matched, such
+// as "GET /api/chirps/{chirpID}". It must wrap the ServeMux directly, which sets the pattern on the
+// request it is given.
+func MiddlewareAPIUsage(r *Recorder, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		next.ServeHTTP(w, req)
+
+		if strings.HasPrefix(req.URL.Path, fileserverPrefix) {
+			return
+		}
+		key := req.Pattern
+		if key == "" {
+			key = unmatchedKey
+		}
+		r.Record(MetricAPIRequest, key)
+	})
+}
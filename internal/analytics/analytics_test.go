@@ -0,0 +1,220 @@
+package analytics
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type mockCountDB struct {
+	batches []database.AddAnalyticsCountsParams
+	err     error
+}
+
+func (m *mockCountDB) AddAnalyticsCounts(ctx context.Context, arg database.AddAnalyticsCountsParams) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.batches = append(m.batches, arg)
+	return nil
+}
+
+// sums returns the flushed count for each metric and key, across every minute and batch
+func (m *mockCountDB) sums() map[string]int64 {
+	sums := map[string]int64{}
+	for _, b := range m.batches {
+		for i := range b.Keys {
+			sums[b.Metrics[i]+" "+b.Keys[i]] += b.Counts[i]
+		}
+	}
+	return sums
+}
+
+func TestFlush(t *testing.T) {
+	db := &mockCountDB{}
+	r := NewRecorder(db)
+
+	r.Record(MetricPageView, "/app/")
+	r.Record(MetricAPIRequest, "GET /api/chirps")
+	r.Record(MetricPageView, "/app/")
+	r.Record(MetricPageView, "/app/about.html")
+
+	db.err = errors.New("connection refused")
+	if err := r.Flush(context.Background()); err == nil {
+		t.Fatal("Fail: expected the flush to fail")
+	}
+
+	// counts from a failed flush are kept, and added to those recorded since
+	db.err = nil
+	r.Record(MetricPageView, "/app/")
+	if err := r.Flush(context.Background()); err != nil {
+		t.Fatalf("Fail: unexpected error: %v", err)
+	}
+	if len(db.batches) != 1 {
+		t.Fatalf("Fail: expected one batch, got %d", len(db.batches))
+	}
+
+	expected := map[string]int64{"page_view /app/": 3, "page_view /app/about.html": 1, "api_request GET /api/chirps": 1}
+	for k, n := range expected {
+		if db.sums()[k] != n {
+			t.Fatalf("Fail: expected %d for %q, got %v", n, k, db.sums())
+		}
+	}
+
+	b := db.batches[0]
+	for i := 1; i < len(b.Keys); i++ {
+		if b.Minutes[i-1] == b.Minutes[i] && b.Metrics[i-1]+" "+b.Keys[i-1] > b.Metrics[i]+" "+b.Keys[i] {
+			t.Fatalf("Fail: expected the batch to be sorted, got %v %v", b.Metrics, b.Keys)
+		}
+	}
+	if !slices.IsSorted(b.Minutes) {
+		t.Fatalf("Fail: expected the batch to be sorted by minute, got %v", b.Minutes)
+	}
+
+	// nothing is written when nothing was recorded
+	if err := r.Flush(context.Background()); err != nil || len(db.batches) != 1 {
+		t.Fatalf("Fail: expected an empty flush to do nothing, got %d batches and error %v", len(db.batches), err)
+	}
+}
+
+func TestMiddlewarePageViews(t *testing.T) {
+	type testCase struct {
+		testName    string
+		contentType string
+		status      int
+		expected    int64
+	}
+
+	testCases := []testCase{
+		{"html page", "text/html; charset=utf-8", http.StatusOK, 1},
+		{"stylesheet", "text/css; charset=utf-8", http.StatusOK, 0},
+		{"missing page", "text/html; charset=utf-8", http.StatusNotFound, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			db := &mockCountDB{}
+			r := NewRecorder(db)
+			handler := MiddlewarePageViews(r, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.Header().Set("Content-Type", tc.contentType)
+				w.WriteHeader(tc.status)
+			}))
+
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/app/index.html", nil))
+			if err := r.Flush(context.Background()); err != nil {
+				t.Fatalf("Fail: unexpected error: %v", err)
+			}
+
+			if n := db.sums()["page_view /app/index.html"]; n != tc.expected {
+				t.Fatalf("Fail: expected %d page views, got %d", tc.expected, n)
+			}
+		})
+	}
+}
+
+func TestMiddlewareAPIUsage(t *testing.T) {
+	db := &mockCountDB{}
+	r := NewRecorder(db)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/chirps/{chirpID}", func(w http.ResponseWriter, req *http.Request) {})
+	mux.HandleFunc("/app/", func(w http.ResponseWriter, req *http.Request) {})
+	handler := MiddlewareAPIUsage(r, mux)
+
+	for _, path := range []string{"/api/chirps/1", "/api/chirps/2", "/api/nothing-here", "/app/index.html"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	if err := r.Flush(context.Background()); err != nil {
+		t.Fatalf("Fail: unexpected error: %v", err)
+	}
+
+	expected := map[string]int64{"api_request GET /api/chirps/{chirpID}": 2, "api_request " + unmatchedKey: 1}
+	sums := db.sums()
+	if len(sums) != len(expected) {
+		t.Fatalf("Fail: expected %v, got %v", expected, sums)
+	}
+	for k, n := range expected {
+		if sums[k] != n {
+			t.Fatalf("Fail: expected %d for %q, got %v", n, k, sums)
+		}
+	}
+}
+
+type mockImpressionDB struct {
+	batches []database.AddChirpImpressionsParams
+	err     error
+}
+
+func (m *mockImpressionDB) AddChirpImpressions(ctx context.Context, arg database.AddChirpImpressionsParams) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.batches = append(m.batches, arg)
+	return nil
+}
+
+func TestViewerID(t *testing.T) {
+	day := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	id := ViewerID("abcd", uuid.Nil, "192.0.2.1", day)
+
+	if again := ViewerID("abcd", uuid.Nil, "192.0.2.1", day.Add(14*time.Hour)); again != id {
+		t.Fatal("Fail: expected the same viewer to keep their ID all day")
+	}
+	if next := ViewerID("abcd", uuid.Nil, "192.0.2.1", day.Add(24*time.Hour)); next == id {
+		t.Fatal("Fail: expected the viewer's ID to change the next day")
+	}
+	if other := ViewerID("efgh", uuid.Nil, "192.0.2.1", day); other == id {
+		t.Fatal("Fail: expected the ID to depend on the secret")
+	}
+
+	sum := sha256.Sum256([]byte("ip:192.0.2.1"))
+	if id == hex.EncodeToString(sum[:16]) {
+		t.Fatal("Fail: expected the ID not to be a plain hash of the address")
+	}
+}
+
+func TestImpressions(t *testing.T) {
+	db := &mockImpressionDB{}
+	im := NewImpressions(db)
+	first, second := uuid.New(), uuid.New()
+	now := time.Now()
+	alice, bob := ViewerID("abcd", uuid.New(), "192.0.2.1", now), ViewerID("abcd", uuid.Nil, "192.0.2.1", now)
+
+	im.Record(alice, first, second)
+	im.Record(alice, first)
+	im.Record(bob, first)
+
+	db.err = errors.New("connection refused")
+	if err := im.Flush(context.Background()); err == nil {
+		t.Fatal("Fail: expected the flush to fail")
+	}
+
+	// the failed batch is kept, and seeing the same chirp again adds nothing to it
+	db.err = nil
+	im.Record(bob, first)
+	if err := im.Flush(context.Background()); err != nil {
+		t.Fatalf("Fail: unexpected error: %v", err)
+	}
+	if len(db.batches) != 1 {
+		t.Fatalf("Fail: expected one batch, got %d", len(db.batches))
+	}
+
+	seen := map[string]int{}
+	for i, chirpID := range db.batches[0].ChirpIds {
+		seen[chirpID.String()+" "+db.batches[0].Viewers[i]]++
+	}
+	expected := map[string]int{first.String() + " " + alice: 1, second.String() + " " + alice: 1, first.String() + " " + bob: 1}
+	if !maps.Equal(seen, expected) {
+		t.Fatalf("Fail: expected each viewer once per chirp, got %v", seen)
+	}
+}
@@ -0,0 +1,126 @@
+package analytics
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// impressionWindow is how long a viewer counts once per chirp, however often it is shown to them. It is
+// the hour that AddChirpImpressions stores impressions by.
+const impressionWindow = time.Hour
+
+type impressionAdder interface {
+	AddChirpImpressions(ctx context.Context, arg database.AddChirpImpressionsParams) error
+}
+
+type impression struct {
+	// window is the Unix time divided by the window length
+	window  int64
+	chirpID uuid.UUID
+	viewer  string
+}
+
+// Impressions collects which viewers were shown which chirps until they are flushed. Repeats within a
+// window are dropped here first, and the database drops those seen by other servers.
+type Impressions struct {
+	db impressionAdder
+
+	mu      sync.Mutex
+	pending map[impression]struct{}
+	dropped int64
+}
+
+func NewImpressions(db impressionAdder) *Impressions {
+	return &Impressions{db: db, pending: map[impression]struct{}{}}
+}
+
+// ViewerID identifies a viewer without storing who they are. Logged-out viewers are told apart by IP
+// address. The ID is keyed with secret, so it cannot be reversed by hashing every IP address, and
+// changes each UTC day, so one viewer's impressions cannot be linked across days. Impression windows
+// never span midnight, so this does not count anyone twice.
+func ViewerID(secret string, userID uuid.UUID, ip string, at time.Time) string {
+	id := "ip:" + ip
+	if userID != uuid.Nil {
+		id = "user:" + userID.String()
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("chirp-impression-viewer:" + at.UTC().Format(time.DateOnly) + ":" + id))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// Record notes that viewer was shown each of chirpIDs
+func (im *Impressions) Record(viewer string, chirpIDs ...uuid.UUID) {
+	window := time.Now().Unix() / int64(impressionWindow.Seconds())
+
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	for _, chirpID := range chirpIDs {
+		im.add(impression{window: window, chirpID: chirpID, viewer: viewer})
+	}
+}
+
+// add must be called with mu held
+func (im *Impressions) add(i impression) {
+	if _, ok := im.pending[i]; !ok && len(im.pending) >= maxPending {
+		im.dropped++
+		return
+	}
+	im.pending[i] = struct{}{}
+}
+
+// Flush writes every pending impression in one statement. If it fails they are kept for the next flush.
+func (im *Impressions) Flush(ctx context.Context) error {
+	im.mu.Lock()
+	pending, dropped := im.pending, im.dropped
+	im.pending, im.dropped = map[impression]struct{}{}, 0
+	im.mu.Unlock()
+
+	if dropped > 0 {
+		log.Printf("Warning: dropped %d chirp impressions while too many were waiting to be flushed", dropped)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	batch := make([]impression, 0, len(pending))
+	for i := range pending {
+		batch = append(batch, i)
+	}
+	// sorted, so the rows are always written in the same order
+	slices.SortFunc(batch, func(a, b impression) int {
+		return cmp.Or(bytes.Compare(a.chirpID[:], b.chirpID[:]), cmp.Compare(a.window, b.window), cmp.Compare(a.viewer, b.viewer))
+	})
+
+	params := database.AddChirpImpressionsParams{}
+	for _, i := range batch {
+		params.ChirpIds = append(params.ChirpIds, i.chirpID)
+		params.Hours = append(params.Hours, i.window)
+		params.Viewers = append(params.Viewers, i.viewer)
+	}
+
+	if err := im.db.AddChirpImpressions(ctx, params); err != nil {
+		im.mu.Lock()
+		for i := range pending {
+			im.add(i)
+		}
+		im.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Run flushes every interval until ctx is cancelled. The caller should Flush once more after that.
+func (im *Impressions) Run(ctx context.Context, interval time.Duration) {
+	flushEvery(ctx, interval, "chirp impressions", im.Flush)
+}
@@ -0,0 +1,189 @@
+// Package audit keeps an append-only record of security and admin actions. Every event is written in the
+// same transaction as the action it describes and carries the hash of the event before it, so an event
+// that is edited or removed afterwards breaks the chain.
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/clientip"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	ActionLogin           = "user.login"
+	ActionLoginFailed     = "user.login_failed"
+	ActionLogout          = "user.logout"
+	ActionPasswordChange  = "user.password_change"
+	ActionPasswordReset   = "user.password_reset"
+	ActionMFAEnable       = "user.mfa_enable"
+	ActionAccountDeletion = "user.deletion_scheduled"
+	ActionUpgrade         = "user.upgrade"
+	ActionTokenRevoke     = "token.revoke"
+	ActionChirpDelete     = "chirp.delete"
+
+	ActionReset            = "admin.reset"
+	ActionUnlock           = "admin.unlock"
+	ActionRoleChange       = "admin.role_change"
+	ActionSuspend          = "admin.suspend"
+	ActionLiftSuspension   = "admin.lift_suspension"
+	ActionResolveReport    = "admin.resolve_report"
+	ActionFilterRuleCreate = "admin.filter_rule_create"
+	ActionFilterRuleDelete = "admin.filter_rule_delete"
+
+	ActionForcePasswordReset  = "admin.force_password_reset"
+	ActionRevokeSessions      = "admin.revoke_sessions"
+	ActionSetChirpyRed        = "admin.set_chirpy_red"
+	ActionImpersonate         = "admin.impersonate"
+	ActionImpersonatedRequest = "admin.impersonated_request"
+)
+
+const (
+	TargetUser           = "user"
+	TargetChirp          = "chirp"
+	TargetRefreshToken   = "refresh_token"
+	TargetPersonalToken  = "personal_access_token"
+	TargetModerationCase = "moderation_case"
+	TargetFilterRule     = "filter_rule"
+)
+
+const (
+	requestIDHeader    = "X-Request-ID"
+	maxRequestIDLength = 64
+)
+
+// Event is an action about to be recorded. The IP and request ID are taken from the request context.
+type Event struct {
+	// ActorID is the user who acted, or uuid.Nil for anonymous requests and webhooks
+	ActorID    uuid.UUID
+	Action     string
+	TargetType string
+	TargetID   string
+	Metadata   map[string]string
+}
+
+type requestInfoKey struct{}
+
+type impersonatorKey struct{}
+
+type requestInfo struct {
+	id string
+	ip string
+}
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// MiddlewareRequestID gives every request an ID, keeping one sent in X-Request-ID if it is well formed,
+// and echoes it on the response so a client can quote it when reporting a problem
+func MiddlewareRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(requestIDHeader)
+		if len(id) > maxRequestIDLength || !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		ctx := context.WithValue(req.Context(), requestInfoKey{}, requestInfo{id: id, ip: clientip.FromRequest(req)})
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RequestID returns the ID MiddlewareRequestID gave the request, or "" outside of a request
+func RequestID(ctx context.Context) string {
+	info, _ := ctx.Value(requestInfoKey{}).(requestInfo)
+	return info.id
+}
+
+func clientIP(ctx context.Context) string {
+	info, _ := ctx.Value(requestInfoKey{}).(requestInfo)
+	return info.ip
+}
+
+// WithImpersonator marks ctx as belonging to a request made by impersonatorID with an impersonation token.
+// Every event recorded with it names them in its metadata, whoever its actor is.
+func WithImpersonator(ctx context.Context, impersonatorID uuid.UUID) context.Context {
+	return context.WithValue(ctx, impersonatorKey{}, impersonatorID)
+}
+
+func impersonator(ctx context.Context) uuid.UUID {
+	id, _ := ctx.Value(impersonatorKey{}).(uuid.UUID)
+	return id
+}
+
+// marshalMetadata encodes metadata the same way every time, as map keys are sorted
+func marshalMetadata(metadata map[string]string) []byte {
+	if len(metadata) == 0 {
+		return []byte("{}")
+	}
+	// a map of strings always marshals
+	data, _ := json.Marshal(metadata)
+	return data
+}
+
+// Hash computes the hash of an event from the hash before it and every other column. The metadata is
+// re-encoded first, as Postgres does not keep JSONB in the form it was written.
+func Hash(e database.AuditEvent) string {
+	var metadata map[string]string
+	if err := json.Unmarshal(e.Metadata, &metadata); err != nil {
+		metadata = nil
+	}
+
+	actor := ""
+	if e.ActorID.Valid {
+		actor = e.ActorID.UUID.String()
+	}
+
+	fields := []string{
+		e.PrevHash,
+		strconv.FormatInt(e.Seq, 10),
+		e.CreatedAt.UTC().Format("2006-01-02T15:04:05.000000Z"),
+		actor,
+		e.Action,
+		e.TargetType,
+		e.TargetID,
+		e.Ip,
+		e.RequestID,
+		string(marshalMetadata(metadata)),
+	}
+
+	h := sha256.New()
+	for _, f := range fields {
+		// length prefixes keep one field from running into the next
+		h.Write([]byte(strconv.Itoa(len(f))))
+		h.Write([]byte{':'})
+		h.Write([]byte(f))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Verify checks that events, in ascending order, continue a chain whose last event had sequence number
+// prevSeq and hash prevHash. It returns the sequence number of the first event that does not, and false.
+func Verify(prevSeq int64, prevHash string, events []database.AuditEvent) (int64, bool) {
+	for _, e := range events {
+		if e.Seq != prevSeq+1 || e.PrevHash != prevHash || Hash(e) != e.Hash {
+			return e.Seq, false
+		}
+		prevSeq, prevHash = e.Seq, e.Hash
+	}
+	return 0, true
+}
+
+// now is when an event is recorded, to the precision Postgres keeps, so the hash survives the round trip
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
@@ -0,0 +1,137 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// chain builds n events linked the way Store.append links them
+func chain(n int) []database.AuditEvent {
+	events := []database.AuditEvent{}
+	prevHash := ""
+	for i := range n {
+		e := database.AuditEvent{
+			Seq:        int64(i + 1),
+			CreatedAt:  now(),
+			ActorID:    uuid.NullUUID{UUID: uuid.New(), Valid: true},
+			Action:     ActionLogin,
+			TargetType: TargetUser,
+			TargetID:   uuid.NewString(),
+			Ip:         "203.0.113.7",
+			RequestID:  newRequestID(),
+			Metadata:   marshalMetadata(map[string]string{"session": "cookie", "attempt": "1"}),
+			PrevHash:   prevHash,
+		}
+		e.Hash = Hash(e)
+		prevHash = e.Hash
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestVerify(t *testing.T) {
+	type testCase struct {
+		testName       string
+		tamper         func([]database.AuditEvent) []database.AuditEvent
+		expectedValid  bool
+		expectedBroken int64
+	}
+
+	testCases := []testCase{
+		{"untouched", func(e []database.AuditEvent) []database.AuditEvent { return e }, true, 0},
+		{"metadata stored in another form", func(e []database.AuditEvent) []database.AuditEvent {
+			// Postgres reorders JSONB keys and adds spaces
+			e[2].Metadata = json.RawMessage(`{"attempt": "1", "session": "cookie"}`)
+			return e
+		}, true, 0},
+		{"edited action", func(e []database.AuditEvent) []database.AuditEvent {
+			e[2].Action = ActionLogout
+			return e
+		}, false, 3},
+		{"edited metadata", func(e []database.AuditEvent) []database.AuditEvent {
+			e[1].Metadata = json.RawMessage(`{"session": "token"}`)
+			return e
+		}, false, 2},
+		{"rehashed after editing", func(e []database.AuditEvent) []database.AuditEvent {
+			e[1].Ip = "198.51.100.1"
+			e[1].Hash = Hash(e[1])
+			return e
+		}, false, 3},
+		{"removed event", func(e []database.AuditEvent) []database.AuditEvent {
+			return slices.Delete(e, 2, 3)
+		}, false, 4},
+		{"swapped events", func(e []database.AuditEvent) []database.AuditEvent {
+			e[1], e[2] = e[2], e[1]
+			return e
+		}, false, 3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			brokenAt, ok := Verify(0, "", tc.tamper(chain(5)))
+			if ok != tc.expectedValid {
+				t.Fatalf("expected valid %v, got %v", tc.expectedValid, ok)
+			}
+			if brokenAt != tc.expectedBroken {
+				t.Fatalf("expected the chain to break at %d, got %d", tc.expectedBroken, brokenAt)
+			}
+		})
+	}
+}
+
+func TestHashSurvivesTimeZone(t *testing.T) {
+	e := chain(1)[0]
+	e.CreatedAt = e.CreatedAt.In(time.FixedZone("", 0))
+	if Hash(e) != e.Hash {
+		t.Fatal("expected the hash not to depend on the location of created_at")
+	}
+}
+
+func TestMiddlewareRequestID(t *testing.T) {
+	type testCase struct {
+		testName string
+		sent     string
+		kept     bool
+	}
+
+	testCases := []testCase{
+		{"none sent", "", false},
+		{"well formed", "req-123.abc_DEF", true},
+		{"spaces", "req 123", false},
+		{"too long", string(make([]byte, maxRequestIDLength+1)), false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			var seenID, seenIP string
+			handler := MiddlewareRequestID(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				seenID, seenIP = RequestID(req.Context()), clientIP(req.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/healthz", nil)
+			req.RemoteAddr = "203.0.113.7:5123"
+			if tc.sent != "" {
+				req.Header.Set(requestIDHeader, tc.sent)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if seenID == "" || w.Header().Get(requestIDHeader) != seenID {
+				t.Fatalf("expected the request ID %q to be echoed, got %q", seenID, w.Header().Get(requestIDHeader))
+			}
+			if (seenID == tc.sent) != tc.kept {
+				t.Fatalf("expected kept %v, got ID %q", tc.kept, seenID)
+			}
+			if seenIP != "203.0.113.7" {
+				t.Fatalf("expected the client IP without its port, got %q", seenIP)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type txKey struct{}
+
+// contextDB runs queries in the transaction carried by their context, if there is one, so the same
+// Queries can be used inside and outside RecordAudit
+type contextDB struct {
+	db *sql.DB
+}
+
+func (c contextDB) conn(ctx context.Context) database.DBTX {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return c.db
+}
+
+func (c contextDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return c.conn(ctx).ExecContext(ctx, query, args...)
+}
+
+func (c contextDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return c.conn(ctx).PrepareContext(ctx, query)
+}
+
+func (c contextDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return c.conn(ctx).QueryContext(ctx, query, args...)
+}
+
+func (c contextDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return c.conn(ctx).QueryRowContext(ctx, query, args...)
+}
+
+// Store is the database used by the server. It has every query, plus RecordAudit.
+type Store struct {
+	*database.Queries
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{Queries: database.New(contextDB{db: db}), db: db}
+}
+
+// PingContext checks that the database can still be reached
+func (s *Store) PingContext(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// RecordAudit runs action and records event in one transaction, so neither happens without the other.
+// Queries made with the context passed to action run in the transaction. If action fails the
+// transaction is rolled back and its error is returned unwrapped. A nil action only records the event.
+func (s *Store) RecordAudit(ctx context.Context, event Event, action func(ctx context.Context) error) error {
+	// already inside RecordAudit, so the outer call commits
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return s.runAndAppend(ctx, event, action)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %v", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := s.runAndAppend(context.WithValue(ctx, txKey{}, tx), event, action); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit transaction: %v", err)
+	}
+	return nil
+}
+
+func (s *Store) runAndAppend(ctx context.Context, event Event, action func(ctx context.Context) error) error {
+	if action != nil {
+		if err := action(ctx); err != nil {
+			return err
+		}
+	}
+	if err := s.append(ctx, event); err != nil {
+		return fmt.Errorf("could not record audit event %s: %v", event.Action, err)
+	}
+	return nil
+}
+
+// append adds event to the end of the chain. The advisory lock makes concurrent transactions take turns,
+// so no two events can claim the same predecessor.
+func (s *Store) append(ctx context.Context, event Event) error {
+	if err := s.LockAuditLog(ctx); err != nil {
+		return err
+	}
+
+	latest, err := s.GetLatestAuditEvent(ctx)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	if id := impersonator(ctx); id != uuid.Nil {
+		// copied, as the caller's map is not ours to change
+		metadata := map[string]string{}
+		maps.Copy(metadata, event.Metadata)
+		metadata["impersonator_id"] = id.String()
+		event.Metadata = metadata
+	}
+
+	row := database.AuditEvent{
+		Seq:        latest.Seq + 1,
+		CreatedAt:  now(),
+		Action:     event.Action,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+		Ip:         clientIP(ctx),
+		RequestID:  RequestID(ctx),
+		Metadata:   marshalMetadata(event.Metadata),
+		PrevHash:   latest.Hash,
+	}
+	if event.ActorID != uuid.Nil {
+		row.ActorID = uuid.NullUUID{UUID: event.ActorID, Valid: true}
+	}
+	row.Hash = Hash(row)
+
+	return s.InsertAuditEvent(ctx, database.InsertAuditEventParams(row))
+}
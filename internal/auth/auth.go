@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/alexedwards/argon2id"
@@ -15,8 +16,24 @@ import (
 	"github.com/google/uuid"
 )
 
+var hashParams atomic.Pointer[argon2id.Params]
+
+func init() {
+	hashParams.Store(argon2id.DefaultParams)
+}
+
+// SetHashParams changes the argon2id parameters used for new hashes.
+// Existing hashes keep verifying, and NeedsRehash reports them as outdated.
+func SetHashParams(params *argon2id.Params) {
+	hashParams.Store(params)
+}
+
+func HashParams() *argon2id.Params {
+	return hashParams.Load()
+}
+
 func HashPassword(password string) (string, error) {
-	hashedPassword, err := argon2id.CreateHash(password, argon2id.DefaultParams)
+	hashedPassword, err := argon2id.CreateHash(password, hashParams.Load())
 	if err != nil {
 		return "", fmt.Errorf("could not hash passsword: %v", err)
 	}
@@ -24,6 +41,49 @@ func HashPassword(password string) (string, error) {
 	return hashedPassword, nil
 }
 
+// NeedsRehash reports whether hash was made with weaker parameters than the current ones. A hash
+// that is already as strong in every respect is kept, so lowering the cost never weakens stored
+// hashes. Parallelism only changes how the work is split, so it does not count.
+func NeedsRehash(hash string) bool {
+	stored, salt, key, err := argon2id.DecodeHash(hash)
+	if err != nil {
+		return false
+	}
+
+	current := hashParams.Load()
+	return stored.Memory < current.Memory ||
+		stored.Iterations < current.Iterations ||
+		uint32(len(salt)) < current.SaltLength ||
+		uint32(len(key)) < current.KeyLength
+}
+
+// CalibrateHashParams raises the iteration count at the given memory cost and parallelism
+// until hashing takes at least target on this machine
+func CalibrateHashParams(target time.Duration, memoryKiB uint32, parallelism uint8) (*argon2id.Params, error) {
+	const maxIterations = 64
+
+	params := &argon2id.Params{
+		Memory:      memoryKiB,
+		Iterations:  1,
+		Parallelism: parallelism,
+		SaltLength:  argon2id.DefaultParams.SaltLength,
+		KeyLength:   argon2id.DefaultParams.KeyLength,
+	}
+
+	for ; params.Iterations < maxIterations; params.Iterations++ {
+		start := time.Now()
+		if _, err := argon2id.CreateHash("calibration password", params); err != nil {
+			return nil, fmt.Errorf("could not hash during calibration: %v", err)
+		}
+
+		if time.Since(start) >= target {
+			break
+		}
+	}
+
+	return params, nil
+}
+
 func CheckPasswordHash(password, hash string) (bool, error) {
 	ok, err := argon2id.ComparePasswordAndHash(password, hash)
 	if err != nil {
@@ -33,13 +93,152 @@ func CheckPasswordHash(password, hash string) (bool, error) {
 	return ok, nil
 }
 
+const (
+	accessTokenIssuer  = "chirpy"
+	mfaChallengeIssuer = "chirpy-mfa"
+
+	AccessTokenTTL        = time.Hour
+	ImpersonationTokenTTL = 15 * time.Minute
+	mfaChallengeTTL       = 5 * time.Minute
+)
+
+type accessClaims struct {
+	jwt.RegisteredClaims
+	// Scope and ClientID are only set on tokens issued to third-party OAuth clients
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	// Act is only set on impersonation tokens, and names the staff member acting as the subject (RFC 8693)
+	Act *actorClaim `json:"act,omitempty"`
+}
+
+type actorClaim struct {
+	Subject string `json:"sub"`
+}
+
+// AccessToken is what a validated access JWT says about its bearer
+type AccessToken struct {
+	UserID uuid.UUID
+	// ClientID is uuid.Nil for first-party session tokens
+	ClientID uuid.UUID
+	// Scopes is nil for first-party session tokens, which may do anything their user can
+	Scopes []string
+	// ImpersonatorID is the staff member acting as UserID, or uuid.Nil if the user is acting for themselves
+	ImpersonatorID uuid.UUID
+	IssuedAt       time.Time
+	ExpiresAt      time.Time
+}
+
 func MakeJWT(userID uuid.UUID, tokenSecret string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    "chirpy",
+	return makeJWT(newClaims(userID, accessTokenIssuer, AccessTokenTTL), tokenSecret)
+}
+
+// MakeClientJWT issues an access token to a third-party OAuth client, limited to scopes
+func MakeClientJWT(userID, clientID uuid.UUID, scopes []string, tokenSecret string) (string, error) {
+	claims := newClaims(userID, accessTokenIssuer, AccessTokenTTL)
+	claims.ClientID = clientID.String()
+	claims.Scope = FormatScopes(scopes)
+	return makeJWT(claims, tokenSecret)
+}
+
+// MakeImpersonationJWT issues a short-lived token that lets impersonatorID act as userID for support.
+// It holds every scope but is not a session token, so ValidateJWT refuses it and it cannot change
+// the account's credentials or manage its tokens.
+func MakeImpersonationJWT(userID, impersonatorID uuid.UUID, tokenSecret string) (string, error) {
+	claims := newClaims(userID, accessTokenIssuer, ImpersonationTokenTTL)
+	claims.Act = &actorClaim{Subject: impersonatorID.String()}
+	claims.Scope = FormatScopes(AllScopes)
+	return makeJWT(claims, tokenSecret)
+}
+
+// ValidateJWT only accepts first-party session tokens. Tokens issued to OAuth clients are scoped,
+// so they must go through ParseAccessToken and have their scopes checked, as must impersonation tokens.
+func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+	token, err := ParseAccessToken(tokenString, tokenSecret)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+
+	if token.ClientID != uuid.Nil {
+		return uuid.UUID{}, errors.New("token was issued to a third-party client")
+	}
+
+	if token.ImpersonatorID != uuid.Nil {
+		return uuid.UUID{}, errors.New("token impersonates its user")
+	}
+
+	return token.UserID, nil
+}
+
+// ParseAccessToken validates any access JWT, first-party or issued to an OAuth client
+func ParseAccessToken(tokenString, tokenSecret string) (AccessToken, error) {
+	claims, err := parseJWTWithIssuer(tokenString, tokenSecret, accessTokenIssuer)
+	if err != nil {
+		return AccessToken{}, err
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return AccessToken{}, fmt.Errorf("could not parse subject field to UUID: %v", err)
+	}
+
+	token := AccessToken{
+		UserID:    userID,
+		IssuedAt:  claims.IssuedAt.Time,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+
+	if claims.ClientID != "" {
+		if token.ClientID, err = uuid.Parse(claims.ClientID); err != nil {
+			return AccessToken{}, fmt.Errorf("could not parse client_id field to UUID: %v", err)
+		}
+	}
+
+	if claims.Act != nil {
+		if token.ImpersonatorID, err = uuid.Parse(claims.Act.Subject); err != nil {
+			return AccessToken{}, fmt.Errorf("could not parse act field to UUID: %v", err)
+		}
+	}
+
+	if claims.ClientID != "" || claims.Act != nil {
+		token.Scopes = strings.Fields(claims.Scope)
+		if token.Scopes == nil {
+			token.Scopes = []string{}
+		}
+	}
+
+	return token, nil
+}
+
+// MakeMFAChallengeJWT issues a short-lived token proving the password step of login succeeded.
+// It cannot be used as an access token.
+func MakeMFAChallengeJWT(userID uuid.UUID, tokenSecret string) (string, error) {
+	return makeJWT(newClaims(userID, mfaChallengeIssuer, mfaChallengeTTL), tokenSecret)
+}
+
+func ValidateMFAChallengeJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+	claims, err := parseJWTWithIssuer(tokenString, tokenSecret, mfaChallengeIssuer)
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("could not parse subject field to UUID: %v", err)
+	}
+	return userID, nil
+}
+
+func newClaims(userID uuid.UUID, issuer string, ttl time.Duration) *accessClaims {
+	return &accessClaims{RegisteredClaims: jwt.RegisteredClaims{
+		Issuer:    issuer,
 		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(time.Hour)),
+		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(ttl)),
 		Subject:   userID.String(),
-	})
+	}}
+}
+
+func makeJWT(claims *accessClaims, tokenSecret string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	tokenString, err := token.SignedString([]byte(tokenSecret))
 	if err != nil {
@@ -49,10 +248,10 @@ func MakeJWT(userID uuid.UUID, tokenSecret string) (string, error) {
 	return tokenString, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+func parseJWTWithIssuer(tokenString, tokenSecret, issuer string) (*accessClaims, error) {
 	token, err := jwt.ParseWithClaims(
 		tokenString,
-		&jwt.RegisteredClaims{},
+		&accessClaims{},
 		func(token *jwt.Token) (any, error) {
 			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 				return nil, errors.New("unexpected signing method")
@@ -61,20 +260,21 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 		})
 
 	if err != nil {
-		return uuid.UUID{}, fmt.Errorf("could not parse token: %v", err)
+		return nil, fmt.Errorf("could not parse token: %v", err)
 	} else if !token.Valid {
-		return uuid.UUID{}, errors.New("token is invalid")
+		return nil, errors.New("token is invalid")
 	}
 
-	if claims, ok := token.Claims.(*jwt.RegisteredClaims); ok {
-		userID, err := uuid.Parse(claims.Subject)
-		if err != nil {
-			return uuid.UUID{}, fmt.Errorf("could not parse subject field to UUID: %v", err)
-		}
-		return userID, nil
+	claims, ok := token.Claims.(*accessClaims)
+	if !ok {
+		return nil, errors.New("unknown claims type, cannot proceed")
+	}
+
+	if !claims.VerifyIssuer(issuer, true) {
+		return nil, fmt.Errorf("unexpected token issuer %q", claims.Issuer)
 	}
 
-	return uuid.UUID{}, errors.New("unknown claims type, cannot proceed")
+	return claims, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -2,8 +2,13 @@ package auth
 
 import (
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/alexedwards/argon2id"
 	"github.com/google/uuid"
 )
 
@@ -157,3 +162,249 @@ func TestGetBearerToken(t *testing.T) {
 		})
 	}
 }
+
+func TestLockoutPolicy(t *testing.T) {
+	policy := LockoutPolicy{Threshold: 3, BaseLock: time.Minute, MaxLock: 5 * time.Minute}
+
+	type testCase struct {
+		failures     int
+		expectedLock time.Duration
+	}
+
+	testCases := []testCase{
+		{0, 0},
+		{2, 0},
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{5, 4 * time.Minute},
+		{6, 5 * time.Minute},
+		{50, 5 * time.Minute},
+	}
+
+	for _, tc := range testCases {
+		if lock := policy.LockDuration(tc.failures); lock != tc.expectedLock {
+			t.Fatalf("Fail: expected %d failures to lock for %v but received %v", tc.failures, tc.expectedLock, lock)
+		}
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	original := HashParams()
+	defer SetHashParams(original)
+
+	weak := &argon2id.Params{Memory: 8 * 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	SetHashParams(weak)
+	hash, _ := HashPassword("pa$$word")
+	if NeedsRehash(hash) {
+		t.Fatal("Fail: hash made with the current params reported as outdated")
+	}
+
+	stronger := *weak
+	stronger.Iterations = 2
+	SetHashParams(&stronger)
+	if !NeedsRehash(hash) {
+		t.Fatal("Fail: hash made with old params not reported as outdated")
+	}
+
+	if ok, _ := CheckPasswordHash("pa$$word", hash); !ok {
+		t.Fatal("Fail: hash made with old params no longer verifies")
+	}
+
+	strongHash, _ := HashPassword("pa$$word")
+	SetHashParams(weak)
+	if NeedsRehash(strongHash) {
+		t.Fatal("Fail: hash made with stronger params reported as outdated")
+	}
+
+	otherParallelism := *weak
+	otherParallelism.Parallelism = 4
+	SetHashParams(&otherParallelism)
+	if NeedsRehash(hash) {
+		t.Fatal("Fail: hash reported as outdated for a different parallelism alone")
+	}
+}
+
+func TestCalibrateHashParams(t *testing.T) {
+	params, err := CalibrateHashParams(time.Millisecond, 8*1024, 1)
+	if err != nil {
+		t.Fatalf("Error: could not calibrate: %v", err)
+	}
+
+	if params.Memory != 8*1024 || params.Parallelism != 1 || params.Iterations < 1 {
+		t.Fatalf("Fail: unexpected calibrated params %+v", params)
+	}
+}
+
+func TestVerifyPKCE(t *testing.T) {
+	// challenge computed independently with openssl dgst -sha256 and base64url
+	const (
+		verifier  = "dBjftJeZ4CVP-mJ92K9TnDZ6ca7mxlPR3vQ2RxNF5nH8"
+		challenge = "la3lhEpUiTfEQHhgidMNxLID-4ZHLQS3bEA_1DXa6ew"
+	)
+
+	type testCase struct {
+		testName   string
+		verifier   string
+		expectedOK bool
+	}
+
+	testCases := []testCase{
+		{"matching verifier", verifier, true},
+		{"wrong verifier", verifier[:len(verifier)-1] + "9", false},
+		{"too short", "abc", false},
+		{"illegal characters", verifier[:len(verifier)-1] + "/", false},
+	}
+
+	if got := PKCEChallenge(verifier); got != challenge {
+		t.Fatalf("Fail: expected challenge %s but received %s", challenge, got)
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			if ok := VerifyPKCE(tc.verifier, challenge); ok != tc.expectedOK {
+				t.Fatalf("Fail: expected ok=%v but received %v", tc.expectedOK, ok)
+			}
+		})
+	}
+}
+
+func TestClientJWTIsScoped(t *testing.T) {
+	const secret = "abcd"
+	userID, clientID := uuid.New(), uuid.New()
+
+	token, err := MakeClientJWT(userID, clientID, []string{ScopeChirpsRead}, secret)
+	if err != nil {
+		t.Fatalf("Error: could not make client JWT: %v", err)
+	}
+
+	if _, err := ValidateJWT(token, secret); err == nil {
+		t.Fatal("Fail: client token was accepted as a first-party session token")
+	}
+
+	parsed, err := ParseAccessToken(token, secret)
+	if err != nil {
+		t.Fatalf("Fail: could not parse client token: %v", err)
+	}
+	if parsed.UserID != userID || parsed.ClientID != clientID || len(parsed.Scopes) != 1 || parsed.Scopes[0] != ScopeChirpsRead {
+		t.Fatalf("Fail: unexpected claims %+v", parsed)
+	}
+
+	session, _ := MakeJWT(userID, secret)
+	parsed, err = ParseAccessToken(session, secret)
+	if err != nil || parsed.Scopes != nil || parsed.ClientID != uuid.Nil {
+		t.Fatalf("Fail: session token should be unscoped, got %+v, %v", parsed, err)
+	}
+}
+
+func TestImpersonationJWTIsNotASession(t *testing.T) {
+	const secret = "abcd"
+	userID, staffID := uuid.New(), uuid.New()
+
+	token, err := MakeImpersonationJWT(userID, staffID, secret)
+	if err != nil {
+		t.Fatalf("Error: could not make impersonation JWT: %v", err)
+	}
+
+	if _, err := ValidateJWT(token, secret); err == nil {
+		t.Fatal("Fail: impersonation token was accepted as a first-party session token")
+	}
+
+	parsed, err := ParseAccessToken(token, secret)
+	if err != nil {
+		t.Fatalf("Fail: could not parse impersonation token: %v", err)
+	}
+	if parsed.UserID != userID || parsed.ImpersonatorID != staffID || parsed.ClientID != uuid.Nil || len(parsed.Scopes) != len(AllScopes) {
+		t.Fatalf("Fail: unexpected claims %+v", parsed)
+	}
+	if parsed.ExpiresAt.Sub(parsed.IssuedAt) != ImpersonationTokenTTL {
+		t.Fatalf("Fail: expected the token to last %v, got %v", ImpersonationTokenTTL, parsed.ExpiresAt.Sub(parsed.IssuedAt))
+	}
+
+	session, _ := MakeJWT(userID, secret)
+	if parsed, err := ParseAccessToken(session, secret); err != nil || parsed.ImpersonatorID != uuid.Nil {
+		t.Fatalf("Fail: session token should not name an impersonator, got %+v, %v", parsed, err)
+	}
+}
+
+func TestSignedURL(t *testing.T) {
+	const (
+		path   = "/api/exports/123/download"
+		secret = "abcd"
+	)
+
+	query := func(signed string) url.Values {
+		u, err := url.Parse(signed)
+		if err != nil {
+			t.Fatalf("Error: could not parse signed url: %v", err)
+		}
+		return u.Query()
+	}
+
+	valid := query(SignURL(path, time.Now().Add(time.Hour), secret))
+	tampered := query(SignURL(path, time.Now().Add(time.Hour), secret))
+	tampered.Set("expires", "9999999999")
+
+	type testCase struct {
+		testName    string
+		path        string
+		query       url.Values
+		secret      string
+		expectedErr bool
+	}
+
+	testCases := []testCase{
+		{"valid link", path, valid, secret, false},
+		{"different path", "/api/exports/456/download", valid, secret, true},
+		{"extended expiry", path, tampered, secret, true},
+		{"wrong secret", path, valid, "wrong", true},
+		{"expired link", path, query(SignURL(path, time.Now().Add(-time.Second), secret)), secret, true},
+		{"missing signature", path, url.Values{}, secret, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			err := ValidateSignedURL(tc.path, tc.query, tc.secret)
+			if (err != nil) != tc.expectedErr {
+				t.Fatalf("Fail: expected error=%v but received %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestConfirmationToken(t *testing.T) {
+	const (
+		action = "reset:tables=chirps"
+		secret = "abcd"
+	)
+
+	valid := MakeConfirmationToken(action, time.Now().Add(time.Minute), secret)
+	expiry, signature, _ := strings.Cut(valid, ".")
+	extended := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10) + "." + signature
+
+	type testCase struct {
+		testName    string
+		token       string
+		action      string
+		secret      string
+		expectedErr bool
+	}
+
+	testCases := []testCase{
+		{"valid token", valid, action, secret, false},
+		{"different action", valid, "reset:all", secret, true},
+		{"wrong secret", valid, action, "wrong", true},
+		{"extended expiry", extended, action, secret, true},
+		{"expired token", MakeConfirmationToken(action, time.Now().Add(-time.Second), secret), action, secret, true},
+		{"no signature", expiry, action, secret, true},
+		{"empty token", "", action, secret, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			err := ValidateConfirmationToken(tc.token, tc.action, tc.secret)
+			if (err != nil) != tc.expectedErr {
+				t.Fatalf("Fail: expected error=%v but received %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MakeConfirmationToken returns a token that confirms action until expiresAt. Destructive admin actions
+// are asked for twice: the first request describes what would happen and returns a token, and only a
+// second request carrying that token does it.
+func MakeConfirmationToken(action string, expiresAt time.Time, tokenSecret string) string {
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	return expires + "." + signConfirmation(action, expires, tokenSecret)
+}
+
+// ValidateConfirmationToken checks that token was made for exactly action and has not expired
+func ValidateConfirmationToken(token, action, tokenSecret string) error {
+	expires, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return errors.New("malformed confirmation token")
+	}
+
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return errors.New("malformed confirmation token")
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(signConfirmation(action, expires, tokenSecret))) {
+		return errors.New("confirmation token is for a different action")
+	}
+
+	if time.Now().After(time.Unix(unix, 0)) {
+		return errors.New("confirmation token has expired")
+	}
+
+	return nil
+}
+
+func signConfirmation(action, expires, tokenSecret string) string {
+	mac := hmac.New(sha256.New, []byte(tokenSecret))
+	mac.Write([]byte("confirm:" + action + ":" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"strings"
+	"time"
+)
+
+// LockoutPolicy describes how long a throttle key is locked after repeated authentication failures.
+// Each failure past the threshold doubles the lock, up to MaxLock.
+type LockoutPolicy struct {
+	Threshold int
+	BaseLock  time.Duration
+	MaxLock   time.Duration
+}
+
+var (
+	AccountLockoutPolicy = LockoutPolicy{Threshold: 5, BaseLock: 30 * time.Second, MaxLock: time.Hour}
+	IPLockoutPolicy      = LockoutPolicy{Threshold: 20, BaseLock: time.Minute, MaxLock: time.Hour}
+
+	// magic links are rate limited on every request, not just failures, as each one sends an email
+	MagicLinkEmailPolicy = LockoutPolicy{Threshold: 3, BaseLock: 15 * time.Minute, MaxLock: time.Hour}
+	MagicLinkIPPolicy    = LockoutPolicy{Threshold: 10, BaseLock: 15 * time.Minute, MaxLock: time.Hour}
+)
+
+func (p LockoutPolicy) LockDuration(failures int) time.Duration {
+	if failures < p.Threshold {
+		return 0
+	}
+
+	lock := p.BaseLock
+	for i := p.Threshold; i < failures; i++ {
+		lock *= 2
+		if lock >= p.MaxLock {
+			return p.MaxLock
+		}
+	}
+
+	return lock
+}
+
+// LoginAccountThrottleKey is keyed on the submitted email rather than a user ID,
+// so unknown addresses lock out exactly like real ones and responses cannot be used to enumerate accounts
+func LoginAccountThrottleKey(email string) string {
+	return "login:email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func LoginIPThrottleKey(ip string) string {
+	return "login:ip:" + ip
+}
+
+func MagicLinkEmailThrottleKey(email string) string {
+	return "magic:email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func MagicLinkIPThrottleKey(ip string) string {
+	return "magic:ip:" + ip
+}
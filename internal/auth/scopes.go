@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	ScopeChirpsRead     = "chirps:read"
+	ScopeChirpsWrite    = "chirps:write"
+	ScopeProfileWrite   = "profile:write"
+	ScopeRelationsWrite = "relations:write"
+
+	PersonalAccessTokenPrefix = "chirpy_pat_"
+)
+
+var AllScopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileWrite, ScopeRelationsWrite}
+
+// PublishingScopes put content in front of other users, which users suspended to read-only may not do.
+// Blocking and muting only protect the user, so they are left out.
+var PublishingScopes = []string{ScopeChirpsWrite, ScopeProfileWrite}
+
+func ValidScope(scope string) bool {
+	return slices.Contains(AllScopes, scope)
+}
+
+// ParseScopes splits an OAuth space-delimited scope string, rejecting unknown scopes
+func ParseScopes(scope string) ([]string, error) {
+	scopes := []string{}
+	for _, s := range strings.Fields(scope) {
+		if !ValidScope(s) {
+			return nil, fmt.Errorf("unknown scope %s", s)
+		}
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes, nil
+}
+
+func FormatScopes(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// MakePersonalAccessToken returns a new random token whose prefix lets the auth layer
+// tell it apart from a JWT without parsing it
+func MakePersonalAccessToken() string {
+	return PersonalAccessTokenPrefix + MakeRefreshToken()
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"database/sql"
+	"slices"
+	"time"
+)
+
+// Kinds of suspension a moderator can place on a user
+const (
+	// SuspensionFull locks the user out entirely and hides their chirps
+	SuspensionFull = "full"
+	// SuspensionReadOnly lets the user log in and read, but not post or change anything
+	SuspensionReadOnly = "read_only"
+	// SuspensionShadowBan lets the user carry on as normal, but hides their chirps from everyone else
+	SuspensionShadowBan = "shadow_ban"
+)
+
+var SuspensionKinds = []string{SuspensionFull, SuspensionReadOnly, SuspensionShadowBan}
+
+func ValidSuspensionKind(kind string) bool {
+	return slices.Contains(SuspensionKinds, kind)
+}
+
+// ActiveSuspension returns the kind of suspension in force at now, or "" if there is none.
+// A suspension with no end date lasts until it is lifted.
+func ActiveSuspension(kind string, suspendedAt, suspendedUntil sql.NullTime, now time.Time) string {
+	if !suspendedAt.Valid || (suspendedUntil.Valid && !suspendedUntil.Time.After(now)) {
+		return ""
+	}
+	if kind == "" {
+		// a suspension with no kind locks the user out, as every suspension did before there were kinds
+		return SuspensionFull
+	}
+	return kind
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateTOTPRFC6238Vectors(t *testing.T) {
+	type algorithm struct {
+		name string
+		alg  func() hash.Hash
+		key  []byte
+	}
+
+	sha1Alg := algorithm{"SHA1", sha1.New, []byte("12345678901234567890")}
+	sha256Alg := algorithm{"SHA256", sha256.New, []byte("12345678901234567890123456789012")}
+	sha512Alg := algorithm{"SHA512", sha512.New, []byte("1234567890123456789012345678901234567890123456789012345678901234")}
+
+	type testCase struct {
+		unixTime int64
+		alg      algorithm
+		expected string
+	}
+
+	// Test vectors from RFC 6238 Appendix B
+	testCases := []testCase{
+		{59, sha1Alg, "94287082"},
+		{59, sha256Alg, "46119246"},
+		{59, sha512Alg, "90693936"},
+		{1111111109, sha1Alg, "07081804"},
+		{1111111109, sha256Alg, "68084774"},
+		{1111111109, sha512Alg, "25091201"},
+		{1111111111, sha1Alg, "14050471"},
+		{1111111111, sha256Alg, "67062674"},
+		{1111111111, sha512Alg, "99943326"},
+		{1234567890, sha1Alg, "89005924"},
+		{1234567890, sha256Alg, "91819424"},
+		{1234567890, sha512Alg, "93441116"},
+		{2000000000, sha1Alg, "69279037"},
+		{2000000000, sha256Alg, "90698825"},
+		{2000000000, sha512Alg, "38618901"},
+		{20000000000, sha1Alg, "65353130"},
+		{20000000000, sha256Alg, "77737706"},
+		{20000000000, sha512Alg, "47863826"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.alg.name+"/"+time.Unix(tc.unixTime, 0).UTC().Format(time.RFC3339), func(t *testing.T) {
+			code := GenerateTOTP(tc.alg.key, time.Unix(tc.unixTime, 0), 30, 8, tc.alg.alg)
+			if code != tc.expected {
+				t.Fatalf("Fail: expected code %s but received %s", tc.expected, code)
+			}
+		})
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("Error: could not generate secret: %v", err)
+	}
+
+	key, _ := b32NoPadding.DecodeString(secret)
+	now := time.Unix(1700000000, 0)
+
+	type testCase struct {
+		testName   string
+		codeTime   time.Time
+		expectedOK bool
+	}
+
+	testCases := []testCase{
+		{"current step", now, true},
+		{"previous step within skew", now.Add(-30 * time.Second), true},
+		{"next step within skew", now.Add(30 * time.Second), true},
+		{"two steps old", now.Add(-90 * time.Second), false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			code := GenerateTOTP(key, tc.codeTime, totpPeriod, totpDigits, sha1.New)
+			step, ok := ValidateTOTP(secret, code, now)
+			if ok != tc.expectedOK {
+				t.Fatalf("Fail: expected ok=%v but received %v", tc.expectedOK, ok)
+			}
+			if ok && step != tc.codeTime.Unix()/totpPeriod {
+				t.Fatalf("Fail: expected step %d but received %d", tc.codeTime.Unix()/totpPeriod, step)
+			}
+		})
+	}
+}
+
+func TestNormaliseRecoveryCode(t *testing.T) {
+	codes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatalf("Error: could not generate recovery codes: %v", err)
+	}
+	code := codes[0]
+	expected := NormaliseRecoveryCode(code)
+
+	for _, typed := range []string{code, strings.ToUpper(code), strings.ReplaceAll(code, "-", ""), " " + strings.ReplaceAll(code, "-", " ") + " "} {
+		if got := NormaliseRecoveryCode(typed); got != expected {
+			t.Fatalf("Fail: expected %q to normalise to %q but received %q", typed, expected, got)
+		}
+	}
+}
+
+func TestMFAChallengeIsNotAnAccessToken(t *testing.T) {
+	const secret = "abcd"
+
+	challenge, _ := MakeMFAChallengeJWT([16]byte{1}, secret)
+	if _, err := ValidateJWT(challenge, secret); err == nil {
+		t.Fatal("Fail: MFA challenge token was accepted as an access token")
+	}
+
+	access, _ := MakeJWT([16]byte{1}, secret)
+	if _, err := ValidateMFAChallengeJWT(access, secret); err == nil {
+		t.Fatal("Fail: access token was accepted as an MFA challenge")
+	}
+}
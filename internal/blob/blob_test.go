@@ -0,0 +1,44 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Error: could not create store: %v", err)
+	}
+
+	if err := store.Put(ctx, "user/media/original.png", strings.NewReader("image")); err != nil {
+		t.Fatalf("Fail: could not put blob: %v", err)
+	}
+
+	r, err := store.Get(ctx, "user/media/original.png")
+	if err != nil {
+		t.Fatalf("Fail: could not get blob: %v", err)
+	}
+	b, _ := io.ReadAll(r)
+	_ = r.Close()
+	if string(b) != "image" {
+		t.Fatalf("Fail: expected %q but received %q", "image", b)
+	}
+
+	if err := store.DeletePrefix(ctx, "user"); err != nil {
+		t.Fatalf("Fail: could not delete prefix: %v", err)
+	}
+	if _, err := store.Get(ctx, "user/media/original.png"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Fail: expected ErrNotFound after delete, got %v", err)
+	}
+
+	for _, key := range []string{"../escape", "user/../../escape", "/absolute", "user//double", "", ".hidden"} {
+		if err := store.Put(ctx, key, strings.NewReader("x")); err == nil {
+			t.Fatalf("Fail: expected key %q to be rejected", key)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Package clientip works out which address a request came from, believing X-Forwarded-For only from
+// trusted proxies
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Resolver finds the client address of requests
+type Resolver struct {
+	// proxies are the addresses allowed to say who the client is with X-Forwarded-For
+	proxies []netip.Prefix
+}
+
+func NewResolver(proxies []netip.Prefix) *Resolver {
+	return &Resolver{proxies: proxies}
+}
+
+// ParseTrustedProxies reads a comma-separated list of IP addresses and CIDR ranges
+func ParseTrustedProxies(s string) ([]netip.Prefix, error) {
+	proxies := []netip.Prefix{}
+	for v := range strings.SplitSeq(s, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			addr, err := netip.ParseAddr(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %v", v, err)
+			}
+			proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %v", v, err)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+func (r *Resolver) trusted(addr netip.Addr) bool {
+	for _, p := range r.proxies {
+		if p.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteHost is the connecting address without its port
+func remoteHost(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// IP is the address the request came from. X-Forwarded-For is only believed when the connection is
+// from a trusted proxy, and then only as far back as the last address that is not one, since anything
+// before that was written by the client.
+func (r *Resolver) IP(req *http.Request) string {
+	host := remoteHost(req)
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !r.trusted(addr) {
+		return host
+	}
+
+	hops := []string{}
+	for _, header := range req.Header.Values("X-Forwarded-For") {
+		for hop := range strings.SplitSeq(header, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hopAddr, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			// a malformed hop cannot be trusted, so neither can anything before it
+			break
+		}
+		if !r.trusted(hopAddr) {
+			return hopAddr.Unmap().String()
+		}
+		addr = hopAddr
+	}
+	return addr.Unmap().String()
+}
+
+type clientIPKey struct{}
+
+// Middleware resolves the client address of each request once, for FromRequest to return
+func Middleware(r *Resolver, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := context.WithValue(req.Context(), clientIPKey{}, r.IP(req))
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// FromRequest returns the address Middleware resolved for req. Requests that did not pass through it
+// get the connecting address.
+func FromRequest(req *http.Request) string {
+	if ip, ok := req.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return remoteHost(req)
+}
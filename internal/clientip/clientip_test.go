@@ -0,0 +1,71 @@
+package clientip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	type testCase struct {
+		testName     string
+		remoteAddr   string
+		forwardedFor []string
+		expectedIP   string
+	}
+
+	testCases := []testCase{
+		{testName: "direct", remoteAddr: "203.0.113.7:5123", expectedIP: "203.0.113.7"},
+		{testName: "untrusted proxy is ignored", remoteAddr: "203.0.113.7:5123", forwardedFor: []string{"198.51.100.1"}, expectedIP: "203.0.113.7"},
+		{testName: "trusted proxy", remoteAddr: "10.0.0.2:5123", forwardedFor: []string{"198.51.100.1"}, expectedIP: "198.51.100.1"},
+		{testName: "spoofed hop before the client", remoteAddr: "10.0.0.2:5123", forwardedFor: []string{"1.2.3.4, 198.51.100.1"}, expectedIP: "198.51.100.1"},
+		{testName: "chain of proxies", remoteAddr: "10.0.0.2:5123", forwardedFor: []string{"1.2.3.4, 198.51.100.1", "10.0.0.3"}, expectedIP: "198.51.100.1"},
+		{testName: "malformed hop", remoteAddr: "10.0.0.2:5123", forwardedFor: []string{"198.51.100.1, nonsense"}, expectedIP: "10.0.0.2"},
+		{testName: "trusted proxy without header", remoteAddr: "10.0.0.2:5123", expectedIP: "10.0.0.2"},
+		{testName: "ipv6 trusted proxy", remoteAddr: "[2001:db8::1]:5123", forwardedFor: []string{"198.51.100.1"}, expectedIP: "198.51.100.1"},
+	}
+
+	proxies, err := ParseTrustedProxies("10.0.0.0/8, 2001:db8::1")
+	if err != nil {
+		t.Fatalf("Fail: unexpected error: %v", err)
+	}
+	r := NewResolver(proxies)
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/chirps", nil)
+			req.RemoteAddr = tc.remoteAddr
+			for _, v := range tc.forwardedFor {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			if ip := r.IP(req); ip != tc.expectedIP {
+				t.Fatalf("Fail: expected %s, got %s", tc.expectedIP, ip)
+			}
+		})
+	}
+
+	if _, err := ParseTrustedProxies("10.0.0.0/33"); err == nil {
+		t.Fatal("Fail: expected an invalid range to be refused")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	proxies, _ := ParseTrustedProxies("10.0.0.0/8")
+	var seen string
+	handler := Middleware(NewResolver(proxies), http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		seen = FromRequest(req)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/chirps", nil)
+	req.RemoteAddr = "10.0.0.2:5123"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if seen != "198.51.100.1" {
+		t.Fatalf("Fail: expected handlers to see the resolved address, got %s", seen)
+	}
+
+	// without the middleware the connecting address is all there is
+	if ip := FromRequest(req); ip != "10.0.0.2" {
+		t.Fatalf("Fail: expected the connecting address, got %s", ip)
+	}
+}
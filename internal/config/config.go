@@ -2,11 +2,31 @@
 package config
 
 import (
-	"github.com/bailey4770/chirpy/internal/database"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/audit"
+	"github.com/bailey4770/chirpy/internal/blob"
+	"github.com/bailey4770/chirpy/internal/clientip"
+	"github.com/bailey4770/chirpy/internal/filter"
+	"github.com/bailey4770/chirpy/internal/mailer"
+	"github.com/bailey4770/chirpy/internal/password"
+	"github.com/bailey4770/chirpy/internal/ratelimit"
 )
 
 type APIConfig struct {
-	DB       *database.Queries
-	Secret   string
-	PolkaKey string
+	DB                   *audit.Store
+	Secret               string
+	PolkaKey             string
+	Mailer               mailer.Mailer
+	AppBaseURL           string
+	APIBaseURL           string
+	RequireVerifiedEmail bool
+	PasswordPolicy       password.Policy
+	SecureCookies        bool
+	AccountDeletionGrace time.Duration
+	Blobs                blob.Store
+	MaxChirpMedia        int
+	Filter               *filter.Engine
+	RateLimiter          *ratelimit.Limiter
+	ClientIPs            *clientip.Resolver
 }
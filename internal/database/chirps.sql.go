@@ -7,14 +7,27 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
+const countChirpsForUser = `-- name: CountChirpsForUser :one
+SELECT count(*) FROM chirps
+WHERE user_id = $1
+`
+
+func (q *Queries) CountChirpsForUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countChirpsForUser, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createChirp = `-- name: CreateChirp :one
 INSERT INTO chirps (created_at, updated_at, body, user_id)
 VALUES (NOW(), NOW(), $1, $2)
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, hidden_at
 `
 
 type CreateChirpParams struct {
@@ -31,6 +44,7 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.HiddenAt,
 	)
 	return i, err
 }
@@ -46,8 +60,9 @@ func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 }
 
 const fetchChirpByID = `-- name: FetchChirpByID :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-WHERE id = $1
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.hidden_at FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.id = $1 AND users.delete_after IS NULL AND chirps.hidden_at IS NULL
 `
 
 func (q *Queries) FetchChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -59,26 +74,105 @@ func (q *Queries) FetchChirpByID(ctx context.Context, id uuid.UUID) (Chirp, erro
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.HiddenAt,
 	)
 	return i, err
 }
 
 const fetchChirpsWithOptionalParams = `-- name: FetchChirpsWithOptionalParams :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.hidden_at FROM chirps
+JOIN users ON users.id = chirps.user_id
 WHERE (NULLIF($1::uuid, '00000000-0000-0000-0000-000000000000') IS NULL
-       OR user_id = $1)
+       OR chirps.user_id = $1)
+  AND users.delete_after IS NULL
+  AND chirps.hidden_at IS NULL
+  -- authors hidden from the viewer, as listed by ListHiddenAuthors, are left out before paging so a
+  -- page is never cut short. A muted author's chirps still show when asked for by author.
+  AND chirps.user_id NOT IN (
+    SELECT blocked_id FROM user_blocks WHERE user_blocks.blocker_id = $5
+    UNION ALL
+    SELECT blocker_id FROM user_blocks WHERE user_blocks.blocked_id = $5
+    UNION ALL
+    SELECT muted_id FROM user_mutes WHERE user_mutes.muter_id = $5 AND user_mutes.muted_id <> $1
+    UNION ALL
+    SELECT id FROM users AS suspended
+    WHERE suspended.id <> $5
+      AND suspended.suspension_kind IN ('full', 'shadow_ban')
+      AND suspended.suspended_at IS NOT NULL
+      AND (suspended.suspended_until IS NULL OR suspended.suspended_until > NOW())
+  )
 ORDER BY
-  CASE WHEN $2 = 'asc'  THEN created_at END ASC,
-  CASE WHEN $2 = 'desc' THEN created_at END DESC
+  CASE WHEN $2 = 'asc'  THEN chirps.created_at END ASC,
+  CASE WHEN $2 = 'desc' THEN chirps.created_at END DESC
+LIMIT $3 OFFSET $4
 `
 
 type FetchChirpsWithOptionalParamsParams struct {
-	Column1 uuid.UUID
-	Column2 interface{}
+	Column1  uuid.UUID
+	Column2  interface{}
+	Limit    sql.NullInt32
+	Offset   int32
+	ViewerID uuid.UUID
 }
 
 func (q *Queries) FetchChirpsWithOptionalParams(ctx context.Context, arg FetchChirpsWithOptionalParamsParams) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, fetchChirpsWithOptionalParams, arg.Column1, arg.Column2)
+	rows, err := q.db.QueryContext(ctx, fetchChirpsWithOptionalParams,
+		arg.Column1,
+		arg.Column2,
+		arg.Limit,
+		arg.Offset,
+		arg.ViewerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const hideChirp = `-- name: HideChirp :execrows
+UPDATE chirps
+SET hidden_at = NOW()
+WHERE id = $1 AND hidden_at IS NULL
+`
+
+func (q *Queries) HideChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, hideChirp, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const listChirpsForUser = `-- name: ListChirpsForUser :many
+SELECT id, created_at, updated_at, body, user_id, hidden_at FROM chirps
+WHERE user_id = $1
+ORDER BY created_at ASC
+`
+
+func (q *Queries) ListChirpsForUser(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsForUser, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -92,6 +186,7 @@ func (q *Queries) FetchChirpsWithOptionalParams(ctx context.Context, arg FetchCh
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.HiddenAt,
 		); err != nil {
 			return nil, err
 		}
@@ -6,17 +6,165 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type AnalyticsCount struct {
+	Granularity string
+	Bucket      time.Time
+	Metric      string
+	Key         string
+	Count       int64
+}
+
+type AuditEvent struct {
+	Seq        int64
+	CreatedAt  time.Time
+	ActorID    uuid.NullUUID
+	Action     string
+	TargetType string
+	TargetID   string
+	Ip         string
+	RequestID  string
+	Metadata   json.RawMessage
+	PrevHash   string
+	Hash       string
+}
+
+type AuthThrottle struct {
+	Key           string
+	Failures      int32
+	LastFailureAt time.Time
+	LockedUntil   sql.NullTime
+}
+
 type Chirp struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Body      string
 	UserID    uuid.UUID
+	HiddenAt  sql.NullTime
+}
+
+type ChirpImpression struct {
+	ChirpID uuid.UUID
+	Bucket  time.Time
+	Count   int64
+}
+
+type ChirpImpressionViewer struct {
+	ChirpID     uuid.UUID
+	WindowStart time.Time
+	Viewer      string
+}
+
+type ChirpReport struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	CaseID     uuid.UUID
+	ReporterID uuid.NullUUID
+	Category   string
+	Comment    string
+}
+
+type DataExport struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UserID      uuid.UUID
+	Status      string
+	Archive     []byte
+	CompletedAt sql.NullTime
+	ExpiresAt   sql.NullTime
+}
+
+type FilterRule struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	Pattern   string
+	Severity  string
+	Action    string
+	CreatedBy uuid.NullUUID
+}
+
+type MediaAttachment struct {
+	ID                   uuid.UUID
+	CreatedAt            time.Time
+	UserID               uuid.UUID
+	ChirpID              uuid.NullUUID
+	Position             int32
+	ContentType          string
+	Width                int32
+	Height               int32
+	OriginalKey          string
+	ThumbnailKey         string
+	ThumbnailContentType string
+}
+
+type ModerationCase struct {
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	ChirpID          uuid.UUID
+	ChirpAuthorID    uuid.UUID
+	ChirpBody        string
+	Status           string
+	Action           string
+	ActorID          uuid.NullUUID
+	ResolutionReason string
+	ResolvedAt       sql.NullTime
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash      string
+	CreatedAt     time.Time
+	ClientID      uuid.UUID
+	UserID        uuid.UUID
+	RedirectUri   string
+	Scopes        []string
+	CodeChallenge string
+	ExpiresAt     time.Time
+	UsedAt        sql.NullTime
+}
+
+type OauthClient struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	OwnerID      uuid.UUID
+	Name         string
+	SecretHash   sql.NullString
+	RedirectUris []string
+	Scopes       []string
+}
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UserID     uuid.UUID
+	Name       string
+	TokenHash  string
+	Scopes     []string
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
+type RateLimitBucket struct {
+	Key       string
+	Tokens    float64
+	UpdatedAt time.Time
+	Allowed   bool
+}
+
+type RecoveryCode struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	CodeHash  string
+	UsedAt    sql.NullTime
 }
 
 type RefreshToken struct {
@@ -26,13 +174,62 @@ type RefreshToken struct {
 	UserID    uuid.UUID
 	ExpiresAt time.Time
 	RevokedAt sql.NullTime
+	ClientID  uuid.NullUUID
+	Scopes    []string
 }
 
 type User struct {
-	ID             uuid.UUID
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	Email            string
+	HashedPassword   string
+	IsChirpyRed      bool
+	TotpSecret       sql.NullString
+	TotpEnabled      bool
+	TotpLastStep     int64
+	EmailVerified    bool
+	DeleteAfter      sql.NullTime
+	DisplayName      string
+	Bio              string
+	Location         string
+	Website          string
+	AvatarUrl        string
+	Role             string
+	SuspendedAt      sql.NullTime
+	SuspensionReason string
+	SuspensionKind   string
+	SuspendedUntil   sql.NullTime
+}
+
+type UserBlock struct {
+	BlockerID uuid.UUID
+	BlockedID uuid.UUID
+	CreatedAt time.Time
+}
+
+type UserMute struct {
+	MuterID   uuid.UUID
+	MutedID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type UserToken struct {
+	TokenHash string
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	Purpose   string
+	Email     string
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type WebhookDelivery struct {
+	ID         uuid.UUID
+	ReceivedAt time.Time
+	Source     string
+	Event      string
+	UserID     uuid.NullUUID
+	StatusCode int32
+	Error      string
 }
@@ -7,11 +7,60 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const advanceTOTPStep = `-- name: AdvanceTOTPStep :execrows
+UPDATE users
+SET totp_last_step = $2
+WHERE id = $1 AND totp_last_step < $2
+`
+
+type AdvanceTOTPStepParams struct {
+	ID           uuid.UUID
+	TotpLastStep int64
+}
+
+func (q *Queries) AdvanceTOTPStep(ctx context.Context, arg AdvanceTOTPStepParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, advanceTOTPStep, arg.ID, arg.TotpLastStep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const cancelAccountDeletion = `-- name: CancelAccountDeletion :execrows
+UPDATE users
+SET delete_after = NULL, updated_at = NOW()
+WHERE id = $1 AND delete_after IS NOT NULL
+`
+
+func (q *Queries) CancelAccountDeletion(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, cancelAccountDeletion, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const clearPassword = `-- name: ClearPassword :execrows
+UPDATE users
+SET hashed_password = 'unset', updated_at = NOW()
+WHERE id = $1
+`
+
+// puts back the placeholder a user without a password has, which never matches, so only a reset lets them log in with one
+func (q *Queries) ClearPassword(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, clearPassword, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (created_at, updated_at, email, hashed_password)
 VALUES (NOW(), NOW(), $1, $2)
@@ -44,17 +93,48 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateU
 	return i, err
 }
 
-const deleteAllUsers = `-- name: DeleteAllUsers :exec
+const deleteExpiredAccounts = `-- name: DeleteExpiredAccounts :many
 DELETE FROM users
+WHERE delete_after IS NOT NULL AND delete_after < NOW()
+RETURNING id
 `
 
-func (q *Queries) DeleteAllUsers(ctx context.Context) error {
-	_, err := q.db.ExecContext(ctx, deleteAllUsers)
+func (q *Queries) DeleteExpiredAccounts(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, deleteExpiredAccounts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const enableTOTP = `-- name: EnableTOTP :exec
+UPDATE users
+SET totp_enabled = TRUE, updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) EnableTOTP(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, enableTOTP, id)
 	return err
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, totp_secret, totp_enabled, totp_last_step, email_verified, delete_after, display_name, bio, location, website, avatar_url, role, suspended_at, suspension_reason, suspension_kind, suspended_until FROM users
 WHERE $1=email
 `
 
@@ -68,10 +148,144 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.EmailVerified,
+		&i.DeleteAfter,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.AvatarUrl,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.SuspensionReason,
+		&i.SuspensionKind,
+		&i.SuspendedUntil,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, totp_secret, totp_enabled, totp_last_step, email_verified, delete_after, display_name, bio, location, website, avatar_url, role, suspended_at, suspension_reason, suspension_kind, suspended_until FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.EmailVerified,
+		&i.DeleteAfter,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.AvatarUrl,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.SuspensionReason,
+		&i.SuspensionKind,
+		&i.SuspendedUntil,
 	)
 	return i, err
 }
 
+const liftSuspension = `-- name: LiftSuspension :execrows
+UPDATE users
+SET suspended_at = NULL, suspension_kind = '', suspension_reason = '', suspended_until = NULL, updated_at = NOW()
+WHERE id = $1 AND suspended_at IS NOT NULL
+`
+
+func (q *Queries) LiftSuspension(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, liftSuspension, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const listUsers = `-- name: ListUsers :many
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, totp_secret, totp_enabled, totp_last_step, email_verified, delete_after, display_name, bio, location, website, avatar_url, role, suspended_at, suspension_reason, suspension_kind, suspended_until FROM users
+WHERE ($1::text IS NULL OR email ILIKE '%' || $1::text || '%' OR display_name ILIKE '%' || $1::text || '%')
+  AND ($2::boolean IS NULL OR is_chirpy_red = $2::boolean)
+  AND ($3::text IS NULL OR role = $3::text)
+  AND ($4::boolean IS NULL OR (suspended_at IS NOT NULL AND (suspended_until IS NULL OR suspended_until > NOW())) = $4::boolean)
+ORDER BY created_at DESC, id
+LIMIT $5 OFFSET $6
+`
+
+type ListUsersParams struct {
+	Search      sql.NullString
+	IsChirpyRed sql.NullBool
+	Role        sql.NullString
+	Suspended   sql.NullBool
+	Limit       int32
+	Offset      int32
+}
+
+func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, listUsers,
+		arg.Search,
+		arg.IsChirpyRed,
+		arg.Role,
+		arg.Suspended,
+		arg.Limit,
+		arg.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Email,
+			&i.HashedPassword,
+			&i.IsChirpyRed,
+			&i.TotpSecret,
+			&i.TotpEnabled,
+			&i.TotpLastStep,
+			&i.EmailVerified,
+			&i.DeleteAfter,
+			&i.DisplayName,
+			&i.Bio,
+			&i.Location,
+			&i.Website,
+			&i.AvatarUrl,
+			&i.Role,
+			&i.SuspendedAt,
+			&i.SuspensionReason,
+			&i.SuspensionKind,
+			&i.SuspendedUntil,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const makeUserRed = `-- name: MakeUserRed :exec
 UPDATE users
 SET is_chirpy_red = TRUE
@@ -83,9 +297,131 @@ func (q *Queries) MakeUserRed(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const markEmailVerified = `-- name: MarkEmailVerified :execrows
+UPDATE users
+SET email_verified = TRUE, updated_at = NOW()
+WHERE id = $1 AND email = $2
+`
+
+type MarkEmailVerifiedParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) MarkEmailVerified(ctx context.Context, arg MarkEmailVerifiedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markEmailVerified, arg.ID, arg.Email)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const scheduleAccountDeletion = `-- name: ScheduleAccountDeletion :exec
+UPDATE users
+SET delete_after = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type ScheduleAccountDeletionParams struct {
+	ID          uuid.UUID
+	DeleteAfter sql.NullTime
+}
+
+func (q *Queries) ScheduleAccountDeletion(ctx context.Context, arg ScheduleAccountDeletionParams) error {
+	_, err := q.db.ExecContext(ctx, scheduleAccountDeletion, arg.ID, arg.DeleteAfter)
+	return err
+}
+
+const setChirpyRed = `-- name: SetChirpyRed :execrows
+UPDATE users
+SET is_chirpy_red = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type SetChirpyRedParams struct {
+	ID          uuid.UUID
+	IsChirpyRed bool
+}
+
+func (q *Queries) SetChirpyRed(ctx context.Context, arg SetChirpyRedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setChirpyRed, arg.ID, arg.IsChirpyRed)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setTOTPSecret = `-- name: SetTOTPSecret :exec
+UPDATE users
+SET totp_secret = $2, totp_enabled = FALSE, updated_at = NOW()
+WHERE id = $1
+`
+
+type SetTOTPSecretParams struct {
+	ID         uuid.UUID
+	TotpSecret sql.NullString
+}
+
+func (q *Queries) SetTOTPSecret(ctx context.Context, arg SetTOTPSecretParams) error {
+	_, err := q.db.ExecContext(ctx, setTOTPSecret, arg.ID, arg.TotpSecret)
+	return err
+}
+
+const setUserRole = `-- name: SetUserRole :execrows
+UPDATE users
+SET role = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type SetUserRoleParams struct {
+	ID   uuid.UUID
+	Role string
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setUserRole, arg.ID, arg.Role)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const suspendUser = `-- name: SuspendUser :execrows
+UPDATE users
+SET suspended_at = NOW(), suspension_kind = $2, suspension_reason = $3, suspended_until = $4, updated_at = NOW()
+WHERE id = $1
+`
+
+type SuspendUserParams struct {
+	ID               uuid.UUID
+	SuspensionKind   string
+	SuspensionReason string
+	SuspendedUntil   sql.NullTime
+}
+
+func (q *Queries) SuspendUser(ctx context.Context, arg SuspendUserParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, suspendUser,
+		arg.ID,
+		arg.SuspensionKind,
+		arg.SuspensionReason,
+		arg.SuspendedUntil,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const updateEmailAndPassword = `-- name: UpdateEmailAndPassword :one
+WITH revoked_links AS (
+  DELETE FROM user_tokens
+  USING users
+  WHERE users.id = $1 AND users.email <> $2
+    AND user_tokens.user_id = users.id
+    AND user_tokens.purpose IN ('verify_email', 'magic_login')
+)
 UPDATE users
-SET email = $2, hashed_password = $3, updated_at = NOW()
+SET email = $2, hashed_password = $3, email_verified = email_verified AND email = $2, updated_at = NOW()
 WHERE id = $1
 RETURNING id, created_at, updated_at, email, is_chirpy_red
 `
@@ -116,3 +452,71 @@ func (q *Queries) UpdateEmailAndPassword(ctx context.Context, arg UpdateEmailAnd
 	)
 	return i, err
 }
+
+const updatePassword = `-- name: UpdatePassword :exec
+UPDATE users
+SET hashed_password = $2, updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdatePasswordParams struct {
+	ID             uuid.UUID
+	HashedPassword string
+}
+
+func (q *Queries) UpdatePassword(ctx context.Context, arg UpdatePasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updatePassword, arg.ID, arg.HashedPassword)
+	return err
+}
+
+const updateProfile = `-- name: UpdateProfile :one
+UPDATE users
+SET display_name = $2, bio = $3, location = $4, website = $5, avatar_url = $6, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, totp_secret, totp_enabled, totp_last_step, email_verified, delete_after, display_name, bio, location, website, avatar_url, role, suspended_at, suspension_reason, suspension_kind, suspended_until
+`
+
+type UpdateProfileParams struct {
+	ID          uuid.UUID
+	DisplayName string
+	Bio         string
+	Location    string
+	Website     string
+	AvatarUrl   string
+}
+
+func (q *Queries) UpdateProfile(ctx context.Context, arg UpdateProfileParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateProfile,
+		arg.ID,
+		arg.DisplayName,
+		arg.Bio,
+		arg.Location,
+		arg.Website,
+		arg.AvatarUrl,
+	)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.TotpSecret,
+		&i.TotpEnabled,
+		&i.TotpLastStep,
+		&i.EmailVerified,
+		&i.DeleteAfter,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.AvatarUrl,
+		&i.Role,
+		&i.SuspendedAt,
+		&i.SuspensionReason,
+		&i.SuspensionKind,
+		&i.SuspendedUntil,
+	)
+	return i, err
+}
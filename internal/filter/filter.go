@@ -0,0 +1,279 @@
+// Package filter finds banned words in text however they are disguised: with lookalike letters from other
+// scripts, accents, leetspeak, repeated letters, invisible characters or spaces between the letters
+package filter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+const (
+	SeverityLow    = "low"
+	SeverityMedium = "medium"
+	SeverityHigh   = "high"
+
+	// ActionMask replaces the word with asterisks
+	ActionMask = "mask"
+	// ActionReject refuses the whole text
+	ActionReject = "reject"
+	// ActionFlag lets the text through and sends it to the moderation queue
+	ActionFlag = "flag"
+
+	Mask = "****"
+
+	MaxPatternLength = 100
+)
+
+var severityRank = map[string]int{SeverityLow: 0, SeverityMedium: 1, SeverityHigh: 2}
+
+var actions = []string{ActionMask, ActionReject, ActionFlag}
+
+type Rule struct {
+	Pattern  string
+	Severity string
+	Action   string
+}
+
+// Validate reports why the rule cannot be used, or nil if it can
+func (r Rule) Validate() error {
+	if strings.TrimSpace(r.Pattern) == "" {
+		return fmt.Errorf("pattern is required")
+	}
+	if utf8.RuneCountInString(r.Pattern) > MaxPatternLength {
+		return fmt.Errorf("pattern must be at most %d characters", MaxPatternLength)
+	}
+	if len(normalizePattern(r.Pattern)) == 0 {
+		return fmt.Errorf("pattern must contain a letter or digit")
+	}
+	if _, ok := severityRank[r.Severity]; !ok {
+		return fmt.Errorf("severity must be one of: low, medium, high")
+	}
+	switch r.Action {
+	case ActionMask, ActionReject, ActionFlag:
+	default:
+		return fmt.Errorf("action must be one of: %s", strings.Join(actions, ", "))
+	}
+	return nil
+}
+
+// DefaultRules are used until rules have been loaded from the database
+var DefaultRules = []Rule{
+	{Pattern: "kerfuffle", Severity: SeverityLow, Action: ActionMask},
+	{Pattern: "sharbert", Severity: SeverityLow, Action: ActionMask},
+	{Pattern: "fornax", Severity: SeverityLow, Action: ActionMask},
+}
+
+// Match is one rule matched in a text. Start and End are byte offsets into the original text.
+type Match struct {
+	Rule  Rule
+	Start int
+	End   int
+}
+
+type Result struct {
+	// Text is the original text with every masked word replaced
+	Text    string
+	Matches []Match
+	// Rejected is set if any matched rule rejects the text
+	Rejected bool
+	// Flagged is set if any matched rule sends the text for review
+	Flagged bool
+	// Severity is the highest severity of any matched rule, or empty if nothing matched
+	Severity string
+}
+
+// node is a state of the Aho-Corasick automaton
+type node struct {
+	next map[rune]int
+	fail int
+	// out holds the patterns that end at this state, including those reached through fail links
+	out []int
+}
+
+// Filter matches a fixed set of rules. It is safe for concurrent use.
+type Filter struct {
+	rules    []Rule
+	patterns [][]symbol
+	nodes    []node
+}
+
+// New compiles rules into a Filter. Rules that fail Validate are skipped.
+func New(rules []Rule) *Filter {
+	f := &Filter{nodes: []node{{next: map[rune]int{}}}}
+
+	for _, rule := range rules {
+		if rule.Validate() != nil {
+			continue
+		}
+		pattern := normalizePattern(rule.Pattern)
+
+		state := 0
+		for _, s := range pattern {
+			next, ok := f.nodes[state].next[s.r]
+			if !ok {
+				next = len(f.nodes)
+				f.nodes = append(f.nodes, node{next: map[rune]int{}})
+				f.nodes[state].next[s.r] = next
+			}
+			state = next
+		}
+		f.nodes[state].out = append(f.nodes[state].out, len(f.patterns))
+		f.rules = append(f.rules, rule)
+		f.patterns = append(f.patterns, pattern)
+	}
+
+	// breadth first, so the fail state of every node is finished before its children are visited
+	queue := []int{}
+	for _, child := range f.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+
+		for r, child := range f.nodes[state].next {
+			fail := f.nodes[state].fail
+			for {
+				if next, ok := f.nodes[fail].next[r]; ok {
+					f.nodes[child].fail = next
+					break
+				}
+				if fail == 0 {
+					break
+				}
+				fail = f.nodes[fail].fail
+			}
+			f.nodes[child].out = append(f.nodes[child].out, f.nodes[f.nodes[child].fail].out...)
+			queue = append(queue, child)
+		}
+	}
+
+	return f
+}
+
+// Rules returns the rules the filter was compiled from, without any that were skipped
+func (f *Filter) Rules() []Rule {
+	return f.rules
+}
+
+// Apply matches every rule against text. A pattern only matches whole words, and every letter the pattern
+// repeats must be repeated at least as often in the text, so neither "class" nor "as" matches "ass".
+func (f *Filter) Apply(text string) Result {
+	var seq []symbol
+	for _, w := range words(text) {
+		if len(seq) > 0 {
+			seq = append(seq, symbol{r: wordSeparator, count: 1})
+		}
+		seq = append(seq, w...)
+	}
+
+	result := Result{Text: text}
+	state := 0
+	for i, s := range seq {
+		for state != 0 {
+			if _, ok := f.nodes[state].next[s.r]; ok {
+				break
+			}
+			state = f.nodes[state].fail
+		}
+		if next, ok := f.nodes[state].next[s.r]; ok {
+			state = next
+		}
+
+		for _, p := range f.nodes[state].out {
+			pattern := f.patterns[p]
+			start := i - len(pattern) + 1
+			if !wholeWords(seq, start, i) || !repeatsEnough(seq[start:i+1], pattern) {
+				continue
+			}
+
+			rule := f.rules[p]
+			result.Matches = append(result.Matches, Match{Rule: rule, Start: seq[start].start, End: s.end})
+			switch rule.Action {
+			case ActionReject:
+				result.Rejected = true
+			case ActionFlag:
+				result.Flagged = true
+			}
+			if result.Severity == "" || severityRank[rule.Severity] > severityRank[result.Severity] {
+				result.Severity = rule.Severity
+			}
+		}
+	}
+
+	result.Text = mask(text, result.Matches)
+	return result
+}
+
+// wholeWords reports whether seq[start:end+1] starts and ends on word boundaries
+func wholeWords(seq []symbol, start, end int) bool {
+	startsWord := start == 0 || seq[start-1].r == wordSeparator || seq[start-1].spelled && seq[start].spelled
+	endsWord := end == len(seq)-1 || seq[end+1].r == wordSeparator || seq[end].spelled && seq[end+1].spelled
+	return startsWord && endsWord
+}
+
+func repeatsEnough(text, pattern []symbol) bool {
+	for i := range pattern {
+		if text[i].count < pattern[i].count {
+			return false
+		}
+	}
+	return true
+}
+
+// mask replaces the text of every masking match, merging any that overlap
+func mask(text string, matches []Match) string {
+	var spans []Match
+	for _, m := range matches {
+		if m.Rule.Action == ActionMask {
+			spans = append(spans, m)
+		}
+	}
+	if len(spans) == 0 {
+		return text
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].Start < spans[j].Start })
+
+	var b strings.Builder
+	last := 0
+	for _, m := range spans {
+		if m.End <= last {
+			continue
+		}
+		if m.Start >= last {
+			b.WriteString(text[last:m.Start])
+			b.WriteString(Mask)
+		}
+		last = m.End
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// Engine holds the current Filter and lets it be replaced while requests are using it
+type Engine struct {
+	current atomic.Pointer[Filter]
+}
+
+// NewEngine returns an Engine that starts out with rules
+func NewEngine(rules []Rule) *Engine {
+	e := &Engine{}
+	e.Set(rules)
+	return e
+}
+
+// Set compiles rules and swaps them in. Requests already applying the old rules finish with them.
+func (e *Engine) Set(rules []Rule) {
+	e.current.Store(New(rules))
+}
+
+func (e *Engine) Load() *Filter {
+	return e.current.Load()
+}
+
+func (e *Engine) Apply(text string) Result {
+	return e.Load().Apply(text)
+}
@@ -0,0 +1,118 @@
+package filter
+
+import (
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	rules := []Rule{
+		{Pattern: "kerfuffle", Severity: SeverityLow, Action: ActionMask},
+		{Pattern: "ass", Severity: SeverityMedium, Action: ActionMask},
+		{Pattern: "fornax", Severity: SeverityHigh, Action: ActionReject},
+		{Pattern: "buy followers", Severity: SeverityMedium, Action: ActionFlag},
+	}
+	f := New(rules)
+
+	type testCase struct {
+		testName         string
+		input            string
+		expectedText     string
+		expectedRejected bool
+		expectedFlagged  bool
+		expectedSeverity string
+	}
+
+	testCases := []testCase{
+		{"clean text", "what a lovely day", "what a lovely day", false, false, ""},
+		{"plain word", "such a kerfuffle today", "such a **** today", false, false, SeverityLow},
+		{"case and punctuation", "KERFUFFLE! again", "****! again", false, false, SeverityLow},
+		{"substring left alone", "a classic class assessment", "a classic class assessment", false, false, ""},
+		{"shorter word left alone", "as far as I know", "as far as I know", false, false, ""},
+		{"repeated letters", "kerrrfuuufffle", "****", false, false, SeverityLow},
+		{"leetspeak", "k3rfuff1e and @$$", "**** and ****", false, false, SeverityMedium},
+		{"symbols in the middle", "k€rfuffle c@$h", "k€rfuffle c@$h", false, false, ""},
+		{"trailing symbol is punctuation", "what an ass!", "what an ****!", false, false, SeverityMedium},
+		{"diacritics", "kérfüfflé", "****", false, false, SeverityLow},
+		{"cyrillic homoglyphs", "k\u0435rfuffl\u0435", "****", false, false, SeverityLow},
+		{"fullwidth", "ｋｅｒｆｕｆｆｌｅ", "****", false, false, SeverityLow},
+		{"zero width characters", "ker\u200bfuf\u00adfle", "****", false, false, SeverityLow},
+		{"combining marks", "ke\u0301rfuffle", "****", false, false, SeverityLow},
+		{"spelled out", "k e r f u f f l e", "****", false, false, SeverityLow},
+		{"spelled out with dots", "a k.e.r.f.u.f.f.l.e b", "a **** b", false, false, SeverityLow},
+		{"spelled out after a one-letter word", "I k e r f u f f l e", "I ****", false, false, SeverityLow},
+		{"single letters left alone", "I am a b c", "I am a b c", false, false, ""},
+		{"reject", "a f0rnax here", "a f0rnax here", true, false, SeverityHigh},
+		{"flag across words", "Buy   followers now", "Buy   followers now", false, true, SeverityMedium},
+		{"mask with reject", "kerfuffle fornax", "**** fornax", true, false, SeverityHigh},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			result := f.Apply(tc.input)
+			if result.Text != tc.expectedText {
+				t.Errorf("expected text %q, got %q", tc.expectedText, result.Text)
+			}
+			if result.Rejected != tc.expectedRejected {
+				t.Errorf("expected rejected %v, got %v", tc.expectedRejected, result.Rejected)
+			}
+			if result.Flagged != tc.expectedFlagged {
+				t.Errorf("expected flagged %v, got %v", tc.expectedFlagged, result.Flagged)
+			}
+			if result.Severity != tc.expectedSeverity {
+				t.Errorf("expected severity %q, got %q", tc.expectedSeverity, result.Severity)
+			}
+		})
+	}
+}
+
+func TestOverlappingPatterns(t *testing.T) {
+	f := New([]Rule{
+		{Pattern: "bad", Severity: SeverityLow, Action: ActionMask},
+		{Pattern: "bad word", Severity: SeverityLow, Action: ActionMask},
+		{Pattern: "word", Severity: SeverityLow, Action: ActionMask},
+	})
+
+	result := f.Apply("a bad word here")
+	if result.Text != "a **** here" {
+		t.Errorf("expected overlapping matches to be masked once, got %q", result.Text)
+	}
+	if len(result.Matches) != 3 {
+		t.Errorf("expected 3 matches, got %d", len(result.Matches))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	type testCase struct {
+		testName string
+		rule     Rule
+		valid    bool
+	}
+
+	testCases := []testCase{
+		{"valid", Rule{"kerfuffle", SeverityLow, ActionMask}, true},
+		{"empty pattern", Rule{"  ", SeverityLow, ActionMask}, false},
+		{"no letters", Rule{"!?", SeverityLow, ActionMask}, false},
+		{"bad severity", Rule{"kerfuffle", "extreme", ActionMask}, false},
+		{"bad action", Rule{"kerfuffle", SeverityLow, "delete"}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			if err := tc.rule.Validate(); (err == nil) != tc.valid {
+				t.Errorf("expected valid %v, got error %v", tc.valid, err)
+			}
+		})
+	}
+}
+
+func TestEngineSet(t *testing.T) {
+	e := NewEngine(DefaultRules)
+	if got := e.Apply("sharbert").Text; got != "****" {
+		t.Errorf("expected default rules to mask, got %q", got)
+	}
+
+	e.Set([]Rule{{Pattern: "chirp", Severity: SeverityLow, Action: ActionMask}})
+	if got := e.Apply("sharbert chirp").Text; got != "sharbert ****" {
+		t.Errorf("expected new rules after Set, got %q", got)
+	}
+}
@@ -0,0 +1,260 @@
+package filter
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// symbol is one character of normalized text. Runs of the same character are collapsed into a
+// single symbol with a count, so "heeello" and "hello" share the symbols h, e, l, o.
+type symbol struct {
+	r     rune
+	count int
+	// spelled is set for letters of a word that was spelled out one letter at a time, any of which
+	// could be the first or last letter of a matched word
+	spelled bool
+	// start and end are the byte offsets in the original text this symbol came from
+	start int
+	end   int
+}
+
+// word is a run of word characters in the original text
+type word []symbol
+
+// char is one folded character of the original text
+type char struct {
+	r          rune
+	start, end int
+}
+
+const wordSeparator = ' '
+
+// diacritics maps accented Latin letters to their base letter
+var diacritics = buildFoldTable(map[rune]string{
+	'a': "àáâãäåāăąǎǻạảấầẩẫậắằẳẵặ",
+	'c': "çćĉċč",
+	'd': "ďđ",
+	'e': "èéêëēĕėęěẹẻẽếềểễệ",
+	'g': "ĝğġģ",
+	'h': "ĥħ",
+	'i': "ìíîïĩīĭįıǐỉị",
+	'j': "ĵ",
+	'k': "ķ",
+	'l': "ĺļľŀł",
+	'n': "ñńņňŉ",
+	'o': "òóôõöøōŏőǒọỏốồổỗộớờởỡợơ",
+	'r': "ŕŗř",
+	's': "śŝşšș",
+	't': "ţťŧț",
+	'u': "ùúûüũūŭůűųǔụủứừửữựư",
+	'w': "ŵ",
+	'y': "ýÿŷỳỵỷỹ",
+	'z': "źżž",
+})
+
+// homoglyphs maps letters from other scripts that look like Latin letters
+var homoglyphs = map[rune]rune{
+	// Cyrillic
+	'\u0430': 'a', '\u0432': 'b', '\u0435': 'e', '\u0451': 'e', '\u043a': 'k', '\u043c': 'm',
+	'\u043d': 'h', '\u043e': 'o', '\u0440': 'p', '\u0441': 'c', '\u0442': 't', '\u0443': 'y',
+	'\u0445': 'x', '\u0455': 's', '\u0456': 'i', '\u0457': 'i', '\u0458': 'j', '\u0501': 'd',
+	'\u051b': 'q', '\u051d': 'w', '\u04bb': 'h', '\u0491': 'r',
+	// Greek
+	'\u03b1': 'a', '\u03b2': 'b', '\u03b5': 'e', '\u03b9': 'i', '\u03ba': 'k', '\u03bd': 'v',
+	'\u03bf': 'o', '\u03c1': 'p', '\u03c4': 't', '\u03c5': 'u', '\u03c7': 'x', '\u03b7': 'n',
+	// Latin lookalikes
+	'\u0131': 'i', '\u0237': 'j', '\u0261': 'g', '\u01c0': 'l', '\u00df': 's',
+}
+
+// leet maps digits and symbols used in place of letters. The letters l and i, which are hard to
+// tell apart and both written as 1, share one symbol.
+var leet = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '6': 'g', '7': 't', '8': 'b', '9': 'g',
+	'@': 'a', '$': 's', '!': 'i', '|': 'i', '+': 't', 'l': 'i',
+}
+
+func buildFoldTable(bases map[rune]string) map[rune]rune {
+	table := map[rune]rune{}
+	for base, accented := range bases {
+		for _, r := range accented {
+			table[r] = base
+		}
+	}
+	return table
+}
+
+// fold maps r to the plain lowercase Latin letter or digit it stands for, if any
+func fold(r rune) rune {
+	switch {
+	case r >= 0xff01 && r <= 0xff5e:
+		// fullwidth forms of ASCII
+		r -= 0xfee0
+	case r >= 0x1d400 && r <= 0x1d6a3:
+		// mathematical bold, italic, script, fraktur, double-struck, sans-serif and monospace letters
+		i := (r - 0x1d400) % 52
+		if i < 26 {
+			return 'a' + i
+		}
+		return 'a' + i - 26
+	case r >= 0x1d7ce && r <= 0x1d7ff:
+		// mathematical digits
+		return '0' + (r-0x1d7ce)%10
+	case r >= 0x24b6 && r <= 0x24e9:
+		// circled letters
+		return 'a' + (r-0x24b6)%26
+	}
+
+	r = unicode.ToLower(r)
+	if base, ok := diacritics[r]; ok {
+		return base
+	}
+	if base, ok := homoglyphs[r]; ok {
+		return base
+	}
+	return r
+}
+
+// invisible reports whether r should be dropped before matching: zero-width characters, soft hyphens,
+// bidirectional controls, variation selectors and combining marks
+func invisible(r rune) bool {
+	return unicode.Is(unicode.Cf, r) || unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r) ||
+		unicode.Is(unicode.Variation_Selector, r)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// leetInWord reports whether the symbol at i, such as $ or !, stands for a letter. It does when more of the
+// word follows it, as in "$hit", or when it is one of two or more such symbols standing on their own, as
+// in "@$$", but not when it ends a word, as the ! in "hello!" does.
+func leetInWord(chars []char, i int) bool {
+	isLeet := func(j int) bool {
+		_, ok := leet[chars[j].r]
+		return ok && !isWordRune(chars[j].r)
+	}
+
+	start, end := i, i+1
+	for start > 0 && isLeet(start-1) {
+		start--
+	}
+	for end < len(chars) && isLeet(end) {
+		end++
+	}
+
+	if end < len(chars) && isWordRune(chars[end].r) {
+		return true
+	}
+	return end-start >= 2 && (start == 0 || !isWordRune(chars[start-1].r))
+}
+
+// words splits text into normalized words. Letters are folded to lowercase Latin where they have a
+// lookalike, leetspeak is undone, and letters spelled out with spaces or dots between them
+// ("k e r f" or "k.e.r.f") are joined back into one word.
+func words(text string) []word {
+	var chars []char
+	for i, r := range text {
+		if invisible(r) {
+			continue
+		}
+		chars = append(chars, char{r: fold(r), start: i, end: i + utf8.RuneLen(r)})
+	}
+
+	var (
+		result []word
+		cur    word
+		gaps   []int
+		gap    int
+	)
+	flush := func() {
+		if len(cur) > 0 {
+			result = append(result, cur)
+			gaps = append(gaps, gap)
+			cur, gap = nil, 0
+		}
+	}
+
+	for i, c := range chars {
+		r := c.r
+		inWord := isWordRune(r)
+		if _, ok := leet[r]; ok && !inWord {
+			inWord = leetInWord(chars, i)
+		}
+
+		if !inWord {
+			if len(cur) > 0 {
+				flush()
+			}
+			if c.r == '\n' {
+				gap += 100
+			} else {
+				gap++
+			}
+			continue
+		}
+
+		if l, ok := leet[r]; ok {
+			r = l
+		}
+
+		if n := len(cur); n > 0 && cur[n-1].r == r {
+			cur[n-1].count++
+			cur[n-1].end = c.end
+			continue
+		}
+		cur = append(cur, symbol{r: r, count: 1, start: c.start, end: c.end})
+	}
+	flush()
+
+	return joinSpelledOut(result, gaps)
+}
+
+// joinSpelledOut merges three or more single-letter words in a row, separated by at most two
+// characters on the same line, into one word. Real one-letter words next to a spelled-out word, such
+// as "a" or "I", are swept in too, which is why the letters are marked as spelled.
+func joinSpelledOut(ws []word, gaps []int) []word {
+	const minLetters, maxGap = 3, 2
+
+	var result []word
+	for i := 0; i < len(ws); {
+		j := i + 1
+		if len(ws[i]) == 1 && ws[i][0].count == 1 {
+			for j < len(ws) && len(ws[j]) == 1 && ws[j][0].count == 1 && gaps[j] <= maxGap {
+				j++
+			}
+		}
+
+		if j-i < minLetters {
+			result = append(result, ws[i])
+			i++
+			continue
+		}
+
+		var joined word
+		for _, w := range ws[i:j] {
+			s := w[0]
+			s.spelled = true
+			if n := len(joined); n > 0 && joined[n-1].r == s.r {
+				joined[n-1].count++
+				joined[n-1].end = s.end
+				continue
+			}
+			joined = append(joined, s)
+		}
+		result = append(result, joined)
+		i = j
+	}
+	return result
+}
+
+// normalizePattern turns a rule pattern into the symbols it must match, with a separator between words
+func normalizePattern(pattern string) []symbol {
+	var out []symbol
+	for _, w := range words(pattern) {
+		if len(out) > 0 {
+			out = append(out, symbol{r: wordSeparator, count: 1})
+		}
+		out = append(out, w...)
+	}
+	return out
+}
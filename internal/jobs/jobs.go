@@ -0,0 +1,224 @@
+// Package jobs runs periodic maintenance tasks alongside the API server
+package jobs
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/analytics"
+	"github.com/bailey4770/chirpy/internal/blob"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/filter"
+	"github.com/google/uuid"
+)
+
+// every runs task once immediately and then every interval until ctx is cancelled
+func every(ctx context.Context, interval time.Duration, task func(ctx context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		task(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Background runs one-off tasks, such as sending mail, off the request path. Tasks are passed the
+// server's context, and Wait lets shutdown give the ones in flight time to finish.
+type Background struct {
+	ctx context.Context
+	wg  sync.WaitGroup
+}
+
+func NewBackground(ctx context.Context) *Background {
+	return &Background{ctx: ctx}
+}
+
+// Go runs task in its own goroutine. A nil Background runs it before returning, so tests can
+// check what the task did without waiting.
+func (b *Background) Go(task func(ctx context.Context)) {
+	if b == nil {
+		task(context.Background())
+		return
+	}
+	b.wg.Go(func() { task(b.ctx) })
+}
+
+// Wait blocks until every task started with Go has returned, or ctx is done
+func (b *Background) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type accountPurger interface {
+	DeleteExpiredAccounts(ctx context.Context) ([]uuid.UUID, error)
+}
+
+// PurgeDeletedAccounts permanently removes accounts whose deletion grace period has passed,
+// along with every file they uploaded
+func PurgeDeletedAccounts(ctx context.Context, db accountPurger, blobs blob.Store, interval time.Duration) {
+	every(ctx, interval, func(ctx context.Context) {
+		deleted, err := db.DeleteExpiredAccounts(ctx)
+		if err != nil {
+			log.Printf("Error: could not purge deleted accounts: %v", err)
+			return
+		}
+
+		for _, userID := range deleted {
+			if err := blobs.DeletePrefix(ctx, userID.String()); err != nil {
+				log.Printf("Error: could not delete uploads of purged user %v: %v", userID, err)
+			}
+		}
+		if len(deleted) > 0 {
+			log.Printf("Purged %d accounts past their deletion grace period", len(deleted))
+		}
+	})
+}
+
+type mediaPurger interface {
+	ListDetachedMediaAttachments(ctx context.Context, createdAt time.Time) ([]database.MediaAttachment, error)
+	DeleteMediaAttachment(ctx context.Context, id uuid.UUID) error
+}
+
+// PurgeDetachedMedia removes uploads that were never attached to a chirp within maxAge, and
+// attachments left behind when their chirp was deleted
+func PurgeDetachedMedia(ctx context.Context, db mediaPurger, blobs blob.Store, maxAge, interval time.Duration) {
+	every(ctx, interval, func(ctx context.Context) {
+		detached, err := db.ListDetachedMediaAttachments(ctx, time.Now().Add(-maxAge))
+		if err != nil {
+			log.Printf("Error: could not list detached media: %v", err)
+			return
+		}
+
+		purged := 0
+		for _, m := range detached {
+			if err := blobs.Delete(ctx, m.OriginalKey); err != nil {
+				log.Printf("Error: could not delete blob of media %v: %v", m.ID, err)
+				continue
+			}
+			if err := blobs.Delete(ctx, m.ThumbnailKey); err != nil {
+				log.Printf("Error: could not delete thumbnail of media %v: %v", m.ID, err)
+				continue
+			}
+			if err := db.DeleteMediaAttachment(ctx, m.ID); err != nil {
+				log.Printf("Error: could not delete media %v: %v", m.ID, err)
+				continue
+			}
+			purged++
+		}
+		if purged > 0 {
+			log.Printf("Purged %d detached media uploads", purged)
+		}
+	})
+}
+
+type exportPurger interface {
+	DeleteExpiredDataExports(ctx context.Context) (int64, error)
+}
+
+// PurgeExpiredExports removes data export archives once their download link has expired,
+// along with exports that never finished
+func PurgeExpiredExports(ctx context.Context, db exportPurger, interval time.Duration) {
+	every(ctx, interval, func(ctx context.Context) {
+		deleted, err := db.DeleteExpiredDataExports(ctx)
+		if err != nil {
+			log.Printf("Error: could not purge expired data exports: %v", err)
+		} else if deleted > 0 {
+			log.Printf("Purged %d expired data exports", deleted)
+		}
+	})
+}
+
+type filterRuleLister interface {
+	ListFilterRules(ctx context.Context) ([]database.FilterRule, error)
+}
+
+// ReloadFilterRules keeps engine in step with the rules in the database, so a rule changed through any
+// instance of the server applies everywhere within interval
+func ReloadFilterRules(ctx context.Context, db filterRuleLister, engine *filter.Engine, interval time.Duration) {
+	every(ctx, interval, func(ctx context.Context) {
+		rules, err := db.ListFilterRules(ctx)
+		if err != nil {
+			log.Printf("Error: could not reload filter rules: %v", err)
+			return
+		}
+
+		filterRules := make([]filter.Rule, 0, len(rules))
+		for _, r := range rules {
+			filterRules = append(filterRules, filter.Rule{Pattern: r.Pattern, Severity: r.Severity, Action: r.Action})
+		}
+		engine.Set(filterRules)
+	})
+}
+
+// impressionViewerRetention keeps who saw a chirp for the previous hour as well as the current one, so
+// impressions flushed late are still counted once
+const impressionViewerRetention = 2 * time.Hour
+
+type analyticsPruner interface {
+	DeleteAnalyticsCountsBefore(ctx context.Context, arg database.DeleteAnalyticsCountsBeforeParams) (int64, error)
+	DeleteChirpImpressionViewersBefore(ctx context.Context, windowStart time.Time) (int64, error)
+}
+
+// PruneAnalytics removes per-minute counts older than minuteRetention and hourly counts older than
+// hourRetention. Daily counts are kept for good. It also forgets who saw each chirp once their
+// impressions can no longer be repeated.
+func PruneAnalytics(ctx context.Context, db analyticsPruner, minuteRetention, hourRetention, interval time.Duration) {
+	every(ctx, interval, func(ctx context.Context) {
+		deleted, err := db.DeleteChirpImpressionViewersBefore(ctx, time.Now().UTC().Add(-impressionViewerRetention))
+		if err != nil {
+			log.Printf("Error: could not prune chirp impression viewers: %v", err)
+		} else if deleted > 0 {
+			log.Printf("Pruned %d chirp impression viewers", deleted)
+		}
+
+		for granularity, retention := range map[string]time.Duration{
+			analytics.GranularityMinute: minuteRetention,
+			analytics.GranularityHour:   hourRetention,
+		} {
+			deleted, err := db.DeleteAnalyticsCountsBefore(ctx, database.DeleteAnalyticsCountsBeforeParams{
+				Granularity: granularity,
+				Bucket:      time.Now().UTC().Add(-retention),
+			})
+			if err != nil {
+				log.Printf("Error: could not prune %s analytics: %v", granularity, err)
+			} else if deleted > 0 {
+				log.Printf("Pruned %d %s analytics counts", deleted, granularity)
+			}
+		}
+	})
+}
+
+type rateLimitPruner interface {
+	DeleteIdleRateLimitBuckets(ctx context.Context, updatedAt time.Time) (int64, error)
+}
+
+// PruneRateLimitBuckets removes rate limit buckets unused for maxIdle. It must be longer than the
+// window of every policy, so only buckets that have filled up again are removed.
+func PruneRateLimitBuckets(ctx context.Context, db rateLimitPruner, maxIdle, interval time.Duration) {
+	every(ctx, interval, func(ctx context.Context) {
+		deleted, err := db.DeleteIdleRateLimitBuckets(ctx, time.Now().UTC().Add(-maxIdle))
+		if err != nil {
+			log.Printf("Error: could not prune rate limit buckets: %v", err)
+		} else if deleted > 0 {
+			log.Printf("Pruned %d idle rate limit buckets", deleted)
+		}
+	})
+}
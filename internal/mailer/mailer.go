@@ -0,0 +1,141 @@
+// Package mailer provides a pluggable interface for sending transactional email, with SMTP, file and log backends
+package mailer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// ErrInvalidHeader is returned for a message whose recipient or subject contains a line break, which
+// would let it add headers of its own
+var ErrInvalidHeader = errors.New("mail header contains a line break")
+
+func (msg Message) checkHeaders() error {
+	for _, v := range []string{msg.To, msg.Subject} {
+		if strings.ContainsAny(v, "\r\n") {
+			return ErrInvalidHeader
+		}
+	}
+	return nil
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New builds the mailer named by kind ("smtp", "file" or "log"), defaulting to log
+func New(kind string, smtpCfg SMTPMailer, fileDir, from string) (Mailer, error) {
+	switch kind {
+	case "smtp":
+		smtpCfg.From = from
+		if smtpCfg.Host == "" {
+			return nil, fmt.Errorf("smtp mailer requires a host")
+		}
+		return &smtpCfg, nil
+	case "file":
+		if fileDir == "" {
+			return nil, fmt.Errorf("file mailer requires a directory")
+		}
+		return &FileMailer{Dir: fileDir, From: from}, nil
+	case "log", "":
+		return LogMailer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown mailer %q", kind)
+	}
+}
+
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	var smtpAuth smtp.Auth
+	if m.Username != "" {
+		smtpAuth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	data, err := format(m.From, msg)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(m.Host, m.Port)
+	if err := smtp.SendMail(addr, smtpAuth, m.From, []string{msg.To}, data); err != nil {
+		return fmt.Errorf("could not send mail to %s via %s: %v", msg.To, addr, err)
+	}
+
+	return nil
+}
+
+// FileMailer writes each message to its own .eml file, which is handy in development and tests
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	data, err := format(m.From, msg)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(m.Dir, 0o750); err != nil {
+		return fmt.Errorf("could not create mail directory: %v", err)
+	}
+
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), hex.EncodeToString(suffix))
+
+	if err := os.WriteFile(filepath.Join(m.Dir, name), data, 0o640); err != nil {
+		return fmt.Errorf("could not write mail to file: %v", err)
+	}
+
+	return nil
+}
+
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	if err := msg.checkHeaders(); err != nil {
+		return err
+	}
+	log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+func format(from string, msg Message) ([]byte, error) {
+	if err := msg.checkHeaders(); err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + msg.To + "\r\n")
+	b.WriteString("Subject: " + msg.Subject + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String()), nil
+}
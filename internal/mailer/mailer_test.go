@@ -0,0 +1,75 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m, err := New("file", SMTPMailer{}, dir, "noreply@chirpy.test")
+	if err != nil {
+		t.Fatalf("Error: could not create file mailer: %v", err)
+	}
+
+	msg := Message{To: "user@test.com", Subject: "Hello", Body: "line one\nline two"}
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Error: could not send mail: %v", err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("Fail: expected 1 mail file but found %d", len(entries))
+	}
+
+	data, _ := os.ReadFile(dir + "/" + entries[0].Name())
+	for _, want := range []string{"To: user@test.com\r\n", "Subject: Hello\r\n", "line one\r\nline two"} {
+		if !strings.Contains(string(data), want) {
+			t.Fatalf("Fail: expected mail to contain %q but got:\n%s", want, data)
+		}
+	}
+}
+
+func TestNewRejectsUnknownMailer(t *testing.T) {
+	if _, err := New("carrier-pigeon", SMTPMailer{}, "", ""); err == nil {
+		t.Fatal("Fail: expected an error for an unknown mailer")
+	}
+}
+
+func TestSendRejectsHeaderInjection(t *testing.T) {
+	dir := t.TempDir()
+	mailers := map[string]Mailer{
+		"smtp": &SMTPMailer{Host: "127.0.0.1", Port: "0", From: "noreply@chirpy.test"},
+		"file": &FileMailer{Dir: dir, From: "noreply@chirpy.test"},
+		"log":  LogMailer{},
+	}
+
+	type testCase struct {
+		testName string
+		msg      Message
+	}
+
+	testCases := []testCase{
+		{testName: "bcc in recipient", msg: Message{To: "user@test.com\r\nBcc: victim@test.com", Subject: "Hello", Body: "hi"}},
+		{testName: "bare line feed in recipient", msg: Message{To: "user@test.com\nBcc: victim@test.com", Subject: "Hello", Body: "hi"}},
+		{testName: "body in subject", msg: Message{To: "user@test.com", Subject: "Hello\r\n\r\nclick here", Body: "hi"}},
+		{testName: "bare carriage return in subject", msg: Message{To: "user@test.com", Subject: "Hello\rBcc: victim@test.com", Body: "hi"}},
+	}
+
+	for name, m := range mailers {
+		for _, tc := range testCases {
+			t.Run(name+"/"+tc.testName, func(t *testing.T) {
+				if err := m.Send(context.Background(), tc.msg); !errors.Is(err, ErrInvalidHeader) {
+					t.Fatalf("Fail: expected ErrInvalidHeader, got %v", err)
+				}
+			})
+		}
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("Fail: expected no mail to be written, found %d files", len(entries))
+	}
+}
@@ -0,0 +1,70 @@
+package media
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var errMalformedGIF = errors.New("malformed gif")
+
+// gifSize walks the blocks of a GIF without decoding any pixels, returning how many frames it has
+// and how many pixels they decode to between them
+func gifSize(data []byte) (frames, pixels int, err error) {
+	// header and logical screen descriptor
+	if len(data) < 13 {
+		return 0, 0, errMalformedGIF
+	}
+	i := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		i += 3 << ((flags & 0x07) + 1)
+	}
+
+	// skipSubBlocks moves i past a run of data sub-blocks and its terminator
+	skipSubBlocks := func() error {
+		for {
+			if i >= len(data) {
+				return errMalformedGIF
+			}
+			size := int(data[i])
+			i++
+			if size == 0 {
+				return nil
+			}
+			i += size
+		}
+	}
+
+	for i < len(data) {
+		switch data[i] {
+		case 0x21:
+			// extension: label, then sub-blocks
+			i += 2
+			if err := skipSubBlocks(); err != nil {
+				return 0, 0, err
+			}
+		case 0x2C:
+			// image descriptor, optional local color table, LZW code size, then sub-blocks
+			if i+10 > len(data) {
+				return 0, 0, errMalformedGIF
+			}
+			w := int(binary.LittleEndian.Uint16(data[i+5:]))
+			h := int(binary.LittleEndian.Uint16(data[i+7:]))
+			flags := data[i+9]
+			i += 10
+			if flags&0x80 != 0 {
+				i += 3 << ((flags & 0x07) + 1)
+			}
+			i++
+			if err := skipSubBlocks(); err != nil {
+				return 0, 0, err
+			}
+			frames++
+			pixels += w * h
+		case 0x3B:
+			return frames, pixels, nil
+		default:
+			return 0, 0, errMalformedGIF
+		}
+	}
+	return 0, 0, errMalformedGIF
+}
@@ -0,0 +1,207 @@
+// Package media checks uploaded images and prepares them for serving. Images are decoded and
+// re-encoded, which drops EXIF and every other kind of embedded metadata, and a thumbnail is made.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+const (
+	// MaxUploadBytes is the largest file accepted for upload
+	MaxUploadBytes = 10 << 20
+	// MaxPixels bounds the decoded size of an image, so a small file cannot expand into gigabytes. It
+	// covers every frame of an animated GIF together.
+	MaxPixels = 25_000_000
+	// MaxFrames bounds the number of frames in an animated GIF
+	MaxFrames = 300
+	// ThumbnailSize is the longest side of a thumbnail, in pixels
+	ThumbnailSize = 320
+
+	jpegQuality = 90
+)
+
+var (
+	ErrUnsupportedType = errors.New("file is not a JPEG, PNG or GIF image")
+	ErrTooLarge        = errors.New("image dimensions are too large")
+)
+
+type Image struct {
+	Data        []byte
+	ContentType string
+	Ext         string
+	Width       int
+	Height      int
+}
+
+// Processed holds an upload ready to store: the cleaned original and its thumbnail
+type Processed struct {
+	Original  Image
+	Thumbnail Image
+}
+
+// Process sniffs the real type of data, ignoring whatever the client claimed, and rejects anything
+// but JPEG, PNG and GIF images. JPEGs are rotated upright before their EXIF orientation is dropped.
+func Process(data []byte) (Processed, error) {
+	contentType := http.DetectContentType(data)
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif":
+	default:
+		return Processed{}, ErrUnsupportedType
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Processed{}, fmt.Errorf("could not read image header: %v", err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > MaxPixels {
+		return Processed{}, ErrTooLarge
+	}
+
+	switch contentType {
+	case "image/jpeg":
+		return processJPEG(data)
+	case "image/png":
+		return processPNG(data)
+	default:
+		return processGIF(data)
+	}
+}
+
+func processJPEG(data []byte) (Processed, error) {
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Processed{}, fmt.Errorf("could not decode jpeg: %v", err)
+	}
+	img = applyOrientation(img, exifOrientation(data))
+
+	original, err := encodeJPEG(img)
+	if err != nil {
+		return Processed{}, err
+	}
+
+	thumb, err := encodeJPEG(thumbnail(img, ThumbnailSize))
+	if err != nil {
+		return Processed{}, err
+	}
+
+	return Processed{Original: original, Thumbnail: thumb}, nil
+}
+
+func processPNG(data []byte) (Processed, error) {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Processed{}, fmt.Errorf("could not decode png: %v", err)
+	}
+
+	original, err := encodePNG(img)
+	if err != nil {
+		return Processed{}, err
+	}
+
+	thumb, err := encodePNG(thumbnail(img, ThumbnailSize))
+	if err != nil {
+		return Processed{}, err
+	}
+
+	return Processed{Original: original, Thumbnail: thumb}, nil
+}
+
+// processGIF keeps animation, but the thumbnail is a still of the first frame. The frames are counted
+// and measured before any are decoded, since each one is decoded to its own image.
+func processGIF(data []byte) (Processed, error) {
+	frames, pixels, err := gifSize(data)
+	if err != nil {
+		return Processed{}, fmt.Errorf("could not decode gif: %v", err)
+	}
+	if frames == 0 {
+		return Processed{}, errors.New("gif has no frames")
+	}
+	if frames > MaxFrames || pixels > MaxPixels {
+		return Processed{}, ErrTooLarge
+	}
+
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return Processed{}, fmt.Errorf("could not decode gif: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		return Processed{}, fmt.Errorf("could not encode gif: %v", err)
+	}
+	original := Image{Data: buf.Bytes(), ContentType: "image/gif", Ext: "gif", Width: g.Config.Width, Height: g.Config.Height}
+
+	first := image.NewRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+	draw.Draw(first, g.Image[0].Bounds(), g.Image[0], g.Image[0].Bounds().Min, draw.Over)
+
+	thumb, err := encodePNG(thumbnail(first, ThumbnailSize))
+	if err != nil {
+		return Processed{}, err
+	}
+
+	return Processed{Original: original, Thumbnail: thumb}, nil
+}
+
+func encodeJPEG(img image.Image) (Image, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return Image{}, fmt.Errorf("could not encode jpeg: %v", err)
+	}
+	b := img.Bounds()
+	return Image{Data: buf.Bytes(), ContentType: "image/jpeg", Ext: "jpg", Width: b.Dx(), Height: b.Dy()}, nil
+}
+
+func encodePNG(img image.Image) (Image, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return Image{}, fmt.Errorf("could not encode png: %v", err)
+	}
+	b := img.Bounds()
+	return Image{Data: buf.Bytes(), ContentType: "image/png", Ext: "png", Width: b.Dx(), Height: b.Dy()}, nil
+}
+
+// thumbnail scales img down to fit within size by size, averaging the source pixels behind
+// each thumbnail pixel. Images that already fit are returned unchanged.
+func thumbnail(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+
+	tw, th := size, size
+	if w > h {
+		th = max(1, h*size/w)
+	} else {
+		tw = max(1, w*size/h)
+	}
+
+	dst := image.NewRGBA64(image.Rect(0, 0, tw, th))
+	for y := range th {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+max((y+1)*h/th, y*h/th+1)
+		for x := range tw {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+max((x+1)*w/tw, x*w/tw+1)
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.RGBA64Model.Convert(img.At(sx, sy)).(color.RGBA64)
+					r, g, bl, a = r+uint64(c.R), g+uint64(c.G), bl+uint64(c.B), a+uint64(c.A)
+					n++
+				}
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n)})
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,163 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func testImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+// withOrientation inserts an EXIF segment holding only an orientation tag after the JPEG's SOI marker
+func withOrientation(jpg []byte, orientation byte) []byte {
+	tiff := []byte{
+		'M', 'M', 0x00, 0x2A, 0x00, 0x00, 0x00, 0x08,
+		0x00, 0x01,
+		0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, 0x00, orientation, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+	}
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	size := len(segment) + 2
+
+	out := []byte{0xFF, 0xD8, 0xFF, 0xE1, byte(size >> 8), byte(size)}
+	out = append(out, segment...)
+	return append(out, jpg[2:]...)
+}
+
+func TestProcess(t *testing.T) {
+	var pngBuf bytes.Buffer
+	_ = png.Encode(&pngBuf, testImage(640, 480))
+
+	processed, err := Process(pngBuf.Bytes())
+	if err != nil {
+		t.Fatalf("Fail: could not process png: %v", err)
+	}
+	if processed.Original.ContentType != "image/png" || processed.Original.Width != 640 || processed.Original.Height != 480 {
+		t.Fatalf("Fail: unexpected original %s %dx%d", processed.Original.ContentType, processed.Original.Width, processed.Original.Height)
+	}
+	if processed.Thumbnail.Width != ThumbnailSize || processed.Thumbnail.Height != 240 {
+		t.Fatalf("Fail: expected a %dx240 thumbnail but received %dx%d", ThumbnailSize, processed.Thumbnail.Width, processed.Thumbnail.Height)
+	}
+
+	var jpgBuf bytes.Buffer
+	_ = jpeg.Encode(&jpgBuf, testImage(200, 100), nil)
+	rotated := withOrientation(jpgBuf.Bytes(), 6)
+
+	if got := exifOrientation(rotated); got != 6 {
+		t.Fatalf("Fail: expected orientation 6 but read %d", got)
+	}
+
+	processed, err = Process(rotated)
+	if err != nil {
+		t.Fatalf("Fail: could not process jpeg: %v", err)
+	}
+	if processed.Original.Width != 100 || processed.Original.Height != 200 {
+		t.Fatalf("Fail: expected the jpeg to be turned upright to 100x200, got %dx%d", processed.Original.Width, processed.Original.Height)
+	}
+	if bytes.Contains(processed.Original.Data, []byte("Exif")) {
+		t.Fatal("Fail: EXIF metadata survived processing")
+	}
+
+	if _, err := Process([]byte("<html>not an image</html>")); !errors.Is(err, ErrUnsupportedType) {
+		t.Fatalf("Fail: expected ErrUnsupportedType, got %v", err)
+	}
+}
+
+// testGIF encodes an animation of n blank w by h frames
+func testGIF(w, h, n int) []byte {
+	g := &gif.GIF{}
+	for range n {
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, w, h), color.Palette{color.Black, color.White}))
+		g.Delay = append(g.Delay, 10)
+	}
+	var buf bytes.Buffer
+	_ = gif.EncodeAll(&buf, g)
+	return buf.Bytes()
+}
+
+func TestProcessGIF(t *testing.T) {
+	type testCase struct {
+		testName    string
+		data        []byte
+		expectedErr error
+	}
+
+	testCases := []testCase{
+		{testName: "animation", data: testGIF(64, 48, 10)},
+		{testName: "too many frames", data: testGIF(1, 1, MaxFrames+1), expectedErr: ErrTooLarge},
+		// each frame is within MaxPixels, but all of them together are not
+		{testName: "too many pixels across frames", data: testGIF(1000, 1000, 26), expectedErr: ErrTooLarge},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			processed, err := Process(tc.data)
+			if tc.expectedErr != nil {
+				if !errors.Is(err, tc.expectedErr) {
+					t.Fatalf("Fail: expected %v, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Fail: could not process gif: %v", err)
+			}
+			if processed.Original.ContentType != "image/gif" || processed.Original.Width != 64 || processed.Original.Height != 48 {
+				t.Fatalf("Fail: unexpected original %s %dx%d", processed.Original.ContentType, processed.Original.Width, processed.Original.Height)
+			}
+		})
+	}
+
+	if _, err := Process(testGIF(8, 8, 2)[:40]); err == nil {
+		t.Fatal("Fail: expected a truncated gif to be refused")
+	}
+}
+
+func TestApplyOrientation(t *testing.T) {
+	// a 2x1 image with a red pixel on the left and blue on the right
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	red, blue := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}
+	src.Set(0, 0, red)
+	src.Set(1, 0, blue)
+
+	type testCase struct {
+		orientation int
+		width       int
+		height      int
+		redAt       image.Point
+	}
+
+	testCases := []testCase{
+		{1, 2, 1, image.Pt(0, 0)},
+		{2, 2, 1, image.Pt(1, 0)},
+		{3, 2, 1, image.Pt(1, 0)},
+		{4, 2, 1, image.Pt(0, 0)},
+		{5, 1, 2, image.Pt(0, 0)},
+		{6, 1, 2, image.Pt(0, 0)},
+		{7, 1, 2, image.Pt(0, 1)},
+		{8, 1, 2, image.Pt(0, 1)},
+	}
+
+	for _, tc := range testCases {
+		out := applyOrientation(src, tc.orientation)
+		if b := out.Bounds(); b.Dx() != tc.width || b.Dy() != tc.height {
+			t.Fatalf("Fail: orientation %d expected %dx%d but received %dx%d", tc.orientation, tc.width, tc.height, b.Dx(), b.Dy())
+		}
+		r, _, _, _ := out.At(tc.redAt.X, tc.redAt.Y).RGBA()
+		if r == 0 {
+			t.Fatalf("Fail: orientation %d expected red at %v", tc.orientation, tc.redAt)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"embed"
+	"encoding/hex"
+	"strings"
+	"sync"
+)
+
+//go:embed data/breached_sha1.txt
+var breachedData embed.FS
+
+type BreachChecker interface {
+	IsBreached(password string) bool
+}
+
+// RangeStore answers k-anonymity range queries: given the first five hex characters of a SHA-1,
+// it returns the remaining 35 characters of every breached hash with that prefix.
+// This mirrors the Have I Been Pwned range API, so a remote store can be swapped in without
+// the full password hash ever leaving the server.
+type RangeStore interface {
+	Range(prefix string) []string
+}
+
+type RangeChecker struct {
+	Store RangeStore
+}
+
+func (c RangeChecker) IsBreached(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	for _, candidate := range c.Store.Range(prefix) {
+		if candidate == suffix {
+			return true
+		}
+	}
+
+	return false
+}
+
+// LocalRangeStore holds a breached-password list in PREFIX:SUFFIX form in memory
+type LocalRangeStore struct {
+	ranges map[string][]string
+}
+
+func (s *LocalRangeStore) Range(prefix string) []string {
+	return s.ranges[strings.ToUpper(prefix)]
+}
+
+func parseRangeList(data string) *LocalRangeStore {
+	store := &LocalRangeStore{ranges: map[string][]string{}}
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		prefix, suffix, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok || len(prefix) != 5 {
+			continue
+		}
+		// HIBP lines may carry a trailing :count
+		suffix, _, _ = strings.Cut(suffix, ":")
+		store.ranges[prefix] = append(store.ranges[prefix], suffix)
+	}
+
+	return store
+}
+
+var bundledBreachList = sync.OnceValue(func() BreachChecker {
+	data, err := breachedData.ReadFile("data/breached_sha1.txt")
+	if err != nil {
+		panic("password: bundled breach list missing: " + err.Error())
+	}
+	return RangeChecker{Store: parseRangeList(string(data))}
+})
+
+// BundledBreachList checks passwords against the breached-password hashes shipped with the binary
+func BundledBreachList() BreachChecker {
+	return bundledBreachList()
+}
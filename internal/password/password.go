@@ -0,0 +1,109 @@
+// Package password enforces password policy: length, estimated strength, similarity to the email, and breached-password checks
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	RuleRequired     = "required"
+	RuleMinLength    = "min_length"
+	RuleStrength     = "strength"
+	RuleMatchesEmail = "matches_email"
+	RuleBreached     = "breached"
+)
+
+type Policy struct {
+	MinLength int
+	// MinScore is the lowest acceptable Estimate score, from 0 (guessable) to 4 (very strong)
+	MinScore      int
+	DisallowEmail bool
+	Breached      BreachChecker
+}
+
+// DefaultPolicy is a sensible production policy using the bundled breached-password list
+func DefaultPolicy() Policy {
+	return Policy{
+		MinLength:     10,
+		MinScore:      2,
+		DisallowEmail: true,
+		Breached:      BundledBreachList(),
+	}
+}
+
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Validate returns every rule the password breaks, or nil if it is acceptable
+func (p Policy) Validate(password, email string) []Violation {
+	if password == "" {
+		return []Violation{{RuleRequired, "password is required"}}
+	}
+
+	var violations []Violation
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, Violation{
+			RuleMinLength,
+			fmt.Sprintf("password must be at least %d characters", p.MinLength),
+		})
+	}
+
+	if p.DisallowEmail && matchesEmail(password, email) {
+		violations = append(violations, Violation{
+			RuleMatchesEmail,
+			"password must not be the same as your email address",
+		})
+	}
+
+	if p.MinScore > 0 {
+		if strength := Estimate(password, emailInputs(email)...); strength.Score < p.MinScore {
+			violations = append(violations, Violation{
+				RuleStrength,
+				fmt.Sprintf("password is too easy to guess (strength %d of 4, need %d)", strength.Score, p.MinScore),
+			})
+		}
+	}
+
+	if p.Breached != nil && p.Breached.IsBreached(password) {
+		violations = append(violations, Violation{
+			RuleBreached,
+			"password has appeared in a known data breach",
+		})
+	}
+
+	return violations
+}
+
+func matchesEmail(password, email string) bool {
+	if email == "" {
+		return false
+	}
+
+	password = strings.ToLower(password)
+	email = strings.ToLower(strings.TrimSpace(email))
+	local, _, _ := strings.Cut(email, "@")
+
+	return password == email || password == local
+}
+
+// emailInputs feeds the email and its parts to the estimator as user-specific dictionary words
+func emailInputs(email string) []string {
+	if email == "" {
+		return nil
+	}
+
+	inputs := []string{email}
+	local, domain, _ := strings.Cut(email, "@")
+	inputs = append(inputs, local)
+	inputs = append(inputs, strings.FieldsFunc(local, func(r rune) bool { return r == '.' || r == '_' || r == '-' || r == '+' })...)
+	if name, _, ok := strings.Cut(domain, "."); ok {
+		inputs = append(inputs, name)
+	}
+
+	return inputs
+}
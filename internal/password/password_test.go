@@ -0,0 +1,91 @@
+package password
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEstimate(t *testing.T) {
+	type testCase struct {
+		password string
+		minScore int
+		maxScore int
+	}
+
+	testCases := []testCase{
+		{"password", 0, 0},
+		{"P@ssw0rd", 0, 1},
+		{"qwerty123", 0, 1},
+		{"abcdefgh", 0, 0},
+		{"aaaaaaaaaaaa", 0, 0},
+		{"dragon1987", 0, 2},
+		{"asdfghjkl;", 0, 1},
+		{"correcthorsebatterystaple", 3, 4},
+		{"xK9#mQ2$vL7!pZ4", 4, 4},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.password, func(t *testing.T) {
+			strength := Estimate(tc.password)
+			if strength.Score < tc.minScore || strength.Score > tc.maxScore {
+				t.Fatalf("Fail: expected score in [%d, %d] but received %d (%.0f guesses)", tc.minScore, tc.maxScore, strength.Score, strength.Guesses)
+			}
+		})
+	}
+}
+
+func TestEstimateUsesUserInputs(t *testing.T) {
+	const pw = "bartholomew-chirpy"
+
+	without := Estimate(pw)
+	with := Estimate(pw, "bartholomew", "chirpy")
+	if with.Guesses >= without.Guesses {
+		t.Fatalf("Fail: expected user inputs to lower guesses, got %.0f with and %.0f without", with.Guesses, without.Guesses)
+	}
+}
+
+func TestBundledBreachList(t *testing.T) {
+	checker := BundledBreachList()
+
+	for _, pw := range []string{"password", "123456", "Qwerty1", "letmein!"} {
+		if !checker.IsBreached(pw) {
+			t.Fatalf("Fail: expected %q to be in the breach list", pw)
+		}
+	}
+
+	if checker.IsBreached("violet-Harbour-92-lantern") {
+		t.Fatal("Fail: unexpected breach match for a random passphrase")
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	policy := DefaultPolicy()
+
+	type testCase struct {
+		testName      string
+		password      string
+		email         string
+		expectedRules []string
+	}
+
+	testCases := []testCase{
+		{"empty", "", "user@test.com", []string{RuleRequired}},
+		{"short and weak", "abc", "user@test.com", []string{RuleMinLength, RuleStrength}},
+		{"breached", "password123", "user@test.com", []string{RuleStrength, RuleBreached}},
+		{"same as email", "longusername@test.com", "longusername@test.com", []string{RuleMatchesEmail, RuleStrength}},
+		{"strong", "violet-Harbour-92-lantern", "user@test.com", nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			var rules []string
+			for _, v := range policy.Validate(tc.password, tc.email) {
+				rules = append(rules, v.Rule)
+			}
+
+			if !slices.Equal(rules, tc.expectedRules) {
+				t.Fatalf("Fail: expected violations %v but received %v", tc.expectedRules, rules)
+			}
+		})
+	}
+}
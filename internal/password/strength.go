@@ -0,0 +1,382 @@
+package password
+
+import (
+	"bufio"
+	_ "embed"
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Strength is a zxcvbn-style estimate of how many guesses an attacker would need,
+// and the 0-4 score those guesses fall into
+type Strength struct {
+	Guesses float64
+	Score   int
+}
+
+const (
+	bruteforceCardinality = 10
+	minSubmatchGuesses    = 50
+	minSingleCharGuesses  = 10
+	maxDictionaryWordLen  = 25
+	referenceYear         = 2025
+	minYearSpace          = 20
+)
+
+var (
+	//go:embed data/common_passwords.txt
+	commonPasswordsData string
+	//go:embed data/english_words.txt
+	englishWordsData string
+)
+
+type rankedDict map[string]int
+
+var builtinDicts = sync.OnceValue(func() []rankedDict {
+	return []rankedDict{
+		parseRankedDict(commonPasswordsData),
+		parseRankedDict(englishWordsData),
+	}
+})
+
+func parseRankedDict(data string) rankedDict {
+	dict := rankedDict{}
+	rank := 1
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		word := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if word == "" {
+			continue
+		}
+		if _, ok := dict[word]; !ok {
+			dict[word] = rank
+			rank++
+		}
+	}
+
+	return dict
+}
+
+type match struct {
+	i, j    int
+	guesses float64
+}
+
+// Estimate finds the cheapest way to build password from dictionary words, sequences, repeats,
+// keyboard patterns, years and brute force, in the manner of zxcvbn.
+// userInputs are treated as an extra dictionary, so passwords built from the user's own details score low.
+func Estimate(password string, userInputs ...string) Strength {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return Strength{Guesses: 1, Score: 0}
+	}
+
+	dicts := builtinDicts()
+	if len(userInputs) > 0 {
+		user := rankedDict{}
+		for i, input := range userInputs {
+			if input = strings.ToLower(input); len(input) >= 3 {
+				user[input] = i + 1
+			}
+		}
+		dicts = append(dicts[:len(dicts):len(dicts)], user)
+	}
+
+	var matches []match
+	matches = append(matches, dictionaryMatches(runes, dicts)...)
+	matches = append(matches, sequenceMatches(runes)...)
+	matches = append(matches, repeatMatches(runes)...)
+	matches = append(matches, spatialMatches(runes)...)
+	matches = append(matches, yearMatches(runes)...)
+
+	guesses := mostGuessableSequence(runes, matches)
+	return Strength{Guesses: guesses, Score: scoreFor(guesses)}
+}
+
+func scoreFor(guesses float64) int {
+	switch {
+	case guesses < 1e3+5:
+		return 0
+	case guesses < 1e6+5:
+		return 1
+	case guesses < 1e8+5:
+		return 2
+	case guesses < 1e10+5:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// mostGuessableSequence picks the non-overlapping matches that minimise total guesses,
+// filling any gaps with brute force
+func mostGuessableSequence(runes []rune, matches []match) float64 {
+	n := len(runes)
+	best := make([]float64, n+1)
+	best[0] = 1
+
+	for k := 1; k <= n; k++ {
+		best[k] = best[k-1] * bruteforceCardinality
+
+		for _, m := range matches {
+			if m.j != k-1 {
+				continue
+			}
+
+			g := m.guesses
+			if m.i > 0 || m.j < n-1 {
+				floor := float64(minSubmatchGuesses)
+				if m.i == m.j {
+					floor = minSingleCharGuesses
+				}
+				g = math.Max(g, floor)
+			}
+
+			if candidate := best[m.i] * g; candidate < best[k] {
+				best[k] = candidate
+			}
+		}
+	}
+
+	return best[n]
+}
+
+var leetSubstitutions = []map[rune]rune{
+	{'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '9': 'g', '1': 'i', '!': 'i', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z'},
+	{'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '9': 'g', '1': 'l', '|': 'l', '0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z'},
+}
+
+func dictionaryMatches(runes []rune, dicts []rankedDict) []match {
+	lower := []rune(strings.ToLower(string(runes)))
+
+	variants := [][]rune{lower}
+	for _, table := range leetSubstitutions {
+		unleet := make([]rune, len(lower))
+		for i, r := range lower {
+			if sub, ok := table[r]; ok {
+				unleet[i] = sub
+			} else {
+				unleet[i] = r
+			}
+		}
+		variants = append(variants, unleet)
+	}
+
+	var matches []match
+	for i := range lower {
+		for j := i + 2; j < len(lower) && j-i < maxDictionaryWordLen; j++ {
+			original := runes[i : j+1]
+			for v, variant := range variants {
+				word := string(variant[i : j+1])
+				if v > 0 && word == string(lower[i:j+1]) {
+					continue
+				}
+
+				for _, dict := range dicts {
+					if rank, ok := dict[word]; ok {
+						g := float64(rank) * uppercaseVariations(original)
+						if v > 0 {
+							g *= leetVariations(lower[i:j+1], variant[i:j+1])
+						}
+						matches = append(matches, match{i, j, g})
+					}
+					if rank, ok := dict[reverse(word)]; ok {
+						matches = append(matches, match{i, j, float64(rank) * uppercaseVariations(original) * 2})
+					}
+				}
+			}
+		}
+	}
+
+	return matches
+}
+
+func uppercaseVariations(word []rune) float64 {
+	upper := 0
+	for _, r := range word {
+		if unicode.IsUpper(r) {
+			upper++
+		}
+	}
+
+	switch {
+	case upper == 0:
+		return 1
+	case upper == len(word),
+		upper == 1 && unicode.IsUpper(word[0]),
+		upper == 1 && unicode.IsUpper(word[len(word)-1]):
+		return 2
+	default:
+		return math.Min(math.Pow(2, float64(upper)), 1e4)
+	}
+}
+
+func leetVariations(original, unleet []rune) float64 {
+	subs := 0
+	for i := range original {
+		if original[i] != unleet[i] {
+			subs++
+		}
+	}
+	return math.Pow(2, float64(subs))
+}
+
+func sequenceMatches(runes []rune) []match {
+	var matches []match
+
+	for i := 0; i+2 < len(runes); {
+		delta := runes[i+1] - runes[i]
+		if delta != 1 && delta != -1 {
+			i++
+			continue
+		}
+
+		j := i + 1
+		for j+1 < len(runes) && runes[j+1]-runes[j] == delta {
+			j++
+		}
+
+		if j-i >= 2 {
+			base := 26.0
+			if unicode.IsDigit(runes[i]) {
+				base = 10
+			}
+			if runes[i] == 'a' || runes[i] == 'A' || runes[i] == '1' || runes[i] == '0' {
+				base = 4
+			}
+
+			g := base * float64(j-i+1)
+			if delta < 0 {
+				g *= 2
+			}
+			matches = append(matches, match{i, j, g})
+		}
+		i = j
+	}
+
+	return matches
+}
+
+func repeatMatches(runes []rune) []match {
+	var matches []match
+
+	for i := 0; i < len(runes); {
+		j := i
+		for j+1 < len(runes) && runes[j+1] == runes[i] {
+			j++
+		}
+
+		if j-i >= 2 {
+			matches = append(matches, match{i, j, charCardinality(runes[i]) * float64(j-i+1)})
+		}
+		i = j + 1
+	}
+
+	return matches
+}
+
+func charCardinality(r rune) float64 {
+	switch {
+	case unicode.IsDigit(r):
+		return 10
+	case unicode.IsLetter(r):
+		return 26
+	default:
+		return 33
+	}
+}
+
+var qwertyRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm"}
+
+type keyPos struct{ row, col int }
+
+var qwertyPositions = sync.OnceValue(func() map[rune]keyPos {
+	positions := map[rune]keyPos{}
+	for r, row := range qwertyRows {
+		for c, key := range row {
+			positions[key] = keyPos{r, c}
+		}
+	}
+	return positions
+})
+
+// keyDirection returns which neighbouring key b is from a on a staggered qwerty layout, or -1
+func keyDirection(a, b rune) int {
+	positions := qwertyPositions()
+	pa, okA := positions[unicode.ToLower(a)]
+	pb, okB := positions[unicode.ToLower(b)]
+	if !okA || !okB {
+		return -1
+	}
+
+	neighbours := []keyPos{{0, -1}, {0, 1}, {-1, 0}, {-1, 1}, {1, -1}, {1, 0}}
+	for dir, n := range neighbours {
+		if pb.row-pa.row == n.row && pb.col-pa.col == n.col {
+			return dir
+		}
+	}
+
+	return -1
+}
+
+func spatialMatches(runes []rune) []match {
+	const startingKeys, averageDegree = 40.0, 6.0
+	var matches []match
+
+	for i := 0; i+1 < len(runes); {
+		j, turns, lastDir := i, 0, -1
+		for j+1 < len(runes) {
+			dir := keyDirection(runes[j], runes[j+1])
+			if dir < 0 {
+				break
+			}
+			if dir != lastDir {
+				turns++
+				lastDir = dir
+			}
+			j++
+		}
+
+		if j-i >= 3 {
+			g := startingKeys * float64(j-i+1) * math.Pow(averageDegree, float64(turns-1))
+			matches = append(matches, match{i, j, g})
+		}
+		i = max(j, i+1)
+	}
+
+	return matches
+}
+
+func yearMatches(runes []rune) []match {
+	var matches []match
+
+	for i := 0; i+3 < len(runes); i++ {
+		year := 0
+		isYear := true
+		for _, r := range runes[i : i+4] {
+			if !unicode.IsDigit(r) || r > '9' {
+				isYear = false
+				break
+			}
+			year = year*10 + int(r-'0')
+		}
+
+		if isYear && year >= 1900 && year <= 2099 {
+			g := math.Max(math.Abs(float64(year-referenceYear)), minYearSpace)
+			matches = append(matches, match{i, i + 3, g})
+		}
+	}
+
+	return matches
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
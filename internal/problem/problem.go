@@ -0,0 +1,86 @@
+// Package problem writes error responses as RFC 7807 problem details, in application/problem+json
+package problem
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const ContentType = "application/problem+json"
+
+// Codes for problems that clients are expected to handle. Any other problem's code comes from its status.
+const (
+	CodeValidation        = "validation_failed"
+	CodeInsufficientScope = "insufficient_scope"
+	CodeRateLimited       = "rate_limited"
+	CodeLockedOut         = "locked_out"
+	CodeSuspended         = "account_suspended"
+	CodeInvalidCSRF       = "invalid_csrf_token"
+)
+
+// FieldError says what is wrong with one field of a request
+type FieldError struct {
+	Field string `json:"field"`
+	// Code is the rule the field breaks, where there is one
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+// Details is an error response. Type is always about:blank, so Title is the status text and Code tells
+// problems with the same status apart.
+type Details struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Code   string `json:"code"`
+	// Detail explains this occurrence of the problem to a person
+	Detail string       `json:"detail,omitempty"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// New returns the problem details for status. An empty code is derived from the status, such as
+// "not_found" for 404.
+func New(status int, code, detail string) *Details {
+	if code == "" {
+		code = strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+	}
+	return &Details{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   code,
+		Detail: detail,
+	}
+}
+
+func (d *Details) Error() string {
+	if d.Detail == "" {
+		return d.Title
+	}
+	return d.Title + ": " + d.Detail
+}
+
+// Write sends d as the response, with its status
+func Write(w http.ResponseWriter, d *Details) {
+	data, err := json.Marshal(d)
+	if err != nil {
+		log.Printf("Error: could not marshal problem details: %v", err)
+		data = []byte(`{"type":"about:blank","title":"Internal Server Error","status":500,"code":"internal_server_error"}`)
+		d = &Details{Status: http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(d.Status)
+	if _, err := w.Write(data); err != nil {
+		log.Printf("Error: could not write problem details to response body: %v", err)
+	}
+}
+
+// Error replies with a problem whose code is derived from status. It takes the same arguments as
+// http.Error, which it replaces.
+func Error(w http.ResponseWriter, detail string, status int) {
+	Write(w, New(status, "", detail))
+}
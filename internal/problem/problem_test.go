@@ -0,0 +1,68 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestError(t *testing.T) {
+	type testCase struct {
+		testName     string
+		status       int
+		expectedCode string
+	}
+
+	testCases := []testCase{
+		{testName: "bad request", status: http.StatusBadRequest, expectedCode: "bad_request"},
+		{testName: "not found", status: http.StatusNotFound, expectedCode: "not_found"},
+		{testName: "too large", status: http.StatusRequestEntityTooLarge, expectedCode: "request_entity_too_large"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			Error(w, "something went wrong", tc.status)
+
+			if w.Code != tc.status {
+				t.Fatalf("Fail: expected status %d but received %d", tc.status, w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != ContentType {
+				t.Fatalf("Fail: expected content type %s, got %s", ContentType, ct)
+			}
+
+			var d Details
+			if err := json.Unmarshal(w.Body.Bytes(), &d); err != nil {
+				t.Fatalf("Error: could not unmarshal problem: %v", err)
+			}
+			expected := Details{Type: "about:blank", Title: http.StatusText(tc.status), Status: tc.status, Code: tc.expectedCode, Detail: "something went wrong"}
+			if d.Type != expected.Type || d.Title != expected.Title || d.Status != expected.Status || d.Code != expected.Code || d.Detail != expected.Detail {
+				t.Fatalf("Fail: expected %+v, got %+v", expected, d)
+			}
+		})
+	}
+}
+
+func TestWriteFieldErrors(t *testing.T) {
+	d := New(http.StatusBadRequest, CodeValidation, "profile is invalid")
+	d.Errors = []FieldError{{Field: "website", Message: "must be an http or https URL"}}
+
+	w := httptest.NewRecorder()
+	Write(w, d)
+
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Error: could not unmarshal problem: %v", err)
+	}
+	if body["code"] != CodeValidation {
+		t.Fatalf("Fail: expected code %s, got %v", CodeValidation, body["code"])
+	}
+	errs, ok := body["errors"].([]any)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("Fail: expected 1 field error, got %v", body["errors"])
+	}
+	if _, ok := errs[0].(map[string]any)["code"]; ok {
+		t.Fatal("Fail: expected an empty field error code to be left out")
+	}
+}
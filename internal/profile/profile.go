@@ -0,0 +1,138 @@
+// Package profile validates and sanitizes the public profile fields users can edit
+package profile
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	FieldDisplayName = "display_name"
+	FieldBio         = "bio"
+	FieldLocation    = "location"
+	FieldWebsite     = "website"
+	FieldAvatarURL   = "avatar_url"
+
+	MaxDisplayNameLength = 50
+	MaxBioLength         = 160
+	MaxLocationLength    = 50
+	MaxURLLength         = 200
+)
+
+// Fields is a full set of profile fields. An empty field is cleared.
+type Fields struct {
+	DisplayName string
+	Bio         string
+	Location    string
+	Website     string
+	AvatarURL   string
+}
+
+type Violation struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+const zeroWidthJoiner = '\u200d'
+
+var extraBlankLines = regexp.MustCompile(`\n{3,}`)
+
+// stripInvisible drops control characters and invisible formatting characters, such as zero-width
+// spaces and bidirectional overrides, which can be used to make one name look like another.
+// The zero-width joiner is kept, as emoji sequences need it.
+func stripInvisible(s string, keepNewlines bool) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' && keepNewlines:
+			return r
+		case unicode.IsSpace(r):
+			return ' '
+		case unicode.IsControl(r), unicode.Is(unicode.Cf, r) && r != zeroWidthJoiner:
+			return -1
+		default:
+			return r
+		}
+	}, strings.ToValidUTF8(s, ""))
+}
+
+// cleanLine sanitizes a single-line field, collapsing runs of whitespace to one space
+func cleanLine(s string) string {
+	return strings.Join(strings.Fields(stripInvisible(s, false)), " ")
+}
+
+// cleanText sanitizes a multi-line field, allowing at most one blank line in a row
+func cleanText(s string) string {
+	lines := strings.Split(stripInvisible(strings.ReplaceAll(s, "\r\n", "\n"), true), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRightFunc(line, unicode.IsSpace)
+	}
+	return strings.TrimSpace(extraBlankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+// cleanURL checks an absolute URL uses one of schemes and does not carry credentials, returning it normalised
+func cleanURL(raw string, schemes ...string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+
+	if len(raw) > MaxURLLength {
+		return "", fmt.Errorf("must be at most %d characters", MaxURLLength)
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return "", fmt.Errorf("must be an absolute URL")
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	supported := false
+	for _, scheme := range schemes {
+		supported = supported || u.Scheme == scheme
+	}
+	if !supported {
+		return "", fmt.Errorf("must use %s", strings.Join(schemes, " or "))
+	}
+
+	if u.User != nil {
+		return "", fmt.Errorf("must not contain a username or password")
+	}
+
+	return u.String(), nil
+}
+
+// Sanitize returns f with every field cleaned, along with each rule the cleaned fields break
+func Sanitize(f Fields) (Fields, []Violation) {
+	var violations []Violation
+	tooLong := func(field, value string, max int) {
+		if utf8.RuneCountInString(value) > max {
+			violations = append(violations, Violation{field, fmt.Sprintf("%s must be at most %d characters", field, max)})
+		}
+	}
+
+	clean := Fields{
+		DisplayName: cleanLine(f.DisplayName),
+		Bio:         cleanText(f.Bio),
+		Location:    cleanLine(f.Location),
+	}
+
+	tooLong(FieldDisplayName, clean.DisplayName, MaxDisplayNameLength)
+	tooLong(FieldBio, clean.Bio, MaxBioLength)
+	tooLong(FieldLocation, clean.Location, MaxLocationLength)
+
+	var err error
+	if clean.Website, err = cleanURL(f.Website, "https", "http"); err != nil {
+		violations = append(violations, Violation{FieldWebsite, FieldWebsite + " " + err.Error()})
+	}
+
+	// avatars are loaded by other users' browsers, so they must not be fetched over plain http
+	if clean.AvatarURL, err = cleanURL(f.AvatarURL, "https"); err != nil {
+		violations = append(violations, Violation{FieldAvatarURL, FieldAvatarURL + " " + err.Error()})
+	}
+
+	return clean, violations
+}
@@ -0,0 +1,125 @@
+package public
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/audit"
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/problem"
+	"github.com/google/uuid"
+)
+
+type accountDeletionParams struct {
+	Password string `json:"password"`
+}
+
+type apiAccountDeletion struct {
+	// DeleteAfter is when the account and everything it owns is permanently removed.
+	// Logging in again before then cancels the deletion.
+	DeleteAfter time.Time `json:"delete_after"`
+}
+
+type accountDeletionStore interface {
+	GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error)
+	ScheduleAccountDeletion(ctx context.Context, arg database.ScheduleAccountDeletionParams) error
+	RevokeAllRefreshTokensForUser(ctx context.Context, userID uuid.UUID) error
+	RevokeAllPersonalAccessTokensForUser(ctx context.Context, userID uuid.UUID) error
+	throttleStore
+	auditRecorder
+}
+
+// HandlerDeleteAccount schedules the caller's account for deletion once the grace period has passed.
+// Until then its chirps are hidden and every session and personal access token is revoked.
+func HandlerDeleteAccount(db accountDeletionStore, secret string, sessions SessionConfig, grace time.Duration) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		token, err := auth.GetBearerToken(req.Header)
+		if err != nil {
+			problem.Error(w, "could not get bearer token from header", http.StatusUnauthorized)
+			return
+		}
+
+		userID, err := auth.ValidateJWT(token, secret)
+		if err != nil {
+			log.Printf("Error: could not validate JWT: %v", err)
+			problem.Error(w, "could not validate JWT", http.StatusUnauthorized)
+			return
+		}
+
+		var deleteReq accountDeletionParams
+		if err := json.NewDecoder(req.Body).Decode(&deleteReq); err != nil {
+			problem.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		dbUser, err := db.GetUserByID(req.Context(), userID)
+		if err != nil {
+			problem.Error(w, "could not find user", http.StatusUnauthorized)
+			return
+		}
+
+		if dbUser.DeleteAfter.Valid {
+			problem.Error(w, "account is already scheduled for deletion", http.StatusConflict)
+			return
+		}
+
+		// a stolen access token must not be enough to guess the password at leisure
+		throttleKeys := loginThrottleKeys(req, dbUser.Email)
+		if until, locked := lockedUntil(req.Context(), db, throttleKeys); locked {
+			writeLockedOut(w, until)
+			return
+		}
+
+		ok, err := auth.CheckPasswordHash(deleteReq.Password, dbUser.HashedPassword)
+		if err != nil || !ok {
+			recordFailure(req.Context(), db, throttleKeys)
+			problem.Error(w, "incorrect password", http.StatusUnauthorized)
+			return
+		}
+
+		if err := db.ClearAuthThrottle(req.Context(), throttleKeys[0].key); err != nil {
+			log.Printf("Error: could not clear login throttle for user %v: %v", userID, err)
+		}
+
+		deleteAfter := time.Now().Add(grace)
+		event := audit.Event{
+			ActorID:    userID,
+			Action:     audit.ActionAccountDeletion,
+			TargetType: audit.TargetUser,
+			TargetID:   userID.String(),
+			Metadata:   map[string]string{"delete_after": deleteAfter.UTC().Format(time.RFC3339)},
+		}
+		err = db.RecordAudit(req.Context(), event, func(ctx context.Context) error {
+			if err := db.ScheduleAccountDeletion(ctx, database.ScheduleAccountDeletionParams{
+				ID:          userID,
+				DeleteAfter: sql.NullTime{Time: deleteAfter, Valid: true},
+			}); err != nil {
+				return fmt.Errorf("could not schedule deletion: %v", err)
+			}
+			if err := db.RevokeAllRefreshTokensForUser(ctx, userID); err != nil {
+				return fmt.Errorf("could not revoke refresh tokens: %v", err)
+			}
+			if err := db.RevokeAllPersonalAccessTokensForUser(ctx, userID); err != nil {
+				return fmt.Errorf("could not revoke personal access tokens: %v", err)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Error: could not delete account of user %v: %v", userID, err)
+			problem.Error(w, "could not delete account", http.StatusInternalServerError)
+			return
+		}
+
+		sessions.clearSessionCookies(w)
+
+		log.Printf("User %v scheduled their account for deletion after %v", userID, deleteAfter.Format(time.RFC3339))
+		w.WriteHeader(http.StatusAccepted)
+		writeResponse(apiAccountDeletion{DeleteAfter: deleteAfter}, w)
+	}
+}
@@ -0,0 +1,136 @@
+package public
+
+import (
+	"cmp"
+	"context"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/analytics"
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/problem"
+	"github.com/google/uuid"
+)
+
+// authorAnalyticsRanges are the length of a bucket, the range returned when from is not given, and the
+// longest range that can be asked for, per granularity
+var authorAnalyticsRanges = map[string]struct{ step, defaultRange, maxRange time.Duration }{
+	analytics.GranularityHour: {time.Hour, 24 * time.Hour, 31 * 24 * time.Hour},
+	analytics.GranularityDay:  {24 * time.Hour, 30 * 24 * time.Hour, 366 * 24 * time.Hour},
+}
+
+type apiImpressionPoint struct {
+	Bucket      time.Time `json:"bucket"`
+	Impressions int64     `json:"impressions"`
+}
+
+type apiChirpAnalytics struct {
+	ChirpID     uuid.UUID `json:"chirp_id"`
+	Impressions int64     `json:"impressions"`
+	// Points only has the buckets in which the chirp was seen
+	Points []apiImpressionPoint `json:"points"`
+}
+
+type apiAuthorAnalytics struct {
+	Granularity string    `json:"granularity"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Impressions int64     `json:"impressions"`
+	// Chirps are the caller's chirps seen in the range, most seen first
+	Chirps []apiChirpAnalytics `json:"chirps"`
+}
+
+type authorAnalyticsStore interface {
+	ListChirpImpressionsForUser(ctx context.Context, arg database.ListChirpImpressionsForUserParams) ([]database.ListChirpImpressionsForUserRow, error)
+	tokenAuthenticator
+}
+
+// HandlerGetMyAnalytics returns how many distinct viewers saw each of the caller's chirps over time.
+// granularity is hour or day (the default), and from and to are RFC 3339 times. Only Chirpy Red
+// members have analytics.
+func HandlerGetMyAnalytics(db authorAnalyticsStore, secret string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		caller, ok := requireAuth(w, req, db, secret, auth.ScopeChirpsRead)
+		if !ok {
+			return
+		}
+
+		dbUser, err := db.GetUserByID(req.Context(), caller.UserID)
+		if err != nil {
+			problem.Error(w, "could not find user", http.StatusNotFound)
+			return
+		}
+		if !dbUser.IsChirpyRed {
+			problem.Error(w, "analytics are only available to Chirpy Red members", http.StatusForbidden)
+			return
+		}
+
+		query := req.URL.Query()
+		params := database.ListChirpImpressionsForUserParams{UserID: caller.UserID, Granularity: query.Get("granularity")}
+		if params.Granularity == "" {
+			params.Granularity = analytics.GranularityDay
+		}
+		ranges, ok := authorAnalyticsRanges[params.Granularity]
+		if !ok {
+			problem.Error(w, "granularity must be hour or day", http.StatusBadRequest)
+			return
+		}
+
+		params.ToBucket = time.Now().UTC()
+		params.FromBucket = params.ToBucket.Add(-ranges.defaultRange)
+		for name, dst := range map[string]*time.Time{"from": &params.FromBucket, "to": &params.ToBucket} {
+			if v := query.Get(name); v != "" {
+				t, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					problem.Error(w, name+" must be an RFC 3339 time", http.StatusBadRequest)
+					return
+				}
+				*dst = t.UTC()
+			}
+		}
+
+		// buckets are in UTC, and a day starts at midnight UTC
+		params.FromBucket = params.FromBucket.Truncate(ranges.step)
+		if !params.FromBucket.Before(params.ToBucket) {
+			problem.Error(w, "from must be before to", http.StatusBadRequest)
+			return
+		}
+		if params.ToBucket.Sub(params.FromBucket) > ranges.maxRange {
+			problem.Error(w, "the range is too long for granularity "+params.Granularity, http.StatusBadRequest)
+			return
+		}
+
+		rows, err := db.ListChirpImpressionsForUser(req.Context(), params)
+		if err != nil {
+			log.Printf("Error: could not list chirp impressions of %v: %v", caller.UserID, err)
+			problem.Error(w, "could not get analytics", http.StatusInternalServerError)
+			return
+		}
+
+		resp := apiAuthorAnalytics{
+			Granularity: params.Granularity,
+			From:        params.FromBucket,
+			To:          params.ToBucket,
+			Chirps:      []apiChirpAnalytics{},
+		}
+		// rows are ordered by chirp, then bucket
+		for _, r := range rows {
+			if n := len(resp.Chirps); n == 0 || resp.Chirps[n-1].ChirpID != r.ChirpID {
+				resp.Chirps = append(resp.Chirps, apiChirpAnalytics{ChirpID: r.ChirpID, Points: []apiImpressionPoint{}})
+			}
+			c := &resp.Chirps[len(resp.Chirps)-1]
+			c.Points = append(c.Points, apiImpressionPoint{Bucket: r.Bucket, Impressions: r.Count})
+			c.Impressions += r.Count
+			resp.Impressions += r.Count
+		}
+		slices.SortStableFunc(resp.Chirps, func(a, b apiChirpAnalytics) int {
+			return cmp.Compare(b.Impressions, a.Impressions)
+		})
+
+		w.WriteHeader(http.StatusOK)
+		writeResponse(resp, w)
+	}
+}
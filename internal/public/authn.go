@@ -0,0 +1,229 @@
+package public
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/audit"
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/problem"
+	"github.com/google/uuid"
+)
+
+var (
+	errMissingScope = errors.New("token is missing a required scope")
+	errSuspended    = errors.New("account is suspended")
+	errReadOnly     = errors.New("account is suspended to read-only")
+)
+
+// principal is the user a request acts for, and what it is allowed to do
+type principal struct {
+	UserID uuid.UUID
+	// Scopes is nil for a first-party JWT session, which may do anything its user can.
+	// OAuth client tokens and personal access tokens only get the scopes they were granted.
+	Scopes []string
+}
+
+func (p principal) can(scope string) bool {
+	return p.Scopes == nil || slices.Contains(p.Scopes, scope)
+}
+
+type tokenAuthenticator interface {
+	GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (database.PersonalAccessToken, error)
+	TouchPersonalAccessToken(ctx context.Context, id uuid.UUID) error
+	userGetter
+}
+
+type userGetter interface {
+	GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error)
+}
+
+// activeSuspension looks up the kind of suspension userID is under, or "" if they are not suspended.
+// It is checked on every request rather than when tokens are issued, so a suspension applies at once.
+func activeSuspension(ctx context.Context, db userGetter, userID uuid.UUID) (string, error) {
+	dbUser, err := db.GetUserByID(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("could not find user %v: %v", userID, err)
+	}
+	return auth.ActiveSuspension(dbUser.SuspensionKind, dbUser.SuspendedAt, dbUser.SuspendedUntil, time.Now()), nil
+}
+
+// requireUnrestricted refuses a change to the account of a user who is suspended, even to read-only,
+// writing the error response itself. Handlers that validate a session JWT themselves call it, as
+// MiddlewareSuspension only stops full suspensions. Shadow-banned users are let through, so they
+// cannot tell they are banned.
+func requireUnrestricted(w http.ResponseWriter, req *http.Request, db userGetter, userID uuid.UUID) bool {
+	suspension, err := activeSuspension(req.Context(), db, userID)
+	if err != nil {
+		log.Printf("Error: could not check suspension: %v", err)
+		problem.Error(w, "could not validate JWT", http.StatusUnauthorized)
+		return false
+	}
+
+	switch suspension {
+	case auth.SuspensionFull:
+		problem.Write(w, problem.New(http.StatusForbidden, problem.CodeSuspended, errSuspended.Error()))
+		return false
+	case auth.SuspensionReadOnly:
+		problem.Write(w, problem.New(http.StatusForbidden, problem.CodeSuspended, errReadOnly.Error()))
+		return false
+	}
+	return true
+}
+
+// authenticate resolves the bearer token on req, which may be a session JWT, a JWT issued to an OAuth client,
+// or a personal access token, to a principal holding scope whose user is allowed to use it
+func authenticate(req *http.Request, db tokenAuthenticator, secret, scope string) (principal, error) {
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		return principal{}, err
+	}
+
+	var p principal
+	if auth.IsPersonalAccessToken(token) {
+		p, err = authenticatePersonalAccessToken(req.Context(), db, token)
+	} else {
+		var accessToken auth.AccessToken
+		accessToken, err = auth.ParseAccessToken(token, secret)
+		p = principal{UserID: accessToken.UserID, Scopes: accessToken.Scopes}
+	}
+	if err != nil {
+		return principal{}, err
+	}
+
+	if !p.can(scope) {
+		return principal{}, errMissingScope
+	}
+
+	suspension, err := activeSuspension(req.Context(), db, p.UserID)
+	if err != nil {
+		return principal{}, err
+	}
+	switch {
+	case suspension == auth.SuspensionFull:
+		return principal{}, errSuspended
+	case suspension == auth.SuspensionReadOnly && slices.Contains(auth.PublishingScopes, scope):
+		return principal{}, errReadOnly
+	}
+
+	return p, nil
+}
+
+func authenticatePersonalAccessToken(ctx context.Context, db tokenAuthenticator, token string) (principal, error) {
+	pat, err := db.GetPersonalAccessTokenByHash(ctx, auth.HashToken(token))
+	if err != nil {
+		return principal{}, errors.New("unknown personal access token")
+	}
+
+	if pat.RevokedAt.Valid {
+		return principal{}, fmt.Errorf("personal access token %v has been revoked", pat.ID)
+	}
+
+	if pat.ExpiresAt.Valid && pat.ExpiresAt.Time.Before(time.Now()) {
+		return principal{}, fmt.Errorf("personal access token %v has expired", pat.ID)
+	}
+
+	if err := db.TouchPersonalAccessToken(ctx, pat.ID); err != nil {
+		log.Printf("Error: could not record use of personal access token %v: %v", pat.ID, err)
+	}
+
+	return principal{UserID: pat.UserID, Scopes: pat.Scopes}, nil
+}
+
+// requireAuth authenticates req for scope, writing the error response itself if that fails
+func requireAuth(w http.ResponseWriter, req *http.Request, db tokenAuthenticator, secret, scope string) (principal, bool) {
+	p, err := authenticate(req, db, secret, scope)
+	if errors.Is(err, errMissingScope) {
+		problem.Write(w, problem.New(http.StatusForbidden, problem.CodeInsufficientScope, fmt.Sprintf("token is missing required scope %s", scope)))
+		return principal{}, false
+	} else if errors.Is(err, errSuspended) || errors.Is(err, errReadOnly) {
+		problem.Write(w, problem.New(http.StatusForbidden, problem.CodeSuspended, err.Error()))
+		return principal{}, false
+	} else if err != nil {
+		log.Printf("Error: could not authenticate request: %v", err)
+		problem.Error(w, "could not validate bearer token", http.StatusUnauthorized)
+		return principal{}, false
+	}
+
+	return p, true
+}
+
+// optionalAuth identifies the viewer of a public read. Anonymous requests get a zero principal,
+// but a token that is sent must still be valid.
+func optionalAuth(w http.ResponseWriter, req *http.Request, db tokenAuthenticator, secret, scope string) (principal, bool) {
+	if req.Header.Get("Authorization") == "" {
+		return principal{}, true
+	}
+	return requireAuth(w, req, db, secret, scope)
+}
+
+// MiddlewareSuspension refuses every request made with the JWT of a fully suspended user, including to
+// handlers that check the token themselves instead of calling requireAuth. Requests with no JWT are handed on.
+func MiddlewareSuspension(db userGetter, secret string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		token, err := auth.GetBearerToken(req.Header)
+		if err != nil {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		accessToken, err := auth.ParseAccessToken(token, secret)
+		if err != nil {
+			// personal access tokens, refresh tokens and API keys are checked by their handlers
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		if suspension, err := activeSuspension(req.Context(), db, accessToken.UserID); err == nil && suspension == auth.SuspensionFull {
+			problem.Write(w, problem.New(http.StatusForbidden, problem.CodeSuspended, errSuspended.Error()))
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
+
+// MiddlewareImpersonation marks requests made with an impersonation token, so every audit event they record
+// names the admin behind them. Requests that may change something are also recorded themselves, before they
+// are handed on, and are refused if that fails.
+func MiddlewareImpersonation(db auditRecorder, secret string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		token, err := auth.GetBearerToken(req.Header)
+		if err != nil {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		accessToken, err := auth.ParseAccessToken(token, secret)
+		if err != nil || accessToken.ImpersonatorID == uuid.Nil {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		req = req.WithContext(audit.WithImpersonator(req.Context(), accessToken.ImpersonatorID))
+		log.Printf("Warning: admin %v is acting as user %v: %s %s", accessToken.ImpersonatorID, accessToken.UserID, req.Method, req.URL.Path)
+
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			event := audit.Event{
+				ActorID:    accessToken.ImpersonatorID,
+				Action:     audit.ActionImpersonatedRequest,
+				TargetType: audit.TargetUser,
+				TargetID:   accessToken.UserID.String(),
+				Metadata:   map[string]string{"method": req.Method, "path": req.URL.Path},
+			}
+			if err := db.RecordAudit(req.Context(), event, nil); err != nil {
+				log.Printf("Error: could not record impersonated request: %v", err)
+				problem.Error(w, "could not record impersonated request", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,296 @@
+package public
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/audit"
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/jobs"
+	"github.com/bailey4770/chirpy/internal/mailer"
+	"github.com/bailey4770/chirpy/internal/password"
+	"github.com/bailey4770/chirpy/internal/problem"
+	"github.com/google/uuid"
+)
+
+const (
+	tokenPurposeVerifyEmail   = "verify_email"
+	tokenPurposeResetPassword = "reset_password"
+
+	verifyEmailTTL   = 48 * time.Hour
+	resetPasswordTTL = time.Hour
+)
+
+// MailConfig holds what handlers need to send transactional email containing links back to the app
+type MailConfig struct {
+	Mailer     mailer.Mailer
+	AppBaseURL string
+	// APIBaseURL is where links that must hit the API directly, such as export downloads, point
+	APIBaseURL string
+	// Background sends mail that must not hold up the response, such as mail whose timing would
+	// reveal whether an address has an account
+	Background *jobs.Background
+}
+
+func (m MailConfig) link(path, token string) string {
+	return m.AppBaseURL + path + "?token=" + url.QueryEscape(token)
+}
+
+type emailTokenParams struct {
+	Token string `json:"token"`
+}
+
+type passwordResetRequestParams struct {
+	Email string `json:"email"`
+}
+
+type passwordResetParams struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type userTokenIssuer interface {
+	CreateUserToken(ctx context.Context, arg database.CreateUserTokenParams) error
+	DeleteUserTokens(ctx context.Context, arg database.DeleteUserTokensParams) error
+}
+
+// issueUserToken replaces any outstanding token for purpose with a new one to be sent to email,
+// returning the raw token. Only the hash is stored.
+func issueUserToken(ctx context.Context, db userTokenIssuer, userID uuid.UUID, email, purpose string, ttl time.Duration) (string, error) {
+	if err := db.DeleteUserTokens(ctx, database.DeleteUserTokensParams{
+		UserID:  userID,
+		Purpose: purpose,
+	}); err != nil {
+		return "", fmt.Errorf("could not clear outstanding %s tokens: %v", purpose, err)
+	}
+
+	token := auth.MakeRefreshToken()
+	if err := db.CreateUserToken(ctx, database.CreateUserTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    userID,
+		Purpose:   purpose,
+		Email:     email,
+		ExpiresAt: time.Now().Add(ttl),
+	}); err != nil {
+		return "", fmt.Errorf("could not create %s token: %v", purpose, err)
+	}
+
+	return token, nil
+}
+
+func sendVerificationEmail(ctx context.Context, db userTokenIssuer, mail MailConfig, userID uuid.UUID, email string) error {
+	token, err := issueUserToken(ctx, db, userID, email, tokenPurposeVerifyEmail, verifyEmailTTL)
+	if err != nil {
+		return err
+	}
+
+	return mail.Mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Verify your Chirpy email address",
+		Body: fmt.Sprintf(
+			"Confirm this is your email address by visiting the link below.\n\n%s\n\nThe link expires in %d hours.",
+			mail.link("/verify-email", token), int(verifyEmailTTL.Hours()),
+		),
+	})
+}
+
+type verificationStore interface {
+	GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error)
+	MarkEmailVerified(ctx context.Context, arg database.MarkEmailVerifiedParams) (int64, error)
+	ConsumeUserToken(ctx context.Context, arg database.ConsumeUserTokenParams) (database.ConsumeUserTokenRow, error)
+	userTokenIssuer
+}
+
+func HandlerRequestEmailVerification(db verificationStore, secret string, mail MailConfig) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		token, err := auth.GetBearerToken(req.Header)
+		if err != nil {
+			problem.Error(w, "could not get bearer token from header", http.StatusUnauthorized)
+			return
+		}
+
+		userID, err := auth.ValidateJWT(token, secret)
+		if err != nil {
+			log.Printf("Error: could not validate JWT: %v", err)
+			problem.Error(w, "could not validate JWT", http.StatusUnauthorized)
+			return
+		}
+
+		dbUser, err := db.GetUserByID(req.Context(), userID)
+		if err != nil {
+			problem.Error(w, "could not find user", http.StatusNotFound)
+			return
+		}
+
+		if dbUser.EmailVerified {
+			problem.Error(w, "email address is already verified", http.StatusConflict)
+			return
+		}
+
+		if err := sendVerificationEmail(req.Context(), db, mail, dbUser.ID, dbUser.Email); err != nil {
+			log.Printf("Error: could not send verification email to user %v: %v", userID, err)
+			problem.Error(w, "could not send verification email", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func HandlerVerifyEmail(db verificationStore) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var verifyReq emailTokenParams
+		if err := json.NewDecoder(req.Body).Decode(&verifyReq); err != nil {
+			problem.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		token, err := db.ConsumeUserToken(req.Context(), database.ConsumeUserTokenParams{
+			TokenHash: auth.HashToken(verifyReq.Token),
+			Purpose:   tokenPurposeVerifyEmail,
+		})
+		if err != nil {
+			problem.Error(w, "invalid or expired verification token", http.StatusBadRequest)
+			return
+		}
+
+		// only the address the link was sent to is verified, in case the email changed since
+		verified, err := db.MarkEmailVerified(req.Context(), database.MarkEmailVerifiedParams{
+			ID:    token.UserID,
+			Email: token.Email,
+		})
+		if err != nil {
+			log.Printf("Error: could not mark email verified for user %v: %v", token.UserID, err)
+			problem.Error(w, "could not verify email", http.StatusInternalServerError)
+			return
+		}
+		if verified == 0 {
+			problem.Error(w, "invalid or expired verification token", http.StatusBadRequest)
+			return
+		}
+
+		log.Printf("User %v verified their email address", token.UserID)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+type passwordResetStore interface {
+	GetUserByEmail(ctx context.Context, email string) (database.User, error)
+	GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error)
+	GetValidUserToken(ctx context.Context, arg database.GetValidUserTokenParams) (uuid.UUID, error)
+	ConsumeUserToken(ctx context.Context, arg database.ConsumeUserTokenParams) (database.ConsumeUserTokenRow, error)
+	UpdatePassword(ctx context.Context, arg database.UpdatePasswordParams) error
+	RevokeAllRefreshTokensForUser(ctx context.Context, userID uuid.UUID) error
+	userTokenIssuer
+	auditRecorder
+}
+
+func HandlerRequestPasswordReset(db passwordResetStore, mail MailConfig) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var resetReq passwordResetRequestParams
+		if err := json.NewDecoder(req.Body).Decode(&resetReq); err != nil {
+			problem.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		// always accept so the response does not reveal whether an account exists
+		defer w.WriteHeader(http.StatusAccepted)
+
+		dbUser, err := db.GetUserByEmail(req.Context(), resetReq.Email)
+		if err != nil {
+			log.Printf("Password reset requested for unknown email")
+			return
+		}
+
+		// the token is issued and sent off the request path, so a known address is answered as
+		// quickly as an unknown one
+		mail.Background.Go(func(ctx context.Context) {
+			token, err := issueUserToken(ctx, db, dbUser.ID, dbUser.Email, tokenPurposeResetPassword, resetPasswordTTL)
+			if err != nil {
+				log.Printf("Error: %v", err)
+				return
+			}
+
+			if err := mail.Mailer.Send(ctx, mailer.Message{
+				To:      dbUser.Email,
+				Subject: "Reset your Chirpy password",
+				Body: fmt.Sprintf(
+					"Someone asked to reset the password for your Chirpy account. If it was you, visit the link below.\n\n%s\n\nThe link expires in %d minutes. If you did not ask for this you can ignore this email.",
+					mail.link("/reset-password", token), int(resetPasswordTTL.Minutes()),
+				),
+			}); err != nil {
+				log.Printf("Error: could not send password reset email to user %v: %v", dbUser.ID, err)
+			}
+		})
+	}
+}
+
+func HandlerResetPassword(db passwordResetStore, policy password.Policy) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var resetReq passwordResetParams
+		if err := json.NewDecoder(req.Body).Decode(&resetReq); err != nil {
+			problem.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		tokenParams := database.GetValidUserTokenParams{
+			TokenHash: auth.HashToken(resetReq.Token),
+			Purpose:   tokenPurposeResetPassword,
+		}
+
+		// check the token without spending it, so a rejected password can be retried with the same link
+		userID, err := db.GetValidUserToken(req.Context(), tokenParams)
+		if err != nil {
+			problem.Error(w, "invalid or expired reset token", http.StatusBadRequest)
+			return
+		}
+
+		dbUser, err := db.GetUserByID(req.Context(), userID)
+		if err != nil {
+			problem.Error(w, "invalid or expired reset token", http.StatusBadRequest)
+			return
+		}
+
+		if violations := policy.Validate(resetReq.Password, dbUser.Email); len(violations) > 0 {
+			writePasswordViolations(w, violations)
+			return
+		}
+
+		if _, err := db.ConsumeUserToken(req.Context(), database.ConsumeUserTokenParams(tokenParams)); err != nil {
+			problem.Error(w, "invalid or expired reset token", http.StatusBadRequest)
+			return
+		}
+
+		hashedPassword, err := auth.HashPassword(resetReq.Password)
+		if err != nil {
+			log.Printf("Error: could not hash password: %v", err)
+			problem.Error(w, "could not hash password", http.StatusInternalServerError)
+			return
+		}
+
+		event := audit.Event{ActorID: userID, Action: audit.ActionPasswordReset, TargetType: audit.TargetUser, TargetID: userID.String()}
+		if err := db.RecordAudit(req.Context(), event, func(ctx context.Context) error {
+			return db.UpdatePassword(ctx, database.UpdatePasswordParams{
+				ID:             userID,
+				HashedPassword: hashedPassword,
+			})
+		}); err != nil {
+			log.Printf("Error: could not update password for user %v: %v", userID, err)
+			problem.Error(w, "could not update password", http.StatusInternalServerError)
+			return
+		}
+
+		if err := db.RevokeAllRefreshTokensForUser(req.Context(), userID); err != nil {
+			log.Printf("Error: could not revoke refresh tokens for user %v: %v", userID, err)
+		}
+
+		log.Printf("Warning: user %v reset their password", userID)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
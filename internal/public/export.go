@@ -0,0 +1,236 @@
+package public
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/mailer"
+	"github.com/bailey4770/chirpy/internal/problem"
+	"github.com/bailey4770/chirpy/internal/takeout"
+	"github.com/google/uuid"
+)
+
+const (
+	exportStatusPending = "pending"
+	exportStatusFailed  = "failed"
+
+	// exportTTL is how long a finished archive, and the signed link to it, stays available
+	exportTTL      = 7 * 24 * time.Hour
+	exportCooldown = 24 * time.Hour
+)
+
+// runExport builds archives in the background so the request returns straight away.
+// Tests swap it for a synchronous call.
+var runExport = func(build func()) { go build() }
+
+type apiDataExport struct {
+	ID        uuid.UUID `json:"id"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	// DownloadURL works without logging in until ExpiresAt, so it can be opened from the email
+	DownloadURL string     `json:"download_url,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+func exportDownloadPath(exportID uuid.UUID) string {
+	return "/api/exports/" + exportID.String() + "/download"
+}
+
+func (m MailConfig) exportDownloadURL(export database.DataExport, secret string) string {
+	return m.APIBaseURL + auth.SignURL(exportDownloadPath(export.ID), export.ExpiresAt.Time, secret)
+}
+
+func dbExportToAPIExport(export database.DataExport, mail MailConfig, secret string) apiDataExport {
+	resp := apiDataExport{
+		ID:        export.ID,
+		Status:    export.Status,
+		CreatedAt: export.CreatedAt,
+	}
+
+	if export.ExpiresAt.Valid {
+		resp.DownloadURL = mail.exportDownloadURL(export, secret)
+		resp.ExpiresAt = &export.ExpiresAt.Time
+	}
+
+	return resp
+}
+
+type dataExportStore interface {
+	GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error)
+	ListChirpsForUser(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error)
+	ListRefreshTokensForUser(ctx context.Context, userID uuid.UUID) ([]database.RefreshToken, error)
+	ListPersonalAccessTokens(ctx context.Context, userID uuid.UUID) ([]database.PersonalAccessToken, error)
+	ListOAuthClients(ctx context.Context, ownerID uuid.UUID) ([]database.OauthClient, error)
+	ListWebhookDeliveriesForUser(ctx context.Context, userID uuid.NullUUID) ([]database.WebhookDelivery, error)
+	CreateDataExport(ctx context.Context, userID uuid.UUID) (database.DataExport, error)
+	GetDataExport(ctx context.Context, arg database.GetDataExportParams) (database.DataExport, error)
+	GetLatestDataExport(ctx context.Context, userID uuid.UUID) (database.DataExport, error)
+	CompleteDataExport(ctx context.Context, arg database.CompleteDataExportParams) error
+	FailDataExport(ctx context.Context, id uuid.UUID) error
+}
+
+// HandlerRequestDataExport starts building an archive of everything Chirpy holds about the caller.
+// The user is emailed a download link once it is ready, and can poll HandlerGetDataExport meanwhile.
+func HandlerRequestDataExport(db dataExportStore, secret string, mail MailConfig) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		token, err := auth.GetBearerToken(req.Header)
+		if err != nil {
+			problem.Error(w, "could not get bearer token from header", http.StatusUnauthorized)
+			return
+		}
+
+		userID, err := auth.ValidateJWT(token, secret)
+		if err != nil {
+			log.Printf("Error: could not validate JWT: %v", err)
+			problem.Error(w, "could not validate JWT", http.StatusUnauthorized)
+			return
+		}
+
+		if latest, err := db.GetLatestDataExport(req.Context(), userID); err == nil {
+			if latest.Status == exportStatusPending {
+				problem.Error(w, "an export is already being prepared", http.StatusConflict)
+				return
+			}
+
+			if next := latest.CreatedAt.Add(exportCooldown); latest.Status != exportStatusFailed && time.Now().Before(next) {
+				w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(time.Until(next).Seconds()))))
+				problem.Error(w, "only one export can be requested per day", http.StatusTooManyRequests)
+				return
+			}
+		}
+
+		export, err := db.CreateDataExport(req.Context(), userID)
+		if err != nil {
+			log.Printf("Error: could not create data export for user %v: %v", userID, err)
+			problem.Error(w, "could not start export", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("User %v requested a data export", userID)
+		w.WriteHeader(http.StatusAccepted)
+		writeResponse(dbExportToAPIExport(export, mail, secret), w)
+
+		runExport(func() { buildDataExport(context.Background(), db, secret, mail, export.ID, userID) })
+	}
+}
+
+func buildDataExport(ctx context.Context, db dataExportStore, secret string, mail MailConfig, exportID, userID uuid.UUID) {
+	fail := func(err error) {
+		log.Printf("Error: could not build data export %v for user %v: %v", exportID, userID, err)
+		if err := db.FailDataExport(ctx, exportID); err != nil {
+			log.Printf("Error: could not mark data export %v as failed: %v", exportID, err)
+		}
+	}
+
+	data, err := takeout.Collect(ctx, db, userID)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	archive, err := takeout.Build(data)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	expiresAt := sql.NullTime{Time: time.Now().Add(exportTTL), Valid: true}
+	if err := db.CompleteDataExport(ctx, database.CompleteDataExportParams{
+		ID:        exportID,
+		Archive:   archive,
+		ExpiresAt: expiresAt,
+	}); err != nil {
+		fail(err)
+		return
+	}
+
+	if err := mail.Mailer.Send(ctx, mailer.Message{
+		To:      data.Profile.Email,
+		Subject: "Your Chirpy data export is ready",
+		Body: fmt.Sprintf(
+			"The copy of your Chirpy data you asked for is ready to download:\n\n%s\n\nThe link expires in %d days. Anyone with the link can download the archive, so do not share it.",
+			mail.exportDownloadURL(database.DataExport{ID: exportID, ExpiresAt: expiresAt}, secret), int(exportTTL.Hours()/24),
+		),
+	}); err != nil {
+		log.Printf("Error: could not send data export email to user %v: %v", userID, err)
+	}
+
+	log.Printf("Data export %v for user %v is ready", exportID, userID)
+}
+
+func HandlerGetDataExport(db dataExportStore, secret string, mail MailConfig) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		token, err := auth.GetBearerToken(req.Header)
+		if err != nil {
+			problem.Error(w, "could not get bearer token from header", http.StatusUnauthorized)
+			return
+		}
+
+		userID, err := auth.ValidateJWT(token, secret)
+		if err != nil {
+			log.Printf("Error: could not validate JWT: %v", err)
+			problem.Error(w, "could not validate JWT", http.StatusUnauthorized)
+			return
+		}
+
+		exportID, err := uuid.Parse(req.PathValue("exportID"))
+		if err != nil {
+			problem.Error(w, "could not parse export ID to uuid", http.StatusBadRequest)
+			return
+		}
+
+		export, err := db.GetDataExport(req.Context(), database.GetDataExportParams{
+			ID:     exportID,
+			UserID: userID,
+		})
+		if err != nil {
+			problem.Error(w, "could not find export", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		writeResponse(dbExportToAPIExport(export, mail, secret), w)
+	}
+}
+
+type dataExportArchiveGetter interface {
+	GetDataExportArchive(ctx context.Context, id uuid.UUID) ([]byte, error)
+}
+
+// HandlerDownloadDataExport serves a finished archive to anyone holding a valid signed link
+func HandlerDownloadDataExport(db dataExportArchiveGetter, secret string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		exportID, err := uuid.Parse(req.PathValue("exportID"))
+		if err != nil {
+			problem.Error(w, "could not parse export ID to uuid", http.StatusBadRequest)
+			return
+		}
+
+		if err := auth.ValidateSignedURL(exportDownloadPath(exportID), req.URL.Query(), secret); err != nil {
+			problem.Error(w, "invalid or expired download link", http.StatusForbidden)
+			return
+		}
+
+		archive, err := db.GetDataExportArchive(req.Context(), exportID)
+		if err != nil {
+			problem.Error(w, "export not found or expired", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="chirpy-export.zip"`)
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write(archive); err != nil {
+			log.Printf("Error: could not write data export %v: %v", exportID, err)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package public
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/clientip"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/mailer"
+	"github.com/bailey4770/chirpy/internal/problem"
+	"github.com/google/uuid"
+)
+
+const (
+	tokenPurposeMagicLogin = "magic_login"
+	magicLinkTTL           = 15 * time.Minute
+
+	magicDeviceCookieName = "chirpy_magic_device"
+)
+
+type magicLinkRequestParams struct {
+	Email string `json:"email"`
+}
+
+// magicLinkRequest is returned whether or not the email belongs to an account
+type magicLinkRequest struct {
+	// DeviceToken must be sent back with the link's token. Browsers also get it as a cookie.
+	DeviceToken string `json:"device_token"`
+}
+
+type magicLinkVerifyParams struct {
+	Token       string `json:"token"`
+	DeviceToken string `json:"device_token"`
+	Session     string `json:"session"`
+}
+
+// magicTokenHash binds a link token to the device that asked for it. The link alone is useless
+// to anyone who intercepts the email, as they do not hold the device token.
+func magicTokenHash(token, deviceToken string) string {
+	return auth.HashToken(token + ":" + deviceToken)
+}
+
+type magicLinkStore interface {
+	GetUserByEmail(ctx context.Context, email string) (database.User, error)
+	GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error)
+	ConsumeUserToken(ctx context.Context, arg database.ConsumeUserTokenParams) (database.ConsumeUserTokenRow, error)
+	MarkEmailVerified(ctx context.Context, arg database.MarkEmailVerifiedParams) (int64, error)
+	sessionIssuer
+	userTokenIssuer
+	throttleStore
+}
+
+// HandlerRequestMagicLink emails a single-use login link. Every request counts towards the rate limit,
+// whether or not the address has an account, and the response is the same either way.
+func HandlerRequestMagicLink(db magicLinkStore, mail MailConfig, sessions SessionConfig) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var magicReq magicLinkRequestParams
+		if err := json.NewDecoder(req.Body).Decode(&magicReq); err != nil || magicReq.Email == "" {
+			problem.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		throttleKeys := magicLinkThrottleKeys(req, magicReq.Email)
+		if until, locked := lockedUntil(req.Context(), db, throttleKeys); locked {
+			writeLockedOut(w, until)
+			return
+		}
+		recordFailure(req.Context(), db, throttleKeys)
+
+		deviceToken := auth.MakeRefreshToken()
+		http.SetCookie(w, sessions.cookie(magicDeviceCookieName, deviceToken, magicLinkTTL, true))
+		defer func() {
+			w.WriteHeader(http.StatusAccepted)
+			writeResponse(magicLinkRequest{DeviceToken: deviceToken}, w)
+		}()
+
+		dbUser, err := db.GetUserByEmail(req.Context(), magicReq.Email)
+		if err != nil {
+			log.Printf("Magic link requested for unknown email")
+			return
+		}
+
+		// the link is issued and sent off the request path, so a known address is answered as
+		// quickly as an unknown one
+		mail.Background.Go(func(ctx context.Context) {
+			if err := db.DeleteUserTokens(ctx, database.DeleteUserTokensParams{
+				UserID:  dbUser.ID,
+				Purpose: tokenPurposeMagicLogin,
+			}); err != nil {
+				log.Printf("Error: could not clear outstanding magic links for user %v: %v", dbUser.ID, err)
+				return
+			}
+
+			token := auth.MakeRefreshToken()
+			if err := db.CreateUserToken(ctx, database.CreateUserTokenParams{
+				TokenHash: magicTokenHash(token, deviceToken),
+				UserID:    dbUser.ID,
+				Purpose:   tokenPurposeMagicLogin,
+				Email:     dbUser.Email,
+				ExpiresAt: time.Now().Add(magicLinkTTL),
+			}); err != nil {
+				log.Printf("Error: could not create magic link for user %v: %v", dbUser.ID, err)
+				return
+			}
+
+			if err := mail.Mailer.Send(ctx, mailer.Message{
+				To:      dbUser.Email,
+				Subject: "Your Chirpy login link",
+				Body: fmt.Sprintf(
+					"Visit the link below to log in to Chirpy. It only works once, in the browser where you asked for it.\n\n%s\n\nThe link expires in %d minutes. If you did not ask for this you can ignore this email.",
+					mail.link("/magic-login", token), int(magicLinkTTL.Minutes()),
+				),
+			}); err != nil {
+				log.Printf("Error: could not send magic link to user %v: %v", dbUser.ID, err)
+			}
+		})
+	}
+}
+
+// HandlerVerifyMagicLink exchanges a magic link for the same session HandlerLogin issues,
+// or for an MFA challenge if the user has two-factor authentication enabled
+func HandlerVerifyMagicLink(db magicLinkStore, secret string, sessions SessionConfig) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var verifyReq magicLinkVerifyParams
+		if err := json.NewDecoder(req.Body).Decode(&verifyReq); err != nil {
+			problem.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if verifyReq.Session != "" && verifyReq.Session != sessionModeCookie {
+			problem.Error(w, "session must be empty or cookie", http.StatusBadRequest)
+			return
+		}
+
+		if verifyReq.DeviceToken == "" {
+			if cookie, err := req.Cookie(magicDeviceCookieName); err == nil {
+				verifyReq.DeviceToken = cookie.Value
+			}
+		}
+
+		// failed links count against the same per-IP limit as requests, so tokens cannot be guessed at volume
+		ipKeys := []throttleKey{{auth.MagicLinkIPThrottleKey(clientip.FromRequest(req)), auth.MagicLinkIPPolicy}}
+		if until, locked := lockedUntil(req.Context(), db, ipKeys); locked {
+			writeLockedOut(w, until)
+			return
+		}
+
+		token, err := db.ConsumeUserToken(req.Context(), database.ConsumeUserTokenParams{
+			TokenHash: magicTokenHash(verifyReq.Token, verifyReq.DeviceToken),
+			Purpose:   tokenPurposeMagicLogin,
+		})
+		if err != nil {
+			recordFailure(req.Context(), db, ipKeys)
+			problem.Error(w, "invalid or expired login link, or it was requested from another device", http.StatusUnauthorized)
+			return
+		}
+
+		userID := token.UserID
+		dbUser, err := db.GetUserByID(req.Context(), userID)
+		if err != nil {
+			problem.Error(w, "could not find user", http.StatusUnauthorized)
+			return
+		}
+
+		// following the link proves the user controls the address it was sent to, which is only
+		// verified if it is still theirs
+		if !dbUser.EmailVerified {
+			verified, err := db.MarkEmailVerified(req.Context(), database.MarkEmailVerifiedParams{ID: userID, Email: token.Email})
+			if err != nil {
+				log.Printf("Error: could not mark email verified for user %v: %v", userID, err)
+			}
+			dbUser.EmailVerified = verified == 1
+		}
+
+		cleared := sessions.cookie(magicDeviceCookieName, "", 0, true)
+		cleared.MaxAge = -1
+		http.SetCookie(w, cleared)
+
+		if dbUser.TotpEnabled {
+			log.Printf("User %s followed a magic link, awaiting second factor", dbUser.Email)
+			writeMFAChallenge(w, dbUser, secret)
+			return
+		}
+
+		log.Printf("User %s successfully logged in with a magic link", dbUser.Email)
+		issueSession(w, req, db, dbUser, secret, sessions, verifyReq.Session)
+	}
+}
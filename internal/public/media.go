@@ -0,0 +1,272 @@
+package public
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/blob"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/media"
+	"github.com/bailey4770/chirpy/internal/problem"
+	"github.com/google/uuid"
+)
+
+const (
+	mediaVariantOriginal  = "original"
+	mediaVariantThumbnail = "thumbnail"
+
+	// multipartOverhead allows for the form boundaries and headers around the uploaded file
+	multipartOverhead = 64 << 10
+)
+
+type apiMedia struct {
+	ID           uuid.UUID `json:"id"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url"`
+	ContentType  string    `json:"content_type"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+}
+
+func mediaPath(id uuid.UUID, variant string) string {
+	return "/api/media/" + id.String() + "/" + variant
+}
+
+func dbMediaToAPIMedia(m database.MediaAttachment) apiMedia {
+	return apiMedia{
+		ID:           m.ID,
+		URL:          mediaPath(m.ID, mediaVariantOriginal),
+		ThumbnailURL: mediaPath(m.ID, mediaVariantThumbnail),
+		ContentType:  m.ContentType,
+		Width:        int(m.Width),
+		Height:       int(m.Height),
+	}
+}
+
+type mediaLister interface {
+	ListMediaAttachmentsForChirps(ctx context.Context, chirpIds []uuid.UUID) ([]database.MediaAttachment, error)
+}
+
+// withMedia fills in the attachments of every chirp with a single query
+func withMedia(ctx context.Context, db mediaLister, chirps []apiChirp) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, len(chirps))
+	index := make(map[uuid.UUID]int, len(chirps))
+	for i, chirp := range chirps {
+		ids[i] = chirp.ID
+		index[chirp.ID] = i
+	}
+
+	attachments, err := db.ListMediaAttachmentsForChirps(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range attachments {
+		if i, ok := index[m.ChirpID.UUID]; ok {
+			chirps[i].Media = append(chirps[i].Media, dbMediaToAPIMedia(m))
+		}
+	}
+	return nil
+}
+
+type mediaUploader interface {
+	CreateMediaAttachment(ctx context.Context, arg database.CreateMediaAttachmentParams) (database.MediaAttachment, error)
+	tokenAuthenticator
+}
+
+// HandlerUploadMedia accepts a single image in the multipart field "file". The returned ID can
+// then be attached to a chirp; uploads that are never attached are purged after a day.
+func HandlerUploadMedia(db mediaUploader, blobs blob.Store, secret string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		caller, ok := requireAuth(w, req, db, secret, auth.ScopeChirpsWrite)
+		if !ok {
+			return
+		}
+		userID := caller.UserID
+
+		req.Body = http.MaxBytesReader(w, req.Body, media.MaxUploadBytes+multipartOverhead)
+		file, _, err := req.FormFile("file")
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				problem.Error(w, "file is too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			problem.Error(w, "request must be multipart/form-data with a file field", http.StatusBadRequest)
+			return
+		}
+		defer func() { _ = file.Close() }()
+
+		data, err := io.ReadAll(io.LimitReader(file, media.MaxUploadBytes+1))
+		if err != nil {
+			problem.Error(w, "could not read uploaded file", http.StatusBadRequest)
+			return
+		}
+		if len(data) > media.MaxUploadBytes {
+			problem.Error(w, "file is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		processed, err := media.Process(data)
+		switch {
+		case errors.Is(err, media.ErrUnsupportedType):
+			problem.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+			return
+		case errors.Is(err, media.ErrTooLarge):
+			problem.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		case err != nil:
+			log.Printf("Warning: rejected upload from user %v: %v", userID, err)
+			problem.Error(w, "could not read image", http.StatusBadRequest)
+			return
+		}
+
+		mediaID := uuid.New()
+		// keys start with the owner so every upload of a purged account can be removed at once
+		prefix := userID.String() + "/" + mediaID.String()
+		originalKey := prefix + "/" + mediaVariantOriginal + "." + processed.Original.Ext
+		thumbnailKey := prefix + "/" + mediaVariantThumbnail + "." + processed.Thumbnail.Ext
+
+		for key, img := range map[string]media.Image{originalKey: processed.Original, thumbnailKey: processed.Thumbnail} {
+			if err := blobs.Put(req.Context(), key, bytes.NewReader(img.Data)); err != nil {
+				log.Printf("Error: could not store media %v: %v", mediaID, err)
+				problem.Error(w, "could not store upload", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		dbMedia, err := db.CreateMediaAttachment(req.Context(), database.CreateMediaAttachmentParams{
+			ID:                   mediaID,
+			UserID:               userID,
+			ContentType:          processed.Original.ContentType,
+			Width:                int32(processed.Original.Width),
+			Height:               int32(processed.Original.Height),
+			OriginalKey:          originalKey,
+			ThumbnailKey:         thumbnailKey,
+			ThumbnailContentType: processed.Thumbnail.ContentType,
+		})
+		if err != nil {
+			log.Printf("Error: could not save media %v: %v", mediaID, err)
+			_ = blobs.DeletePrefix(req.Context(), prefix)
+			problem.Error(w, "could not save upload", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("User %v uploaded media %v", userID, mediaID)
+		w.WriteHeader(http.StatusCreated)
+		writeResponse(dbMediaToAPIMedia(dbMedia), w)
+	}
+}
+
+type mediaViewer interface {
+	GetMediaAttachment(ctx context.Context, id uuid.UUID) (database.MediaAttachment, error)
+	FetchChirpByID(ctx context.Context, id uuid.UUID) (database.Chirp, error)
+	relationReader
+	tokenAuthenticator
+}
+
+// mediaCacheControl lets the viewer's browser keep media briefly, but no shared cache, so media stops
+// being served soon after its chirp is hidden or deleted
+const mediaCacheControl = "private, max-age=300"
+
+// HandlerServeMedia serves an uploaded image or its thumbnail to whoever can see the chirp it is
+// attached to, under the same rules as fetching the chirp. Media not attached to a chirp, whether not
+// yet posted or left by a deleted chirp, is only served to its uploader.
+func HandlerServeMedia(db mediaViewer, blobs blob.Store, secret string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		viewer, ok := optionalAuth(w, req, db, secret, auth.ScopeChirpsRead)
+		if !ok {
+			return
+		}
+
+		mediaID, err := uuid.Parse(req.PathValue("mediaID"))
+		if err != nil {
+			problem.Error(w, "could not parse media ID to uuid", http.StatusBadRequest)
+			return
+		}
+
+		variant := req.PathValue("variant")
+		if variant != mediaVariantOriginal && variant != mediaVariantThumbnail {
+			problem.Error(w, "media not found", http.StatusNotFound)
+			return
+		}
+
+		dbMedia, err := db.GetMediaAttachment(req.Context(), mediaID)
+		if err != nil {
+			problem.Error(w, "media not found", http.StatusNotFound)
+			return
+		}
+
+		if visible, err := mediaVisible(req.Context(), db, dbMedia, viewer.UserID); err != nil {
+			log.Printf("Error: could not check who can see media %v: %v", mediaID, err)
+			problem.Error(w, "could not read media", http.StatusInternalServerError)
+			return
+		} else if !visible {
+			// answer as if the media did not exist, as for the chirp itself
+			problem.Error(w, "media not found", http.StatusNotFound)
+			return
+		}
+
+		key, contentType := dbMedia.OriginalKey, dbMedia.ContentType
+		if variant == mediaVariantThumbnail {
+			key, contentType = dbMedia.ThumbnailKey, dbMedia.ThumbnailContentType
+		}
+
+		etag := `"` + mediaID.String() + "-" + variant + `"`
+		if req.Header.Get("If-None-Match") == etag {
+			w.Header().Set("Cache-Control", mediaCacheControl)
+			w.Header().Set("ETag", etag)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		r, err := blobs.Get(req.Context(), key)
+		if errors.Is(err, blob.ErrNotFound) {
+			problem.Error(w, "media not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error: could not read media %v: %v", mediaID, err)
+			problem.Error(w, "could not read media", http.StatusInternalServerError)
+			return
+		}
+		defer func() { _ = r.Close() }()
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Cache-Control", mediaCacheControl)
+		w.Header().Set("ETag", etag)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Security-Policy", "default-src 'none'")
+		w.WriteHeader(http.StatusOK)
+		if _, err := io.Copy(w, r); err != nil {
+			log.Printf("Error: could not write media %v: %v", mediaID, err)
+		}
+	}
+}
+
+// mediaVisible reports whether viewer, uuid.Nil if anonymous, may see m
+func mediaVisible(ctx context.Context, db mediaViewer, m database.MediaAttachment, viewer uuid.UUID) (bool, error) {
+	if !m.ChirpID.Valid {
+		return viewer != uuid.Nil && viewer == m.UserID, nil
+	}
+
+	// hidden chirps and those of accounts pending deletion are not found either
+	chirp, err := db.FetchChirpByID(ctx, m.ChirpID.UUID)
+	if err != nil {
+		return false, nil
+	}
+
+	hidden, err := loadRelations(ctx, db, viewer)
+	if err != nil {
+		return false, err
+	}
+	return !hidden.blocked[chirp.UserID], nil
+}
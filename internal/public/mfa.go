@@ -0,0 +1,303 @@
+package public
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/audit"
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/problem"
+	"github.com/google/uuid"
+)
+
+const totpIssuer = "Chirpy"
+
+type mfaChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+type totpEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type recoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type totpCodeParams struct {
+	Code string `json:"code"`
+}
+
+type mfaLoginParams struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+	Session      string `json:"session"`
+}
+
+type totpStepStore interface {
+	AdvanceTOTPStep(ctx context.Context, arg database.AdvanceTOTPStepParams) (int64, error)
+}
+
+type mfaStore interface {
+	GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error)
+	SetTOTPSecret(ctx context.Context, arg database.SetTOTPSecretParams) error
+	EnableTOTP(ctx context.Context, id uuid.UUID) error
+	totpStepStore
+	CreateRecoveryCode(ctx context.Context, arg database.CreateRecoveryCodeParams) error
+	DeleteRecoveryCodes(ctx context.Context, userID uuid.UUID) error
+	UseRecoveryCode(ctx context.Context, arg database.UseRecoveryCodeParams) (int64, error)
+	sessionIssuer
+	throttleStore
+}
+
+func HandlerEnrollTOTP(db mfaStore, secret string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		token, err := auth.GetBearerToken(req.Header)
+		if err != nil {
+			problem.Error(w, "could not get bearer token from header", http.StatusUnauthorized)
+			return
+		}
+
+		userID, err := auth.ValidateJWT(token, secret)
+		if err != nil {
+			log.Printf("Error: could not validate JWT: %v", err)
+			problem.Error(w, "could not validate JWT", http.StatusUnauthorized)
+			return
+		}
+
+		if !requireUnrestricted(w, req, db, userID) {
+			return
+		}
+
+		dbUser, err := db.GetUserByID(req.Context(), userID)
+		if err != nil {
+			problem.Error(w, "could not find user", http.StatusNotFound)
+			return
+		}
+
+		if dbUser.TotpEnabled {
+			problem.Error(w, "two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+
+		totpSecret, err := auth.GenerateTOTPSecret()
+		if err != nil {
+			log.Printf("Error: %v", err)
+			problem.Error(w, "could not generate totp secret", http.StatusInternalServerError)
+			return
+		}
+
+		if err := db.SetTOTPSecret(req.Context(), database.SetTOTPSecretParams{
+			ID:         userID,
+			TotpSecret: sql.NullString{String: totpSecret, Valid: true},
+		}); err != nil {
+			log.Printf("Error: could not save totp secret for user %v: %v", userID, err)
+			problem.Error(w, "could not save totp secret", http.StatusInternalServerError)
+			return
+		}
+
+		enrollment := totpEnrollment{
+			Secret:     totpSecret,
+			OTPAuthURI: auth.TOTPURI(totpIssuer, dbUser.Email, totpSecret),
+		}
+
+		log.Printf("User %v started totp enrollment", userID)
+		w.WriteHeader(http.StatusOK)
+		writeResponse(enrollment, w)
+	}
+}
+
+func HandlerConfirmTOTP(db mfaStore, secret string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		token, err := auth.GetBearerToken(req.Header)
+		if err != nil {
+			problem.Error(w, "could not get bearer token from header", http.StatusUnauthorized)
+			return
+		}
+
+		userID, err := auth.ValidateJWT(token, secret)
+		if err != nil {
+			log.Printf("Error: could not validate JWT: %v", err)
+			problem.Error(w, "could not validate JWT", http.StatusUnauthorized)
+			return
+		}
+
+		if !requireUnrestricted(w, req, db, userID) {
+			return
+		}
+
+		var confirmReq totpCodeParams
+		if err := json.NewDecoder(req.Body).Decode(&confirmReq); err != nil {
+			problem.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		dbUser, err := db.GetUserByID(req.Context(), userID)
+		if err != nil {
+			problem.Error(w, "could not find user", http.StatusNotFound)
+			return
+		}
+
+		if dbUser.TotpEnabled {
+			problem.Error(w, "two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+
+		if !dbUser.TotpSecret.Valid {
+			problem.Error(w, "totp enrollment has not been started", http.StatusBadRequest)
+			return
+		}
+
+		if !checkTOTP(req.Context(), db, dbUser, confirmReq.Code) {
+			problem.Error(w, "invalid totp code", http.StatusUnauthorized)
+			return
+		}
+
+		var codes []string
+		event := audit.Event{ActorID: userID, Action: audit.ActionMFAEnable, TargetType: audit.TargetUser, TargetID: userID.String()}
+		err = db.RecordAudit(req.Context(), event, func(ctx context.Context) error {
+			if codes, err = replaceRecoveryCodes(ctx, db, userID); err != nil {
+				return fmt.Errorf("could not create recovery codes: %v", err)
+			}
+			return db.EnableTOTP(ctx, userID)
+		})
+		if err != nil {
+			log.Printf("Error: could not enable totp for user %v: %v", userID, err)
+			problem.Error(w, "could not enable two-factor authentication", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("User %v enabled two-factor authentication", userID)
+		w.WriteHeader(http.StatusOK)
+		writeResponse(recoveryCodes{RecoveryCodes: codes}, w)
+	}
+}
+
+func HandlerLoginMFA(db mfaStore, secret string, sessions SessionConfig) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var mfaReq mfaLoginParams
+		if err := json.NewDecoder(req.Body).Decode(&mfaReq); err != nil {
+			problem.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if mfaReq.Session != "" && mfaReq.Session != sessionModeCookie {
+			problem.Error(w, "session must be empty or cookie", http.StatusBadRequest)
+			return
+		}
+
+		userID, err := auth.ValidateMFAChallengeJWT(mfaReq.MFAToken, secret)
+		if err != nil {
+			log.Printf("Error: could not validate MFA challenge: %v", err)
+			problem.Error(w, "invalid or expired MFA challenge", http.StatusUnauthorized)
+			return
+		}
+
+		dbUser, err := db.GetUserByID(req.Context(), userID)
+		if err != nil || !dbUser.TotpEnabled {
+			problem.Error(w, "invalid or expired MFA challenge", http.StatusUnauthorized)
+			return
+		}
+
+		throttleKeys := loginThrottleKeys(req, dbUser.Email)
+		if until, locked := lockedUntil(req.Context(), db, throttleKeys); locked {
+			writeLockedOut(w, until)
+			return
+		}
+
+		switch {
+		case mfaReq.Code != "":
+			if !checkTOTP(req.Context(), db, dbUser, mfaReq.Code) {
+				recordFailure(req.Context(), db, throttleKeys)
+				recordLoginFailure(req.Context(), db, userID, "totp")
+				problem.Error(w, "invalid second factor", http.StatusUnauthorized)
+				return
+			}
+		case mfaReq.RecoveryCode != "":
+			used, err := db.UseRecoveryCode(req.Context(), database.UseRecoveryCodeParams{
+				UserID:   userID,
+				CodeHash: auth.HashToken(auth.NormaliseRecoveryCode(mfaReq.RecoveryCode)),
+			})
+			if err != nil || used != 1 {
+				recordFailure(req.Context(), db, throttleKeys)
+				recordLoginFailure(req.Context(), db, userID, "recovery_code")
+				problem.Error(w, "invalid second factor", http.StatusUnauthorized)
+				return
+			}
+			log.Printf("Warning: user %v logged in with a recovery code", userID)
+		default:
+			problem.Error(w, "a totp code or recovery code is required", http.StatusBadRequest)
+			return
+		}
+
+		if err := db.ClearAuthThrottle(req.Context(), throttleKeys[0].key); err != nil {
+			log.Printf("Error: could not clear login throttle for user %v: %v", dbUser.ID, err)
+		}
+
+		log.Printf("User %s successfully logged in with two factors", dbUser.Email)
+		issueSession(w, req, db, dbUser, secret, sessions, mfaReq.Session)
+	}
+}
+
+// writeMFAChallenge answers a successful first factor for a user with two-factor authentication enabled
+func writeMFAChallenge(w http.ResponseWriter, dbUser database.User, secret string) {
+	challenge, err := auth.MakeMFAChallengeJWT(dbUser.ID, secret)
+	if err != nil {
+		log.Printf("Error: could not make MFA challenge token: %v", err)
+		problem.Error(w, "could not make MFA challenge token", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	writeResponse(mfaChallenge{MFARequired: true, MFAToken: challenge}, w)
+}
+
+// checkTOTP validates code for dbUser and consumes its time step so the same code cannot be replayed
+func checkTOTP(ctx context.Context, db totpStepStore, dbUser database.User, code string) bool {
+	step, ok := auth.ValidateTOTP(dbUser.TotpSecret.String, code, time.Now())
+	if !ok {
+		return false
+	}
+
+	advanced, err := db.AdvanceTOTPStep(ctx, database.AdvanceTOTPStepParams{
+		ID:           dbUser.ID,
+		TotpLastStep: step,
+	})
+	if err != nil {
+		log.Printf("Error: could not record totp step for user %v: %v", dbUser.ID, err)
+		return false
+	}
+
+	return advanced == 1
+}
+
+func replaceRecoveryCodes(ctx context.Context, db mfaStore, userID uuid.UUID) ([]string, error) {
+	codes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.DeleteRecoveryCodes(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	for _, code := range codes {
+		if err := db.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: auth.HashToken(auth.NormaliseRecoveryCode(code)),
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return codes, nil
+}
@@ -0,0 +1,348 @@
+package public
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/audit"
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	oauthRefreshTokenTTL = 60 * 24 * time.Hour
+
+	grantAuthorizationCode = "authorization_code"
+	grantRefreshToken      = "refresh_token"
+	grantClientCredentials = "client_credentials"
+)
+
+// oauthError is the RFC 6749 error body used by the token, introspection and revocation endpoints
+type oauthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+// introspectionResponse follows RFC 7662. Inactive tokens only carry Active.
+type introspectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+}
+
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	writeResponse(oauthError{Error: code, ErrorDescription: description}, w)
+}
+
+type oauthClientGetter interface {
+	GetOAuthClient(ctx context.Context, id uuid.UUID) (database.OauthClient, error)
+}
+
+// authenticateClient identifies the calling client from HTTP Basic credentials or client_id and
+// client_secret form fields. Confidential clients must present their secret; public clients must not.
+func authenticateClient(req *http.Request, db oauthClientGetter) (database.OauthClient, error) {
+	rawID, clientSecret, hasBasic := req.BasicAuth()
+	if !hasBasic {
+		rawID = req.PostForm.Get("client_id")
+		clientSecret = req.PostForm.Get("client_secret")
+	}
+
+	clientID, err := uuid.Parse(rawID)
+	if err != nil {
+		return database.OauthClient{}, errors.New("missing or malformed client_id")
+	}
+
+	client, err := db.GetOAuthClient(req.Context(), clientID)
+	if err != nil {
+		return database.OauthClient{}, errors.New("unknown client")
+	}
+
+	if !client.SecretHash.Valid {
+		if clientSecret != "" {
+			return database.OauthClient{}, errors.New("public clients do not have a secret")
+		}
+		return client, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(auth.HashToken(clientSecret)), []byte(client.SecretHash.String)) != 1 {
+		return database.OauthClient{}, errors.New("client authentication failed")
+	}
+
+	return client, nil
+}
+
+type oauthTokenStore interface {
+	ConsumeOAuthAuthorizationCode(ctx context.Context, arg database.ConsumeOAuthAuthorizationCodeParams) (database.OauthAuthorizationCode, error)
+	CreateClientRefreshToken(ctx context.Context, arg database.CreateClientRefreshTokenParams) (database.RefreshToken, error)
+	GetRefreshToken(ctx context.Context, token string) (database.RefreshToken, error)
+	RevokeClientRefreshToken(ctx context.Context, arg database.RevokeClientRefreshTokenParams) (int64, error)
+	oauthClientGetter
+	auditRecorder
+}
+
+// HandlerOAuthToken is the RFC 6749 token endpoint. It supports the authorization_code grant with PKCE,
+// refresh_token with rotation, and client_credentials for confidential server-to-server clients.
+func HandlerOAuthToken(db oauthTokenStore, secret string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if err := req.ParseForm(); err != nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_request", "could not parse form body")
+			return
+		}
+
+		client, err := authenticateClient(req, db)
+		if err != nil {
+			log.Printf("Error: could not authenticate oauth client: %v", err)
+			writeOAuthError(w, http.StatusUnauthorized, "invalid_client", err.Error())
+			return
+		}
+
+		switch req.PostForm.Get("grant_type") {
+		case grantAuthorizationCode:
+			code, err := db.ConsumeOAuthAuthorizationCode(req.Context(), database.ConsumeOAuthAuthorizationCodeParams{
+				CodeHash: auth.HashToken(req.PostForm.Get("code")),
+				ClientID: client.ID,
+			})
+			if err != nil {
+				writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "invalid, expired or already used authorization code")
+				return
+			}
+
+			if code.RedirectUri != req.PostForm.Get("redirect_uri") {
+				writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "redirect_uri does not match the authorization request")
+				return
+			}
+
+			if !auth.VerifyPKCE(req.PostForm.Get("code_verifier"), code.CodeChallenge) {
+				writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "code_verifier does not match the code challenge")
+				return
+			}
+
+			log.Printf("User %v authorized oauth client %v", code.UserID, client.ID)
+			issueClientTokens(w, req, db, client, code.UserID, code.Scopes, secret, true)
+
+		case grantRefreshToken:
+			refreshToken, err := db.GetRefreshToken(req.Context(), req.PostForm.Get("refresh_token"))
+			if err != nil || !refreshToken.ClientID.Valid || refreshToken.ClientID.UUID != client.ID ||
+				refreshToken.RevokedAt.Valid || refreshToken.ExpiresAt.Before(time.Now()) {
+				writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "invalid, expired or revoked refresh token")
+				return
+			}
+
+			scopes := refreshToken.Scopes
+			if requested := req.PostForm.Get("scope"); requested != "" {
+				narrowed, err := auth.ParseScopes(requested)
+				if err != nil || !subsetOf(narrowed, refreshToken.Scopes) {
+					writeOAuthError(w, http.StatusBadRequest, "invalid_scope", "scope exceeds what was originally granted")
+					return
+				}
+				scopes = narrowed
+			}
+
+			// rotate, so a leaked refresh token stops working once the client has used it.
+			// Only one of two concurrent refreshes with the same token can win the revoke.
+			revoked, err := db.RevokeClientRefreshToken(req.Context(), database.RevokeClientRefreshTokenParams{
+				Token:    refreshToken.Token,
+				ClientID: refreshToken.ClientID,
+			})
+			if err != nil {
+				log.Printf("Error: could not revoke rotated refresh token for client %v: %v", client.ID, err)
+				writeOAuthError(w, http.StatusInternalServerError, "server_error", "could not rotate refresh token")
+				return
+			}
+			if revoked != 1 {
+				writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "invalid, expired or revoked refresh token")
+				return
+			}
+
+			issueClientTokens(w, req, db, client, refreshToken.UserID, scopes, secret, true)
+
+		case grantClientCredentials:
+			if !client.SecretHash.Valid {
+				writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", "client_credentials requires a confidential client")
+				return
+			}
+
+			scopes := client.Scopes
+			if requested := req.PostForm.Get("scope"); requested != "" {
+				scopes, err = auth.ParseScopes(requested)
+				if err != nil || !subsetOf(scopes, client.Scopes) {
+					writeOAuthError(w, http.StatusBadRequest, "invalid_scope", "scope exceeds what the client is registered for")
+					return
+				}
+			}
+
+			// the client acts as the user who registered it, and gets no refresh token as it can always re-authenticate
+			issueClientTokens(w, req, db, client, client.OwnerID, scopes, secret, false)
+
+		default:
+			writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "grant_type must be authorization_code, refresh_token or client_credentials")
+		}
+	}
+}
+
+func issueClientTokens(w http.ResponseWriter, req *http.Request, db oauthTokenStore, client database.OauthClient, userID uuid.UUID, scopes []string, secret string, withRefresh bool) {
+	accessToken, err := auth.MakeClientJWT(userID, client.ID, scopes, secret)
+	if err != nil {
+		log.Printf("Error: could not make JWT: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "could not make access token")
+		return
+	}
+
+	resp := oauthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(auth.AccessTokenTTL.Seconds()),
+		Scope:       auth.FormatScopes(scopes),
+	}
+
+	if withRefresh {
+		resp.RefreshToken = auth.MakeRefreshToken()
+		if _, err := db.CreateClientRefreshToken(req.Context(), database.CreateClientRefreshTokenParams{
+			Token:     resp.RefreshToken,
+			UserID:    userID,
+			ExpiresAt: time.Now().Add(oauthRefreshTokenTTL),
+			ClientID:  uuid.NullUUID{UUID: client.ID, Valid: true},
+			Scopes:    scopes,
+		}); err != nil {
+			log.Printf("Error: could not create refresh token for client %v: %v", client.ID, err)
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "could not create refresh token")
+			return
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	writeResponse(resp, w)
+}
+
+func subsetOf(scopes, allowed []string) bool {
+	for _, scope := range scopes {
+		if !slices.Contains(allowed, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// HandlerOAuthIntrospect implements RFC 7662. A client may only introspect tokens that were issued to it;
+// anything else, including first-party session tokens, is reported as inactive.
+func HandlerOAuthIntrospect(db oauthTokenStore, secret string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if err := req.ParseForm(); err != nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_request", "could not parse form body")
+			return
+		}
+
+		client, err := authenticateClient(req, db)
+		if err != nil {
+			log.Printf("Error: could not authenticate oauth client: %v", err)
+			writeOAuthError(w, http.StatusUnauthorized, "invalid_client", err.Error())
+			return
+		}
+
+		token := req.PostForm.Get("token")
+		resp := introspectionResponse{Active: false}
+
+		if accessToken, err := auth.ParseAccessToken(token, secret); err == nil {
+			if accessToken.ClientID == client.ID {
+				resp = introspectionResponse{
+					Active:    true,
+					Scope:     auth.FormatScopes(accessToken.Scopes),
+					ClientID:  client.ID.String(),
+					Sub:       accessToken.UserID.String(),
+					TokenType: "Bearer",
+					Exp:       accessToken.ExpiresAt.Unix(),
+					Iat:       accessToken.IssuedAt.Unix(),
+				}
+			}
+		} else if refreshToken, err := db.GetRefreshToken(req.Context(), token); err == nil {
+			if refreshToken.ClientID.Valid && refreshToken.ClientID.UUID == client.ID &&
+				!refreshToken.RevokedAt.Valid && refreshToken.ExpiresAt.After(time.Now()) {
+				resp = introspectionResponse{
+					Active:    true,
+					Scope:     auth.FormatScopes(refreshToken.Scopes),
+					ClientID:  client.ID.String(),
+					Sub:       refreshToken.UserID.String(),
+					TokenType: "refresh_token",
+					Exp:       refreshToken.ExpiresAt.Unix(),
+					Iat:       refreshToken.CreatedAt.Unix(),
+				}
+			}
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		writeResponse(resp, w)
+	}
+}
+
+// HandlerOAuthRevoke implements RFC 7009 for refresh tokens. Access tokens are short-lived JWTs and
+// cannot be revoked individually. Unknown tokens still get 200, as the spec requires.
+func HandlerOAuthRevoke(db oauthTokenStore) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if err := req.ParseForm(); err != nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_request", "could not parse form body")
+			return
+		}
+
+		client, err := authenticateClient(req, db)
+		if err != nil {
+			log.Printf("Error: could not authenticate oauth client: %v", err)
+			writeOAuthError(w, http.StatusUnauthorized, "invalid_client", err.Error())
+			return
+		}
+
+		token := req.PostForm.Get("token")
+		event := audit.Event{
+			Action:     audit.ActionTokenRevoke,
+			TargetType: audit.TargetUser,
+			Metadata:   map[string]string{"token_type": "oauth", "client_id": client.ID.String()},
+		}
+		if refreshToken, err := db.GetRefreshToken(req.Context(), token); err == nil {
+			event.ActorID = refreshToken.UserID
+			event.TargetID = refreshToken.UserID.String()
+		}
+
+		err = db.RecordAudit(req.Context(), event, func(ctx context.Context) error {
+			revoked, err := db.RevokeClientRefreshToken(ctx, database.RevokeClientRefreshTokenParams{
+				Token:    token,
+				ClientID: uuid.NullUUID{UUID: client.ID, Valid: true},
+			})
+			if err == nil && revoked == 0 {
+				return errNothingChanged
+			}
+			return err
+		})
+		// unknown tokens are not an error, so a client cannot probe for them
+		if err != nil && !errors.Is(err, errNothingChanged) {
+			log.Printf("Error: could not revoke refresh token for client %v: %v", client.ID, err)
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "could not revoke token")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
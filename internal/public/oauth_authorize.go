@@ -0,0 +1,298 @@
+package public
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/problem"
+	"github.com/google/uuid"
+)
+
+const authorizationCodeTTL = 10 * time.Minute
+
+var scopeDescriptions = map[string]string{
+	auth.ScopeChirpsRead:     "Read chirps",
+	auth.ScopeChirpsWrite:    "Post and delete chirps as you",
+	auth.ScopeProfileWrite:   "Update your profile",
+	auth.ScopeRelationsWrite: "See and change who you block and mute",
+}
+
+var consentPage = template.Must(template.New("consent").Parse(`<html>
+  <head><title>Authorize {{.ClientName}} - Chirpy</title></head>
+  <body>
+    {{if .Fatal}}
+    <h1>Authorization failed</h1>
+    <p>{{.Fatal}}</p>
+    {{else}}
+    <h1>Authorize {{.ClientName}}</h1>
+    <p><b>{{.ClientName}}</b> would like to use your Chirpy account. It will be able to:</p>
+    <ul>
+      {{range .Scopes}}<li>{{.}}</li>{{end}}
+    </ul>
+    {{if .Error}}<p style="color: red">{{.Error}}</p>{{end}}
+    <form method="POST" action="/oauth/authorize">
+      {{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+      {{end}}
+      <p><label>Email <input type="email" name="email" value="{{.Email}}" required></label></p>
+      <p><label>Password <input type="password" name="password" required></label></p>
+      <p><label>Two-factor code, if enabled <input type="text" name="totp_code" inputmode="numeric" autocomplete="one-time-code"></label></p>
+      <button type="submit" name="decision" value="approve">Allow</button>
+      <button type="submit" name="decision" value="deny" formnovalidate>Deny</button>
+    </form>
+    {{end}}
+  </body>
+</html>`))
+
+type consentView struct {
+	ClientName string
+	Scopes     []string
+	Params     map[string]string
+	Email      string
+	Error      string
+	Fatal      string
+}
+
+// authorizeRequest is a validated RFC 6749 authorization request
+type authorizeRequest struct {
+	client        database.OauthClient
+	redirectURI   string
+	state         string
+	scopes        []string
+	codeChallenge string
+}
+
+// errorRedirect means the request was bad, but the client and redirect uri are trusted,
+// so the error is sent back to the client rather than shown to the user
+type errorRedirect struct {
+	code        string
+	description string
+}
+
+func (e errorRedirect) Error() string {
+	return e.code + ": " + e.description
+}
+
+func parseAuthorizeRequest(ctx context.Context, db oauthClientGetter, values url.Values) (authorizeRequest, error) {
+	clientID, err := uuid.Parse(values.Get("client_id"))
+	if err != nil {
+		return authorizeRequest{}, errors.New("missing or malformed client_id")
+	}
+
+	client, err := db.GetOAuthClient(ctx, clientID)
+	if err != nil {
+		return authorizeRequest{}, errors.New("unknown client")
+	}
+
+	ar := authorizeRequest{
+		client:        client,
+		redirectURI:   values.Get("redirect_uri"),
+		state:         values.Get("state"),
+		codeChallenge: values.Get("code_challenge"),
+	}
+
+	// never redirect anywhere the client did not register, or the page becomes an open redirector
+	if ar.redirectURI == "" && len(client.RedirectUris) == 1 {
+		ar.redirectURI = client.RedirectUris[0]
+	} else if !slices.Contains(client.RedirectUris, ar.redirectURI) {
+		return authorizeRequest{}, errors.New("redirect_uri is not registered for this client")
+	}
+
+	if values.Get("response_type") != "code" {
+		return ar, errorRedirect{"unsupported_response_type", "response_type must be code"}
+	}
+
+	if ar.codeChallenge == "" || values.Get("code_challenge_method") != "S256" {
+		return ar, errorRedirect{"invalid_request", "PKCE with code_challenge_method S256 is required"}
+	}
+
+	ar.scopes = client.Scopes
+	if requested := values.Get("scope"); requested != "" {
+		ar.scopes, err = auth.ParseScopes(requested)
+		if err != nil || !subsetOf(ar.scopes, client.Scopes) {
+			return ar, errorRedirect{"invalid_scope", "scope exceeds what the client is registered for"}
+		}
+	}
+
+	return ar, nil
+}
+
+// redirect sends the user back to the client with params and the original state
+func (ar authorizeRequest) redirect(w http.ResponseWriter, req *http.Request, params url.Values) {
+	u, err := url.Parse(ar.redirectURI)
+	if err != nil {
+		problem.Error(w, "invalid redirect uri", http.StatusInternalServerError)
+		return
+	}
+
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	if ar.state != "" {
+		q.Set("state", ar.state)
+	}
+	u.RawQuery = q.Encode()
+
+	http.Redirect(w, req, u.String(), http.StatusSeeOther)
+}
+
+// handleAuthorizeError reports whether err ended the request, writing the error page or redirect itself
+func handleAuthorizeError(w http.ResponseWriter, req *http.Request, ar authorizeRequest, err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var redirectErr errorRedirect
+	if errors.As(err, &redirectErr) {
+		ar.redirect(w, req, url.Values{
+			"error":             {redirectErr.code},
+			"error_description": {redirectErr.description},
+		})
+		return true
+	}
+
+	renderConsent(w, http.StatusBadRequest, consentView{Fatal: err.Error()})
+	return true
+}
+
+func renderConsent(w http.ResponseWriter, status int, view consentView) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// the consent page takes a password, so it must never be framed by another site
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.WriteHeader(status)
+
+	if err := consentPage.Execute(w, view); err != nil {
+		log.Printf("Error: could not render consent page: %v", err)
+	}
+}
+
+func newConsentView(ar authorizeRequest, values url.Values) consentView {
+	view := consentView{
+		ClientName: ar.client.Name,
+		Params:     map[string]string{},
+	}
+
+	for _, scope := range ar.scopes {
+		view.Scopes = append(view.Scopes, scopeDescriptions[scope])
+	}
+
+	for _, name := range []string{"response_type", "client_id", "redirect_uri", "scope", "state", "code_challenge", "code_challenge_method"} {
+		if v := values.Get(name); v != "" {
+			view.Params[name] = v
+		}
+	}
+
+	return view
+}
+
+// HandlerOAuthAuthorize shows the consent page for an authorization request
+func HandlerOAuthAuthorize(db oauthClientGetter) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		values := req.URL.Query()
+
+		ar, err := parseAuthorizeRequest(req.Context(), db, values)
+		if handleAuthorizeError(w, req, ar, err) {
+			return
+		}
+
+		renderConsent(w, http.StatusOK, newConsentView(ar, values))
+	}
+}
+
+type oauthConsentStore interface {
+	GetUserByEmail(ctx context.Context, email string) (database.User, error)
+	CreateOAuthAuthorizationCode(ctx context.Context, arg database.CreateOAuthAuthorizationCodeParams) error
+	oauthClientGetter
+	totpStepStore
+	throttleStore
+}
+
+// HandlerOAuthApprove handles the consent form. The user signs in on Chirpy's own page, so the
+// third-party app never sees their password, and approving redirects back with a one-time code.
+func HandlerOAuthApprove(db oauthConsentStore) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if err := req.ParseForm(); err != nil {
+			renderConsent(w, http.StatusBadRequest, consentView{Fatal: "could not parse form body"})
+			return
+		}
+		values := req.PostForm
+
+		ar, err := parseAuthorizeRequest(req.Context(), db, values)
+		if handleAuthorizeError(w, req, ar, err) {
+			return
+		}
+
+		if values.Get("decision") != "approve" {
+			ar.redirect(w, req, url.Values{
+				"error":             {"access_denied"},
+				"error_description": {"the user denied the request"},
+			})
+			return
+		}
+
+		view := newConsentView(ar, values)
+		view.Email = values.Get("email")
+
+		throttleKeys := loginThrottleKeys(req, view.Email)
+		if _, locked := lockedUntil(req.Context(), db, throttleKeys); locked {
+			view.Error = lockedOutMsg
+			renderConsent(w, http.StatusTooManyRequests, view)
+			return
+		}
+
+		dbUser, err := db.GetUserByEmail(req.Context(), view.Email)
+		if err == nil {
+			var ok bool
+			ok, err = auth.CheckPasswordHash(values.Get("password"), dbUser.HashedPassword)
+			if err == nil && !ok {
+				err = errors.New("incorrect password")
+			}
+		}
+		if err != nil {
+			recordFailure(req.Context(), db, throttleKeys)
+			view.Error = "Incorrect email or password"
+			renderConsent(w, http.StatusUnauthorized, view)
+			return
+		}
+
+		if dbUser.TotpEnabled && !checkTOTP(req.Context(), db, dbUser, values.Get("totp_code")) {
+			recordFailure(req.Context(), db, throttleKeys)
+			view.Error = "Invalid or missing two-factor code"
+			renderConsent(w, http.StatusUnauthorized, view)
+			return
+		}
+
+		if err := db.ClearAuthThrottle(req.Context(), throttleKeys[0].key); err != nil {
+			log.Printf("Error: could not clear login throttle for user %v: %v", dbUser.ID, err)
+		}
+
+		code := auth.MakeRefreshToken()
+		if err := db.CreateOAuthAuthorizationCode(req.Context(), database.CreateOAuthAuthorizationCodeParams{
+			CodeHash: auth.HashToken(code),
+			ClientID: ar.client.ID,
+			UserID:   dbUser.ID,
+			// the token request must repeat redirect_uri exactly as it was sent here, even if it was omitted
+			RedirectUri:   values.Get("redirect_uri"),
+			Scopes:        ar.scopes,
+			CodeChallenge: ar.codeChallenge,
+			ExpiresAt:     time.Now().Add(authorizationCodeTTL),
+		}); err != nil {
+			log.Printf("Error: could not create authorization code for client %v: %v", ar.client.ID, err)
+			ar.redirect(w, req, url.Values{"error": {"server_error"}})
+			return
+		}
+
+		log.Printf("User %v approved oauth client %v for %v", dbUser.ID, ar.client.ID, ar.scopes)
+		ar.redirect(w, req, url.Values{"code": {code}})
+	}
+}
@@ -0,0 +1,240 @@
+package public
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/problem"
+	"github.com/google/uuid"
+)
+
+const (
+	maxClientNameLength   = 100
+	maxClientRedirectURIs = 10
+)
+
+type oauthClientParams struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+	// Confidential clients run on a server and can keep a secret. Public clients, such as
+	// mobile and single-page apps, cannot, so they rely on PKCE alone.
+	Confidential bool `json:"confidential"`
+}
+
+type apiOAuthClient struct {
+	ClientID     uuid.UUID `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Confidential bool      `json:"confidential"`
+	CreatedAt    time.Time `json:"created_at"`
+	// ClientSecret is only ever returned once, when a confidential client is registered
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+func dbClientToAPIClient(client database.OauthClient) apiOAuthClient {
+	return apiOAuthClient{
+		ClientID:     client.ID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectUris,
+		Scopes:       client.Scopes,
+		Confidential: client.SecretHash.Valid,
+		CreatedAt:    client.CreatedAt,
+	}
+}
+
+// validRedirectURI only allows absolute https URIs, or http on the loopback interface for local development
+func validRedirectURI(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return fmt.Errorf("redirect uri %q must be an absolute URL", raw)
+	}
+
+	if u.Fragment != "" {
+		return fmt.Errorf("redirect uri %q must not contain a fragment", raw)
+	}
+
+	switch {
+	case u.Scheme == "https":
+		return nil
+	case u.Scheme == "http" && (u.Hostname() == "localhost" || u.Hostname() == "127.0.0.1" || u.Hostname() == "::1"):
+		return nil
+	default:
+		return fmt.Errorf("redirect uri %q must use https", raw)
+	}
+}
+
+type oauthClientStore interface {
+	CreateOAuthClient(ctx context.Context, arg database.CreateOAuthClientParams) (database.OauthClient, error)
+	ListOAuthClients(ctx context.Context, ownerID uuid.UUID) ([]database.OauthClient, error)
+	DeleteOAuthClient(ctx context.Context, arg database.DeleteOAuthClientParams) (int64, error)
+	userGetter
+}
+
+// HandlerRegisterOAuthClient registers a third-party app owned by the caller. Like personal access
+// tokens, clients can only be managed from a first-party login session.
+func HandlerRegisterOAuthClient(db oauthClientStore, secret string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		token, err := auth.GetBearerToken(req.Header)
+		if err != nil {
+			problem.Error(w, "could not get bearer token from header", http.StatusUnauthorized)
+			return
+		}
+
+		userID, err := auth.ValidateJWT(token, secret)
+		if err != nil {
+			log.Printf("Error: could not validate JWT: %v", err)
+			problem.Error(w, "could not validate JWT", http.StatusUnauthorized)
+			return
+		}
+
+		if !requireUnrestricted(w, req, db, userID) {
+			return
+		}
+
+		var clientReq oauthClientParams
+		if err := json.NewDecoder(req.Body).Decode(&clientReq); err != nil {
+			problem.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if clientReq.Name == "" || len(clientReq.Name) > maxClientNameLength {
+			problem.Error(w, "client name must be between 1 and 100 characters", http.StatusBadRequest)
+			return
+		}
+
+		if len(clientReq.RedirectURIs) == 0 || len(clientReq.RedirectURIs) > maxClientRedirectURIs {
+			problem.Error(w, "between 1 and 10 redirect uris are required", http.StatusBadRequest)
+			return
+		}
+
+		for _, uri := range clientReq.RedirectURIs {
+			if err := validRedirectURI(uri); err != nil {
+				problem.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if len(clientReq.Scopes) == 0 {
+			problem.Error(w, "at least one scope is required", http.StatusBadRequest)
+			return
+		}
+
+		for _, scope := range clientReq.Scopes {
+			if !auth.ValidScope(scope) {
+				problem.Error(w, "unknown scope "+scope, http.StatusBadRequest)
+				return
+			}
+		}
+
+		var clientSecret string
+		var secretHash sql.NullString
+		if clientReq.Confidential {
+			clientSecret = auth.MakeRefreshToken()
+			secretHash = sql.NullString{String: auth.HashToken(clientSecret), Valid: true}
+		}
+
+		client, err := db.CreateOAuthClient(req.Context(), database.CreateOAuthClientParams{
+			OwnerID:      userID,
+			Name:         clientReq.Name,
+			SecretHash:   secretHash,
+			RedirectUris: clientReq.RedirectURIs,
+			Scopes:       clientReq.Scopes,
+		})
+		if err != nil {
+			log.Printf("Error: could not create oauth client for user %v: %v", userID, err)
+			problem.Error(w, "could not register client", http.StatusInternalServerError)
+			return
+		}
+
+		created := dbClientToAPIClient(client)
+		created.ClientSecret = clientSecret
+
+		log.Printf("User %v registered oauth client %v", userID, client.ID)
+		w.WriteHeader(http.StatusCreated)
+		writeResponse(created, w)
+	}
+}
+
+func HandlerListOAuthClients(db oauthClientStore, secret string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		token, err := auth.GetBearerToken(req.Header)
+		if err != nil {
+			problem.Error(w, "could not get bearer token from header", http.StatusUnauthorized)
+			return
+		}
+
+		userID, err := auth.ValidateJWT(token, secret)
+		if err != nil {
+			log.Printf("Error: could not validate JWT: %v", err)
+			problem.Error(w, "could not validate JWT", http.StatusUnauthorized)
+			return
+		}
+
+		dbClients, err := db.ListOAuthClients(req.Context(), userID)
+		if err != nil {
+			log.Printf("Error: could not list oauth clients for user %v: %v", userID, err)
+			problem.Error(w, "could not list clients", http.StatusInternalServerError)
+			return
+		}
+
+		clients := []apiOAuthClient{}
+		for _, client := range dbClients {
+			clients = append(clients, dbClientToAPIClient(client))
+		}
+
+		w.WriteHeader(http.StatusOK)
+		writeResponse(clients, w)
+	}
+}
+
+// HandlerDeleteOAuthClient removes a client along with its outstanding codes and refresh tokens
+func HandlerDeleteOAuthClient(db oauthClientStore, secret string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		token, err := auth.GetBearerToken(req.Header)
+		if err != nil {
+			problem.Error(w, "could not get bearer token from header", http.StatusUnauthorized)
+			return
+		}
+
+		userID, err := auth.ValidateJWT(token, secret)
+		if err != nil {
+			log.Printf("Error: could not validate JWT: %v", err)
+			problem.Error(w, "could not validate JWT", http.StatusUnauthorized)
+			return
+		}
+
+		clientID, err := uuid.Parse(req.PathValue("clientID"))
+		if err != nil {
+			problem.Error(w, "could not parse client ID to uuid", http.StatusBadRequest)
+			return
+		}
+
+		deleted, err := db.DeleteOAuthClient(req.Context(), database.DeleteOAuthClientParams{
+			ID:      clientID,
+			OwnerID: userID,
+		})
+		if err != nil {
+			log.Printf("Error: could not delete oauth client %v: %v", clientID, err)
+			problem.Error(w, "could not delete client", http.StatusInternalServerError)
+			return
+		}
+
+		if deleted == 0 {
+			problem.Error(w, "could not find client", http.StatusNotFound)
+			return
+		}
+
+		log.Printf("User %v deleted oauth client %v", userID, clientID)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
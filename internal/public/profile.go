@@ -0,0 +1,148 @@
+package public
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/problem"
+	"github.com/bailey4770/chirpy/internal/profile"
+	"github.com/google/uuid"
+)
+
+// apiProfile is the public view of a user. It must never include the email address.
+type apiProfile struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	Location    string    `json:"location"`
+	Website     string    `json:"website"`
+	AvatarURL   string    `json:"avatar_url"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+}
+
+func dbUserToAPIProfile(dbUser database.User) apiProfile {
+	return apiProfile{
+		ID:          dbUser.ID,
+		CreatedAt:   dbUser.CreatedAt,
+		DisplayName: dbUser.DisplayName,
+		Bio:         dbUser.Bio,
+		Location:    dbUser.Location,
+		Website:     dbUser.Website,
+		AvatarURL:   dbUser.AvatarUrl,
+		IsChirpyRed: dbUser.IsChirpyRed,
+	}
+}
+
+// profileUpdateParams only changes the fields that are present. An empty string clears a field.
+type profileUpdateParams struct {
+	DisplayName *string `json:"display_name"`
+	Bio         *string `json:"bio"`
+	Location    *string `json:"location"`
+	Website     *string `json:"website"`
+	AvatarURL   *string `json:"avatar_url"`
+}
+
+type profileGetter interface {
+	GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error)
+}
+
+func HandlerGetProfile(db profileGetter) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		userID, err := uuid.Parse(req.PathValue("userID"))
+		if err != nil {
+			problem.Error(w, "could not parse user ID to uuid", http.StatusBadRequest)
+			return
+		}
+
+		dbUser, err := db.GetUserByID(req.Context(), userID)
+		// accounts pending deletion are hidden, like their chirps
+		if err != nil || dbUser.DeleteAfter.Valid {
+			problem.Error(w, "could not find user", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		writeResponse(dbUserToAPIProfile(dbUser), w)
+	}
+}
+
+type profileStore interface {
+	GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error)
+	UpdateProfile(ctx context.Context, arg database.UpdateProfileParams) (database.User, error)
+	tokenAuthenticator
+}
+
+// HandlerUpdateProfile applies a partial update to the caller's profile, cleaning every field
+// and rejecting the whole update if any field is invalid
+func HandlerUpdateProfile(db profileStore, secret string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		p, ok := requireAuth(w, req, db, secret, auth.ScopeProfileWrite)
+		if !ok {
+			return
+		}
+
+		var updateReq profileUpdateParams
+		if err := json.NewDecoder(req.Body).Decode(&updateReq); err != nil {
+			problem.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		dbUser, err := db.GetUserByID(req.Context(), p.UserID)
+		if err != nil {
+			problem.Error(w, "could not find user", http.StatusUnauthorized)
+			return
+		}
+
+		fields := profile.Fields{
+			DisplayName: dbUser.DisplayName,
+			Bio:         dbUser.Bio,
+			Location:    dbUser.Location,
+			Website:     dbUser.Website,
+			AvatarURL:   dbUser.AvatarUrl,
+		}
+		for dst, src := range map[*string]*string{
+			&fields.DisplayName: updateReq.DisplayName,
+			&fields.Bio:         updateReq.Bio,
+			&fields.Location:    updateReq.Location,
+			&fields.Website:     updateReq.Website,
+			&fields.AvatarURL:   updateReq.AvatarURL,
+		} {
+			if src != nil {
+				*dst = *src
+			}
+		}
+
+		clean, violations := profile.Sanitize(fields)
+		if len(violations) > 0 {
+			d := problem.New(http.StatusBadRequest, problem.CodeValidation, "profile is invalid")
+			for _, v := range violations {
+				d.Errors = append(d.Errors, problem.FieldError{Field: v.Field, Message: v.Message})
+			}
+			problem.Write(w, d)
+			return
+		}
+
+		updated, err := db.UpdateProfile(req.Context(), database.UpdateProfileParams{
+			ID:          p.UserID,
+			DisplayName: clean.DisplayName,
+			Bio:         clean.Bio,
+			Location:    clean.Location,
+			Website:     clean.Website,
+			AvatarUrl:   clean.AvatarURL,
+		})
+		if err != nil {
+			log.Printf("Error: could not update profile for user %v: %v", p.UserID, err)
+			problem.Error(w, "could not update profile", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		writeResponse(dbUserToAPIProfile(updated), w)
+	}
+}
@@ -3,14 +3,26 @@ package public
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
-	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/bailey4770/chirpy/internal/analytics"
+	"github.com/bailey4770/chirpy/internal/audit"
 	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/clientip"
 	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/filter"
+	"github.com/bailey4770/chirpy/internal/password"
+	"github.com/bailey4770/chirpy/internal/problem"
 	"github.com/google/uuid"
 )
 
@@ -23,15 +35,17 @@ func HandlerHealth(w http.ResponseWriter, req *http.Request) {
 }
 
 type chirpParams struct {
-	Body string `json:"body"`
+	Body     string      `json:"body"`
+	MediaIDs []uuid.UUID `json:"media_ids"`
 }
 
 type apiChirp struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserID    uuid.UUID `json:"user_id"`
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Body      string     `json:"body"`
+	UserID    uuid.UUID  `json:"user_id"`
+	Media     []apiMedia `json:"media"`
 }
 
 func dbChirpToAPIChirp(dbChirp database.Chirp) apiChirp {
@@ -41,79 +55,213 @@ func dbChirpToAPIChirp(dbChirp database.Chirp) apiChirp {
 		UpdatedAt: dbChirp.UpdatedAt,
 		Body:      dbChirp.Body,
 		UserID:    dbChirp.UserID,
+		Media:     []apiMedia{},
 	}
 }
 
+// ChirpPolicy holds server-wide rules applied when users post chirps
+type ChirpPolicy struct {
+	RequireVerifiedEmail bool
+	// MaxMedia is the number of uploads that can be attached to one chirp
+	MaxMedia int
+	// Filter checks chirps for banned words. The default word list is used if it is nil.
+	Filter *filter.Engine
+}
+
 type chirpCreator interface {
 	CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error)
+	DeleteChirp(ctx context.Context, id uuid.UUID) error
+	GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error)
+	GetMediaAttachment(ctx context.Context, id uuid.UUID) (database.MediaAttachment, error)
+	AttachMediaToChirp(ctx context.Context, arg database.AttachMediaToChirpParams) (int64, error)
+	OpenModerationCase(ctx context.Context, arg database.OpenModerationCaseParams) (database.ModerationCase, error)
+	CreateChirpReport(ctx context.Context, arg database.CreateChirpReportParams) (int64, error)
+	tokenAuthenticator
 }
 
-func HandlerPostChirp(db chirpCreator, secret string) func(http.ResponseWriter, *http.Request) {
-	removeProfanity := func(text string) string {
-		profanity := []string{
-			"kerfuffle",
-			"sharbert",
-			"fornax",
-		}
-
-		for _, bw := range profanity {
-			re := regexp.MustCompile(`(?i)` + regexp.QuoteMeta(bw))
-			text = re.ReplaceAllString(text, "****")
-		}
-
-		return text
+// HandlerPostChirp creates a chirp after running it through the content filter, which may mask words,
+// refuse the chirp, or post it and send it to the moderation queue
+func HandlerPostChirp(db chirpCreator, secret string, policy ChirpPolicy) func(http.ResponseWriter, *http.Request) {
+	contentFilter := policy.Filter
+	if contentFilter == nil {
+		contentFilter = filter.NewEngine(filter.DefaultRules)
 	}
 
 	return func(w http.ResponseWriter, req *http.Request) {
 		chirpReq := chirpParams{}
 		if err := json.NewDecoder(req.Body).Decode(&chirpReq); err != nil {
-			http.Error(w, "invalid request body", http.StatusBadRequest)
+			problem.Error(w, "invalid request body", http.StatusBadRequest)
 			return
 		}
 
-		token, err := auth.GetBearerToken(req.Header)
-		if err != nil {
-			http.Error(w, "could not get bearer token from header", http.StatusUnauthorized)
+		caller, ok := requireAuth(w, req, db, secret, auth.ScopeChirpsWrite)
+		if !ok {
 			return
 		}
+		userID := caller.UserID
 
-		userID, err := auth.ValidateJWT(token, secret)
-		if err != nil {
-			log.Printf("Error: could not validate JWT: %v", err)
-			http.Error(w, "could not validate JWT", http.StatusUnauthorized)
-			return
+		if policy.RequireVerifiedEmail {
+			dbUser, err := db.GetUserByID(req.Context(), userID)
+			if err != nil {
+				problem.Error(w, "could not find user", http.StatusUnauthorized)
+				return
+			}
+
+			if !dbUser.EmailVerified {
+				problem.Error(w, "email address must be verified before posting chirps", http.StatusForbidden)
+				return
+			}
 		}
 
 		if len(chirpReq.Body) > 140 {
-			http.Error(w, "Chirp is too long", http.StatusBadRequest)
+			problem.Error(w, "Chirp is too long", http.StatusBadRequest)
+			return
+		}
+
+		if len(chirpReq.MediaIDs) > policy.MaxMedia {
+			problem.Error(w, fmt.Sprintf("a chirp can have at most %d media attachments", policy.MaxMedia), http.StatusBadRequest)
 			return
 		}
 
+		filtered := contentFilter.Apply(chirpReq.Body)
+		if filtered.Rejected {
+			log.Printf("Warning: chirp by user %v was rejected by the content filter", userID)
+			problem.Error(w, "chirp contains language that is not allowed", http.StatusBadRequest)
+			return
+		}
+
+		attachments := make([]database.MediaAttachment, 0, len(chirpReq.MediaIDs))
+		for _, mediaID := range chirpReq.MediaIDs {
+			m, err := db.GetMediaAttachment(req.Context(), mediaID)
+			if err != nil || m.UserID != userID || m.ChirpID.Valid || slices.ContainsFunc(attachments, func(a database.MediaAttachment) bool { return a.ID == mediaID }) {
+				problem.Error(w, fmt.Sprintf("media %v is not an unused upload of yours", mediaID), http.StatusBadRequest)
+				return
+			}
+			attachments = append(attachments, m)
+		}
+
 		dbChirp, err := db.CreateChirp(req.Context(), database.CreateChirpParams{
-			Body:   removeProfanity(chirpReq.Body),
+			Body:   filtered.Text,
 			UserID: userID,
 		})
 		if err != nil {
-			http.Error(w, "Could not create chirp in db", http.StatusInternalServerError)
+			problem.Error(w, "Could not create chirp in db", http.StatusInternalServerError)
 			return
 		}
 
 		chirp := dbChirpToAPIChirp(dbChirp)
 
+		for i, m := range attachments {
+			attached, err := db.AttachMediaToChirp(req.Context(), database.AttachMediaToChirpParams{
+				ID:       m.ID,
+				UserID:   userID,
+				ChirpID:  uuid.NullUUID{UUID: dbChirp.ID, Valid: true},
+				Position: int32(i),
+			})
+			if err != nil || attached == 0 {
+				// another chirp claimed the upload since it was checked, so take this one back
+				log.Printf("Warning: could not attach media %v to chirp %v: %v", m.ID, dbChirp.ID, err)
+				if err := db.DeleteChirp(req.Context(), dbChirp.ID); err != nil {
+					log.Printf("Error: could not remove chirp %v after failing to attach media: %v", dbChirp.ID, err)
+				}
+				problem.Error(w, fmt.Sprintf("media %v is not an unused upload of yours", m.ID), http.StatusBadRequest)
+				return
+			}
+			chirp.Media = append(chirp.Media, dbMediaToAPIMedia(m))
+		}
+
+		if filtered.Flagged {
+			flagChirp(req.Context(), db, dbChirp, filtered)
+		}
+
 		log.Printf("User %v successfully posted chirp %v", userID, dbChirp.ID)
 		w.WriteHeader(http.StatusCreated)
 		writeResponse(chirp, w)
 	}
 }
 
+// flagChirp sends a chirp the content filter flagged to the moderation queue. The report has no reporter,
+// and its comment lists the rules that matched. The chirp has been posted either way, so failures are only logged.
+func flagChirp(ctx context.Context, db chirpCreator, dbChirp database.Chirp, filtered filter.Result) {
+	var matched []string
+	for _, m := range filtered.Matches {
+		rule := fmt.Sprintf("%s (%s)", m.Rule.Pattern, m.Rule.Severity)
+		if m.Rule.Action == filter.ActionFlag && !slices.Contains(matched, rule) {
+			matched = append(matched, rule)
+		}
+	}
+
+	modCase, err := db.OpenModerationCase(ctx, database.OpenModerationCaseParams{
+		ChirpID:       dbChirp.ID,
+		ChirpAuthorID: dbChirp.UserID,
+		ChirpBody:     dbChirp.Body,
+	})
+	if err != nil {
+		log.Printf("Error: could not open moderation case for flagged chirp %v: %v", dbChirp.ID, err)
+		return
+	}
+
+	if _, err := db.CreateChirpReport(ctx, database.CreateChirpReportParams{
+		CaseID:   modCase.ID,
+		Category: filterReportCategory,
+		Comment:  "matched filter rules: " + strings.Join(matched, ", "),
+	}); err != nil {
+		log.Printf("Error: could not report flagged chirp %v: %v", dbChirp.ID, err)
+		return
+	}
+
+	log.Printf("Chirp %v was flagged for review by the content filter", dbChirp.ID)
+}
+
 type chirpStore interface {
 	FetchChirpsWithOptionalParams(ctx context.Context, arg database.FetchChirpsWithOptionalParamsParams) ([]database.Chirp, error)
 	FetchChirpByID(ctx context.Context, id uuid.UUID) (database.Chirp, error)
 	DeleteChirp(ctx context.Context, id uuid.UUID) error
+	mediaLister
+	relationReader
+	tokenAuthenticator
+	auditRecorder
 }
 
-func HandlerFetchChirpsByAge(db chirpStore) func(http.ResponseWriter, *http.Request) {
+// maxChirpPageSize is the largest limit on a chirp listing, and the most chirps one listing counts
+// impressions for
+const maxChirpPageSize = 100
+
+// impressionRecorder is told which chirps each viewer was shown, for their authors' analytics
+type impressionRecorder interface {
+	Record(viewer string, chirpIDs ...uuid.UUID)
+}
+
+// recordImpressions counts chirps shown to viewerID, except their own. Only the first
+// maxChirpPageSize are counted, so one request for every chirp cannot crowd out everyone else's
+// impressions. impressions may be nil.
+func recordImpressions(req *http.Request, impressions impressionRecorder, secret string, viewerID uuid.UUID, chirps []apiChirp) {
+	if impressions == nil {
+		return
+	}
+	chirps = chirps[:min(len(chirps), maxChirpPageSize)]
+
+	chirpIDs := make([]uuid.UUID, 0, len(chirps))
+	for _, c := range chirps {
+		if c.UserID != viewerID {
+			chirpIDs = append(chirpIDs, c.ID)
+		}
+	}
+	if len(chirpIDs) > 0 {
+		impressions.Record(analytics.ViewerID(secret, viewerID, clientip.FromRequest(req), time.Now()), chirpIDs...)
+	}
+}
+
+// HandlerFetchChirpsByAge lists chirps to anyone, a page at a time if limit is given. Logged-in
+// viewers do not see chirps from users they have blocked, who have blocked them, or whom they have
+// muted. A muted author's chirps are still listed when they are asked for by author_id.
+func HandlerFetchChirpsByAge(db chirpStore, secret string, impressions impressionRecorder) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, req *http.Request) {
+		viewer, ok := optionalAuth(w, req, db, secret, auth.ScopeChirpsRead)
+		if !ok {
+			return
+		}
+
 		authorIDString := req.URL.Query().Get("author_id")
 
 		var authorID uuid.UUID
@@ -121,7 +269,7 @@ func HandlerFetchChirpsByAge(db chirpStore) func(http.ResponseWriter, *http.Requ
 			var err error
 			authorID, err = uuid.Parse(authorIDString)
 			if err != nil {
-				http.Error(w, "could not find any chirps from provided user", http.StatusBadRequest)
+				problem.Error(w, "could not find any chirps from provided user", http.StatusBadRequest)
 				return
 			}
 		}
@@ -131,13 +279,35 @@ func HandlerFetchChirpsByAge(db chirpStore) func(http.ResponseWriter, *http.Requ
 			orderBy = "asc"
 		}
 
+		var limit sql.NullInt32
+		if v := req.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxChirpPageSize {
+				problem.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxChirpPageSize), http.StatusBadRequest)
+				return
+			}
+			limit = sql.NullInt32{Int32: int32(n), Valid: true}
+		}
+
+		var offset int
+		if v := req.URL.Query().Get("offset"); v != "" {
+			var err error
+			if offset, err = strconv.Atoi(v); err != nil || offset < 0 || offset > math.MaxInt32 {
+				problem.Error(w, "offset must be a whole number", http.StatusBadRequest)
+				return
+			}
+		}
+
 		dbChirps, err := db.FetchChirpsWithOptionalParams(req.Context(), database.FetchChirpsWithOptionalParamsParams{
-			Column1: authorID,
-			Column2: orderBy,
+			Column1:  authorID,
+			Column2:  orderBy,
+			Limit:    limit,
+			Offset:   int32(offset),
+			ViewerID: viewer.UserID,
 		})
 		if err != nil {
 			log.Printf("Error: could not fetch chirps from [optional] %v sorted by [optional] %v: %v", authorID, orderBy, err)
-			http.Error(w, "could not fetch chirps", http.StatusNotFound)
+			problem.Error(w, "could not fetch chirps", http.StatusNotFound)
 			return
 		}
 
@@ -146,26 +316,59 @@ func HandlerFetchChirpsByAge(db chirpStore) func(http.ResponseWriter, *http.Requ
 			chirps = append(chirps, dbChirpToAPIChirp(dbChirp))
 		}
 
+		if err := withMedia(req.Context(), db, chirps); err != nil {
+			log.Printf("Error: could not fetch media for chirps: %v", err)
+			problem.Error(w, "could not fetch chirps", http.StatusInternalServerError)
+			return
+		}
+
+		recordImpressions(req, impressions, secret, viewer.UserID, chirps)
 		w.WriteHeader(http.StatusOK)
 		writeResponse(chirps, w)
 	}
 }
 
-func HandlerFetchChirpByID(db chirpStore) func(http.ResponseWriter, *http.Request) {
+// HandlerFetchChirpByID returns a chirp to anyone, except that users on either side of a block
+// cannot see each other's chirps. Muting does not hide a chirp that is asked for directly.
+func HandlerFetchChirpByID(db chirpStore, secret string, impressions impressionRecorder) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, req *http.Request) {
+		viewer, ok := optionalAuth(w, req, db, secret, auth.ScopeChirpsRead)
+		if !ok {
+			return
+		}
+
 		chirpID, err := uuid.Parse(req.PathValue("chirpID"))
 		if err != nil {
-			http.Error(w, "could not parse chirp ID to uuid", http.StatusBadRequest)
+			problem.Error(w, "could not parse chirp ID to uuid", http.StatusBadRequest)
 			return
 		}
 
 		dbChirp, err := db.FetchChirpByID(req.Context(), chirpID)
 		if err != nil {
-			http.Error(w, "could not fetch requested chirp", http.StatusNotFound)
+			problem.Error(w, "could not fetch requested chirp", http.StatusNotFound)
 			return
 		}
 
-		chirp := dbChirpToAPIChirp(dbChirp)
+		hidden, err := loadRelations(req.Context(), db, viewer.UserID)
+		if err != nil {
+			log.Printf("Error: could not load blocks and mutes of %v: %v", viewer.UserID, err)
+			problem.Error(w, "could not fetch requested chirp", http.StatusInternalServerError)
+			return
+		}
+		if hidden.blocked[dbChirp.UserID] {
+			// answer as if the chirp did not exist, so a block cannot be probed for
+			problem.Error(w, "could not fetch requested chirp", http.StatusNotFound)
+			return
+		}
+
+		chirps := []apiChirp{dbChirpToAPIChirp(dbChirp)}
+		if err := withMedia(req.Context(), db, chirps); err != nil {
+			log.Printf("Error: could not fetch media for chirp %v: %v", chirpID, err)
+			problem.Error(w, "could not fetch requested chirp", http.StatusInternalServerError)
+			return
+		}
+		chirp := chirps[0]
+		recordImpressions(req, impressions, secret, viewer.UserID, chirps)
 
 		log.Printf("Chirp %v successfully requested ", chirpID)
 		w.WriteHeader(http.StatusOK)
@@ -175,39 +378,35 @@ func HandlerFetchChirpByID(db chirpStore) func(http.ResponseWriter, *http.Reques
 
 func HandlerDeleteChirp(db chirpStore, secret string) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, req *http.Request) {
-		token, err := auth.GetBearerToken(req.Header)
-		if err != nil {
-			http.Error(w, "could not get bearer token from header", http.StatusUnauthorized)
-			return
-		}
-
-		userID, err := auth.ValidateJWT(token, secret)
-		if err != nil {
-			log.Printf("Error: could not validate JWT: %v", err)
-			http.Error(w, "could not validate JWT", http.StatusUnauthorized)
+		caller, ok := requireAuth(w, req, db, secret, auth.ScopeChirpsWrite)
+		if !ok {
 			return
 		}
+		userID := caller.UserID
 
 		chirpID, err := uuid.Parse(req.PathValue("chirpID"))
 		if err != nil {
-			http.Error(w, "could not parse chirp ID to uuid", http.StatusBadRequest)
+			problem.Error(w, "could not parse chirp ID to uuid", http.StatusBadRequest)
 			return
 		}
 
 		dbChirp, err := db.FetchChirpByID(req.Context(), chirpID)
 		if err != nil {
-			http.Error(w, "could not fetch requested chirp", http.StatusNotFound)
+			problem.Error(w, "could not fetch requested chirp", http.StatusNotFound)
 			return
 		}
 
 		if userID != dbChirp.UserID {
-			http.Error(w, "request user ID does not match chirp's user ID", http.StatusForbidden)
+			problem.Error(w, "request user ID does not match chirp's user ID", http.StatusForbidden)
 			return
 		}
 
-		if err = db.DeleteChirp(req.Context(), dbChirp.ID); err != nil {
+		event := audit.Event{ActorID: userID, Action: audit.ActionChirpDelete, TargetType: audit.TargetChirp, TargetID: chirpID.String()}
+		if err := db.RecordAudit(req.Context(), event, func(ctx context.Context) error {
+			return db.DeleteChirp(ctx, dbChirp.ID)
+		}); err != nil {
 			log.Printf("Error: could not delete chirp from db: %v", err)
-			http.Error(w, "could no delete chirp from db", http.StatusInternalServerError)
+			problem.Error(w, "could no delete chirp from db", http.StatusInternalServerError)
 			return
 		}
 
@@ -219,35 +418,44 @@ func HandlerDeleteChirp(db chirpStore, secret string) func(http.ResponseWriter,
 type userRequestParams struct {
 	Password string `json:"password"`
 	Email    string `json:"email"`
+	// Session is only read by login. "cookie" sets session cookies instead of returning the tokens.
+	Session string `json:"session"`
 }
 
 type apiUser struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	Email        string    `json:"email"`
-	Token        string    `json:"token"`
-	RefreshToken string    `json:"refresh_token"`
-	IsChirpyRed  bool      `json:"is_chirpy_red"`
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	Token         string    `json:"token,omitempty"`
+	RefreshToken  string    `json:"refresh_token,omitempty"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+	EmailVerified bool      `json:"email_verified"`
 }
 
 type userCreator interface {
 	CreateUser(ctx context.Context, arg database.CreateUserParams) (database.CreateUserRow, error)
+	userTokenIssuer
 }
 
-func HandlerCreateUser(db userCreator) func(http.ResponseWriter, *http.Request) {
+func HandlerCreateUser(db userCreator, mail MailConfig, policy password.Policy) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, req *http.Request) {
 		createUserReq := userRequestParams{}
 
 		if err := json.NewDecoder(req.Body).Decode(&createUserReq); err != nil {
 			log.Printf("Error: could not recode create user request to Go struct: %v", err)
-			http.Error(w, "invalid requesy body", http.StatusBadRequest)
+			problem.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if violations := policy.Validate(createUserReq.Password, createUserReq.Email); len(violations) > 0 {
+			writePasswordViolations(w, violations)
 			return
 		}
 
 		hashedPassword, err := auth.HashPassword(createUserReq.Password)
 		if err != nil {
-			http.Error(w, "could not hash provided password", http.StatusInternalServerError)
+			problem.Error(w, "could not hash provided password", http.StatusInternalServerError)
 			return
 		}
 
@@ -257,12 +465,16 @@ func HandlerCreateUser(db userCreator) func(http.ResponseWriter, *http.Request)
 		})
 		if err != nil {
 			log.Printf("Error: could not create new user with email %s: %v", createUserReq.Email, err)
-			http.Error(w, "databse could not create new user with email %s", http.StatusInternalServerError)
+			problem.Error(w, "could not create new user", http.StatusInternalServerError)
 			return
 		}
 
 		log.Printf("New user %s successfully created", dbUser.Email)
 
+		if err := sendVerificationEmail(req.Context(), db, mail, dbUser.ID, dbUser.Email); err != nil {
+			log.Printf("Error: could not send verification email to new user %v: %v", dbUser.ID, err)
+		}
+
 		user := apiUser{
 			ID:          dbUser.ID,
 			CreatedAt:   dbUser.CreatedAt,
@@ -276,6 +488,8 @@ func HandlerCreateUser(db userCreator) func(http.ResponseWriter, *http.Request)
 	}
 }
 
+const webhookSourcePolka = "polka"
+
 type polkaWebhook struct {
 	Event string `json:"event"`
 	Data  struct {
@@ -285,6 +499,8 @@ type polkaWebhook struct {
 
 type userUpgrader interface {
 	MakeUserRed(ctx context.Context, id uuid.UUID) error
+	CreateWebhookDelivery(ctx context.Context, arg database.CreateWebhookDeliveryParams) error
+	auditRecorder
 }
 
 func HandlerUpgradeUser(db userUpgrader, polkaKey string) func(http.ResponseWriter, *http.Request) {
@@ -292,29 +508,53 @@ func HandlerUpgradeUser(db userUpgrader, polkaKey string) func(http.ResponseWrit
 		apiKey, err := auth.GetAPIKey(req.Header)
 		if err != nil || apiKey != polkaKey {
 			log.Printf("Error: %v", err)
-			http.Error(w, "invalid api key in authorisation header", http.StatusUnauthorized)
+			problem.Error(w, "invalid api key in authorisation header", http.StatusUnauthorized)
 			return
 		}
 
+		// only authenticated deliveries are kept, so anyone guessing at the endpoint cannot fill the table
+		delivery := database.CreateWebhookDeliveryParams{Source: webhookSourcePolka, StatusCode: http.StatusNoContent}
+		defer func() {
+			if err := db.CreateWebhookDelivery(context.WithoutCancel(req.Context()), delivery); err != nil {
+				log.Printf("Error: could not record %s webhook delivery: %v", delivery.Source, err)
+			}
+		}()
+
 		upgradeReq := polkaWebhook{}
 		if err := json.NewDecoder(req.Body).Decode(&upgradeReq); err != nil {
 			log.Printf("Error: could not decode json: %v", err)
-			http.Error(w, "invalid request body", http.StatusBadRequest)
+			delivery.StatusCode, delivery.Error = http.StatusBadRequest, err.Error()
+			problem.Error(w, "invalid request body", http.StatusBadRequest)
 			return
 		}
 
+		delivery.Event = upgradeReq.Event
+		if upgradeReq.Data.UserID != uuid.Nil {
+			delivery.UserID = uuid.NullUUID{UUID: upgradeReq.Data.UserID, Valid: true}
+		}
+
 		if upgradeReq.Event != "user.upgraded" {
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 
-		if err := db.MakeUserRed(req.Context(), upgradeReq.Data.UserID); err != nil {
+		userID := upgradeReq.Data.UserID
+		event := audit.Event{
+			Action:     audit.ActionUpgrade,
+			TargetType: audit.TargetUser,
+			TargetID:   userID.String(),
+			Metadata:   map[string]string{"source": webhookSourcePolka},
+		}
+		if err := db.RecordAudit(req.Context(), event, func(ctx context.Context) error {
+			return db.MakeUserRed(ctx, userID)
+		}); err != nil {
 			log.Printf("Error: could not upgrade user %v: %v", upgradeReq.Data.UserID, err)
-			http.Error(w, "could not find user", http.StatusNotFound)
+			delivery.StatusCode, delivery.Error = http.StatusNotFound, err.Error()
+			problem.Error(w, "could not find user", http.StatusNotFound)
 			return
 		}
 
-		log.Printf("User %v succesffully upgraded to red", upgradeReq.Data.UserID)
+		log.Printf("User %v successfully upgraded to red", upgradeReq.Data.UserID)
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
@@ -322,104 +562,231 @@ func HandlerUpgradeUser(db userUpgrader, polkaKey string) func(http.ResponseWrit
 type authStore interface {
 	GetUserByEmail(ctx context.Context, email string) (database.User, error)
 	UpdateEmailAndPassword(ctx context.Context, arg database.UpdateEmailAndPasswordParams) (database.UpdateEmailAndPasswordRow, error)
-	CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error)
+	sessionIssuer
 	GetRefreshToken(ctx context.Context, token string) (database.RefreshToken, error)
 	RevokeRefreshToken(ctx context.Context, token string) error
+	UpdatePassword(ctx context.Context, arg database.UpdatePasswordParams) error
+	throttleStore
+	userGetter
 }
 
-func HandlerLogin(db authStore, secret string) func(http.ResponseWriter, *http.Request) {
+func HandlerLogin(db authStore, secret string, sessions SessionConfig) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, req *http.Request) {
 		loginReq := userRequestParams{}
 
 		if err := json.NewDecoder(req.Body).Decode(&loginReq); err != nil {
 			log.Printf("Error: could not decode json: %v", err)
-			http.Error(w, "invalid request body", http.StatusBadRequest)
+			problem.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if loginReq.Session != "" && loginReq.Session != sessionModeCookie {
+			problem.Error(w, "session must be empty or cookie", http.StatusBadRequest)
+			return
+		}
+
+		throttleKeys := loginThrottleKeys(req, loginReq.Email)
+		if until, locked := lockedUntil(req.Context(), db, throttleKeys); locked {
+			writeLockedOut(w, until)
 			return
 		}
 
 		dbUser, err := db.GetUserByEmail(req.Context(), loginReq.Email)
 		if err != nil {
-			http.Error(w, "Incorrect email or password", http.StatusUnauthorized)
+			recordFailure(req.Context(), db, throttleKeys)
+			problem.Error(w, "Incorrect email or password", http.StatusUnauthorized)
 			return
 		}
 
 		ok, err := auth.CheckPasswordHash(loginReq.Password, dbUser.HashedPassword)
 		if err != nil || !ok {
-			http.Error(w, "Incorrect email or password", http.StatusUnauthorized)
+			recordFailure(req.Context(), db, throttleKeys)
+			recordLoginFailure(req.Context(), db, dbUser.ID, "password")
+			problem.Error(w, "Incorrect email or password", http.StatusUnauthorized)
 			return
 		}
 
-		log.Printf("User %s successfully logged in", dbUser.Email)
+		if err := db.ClearAuthThrottle(req.Context(), throttleKeys[0].key); err != nil {
+			log.Printf("Error: could not clear login throttle for user %v: %v", dbUser.ID, err)
+		}
 
-		token, err := auth.MakeJWT(dbUser.ID, secret)
-		if err != nil {
-			log.Printf("Error: could not make JWT: %v", err)
-			http.Error(w, "could not make JWT", http.StatusInternalServerError)
+		if auth.NeedsRehash(dbUser.HashedPassword) {
+			upgradePasswordHash(req.Context(), db, dbUser.ID, loginReq.Password)
+		}
+
+		if dbUser.TotpEnabled {
+			log.Printf("User %s passed password check, awaiting second factor", dbUser.Email)
+			writeMFAChallenge(w, dbUser, secret)
 			return
 		}
 
-		refreshToken := auth.MakeRefreshToken()
-		_, err = db.CreateRefreshToken(req.Context(), database.CreateRefreshTokenParams{
+		log.Printf("User %s successfully logged in", dbUser.Email)
+		issueSession(w, req, db, dbUser, secret, sessions, loginReq.Session)
+	}
+}
+
+// upgradePasswordHash re-hashes a correct password with the current argon2id parameters.
+// Failure is only logged, as the old hash still verifies.
+func upgradePasswordHash(ctx context.Context, db authStore, userID uuid.UUID, password string) {
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		log.Printf("Error: could not re-hash password for user %v: %v", userID, err)
+		return
+	}
+
+	if err := db.UpdatePassword(ctx, database.UpdatePasswordParams{
+		ID:             userID,
+		HashedPassword: hashedPassword,
+	}); err != nil {
+		log.Printf("Error: could not save upgraded password hash for user %v: %v", userID, err)
+		return
+	}
+
+	log.Printf("Upgraded password hash parameters for user %v", userID)
+}
+
+// errNothingChanged is returned from an audited action that found nothing to act on, so no event is recorded
+var errNothingChanged = errors.New("nothing changed")
+
+type auditRecorder interface {
+	// RecordAudit runs action and records event in one transaction. Queries in action must use the context it is passed.
+	RecordAudit(ctx context.Context, event audit.Event, action func(ctx context.Context) error) error
+}
+
+// recordLoginFailure records a wrong password or second factor for an existing account. Failures for unknown
+// emails are only counted by the login throttle.
+func recordLoginFailure(ctx context.Context, db auditRecorder, userID uuid.UUID, factor string) {
+	event := audit.Event{
+		Action:     audit.ActionLoginFailed,
+		TargetType: audit.TargetUser,
+		TargetID:   userID.String(),
+		Metadata:   map[string]string{"factor": factor},
+	}
+	if err := db.RecordAudit(ctx, event, nil); err != nil {
+		log.Printf("Error: %v", err)
+	}
+}
+
+type sessionIssuer interface {
+	CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error)
+	CancelAccountDeletion(ctx context.Context, id uuid.UUID) (int64, error)
+	auditRecorder
+}
+
+// issueSession mints an access and refresh token pair for a fully authenticated user and writes the login response.
+// In cookie mode the tokens are only set as cookies, never returned where page scripts could read them.
+func issueSession(w http.ResponseWriter, req *http.Request, db sessionIssuer, dbUser database.User, secret string, sessions SessionConfig, mode string) {
+	// users suspended to read-only or shadow-banned may still log in
+	if auth.ActiveSuspension(dbUser.SuspensionKind, dbUser.SuspendedAt, dbUser.SuspendedUntil, time.Now()) == auth.SuspensionFull {
+		log.Printf("Warning: suspended user %v tried to log in", dbUser.ID)
+		problem.Error(w, "account is suspended", http.StatusForbidden)
+		return
+	}
+
+	// logging back in during the grace period is how a user changes their mind about deleting their account
+	if dbUser.DeleteAfter.Valid {
+		if cancelled, err := db.CancelAccountDeletion(req.Context(), dbUser.ID); err != nil {
+			log.Printf("Warning: could not cancel pending deletion for user %v: %v", dbUser.ID, err)
+		} else if cancelled > 0 {
+			log.Printf("User %v logged in and cancelled their pending account deletion", dbUser.ID)
+		}
+	}
+
+	token, err := auth.MakeJWT(dbUser.ID, secret)
+	if err != nil {
+		log.Printf("Error: could not make JWT: %v", err)
+		problem.Error(w, "could not make JWT", http.StatusInternalServerError)
+		return
+	}
+
+	refreshToken := auth.MakeRefreshToken()
+	event := audit.Event{ActorID: dbUser.ID, Action: audit.ActionLogin, TargetType: audit.TargetUser, TargetID: dbUser.ID.String()}
+	if mode == sessionModeCookie {
+		event.Metadata = map[string]string{"session": sessionModeCookie}
+	}
+	err = db.RecordAudit(req.Context(), event, func(ctx context.Context) error {
+		_, err := db.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
 			Token:     refreshToken,
 			UserID:    dbUser.ID,
-			ExpiresAt: time.Now().Add(60 * 24 * time.Hour),
+			ExpiresAt: time.Now().Add(refreshTokenTTL),
 		})
-		if err != nil {
-			log.Printf("Error: could not create refresh token: %v", err)
-			http.Error(w, "could not create refresh token", http.StatusInternalServerError)
-			return
-		}
+		return err
+	})
+	if err != nil {
+		log.Printf("Error: could not create refresh token: %v", err)
+		problem.Error(w, "could not create refresh token", http.StatusInternalServerError)
+		return
+	}
 
-		user := apiUser{
-			ID:           dbUser.ID,
-			CreatedAt:    dbUser.CreatedAt,
-			UpdatedAt:    dbUser.UpdatedAt,
-			Email:        dbUser.Email,
-			Token:        token,
-			RefreshToken: refreshToken,
-			IsChirpyRed:  dbUser.IsChirpyRed,
-		}
+	user := apiUser{
+		ID:            dbUser.ID,
+		CreatedAt:     dbUser.CreatedAt,
+		UpdatedAt:     dbUser.UpdatedAt,
+		Email:         dbUser.Email,
+		Token:         token,
+		RefreshToken:  refreshToken,
+		IsChirpyRed:   dbUser.IsChirpyRed,
+		EmailVerified: dbUser.EmailVerified,
+	}
 
-		w.WriteHeader(http.StatusOK)
-		writeResponse(user, w)
+	if mode == sessionModeCookie {
+		sessions.setSessionCookies(w, token, refreshToken, secret)
+		user.Token, user.RefreshToken = "", ""
 	}
+
+	w.WriteHeader(http.StatusOK)
+	writeResponse(user, w)
 }
 
-func HandlerUpdateEmailAndPassword(db authStore, secret string) func(http.ResponseWriter, *http.Request) {
+func HandlerUpdateEmailAndPassword(db authStore, secret string, policy password.Policy) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, req *http.Request) {
 		token, err := auth.GetBearerToken(req.Header)
 		if err != nil {
-			http.Error(w, "could not get bearer token from header", http.StatusUnauthorized)
+			problem.Error(w, "could not get bearer token from header", http.StatusUnauthorized)
 			return
 		}
 
 		userID, err := auth.ValidateJWT(token, secret)
 		if err != nil {
 			log.Printf("Error: could not validate JWT: %v", err)
-			http.Error(w, "could not validate JWT", http.StatusUnauthorized)
+			problem.Error(w, "could not validate JWT", http.StatusUnauthorized)
+			return
+		}
+
+		if !requireUnrestricted(w, req, db, userID) {
 			return
 		}
 
 		var userReq userRequestParams
 		if err := json.NewDecoder(req.Body).Decode(&userReq); err != nil {
-			http.Error(w, "invalid request body", http.StatusBadRequest)
+			problem.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if violations := policy.Validate(userReq.Password, userReq.Email); len(violations) > 0 {
+			writePasswordViolations(w, violations)
 			return
 		}
 
 		hashedPassword, err := auth.HashPassword(userReq.Password)
 		if err != nil {
 			log.Printf("Error: could not hash password: %v", err)
-			http.Error(w, "could not hash password", http.StatusInternalServerError)
+			problem.Error(w, "could not hash password", http.StatusInternalServerError)
 			return
 		}
 
-		dbUser, err := db.UpdateEmailAndPassword(req.Context(), database.UpdateEmailAndPasswordParams{
-			ID:             userID,
-			Email:          userReq.Email,
-			HashedPassword: hashedPassword,
+		var dbUser database.UpdateEmailAndPasswordRow
+		event := audit.Event{ActorID: userID, Action: audit.ActionPasswordChange, TargetType: audit.TargetUser, TargetID: userID.String()}
+		err = db.RecordAudit(req.Context(), event, func(ctx context.Context) error {
+			dbUser, err = db.UpdateEmailAndPassword(ctx, database.UpdateEmailAndPasswordParams{
+				ID:             userID,
+				Email:          userReq.Email,
+				HashedPassword: hashedPassword,
+			})
+			return err
 		})
 		if err != nil {
-			http.Error(w, "could not update user in db", http.StatusInternalServerError)
+			problem.Error(w, "could not update user in db", http.StatusInternalServerError)
 			return
 		}
 
@@ -440,18 +807,23 @@ func HandlerRefresh(db authStore, secret string) func(http.ResponseWriter, *http
 	return func(w http.ResponseWriter, req *http.Request) {
 		token, err := auth.GetBearerToken(req.Header)
 		if err != nil {
-			http.Error(w, "could not get bearer token from header", http.StatusUnauthorized)
+			problem.Error(w, "could not get bearer token from header", http.StatusUnauthorized)
 			return
 		}
 
 		refreshToken, err := db.GetRefreshToken(req.Context(), token)
 		if err != nil {
-			http.Error(w, "could not find token in db", http.StatusUnauthorized)
+			problem.Error(w, "could not find token in db", http.StatusUnauthorized)
 			return
 		}
 
 		if refreshToken.RevokedAt.Valid {
-			http.Error(w, "token has been revoked", http.StatusUnauthorized)
+			problem.Error(w, "token has been revoked", http.StatusUnauthorized)
+			return
+		}
+
+		if refreshToken.ClientID.Valid {
+			problem.Error(w, "tokens issued to OAuth clients must be refreshed at /oauth/token", http.StatusUnauthorized)
 			return
 		}
 
@@ -459,7 +831,7 @@ func HandlerRefresh(db authStore, secret string) func(http.ResponseWriter, *http
 		accessToken.Token, err = auth.MakeJWT(refreshToken.UserID, secret)
 		if err != nil {
 			log.Printf("Error: could not make JWT: %v", err)
-			http.Error(w, "could not make JWT", http.StatusInternalServerError)
+			problem.Error(w, "could not make JWT", http.StatusInternalServerError)
 			return
 		}
 
@@ -472,13 +844,13 @@ func HandlerRevoke(db authStore) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, req *http.Request) {
 		token, err := auth.GetBearerToken(req.Header)
 		if err != nil {
-			http.Error(w, "could not get bearer token from header", http.StatusUnauthorized)
+			problem.Error(w, "could not get bearer token from header", http.StatusUnauthorized)
 			return
 		}
 
-		if err = db.RevokeRefreshToken(req.Context(), token); err != nil {
+		if err := revokeRefreshToken(req.Context(), db, token, audit.ActionTokenRevoke); err != nil {
 			log.Printf("Error: could not revoke token: %v", err)
-			http.Error(w, "could not revoke token", http.StatusInternalServerError)
+			problem.Error(w, "could not revoke token", http.StatusInternalServerError)
 			return
 		}
 
@@ -486,14 +858,54 @@ func HandlerRevoke(db authStore) func(http.ResponseWriter, *http.Request) {
 	}
 }
 
+type refreshTokenRevoker interface {
+	GetRefreshToken(ctx context.Context, token string) (database.RefreshToken, error)
+	RevokeRefreshToken(ctx context.Context, token string) error
+	auditRecorder
+}
+
+// revokeRefreshToken revokes token, recording action against its user. Nothing is recorded for unknown or
+// already revoked tokens, as revoking them changes nothing.
+func revokeRefreshToken(ctx context.Context, db refreshTokenRevoker, token, action string) error {
+	refreshToken, err := db.GetRefreshToken(ctx, token)
+	if err != nil {
+		return db.RevokeRefreshToken(ctx, token)
+	}
+	if refreshToken.RevokedAt.Valid {
+		return nil
+	}
+
+	event := audit.Event{
+		ActorID:    refreshToken.UserID,
+		Action:     action,
+		TargetType: audit.TargetUser,
+		TargetID:   refreshToken.UserID.String(),
+		Metadata:   map[string]string{"token_type": "refresh"},
+	}
+	return db.RecordAudit(ctx, event, func(ctx context.Context) error {
+		return db.RevokeRefreshToken(ctx, token)
+	})
+}
+
+func writePasswordViolations(w http.ResponseWriter, violations []password.Violation) {
+	d := problem.New(http.StatusBadRequest, problem.CodeValidation, "password does not meet policy")
+	for _, v := range violations {
+		d.Errors = append(d.Errors, problem.FieldError{Field: "password", Code: v.Rule, Message: v.Message})
+	}
+	problem.Write(w, d)
+}
+
 type responseTypes interface {
-	apiChirp | apiUser | []apiChirp | accessToken
+	apiChirp | apiUser | []apiChirp | accessToken | mfaChallenge | totpEnrollment | recoveryCodes |
+		apiPersonalAccessToken | []apiPersonalAccessToken | apiOAuthClient | []apiOAuthClient | oauthError | oauthTokenResponse |
+		introspectionResponse | magicLinkRequest | apiAccountDeletion | apiDataExport | apiProfile |
+		apiMedia | []apiRelation | apiAuthorAnalytics
 }
 
 func writeResponse[T responseTypes](response T, w http.ResponseWriter) {
 	data, err := json.Marshal(&response)
 	if err != nil {
-		http.Error(w, "Error: could not marshal response", http.StatusInternalServerError)
+		problem.Error(w, "could not marshal response", http.StatusInternalServerError)
 		return
 	}
 
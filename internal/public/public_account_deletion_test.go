@@ -0,0 +1,77 @@
+package public
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestAccountDeletion(t *testing.T) {
+	const (
+		email    = "leaving@test.com"
+		password = "pa$$word"
+		secret   = "abcd"
+		grace    = 7 * 24 * time.Hour
+	)
+
+	ctx := authTestCtx{
+		t:      t,
+		db:     &mockAuthDB{},
+		secret: secret,
+	}
+	deleteAccount := HandlerDeleteAccount(ctx.db, secret, SessionConfig{}, grace)
+
+	seedUser(ctx, email, password)
+	session := login(ctx, email, password, "/api/login", http.StatusOK)
+
+	postJSON(ctx, deleteAccount, "", accountDeletionParams{Password: password}, http.StatusUnauthorized, nil)
+	postJSON(ctx, deleteAccount, session.Token, accountDeletionParams{Password: "wrong"}, http.StatusUnauthorized, nil)
+
+	var scheduled apiAccountDeletion
+	postJSON(ctx, deleteAccount, session.Token, accountDeletionParams{Password: password}, http.StatusAccepted, &scheduled)
+	if until := time.Until(scheduled.DeleteAfter); until < grace-time.Minute || until > grace {
+		t.Fatalf("Fail: expected deletion after the %v grace period, got %v", grace, scheduled.DeleteAfter)
+	}
+
+	refresh(ctx, session.RefreshToken, "/api/refresh", http.StatusUnauthorized)
+	postJSON(ctx, deleteAccount, session.Token, accountDeletionParams{Password: password}, http.StatusConflict, nil)
+
+	// logging in again cancels the deletion
+	session = login(ctx, email, password, "/api/login", http.StatusOK)
+	if ctx.db.users[0].DeleteAfter.Valid {
+		t.Fatal("Fail: expected login to cancel the pending deletion")
+	}
+	refresh(ctx, session.RefreshToken, "/api/refresh", http.StatusOK)
+
+	postJSON(ctx, deleteAccount, session.Token, accountDeletionParams{Password: password}, http.StatusAccepted, nil)
+}
+
+// --- account deletion ---
+
+func (m *mockAuthDB) ScheduleAccountDeletion(ctx context.Context, arg database.ScheduleAccountDeletionParams) error {
+	return m.updateUser(arg.ID, func(u *database.User) { u.DeleteAfter = arg.DeleteAfter })
+}
+
+func (m *mockAuthDB) CancelAccountDeletion(ctx context.Context, id uuid.UUID) (int64, error) {
+	for i, u := range m.users {
+		if u.ID == id && u.DeleteAfter.Valid {
+			m.users[i].DeleteAfter.Valid = false
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (m *mockAuthDB) RevokeAllPersonalAccessTokensForUser(ctx context.Context, userID uuid.UUID) error {
+	for i, pat := range m.pats {
+		if pat.UserID == userID && !pat.RevokedAt.Valid {
+			m.pats[i].RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package public
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/analytics"
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type mockImpressions struct {
+	seen map[string][]uuid.UUID
+}
+
+func (m *mockImpressions) Record(viewer string, chirpIDs ...uuid.UUID) {
+	m.seen[viewer] = append(m.seen[viewer], chirpIDs...)
+}
+
+func TestChirpImpressions(t *testing.T) {
+	const secret = "abcd"
+	alice, bob := uuid.New(), uuid.New()
+
+	mock := &mockChirpDB{}
+	aliceChirp, _ := mock.CreateChirp(context.Background(), database.CreateChirpParams{Body: "mine", UserID: alice})
+	bobChirp, _ := mock.CreateChirp(context.Background(), database.CreateChirpParams{Body: "his", UserID: bob})
+	aliceToken, _ := auth.MakeJWT(alice, secret)
+
+	impressions := &mockImpressions{seen: map[string][]uuid.UUID{}}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/chirps", nil)
+	req.Header.Set("Authorization", "Bearer "+aliceToken)
+	w := httptest.NewRecorder()
+	HandlerFetchChirpsByAge(mock, secret, impressions)(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Fail: expected status 200 but received %d with message: \n%s", w.Code, w.Body.String())
+	}
+
+	// authors seeing their own chirps are not counted
+	if seen := impressions.seen[analytics.ViewerID(secret, alice, "192.0.2.1", time.Now())]; !slices.Equal(seen, []uuid.UUID{bobChirp.ID}) {
+		t.Fatalf("Fail: expected alice to have seen only %v, got %v", bobChirp.ID, seen)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/chirps/"+aliceChirp.ID.String(), nil)
+	req.SetPathValue("chirpID", aliceChirp.ID.String())
+	req.RemoteAddr = "203.0.113.7:5123"
+	w = httptest.NewRecorder()
+	HandlerFetchChirpByID(mock, secret, impressions)(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Fail: expected status 200 but received %d with message: \n%s", w.Code, w.Body.String())
+	}
+
+	// logged-out viewers are told apart by IP address
+	if seen := impressions.seen[analytics.ViewerID(secret, uuid.Nil, "203.0.113.7", time.Now())]; !slices.Equal(seen, []uuid.UUID{aliceChirp.ID}) {
+		t.Fatalf("Fail: expected the anonymous viewer to have seen %v, got %v", aliceChirp.ID, seen)
+	}
+
+	// one listing counts at most a page of impressions, however many chirps it returns
+	for range maxChirpPageSize + 10 {
+		_, _ = mock.CreateChirp(context.Background(), database.CreateChirpParams{Body: "again", UserID: bob})
+	}
+	req = httptest.NewRequest(http.MethodGet, "/api/chirps", nil)
+	req.RemoteAddr = "198.51.100.9:5123"
+	w = httptest.NewRecorder()
+	HandlerFetchChirpsByAge(mock, secret, impressions)(w, req)
+	if seen := impressions.seen[analytics.ViewerID(secret, uuid.Nil, "198.51.100.9", time.Now())]; len(seen) != maxChirpPageSize {
+		t.Fatalf("Fail: expected %d impressions from one listing, got %d", maxChirpPageSize, len(seen))
+	}
+}
+
+func TestFetchChirpsPagination(t *testing.T) {
+	const secret = "abcd"
+	mock := &mockChirpDB{}
+	author := uuid.New()
+	for range 5 {
+		_, _ = mock.CreateChirp(context.Background(), database.CreateChirpParams{Body: "hello", UserID: author})
+	}
+
+	type testCase struct {
+		testName       string
+		query          string
+		expectedStatus int
+		expectedIDs    []uuid.UUID
+	}
+
+	testCases := []testCase{
+		{testName: "everything by default", query: "", expectedStatus: http.StatusOK, expectedIDs: []uuid.UUID{mock.chirps[0].ID, mock.chirps[1].ID, mock.chirps[2].ID, mock.chirps[3].ID, mock.chirps[4].ID}},
+		{testName: "first page", query: "?limit=2", expectedStatus: http.StatusOK, expectedIDs: []uuid.UUID{mock.chirps[0].ID, mock.chirps[1].ID}},
+		{testName: "later page", query: "?limit=2&offset=4", expectedStatus: http.StatusOK, expectedIDs: []uuid.UUID{mock.chirps[4].ID}},
+		{testName: "zero limit", query: "?limit=0", expectedStatus: http.StatusBadRequest},
+		{testName: "limit too large", query: "?limit=101", expectedStatus: http.StatusBadRequest},
+		{testName: "negative offset", query: "?offset=-1", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.testName, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/chirps"+tc.query, nil)
+			w := httptest.NewRecorder()
+			HandlerFetchChirpsByAge(mock, secret, nil)(w, req)
+			if w.Code != tc.expectedStatus {
+				t.Fatalf("Fail: expected status %d but received %d", tc.expectedStatus, w.Code)
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var chirps []apiChirp
+			if err := json.Unmarshal(w.Body.Bytes(), &chirps); err != nil {
+				t.Fatalf("Error: could not unmarshal chirps: %v", err)
+			}
+			ids := []uuid.UUID{}
+			for _, c := range chirps {
+				ids = append(ids, c.ID)
+			}
+			if !slices.Equal(ids, tc.expectedIDs) {
+				t.Fatalf("Fail: expected chirps %v, got %v", tc.expectedIDs, ids)
+			}
+		})
+	}
+}
+
+type mockAuthorAnalyticsDB struct {
+	*mockChirpDB
+	rows []database.ListChirpImpressionsForUserRow
+	// asked is the last query made
+	asked database.ListChirpImpressionsForUserParams
+}
+
+func (m *mockAuthorAnalyticsDB) ListChirpImpressionsForUser(ctx context.Context, arg database.ListChirpImpressionsForUserParams) ([]database.ListChirpImpressionsForUserRow, error) {
+	m.asked = arg
+	return m.rows, nil
+}
+
+func TestHandlerGetMyAnalytics(t *testing.T) {
+	const secret = "abcd"
+	red, free := uuid.New(), uuid.New()
+	quiet, popular := uuid.New(), uuid.New()
+	day := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+
+	mock := &mockAuthorAnalyticsDB{
+		mockChirpDB: &mockChirpDB{users: map[uuid.UUID]database.User{
+			red:  {ID: red, IsChirpyRed: true},
+			free: {ID: free},
+		}},
+		rows: []database.ListChirpImpressionsForUserRow{
+			{ChirpID: quiet, Bucket: day, Count: 2},
+			{ChirpID: popular, Bucket: day, Count: 5},
+			{ChirpID: popular, Bucket: day.Add(24 * time.Hour), Count: 7},
+		},
+	}
+
+	get := func(caller uuid.UUID, query string) *httptest.ResponseRecorder {
+		t.Helper()
+		token, _ := auth.MakeJWT(caller, secret)
+		req := httptest.NewRequest(http.MethodGet, "/api/users/me/analytics"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		HandlerGetMyAnalytics(mock, secret)(w, req)
+		return w
+	}
+
+	if w := get(free, ""); w.Code != http.StatusForbidden {
+		t.Fatalf("Fail: expected status 403 without Chirpy Red but received %d", w.Code)
+	}
+
+	for _, query := range []string{"?granularity=minute", "?from=yesterday", "?granularity=hour&from=2025-01-01T00:00:00Z"} {
+		if w := get(red, query); w.Code != http.StatusBadRequest {
+			t.Fatalf("Fail: expected status 400 for %s but received %d", query, w.Code)
+		}
+	}
+
+	w := get(red, "?from=2026-10-18T09:30:00Z&to=2026-10-20T00:00:00Z")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Fail: expected status 200 but received %d with message: \n%s", w.Code, w.Body.String())
+	}
+	if !mock.asked.FromBucket.Equal(day) || mock.asked.UserID != red || mock.asked.Granularity != analytics.GranularityDay {
+		t.Fatalf("Fail: expected the caller's daily impressions from %v, asked for %+v", day, mock.asked)
+	}
+
+	var resp apiAuthorAnalytics
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Error: could not unmarshal analytics: %v", err)
+	}
+	if resp.Impressions != 14 || len(resp.Chirps) != 2 {
+		t.Fatalf("Fail: expected 14 impressions over 2 chirps, got %+v", resp)
+	}
+	if resp.Chirps[0].ChirpID != popular || resp.Chirps[0].Impressions != 12 || len(resp.Chirps[0].Points) != 2 {
+		t.Fatalf("Fail: expected the most seen chirp first, got %+v", resp.Chirps[0])
+	}
+}
@@ -0,0 +1,180 @@
+package public
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bailey4770/chirpy/internal/audit"
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/password"
+	"github.com/google/uuid"
+)
+
+func (m *mockAuthDB) RecordAudit(ctx context.Context, event audit.Event, action func(ctx context.Context) error) error {
+	if action != nil {
+		if err := action(ctx); err != nil {
+			return err
+		}
+	}
+	m.events = append(m.events, event)
+	return nil
+}
+
+func (m *mockChirpDB) RecordAudit(ctx context.Context, event audit.Event, action func(ctx context.Context) error) error {
+	if action != nil {
+		if err := action(ctx); err != nil {
+			return err
+		}
+	}
+	m.events = append(m.events, event)
+	return nil
+}
+
+func auditActions(events []audit.Event) []string {
+	actions := []string{}
+	for _, e := range events {
+		actions = append(actions, e.Action)
+	}
+	return actions
+}
+
+func TestAuditAuthEvents(t *testing.T) {
+	const (
+		email    = "user@test.com"
+		password = "pa$$word"
+		secret   = "abcd"
+	)
+
+	ctx := authTestCtx{t: t, db: &mockAuthDB{}, secret: secret}
+	seedUser(ctx, email, password)
+
+	login(ctx, email, "wrong", "/api/login", http.StatusUnauthorized)
+	login(ctx, "nobody@test.com", password, "/api/login", http.StatusUnauthorized)
+	session := login(ctx, email, password, "/api/login", http.StatusOK)
+	updateUser(ctx, session.Token, email, "newpa$$word", "/api/users")
+	revoke(ctx, session.RefreshToken, "/api/revoke")
+	// revoking again changes nothing, so nothing more is recorded
+	revoke(ctx, session.RefreshToken, "/api/revoke")
+
+	expected := []string{audit.ActionLoginFailed, audit.ActionLogin, audit.ActionPasswordChange, audit.ActionTokenRevoke}
+	if actions := auditActions(ctx.db.events); !slices.Equal(actions, expected) {
+		t.Fatalf("Fail: expected events %v but recorded %v", expected, actions)
+	}
+
+	userID := ctx.db.users[0].ID
+	for _, e := range ctx.db.events {
+		if e.TargetID != userID.String() {
+			t.Errorf("Fail: expected %s to target user %v, got %q", e.Action, userID, e.TargetID)
+		}
+	}
+	if ctx.db.events[0].ActorID != uuid.Nil {
+		t.Errorf("Fail: expected a failed login to have no actor, got %v", ctx.db.events[0].ActorID)
+	}
+	if ctx.db.events[1].ActorID != userID {
+		t.Errorf("Fail: expected the login to be recorded as acting for %v, got %v", userID, ctx.db.events[1].ActorID)
+	}
+}
+
+func TestAuditChirpDeletion(t *testing.T) {
+	const secret = "abcd"
+	author, other := uuid.New(), uuid.New()
+	mock := &mockChirpDB{}
+	chirp, _ := mock.CreateChirp(context.Background(), database.CreateChirpParams{Body: "hello", UserID: author})
+
+	del := func(caller uuid.UUID, expectStatus int) {
+		t.Helper()
+		token, _ := auth.MakeJWT(caller, secret)
+		req := httptest.NewRequest(http.MethodDelete, "/api/chirps/"+chirp.ID.String(), nil)
+		req.SetPathValue("chirpID", chirp.ID.String())
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		HandlerDeleteChirp(mock, secret)(w, req)
+		if w.Code != expectStatus {
+			t.Fatalf("Fail: expected status %d but received %d", expectStatus, w.Code)
+		}
+	}
+
+	del(other, http.StatusForbidden)
+	if len(mock.events) != 0 {
+		t.Fatalf("Fail: expected a refused deletion to record nothing, got %v", auditActions(mock.events))
+	}
+
+	del(author, http.StatusNoContent)
+	if len(mock.events) != 1 {
+		t.Fatalf("Fail: expected one event, got %v", auditActions(mock.events))
+	}
+	e := mock.events[0]
+	if e.Action != audit.ActionChirpDelete || e.ActorID != author || e.TargetID != chirp.ID.String() {
+		t.Fatalf("Fail: unexpected event %+v", e)
+	}
+}
+
+func TestImpersonation(t *testing.T) {
+	const secret = "abcd"
+	userID, staffID := uuid.New(), uuid.New()
+	mock := &mockChirpDB{users: map[uuid.UUID]database.User{userID: {ID: userID, EmailVerified: true}}}
+
+	session, _ := auth.MakeJWT(userID, secret)
+	impersonation, _ := auth.MakeImpersonationJWT(userID, staffID, secret)
+
+	handled := 0
+	handler := MiddlewareImpersonation(mock, secret, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		handled++
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	type testCase struct {
+		name           string
+		method         string
+		token          string
+		expectedEvents int
+	}
+
+	testCases := []testCase{
+		{"own session", http.MethodPost, session, 0},
+		{"impersonated read", http.MethodGet, impersonation, 0},
+		{"impersonated write", http.MethodPost, impersonation, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mock.events = nil
+			req := httptest.NewRequest(tc.method, "/api/chirps", nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("Fail: expected status 204 but received %d", w.Code)
+			}
+			if len(mock.events) != tc.expectedEvents {
+				t.Fatalf("Fail: expected %d events, got %v", tc.expectedEvents, auditActions(mock.events))
+			}
+			for _, e := range mock.events {
+				if e.Action != audit.ActionImpersonatedRequest || e.ActorID != staffID || e.TargetID != userID.String() {
+					t.Fatalf("Fail: expected the request to be recorded against the admin, got %+v", e)
+				}
+			}
+		})
+	}
+	if handled != len(testCases) {
+		t.Fatalf("Fail: expected every request to be handed on, %d were", handled)
+	}
+
+	postChirp(t, HandlerPostChirp(mock, secret, ChirpPolicy{}), impersonation, chirpParams{Body: "posted by support"}, http.StatusCreated)
+
+	ctx := authTestCtx{t: t, db: &mockAuthDB{}, secret: secret}
+	body := strings.NewReader(`{"email": "taken@test.com", "password": "hijacked"}`)
+	req := httptest.NewRequest(http.MethodPut, "/api/users", body)
+	req.Header.Set("Authorization", "Bearer "+impersonation)
+	w := httptest.NewRecorder()
+	HandlerUpdateEmailAndPassword(ctx.db, ctx.secret, password.Policy{})(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Fail: expected an impersonation token not to change credentials, got %d", w.Code)
+	}
+}
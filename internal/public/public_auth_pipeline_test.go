@@ -11,14 +11,24 @@ import (
 	"testing"
 	"time"
 
+	"github.com/bailey4770/chirpy/internal/audit"
 	"github.com/bailey4770/chirpy/internal/auth"
 	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/password"
 	"github.com/google/uuid"
 )
 
 type mockAuthDB struct {
 	users         []database.User
 	refreshTokens []database.RefreshToken
+	recoveryCodes []database.RecoveryCode
+	userTokens    []database.UserToken
+	throttles     map[string]database.AuthThrottle
+	oauthClients  []database.OauthClient
+	oauthCodes    []database.OauthAuthorizationCode
+	dataExports   []database.DataExport
+	pats          []database.PersonalAccessToken
+	events        []audit.Event
 }
 
 // --- integration test ---
@@ -92,6 +102,11 @@ func (m *mockAuthDB) UpdateEmailAndPassword(
 ) (database.UpdateEmailAndPasswordRow, error) {
 	for i, u := range m.users {
 		if u.ID == arg.ID {
+			if u.Email != arg.Email {
+				_ = m.DeleteUserTokens(ctx, database.DeleteUserTokensParams{UserID: u.ID, Purpose: tokenPurposeVerifyEmail})
+				_ = m.DeleteUserTokens(ctx, database.DeleteUserTokensParams{UserID: u.ID, Purpose: tokenPurposeMagicLogin})
+			}
+			u.EmailVerified = u.EmailVerified && u.Email == arg.Email
 			u.Email = arg.Email
 			u.HashedPassword = arg.HashedPassword
 			u.UpdatedAt = time.Now()
@@ -173,7 +188,7 @@ func login(
 	req.Header.Set("Content-Type", "application/json")
 	rec := httptest.NewRecorder()
 
-	HandlerLogin(ctx.db, ctx.secret)(rec, req)
+	HandlerLogin(ctx.db, ctx.secret, SessionConfig{})(rec, req)
 
 	if rec.Code != expectStatus {
 		ctx.t.Fatalf("login expected %d, got %d", expectStatus, rec.Code)
@@ -190,18 +205,18 @@ func login(
 
 func updateUser(
 	ctx authTestCtx,
-	token, email, password, url string,
+	token, email, newPassword, url string,
 ) {
 	body, _ := json.Marshal(map[string]string{
 		"email":    email,
-		"password": password,
+		"password": newPassword,
 	})
 
 	req := httptest.NewRequest(http.MethodPut, url, bytes.NewReader(body))
 	req.Header.Set("Authorization", "Bearer "+token)
 	rec := httptest.NewRecorder()
 
-	HandlerUpdateEmailAndPassword(ctx.db, ctx.secret)(rec, req)
+	HandlerUpdateEmailAndPassword(ctx.db, ctx.secret, password.Policy{})(rec, req)
 
 	if rec.Code != http.StatusOK {
 		ctx.t.Fatalf("update failed: %d", rec.Code)
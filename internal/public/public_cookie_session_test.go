@@ -0,0 +1,119 @@
+package public
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bailey4770/chirpy/internal/auth"
+)
+
+func TestCookieSession(t *testing.T) {
+	const (
+		email    = "browser@test.com"
+		password = "pa$$word"
+		secret   = "abcd"
+	)
+
+	ctx := authTestCtx{
+		t:      t,
+		db:     &mockAuthDB{},
+		secret: secret,
+	}
+	sessions := SessionConfig{Secure: true}
+
+	seedUser(ctx, email, password)
+
+	body, _ := json.Marshal(userRequestParams{Email: email, Password: password, Session: sessionModeCookie})
+	req := httptest.NewRequest(http.MethodPost, "/api/login", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	HandlerLogin(ctx.db, secret, sessions)(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Fail: cookie login expected %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	var user apiUser
+	_ = json.NewDecoder(rec.Body).Decode(&user)
+	if user.Token != "" || user.RefreshToken != "" {
+		t.Fatal("Fail: cookie login must not return tokens in the body")
+	}
+
+	cookies := map[string]*http.Cookie{}
+	for _, c := range rec.Result().Cookies() {
+		cookies[c.Name] = c
+		if !c.Secure || c.SameSite != http.SameSiteStrictMode {
+			t.Fatalf("Fail: cookie %s is not Secure and SameSite=Strict", c.Name)
+		}
+	}
+	if !cookies[accessCookieName].HttpOnly || !cookies[refreshCookieName].HttpOnly || cookies[csrfCookieName].HttpOnly {
+		t.Fatal("Fail: token cookies must be HttpOnly and the CSRF cookie readable")
+	}
+
+	// echoes back the bearer token the middleware passed on
+	var seenAuth string
+	protected := MiddlewareCookieSession(ctx.db, secret, sessions, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		seenAuth = req.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	send := func(method string, withCookies []string, csrf string) *httptest.ResponseRecorder {
+		seenAuth = ""
+		req := httptest.NewRequest(method, "/api/chirps", nil)
+		for _, name := range withCookies {
+			req.AddCookie(cookies[name])
+		}
+		if csrf != "" {
+			req.Header.Set(csrfHeaderName, csrf)
+		}
+		rec := httptest.NewRecorder()
+		protected.ServeHTTP(rec, req)
+		return rec
+	}
+
+	all := []string{accessCookieName, refreshCookieName, csrfCookieName}
+	csrf := cookies[csrfCookieName].Value
+
+	if rec := send(http.MethodGet, all, ""); rec.Code != http.StatusNoContent || seenAuth != "Bearer "+cookies[accessCookieName].Value {
+		t.Fatalf("Fail: safe request was not authenticated from cookies, got %d with %q", rec.Code, seenAuth)
+	}
+
+	if rec := send(http.MethodPost, all, ""); rec.Code != http.StatusForbidden {
+		t.Fatalf("Fail: POST without CSRF token expected %d, got %d", http.StatusForbidden, rec.Code)
+	}
+
+	forged := auth.MakeCSRFToken("some other session", secret)
+	if rec := send(http.MethodPost, all, forged); rec.Code != http.StatusForbidden {
+		t.Fatalf("Fail: POST with CSRF token from another session expected %d, got %d", http.StatusForbidden, rec.Code)
+	}
+
+	if rec := send(http.MethodPost, all, csrf); rec.Code != http.StatusNoContent || seenAuth == "" {
+		t.Fatalf("Fail: POST with CSRF token was not authenticated, got %d", rec.Code)
+	}
+
+	// without an access cookie the session is refreshed from the refresh cookie
+	rec = send(http.MethodGet, []string{refreshCookieName, csrfCookieName}, "")
+	var refreshedAccess string
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == accessCookieName {
+			refreshedAccess = c.Value
+		}
+	}
+	if refreshedAccess == "" || seenAuth != "Bearer "+refreshedAccess {
+		t.Fatal("Fail: missing access cookie was not refreshed automatically")
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/logout", nil)
+	req.AddCookie(cookies[refreshCookieName])
+	rec = httptest.NewRecorder()
+	HandlerLogout(ctx.db, sessions)(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Fail: logout expected %d, got %d", http.StatusNoContent, rec.Code)
+	}
+
+	if rec := send(http.MethodGet, []string{refreshCookieName, csrfCookieName}, ""); seenAuth != "" || rec.Code != http.StatusNoContent {
+		t.Fatal("Fail: revoked session was still authenticated")
+	}
+}
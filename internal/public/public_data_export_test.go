@@ -0,0 +1,175 @@
+package public
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestDataExport(t *testing.T) {
+	const (
+		email  = "export@test.com"
+		secret = "abcd"
+	)
+
+	runExport = func(build func()) { build() }
+	t.Cleanup(func() { runExport = func(build func()) { go build() } })
+
+	ctx := authTestCtx{
+		t:      t,
+		db:     &mockAuthDB{},
+		secret: secret,
+	}
+	outbox := &captureMailer{}
+	mail := MailConfig{Mailer: outbox, APIBaseURL: "http://api.chirpy.test"}
+
+	seedUser(ctx, email, "pa$$word")
+	session := login(ctx, email, "pa$$word", "/api/login", http.StatusOK)
+
+	var started apiDataExport
+	postJSON(ctx, HandlerRequestDataExport(ctx.db, secret, mail), session.Token, nil, http.StatusAccepted, &started)
+	if started.Status != exportStatusPending || started.DownloadURL != "" {
+		t.Fatalf("Fail: expected a pending export, got %+v", started)
+	}
+
+	postJSON(ctx, HandlerRequestDataExport(ctx.db, secret, mail), session.Token, nil, http.StatusTooManyRequests, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+session.Token)
+	req.SetPathValue("exportID", started.ID.String())
+	rec := httptest.NewRecorder()
+	HandlerGetDataExport(ctx.db, secret, mail)(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"ready"`) {
+		t.Fatalf("Fail: expected a ready export, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if len(outbox.sent) != 1 || outbox.sent[0].To != email {
+		t.Fatalf("Fail: expected 1 export email to %s but %d were sent", email, len(outbox.sent))
+	}
+	link := regexp.MustCompile(`http://api\.chirpy\.test/\S+`).FindString(outbox.sent[0].Body)
+
+	download := func(rawURL string, expectStatus int) []byte {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			t.Fatalf("Error: could not parse download link %q: %v", rawURL, err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, u.RequestURI(), nil)
+		req.SetPathValue("exportID", started.ID.String())
+		rec := httptest.NewRecorder()
+		HandlerDownloadDataExport(ctx.db, secret)(rec, req)
+
+		if rec.Code != expectStatus {
+			t.Fatalf("download expected %d, got %d: %s", expectStatus, rec.Code, rec.Body.String())
+		}
+		return rec.Body.Bytes()
+	}
+
+	archive := download(link, http.StatusOK)
+	if _, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive))); err != nil {
+		t.Fatalf("Fail: download is not a zip archive: %v", err)
+	}
+
+	download(strings.Replace(link, "signature=", "signature=x", 1), http.StatusForbidden)
+}
+
+// --- data export ---
+
+func (m *mockAuthDB) ListChirpsForUser(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error) {
+	return nil, nil
+}
+
+func (m *mockAuthDB) ListRefreshTokensForUser(ctx context.Context, userID uuid.UUID) ([]database.RefreshToken, error) {
+	var tokens []database.RefreshToken
+	for _, rt := range m.refreshTokens {
+		if rt.UserID == userID {
+			tokens = append(tokens, rt)
+		}
+	}
+	return tokens, nil
+}
+
+func (m *mockAuthDB) ListPersonalAccessTokens(ctx context.Context, userID uuid.UUID) ([]database.PersonalAccessToken, error) {
+	var pats []database.PersonalAccessToken
+	for _, pat := range m.pats {
+		if pat.UserID == userID {
+			pats = append(pats, pat)
+		}
+	}
+	return pats, nil
+}
+
+func (m *mockAuthDB) ListWebhookDeliveriesForUser(ctx context.Context, userID uuid.NullUUID) ([]database.WebhookDelivery, error) {
+	return nil, nil
+}
+
+func (m *mockAuthDB) CreateDataExport(ctx context.Context, userID uuid.UUID) (database.DataExport, error) {
+	export := database.DataExport{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UserID:    userID,
+		Status:    exportStatusPending,
+	}
+	m.dataExports = append(m.dataExports, export)
+	return export, nil
+}
+
+func (m *mockAuthDB) GetDataExport(ctx context.Context, arg database.GetDataExportParams) (database.DataExport, error) {
+	for _, e := range m.dataExports {
+		if e.ID == arg.ID && e.UserID == arg.UserID {
+			return e, nil
+		}
+	}
+	return database.DataExport{}, sql.ErrNoRows
+}
+
+func (m *mockAuthDB) GetLatestDataExport(ctx context.Context, userID uuid.UUID) (database.DataExport, error) {
+	for i := len(m.dataExports) - 1; i >= 0; i-- {
+		if m.dataExports[i].UserID == userID {
+			return m.dataExports[i], nil
+		}
+	}
+	return database.DataExport{}, sql.ErrNoRows
+}
+
+func (m *mockAuthDB) GetDataExportArchive(ctx context.Context, id uuid.UUID) ([]byte, error) {
+	for _, e := range m.dataExports {
+		if e.ID == id && e.Status == "ready" && e.ExpiresAt.Time.After(time.Now()) {
+			return e.Archive, nil
+		}
+	}
+	return nil, errors.New("export not found")
+}
+
+func (m *mockAuthDB) CompleteDataExport(ctx context.Context, arg database.CompleteDataExportParams) error {
+	for i, e := range m.dataExports {
+		if e.ID == arg.ID {
+			m.dataExports[i].Status = "ready"
+			m.dataExports[i].Archive = arg.Archive
+			m.dataExports[i].ExpiresAt = arg.ExpiresAt
+			return nil
+		}
+	}
+	return errors.New("export not found")
+}
+
+func (m *mockAuthDB) FailDataExport(ctx context.Context, id uuid.UUID) error {
+	for i, e := range m.dataExports {
+		if e.ID == id {
+			m.dataExports[i].Status = exportStatusFailed
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package public
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+)
+
+func TestLoginLockout(t *testing.T) {
+	const (
+		email    = "locked@test.com"
+		password = "pa$$word"
+		secret   = "abcd"
+	)
+
+	ctx := authTestCtx{
+		t:      t,
+		db:     &mockAuthDB{},
+		secret: secret,
+	}
+
+	seedUser(ctx, email, password)
+
+	for range auth.AccountLockoutPolicy.Threshold {
+		login(ctx, email, "wrong", "/api/login", http.StatusUnauthorized)
+	}
+
+	// a correct password is refused while the account is locked
+	login(ctx, email, password, "/api/login", http.StatusTooManyRequests)
+
+	// unknown addresses lock the same way, so a lockout does not reveal that an account exists
+	for range auth.AccountLockoutPolicy.Threshold {
+		login(ctx, "ghost@test.com", "wrong", "/api/login", http.StatusUnauthorized)
+	}
+	login(ctx, "ghost@test.com", "wrong", "/api/login", http.StatusTooManyRequests)
+
+	if err := ctx.db.ClearAuthThrottle(context.Background(), auth.LoginAccountThrottleKey(email)); err != nil {
+		t.Fatalf("Error: could not unlock account: %v", err)
+	}
+	login(ctx, email, password, "/api/login", http.StatusOK)
+}
+
+// --- throttles ---
+
+func (m *mockAuthDB) GetAuthThrottle(ctx context.Context, key string) (database.AuthThrottle, error) {
+	throttle, ok := m.throttles[key]
+	if !ok {
+		return database.AuthThrottle{}, errors.New("throttle not found")
+	}
+	return throttle, nil
+}
+
+func (m *mockAuthDB) RecordAuthFailure(ctx context.Context, key string) (int32, error) {
+	if m.throttles == nil {
+		m.throttles = map[string]database.AuthThrottle{}
+	}
+
+	throttle := m.throttles[key]
+	throttle.Key = key
+	throttle.Failures++
+	throttle.LastFailureAt = time.Now()
+	m.throttles[key] = throttle
+	return throttle.Failures, nil
+}
+
+func (m *mockAuthDB) LockAuthThrottle(ctx context.Context, arg database.LockAuthThrottleParams) error {
+	throttle := m.throttles[arg.Key]
+	throttle.LockedUntil = arg.LockedUntil
+	m.throttles[arg.Key] = throttle
+	return nil
+}
+
+func (m *mockAuthDB) ClearAuthThrottle(ctx context.Context, key string) error {
+	delete(m.throttles, key)
+	return nil
+}
@@ -0,0 +1,39 @@
+package public
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/alexedwards/argon2id"
+	"github.com/bailey4770/chirpy/internal/auth"
+)
+
+func TestLoginUpgradesOutdatedHash(t *testing.T) {
+	const (
+		email    = "rehash@test.com"
+		password = "pa$$word"
+	)
+
+	ctx := authTestCtx{
+		t:      t,
+		db:     &mockAuthDB{},
+		secret: "abcd",
+	}
+
+	original := auth.HashParams()
+	defer auth.SetHashParams(original)
+
+	auth.SetHashParams(&argon2id.Params{Memory: 8 * 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	seedUser(ctx, email, password)
+
+	auth.SetHashParams(&argon2id.Params{Memory: 8 * 1024, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	login(ctx, email, password, "/api/login", http.StatusOK)
+
+	dbUser, _ := ctx.db.GetUserByEmail(context.Background(), email)
+	if auth.NeedsRehash(dbUser.HashedPassword) {
+		t.Fatal("Fail: login did not upgrade the outdated password hash")
+	}
+
+	login(ctx, email, password, "/api/login", http.StatusOK)
+}
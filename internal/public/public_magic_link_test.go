@@ -0,0 +1,113 @@
+package public
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/password"
+)
+
+func TestMagicLinkLogin(t *testing.T) {
+	const (
+		email  = "magic@test.com"
+		secret = "abcd"
+	)
+
+	ctx := authTestCtx{
+		t:      t,
+		db:     &mockAuthDB{},
+		secret: secret,
+	}
+	outbox := &captureMailer{}
+	mail := MailConfig{Mailer: outbox, AppBaseURL: "http://chirpy.test"}
+	request := HandlerRequestMagicLink(ctx.db, mail, SessionConfig{})
+	verify := HandlerVerifyMagicLink(ctx.db, secret, SessionConfig{})
+
+	seedUser(ctx, email, "pa$$word")
+
+	var unknown magicLinkRequest
+	postJSON(ctx, request, "", magicLinkRequestParams{Email: "nobody@test.com"}, http.StatusAccepted, &unknown)
+	if len(outbox.sent) != 0 || unknown.DeviceToken == "" {
+		t.Fatal("Fail: unknown address must get the same response and no email")
+	}
+
+	var device magicLinkRequest
+	postJSON(ctx, request, "", magicLinkRequestParams{Email: email}, http.StatusAccepted, &device)
+	if len(outbox.sent) != 1 {
+		t.Fatalf("Fail: expected 1 magic link email but %d were sent", len(outbox.sent))
+	}
+	token := regexp.MustCompile(`token=([0-9a-f]+)`).FindStringSubmatch(outbox.sent[0].Body)[1]
+
+	// the link is useless from a different device
+	postJSON(ctx, verify, "", magicLinkVerifyParams{Token: token, DeviceToken: unknown.DeviceToken}, http.StatusUnauthorized, nil)
+
+	var session apiUser
+	postJSON(ctx, verify, "", magicLinkVerifyParams{Token: token, DeviceToken: device.DeviceToken}, http.StatusOK, &session)
+	if session.Token == "" || session.RefreshToken == "" || !session.EmailVerified {
+		t.Fatalf("Fail: expected a verified login session, got %+v", session)
+	}
+
+	postJSON(ctx, verify, "", magicLinkVerifyParams{Token: token, DeviceToken: device.DeviceToken}, http.StatusUnauthorized, nil)
+
+	// 3 links per address within the window
+	postJSON(ctx, request, "", magicLinkRequestParams{Email: email}, http.StatusAccepted, nil)
+	postJSON(ctx, request, "", magicLinkRequestParams{Email: email}, http.StatusAccepted, nil)
+	postJSON(ctx, request, "", magicLinkRequestParams{Email: email}, http.StatusTooManyRequests, nil)
+}
+
+func TestMagicLinkAfterEmailChange(t *testing.T) {
+	const (
+		email    = "magic@test.com"
+		newEmail = "moved@test.com"
+		pw       = "pa$$word"
+		secret   = "abcd"
+	)
+
+	ctx := authTestCtx{
+		t:      t,
+		db:     &mockAuthDB{},
+		secret: secret,
+	}
+	outbox := &captureMailer{}
+	mail := MailConfig{Mailer: outbox, AppBaseURL: "http://chirpy.test"}
+	request := HandlerRequestMagicLink(ctx.db, mail, SessionConfig{})
+	verify := HandlerVerifyMagicLink(ctx.db, secret, SessionConfig{})
+
+	seedUser(ctx, email, pw)
+	session := login(ctx, email, pw, "/api/login", http.StatusOK)
+
+	requestLink := func(address string) magicLinkVerifyParams {
+		t.Helper()
+		var device magicLinkRequest
+		postJSON(ctx, request, "", magicLinkRequestParams{Email: address}, http.StatusAccepted, &device)
+		token := regexp.MustCompile(`token=([0-9a-f]+)`).FindStringSubmatch(outbox.sent[len(outbox.sent)-1].Body)[1]
+		return magicLinkVerifyParams{Token: token, DeviceToken: device.DeviceToken}
+	}
+
+	// changing the email invalidates links sent to the old address
+	oldLink := requestLink(email)
+	postJSON(ctx, HandlerUpdateEmailAndPassword(ctx.db, secret, password.Policy{}), session.Token, userRequestParams{Email: newEmail, Password: pw}, http.StatusOK, nil)
+	postJSON(ctx, verify, "", oldLink, http.StatusUnauthorized, nil)
+
+	// a link followed after its address stopped being the user's still logs in, but verifies nothing
+	link := requestLink(newEmail)
+	_ = ctx.db.updateUser(ctx.db.users[0].ID, func(u *database.User) { u.Email = email })
+	var loggedIn apiUser
+	postJSON(ctx, verify, "", link, http.StatusOK, &loggedIn)
+	if loggedIn.EmailVerified || ctx.db.users[0].EmailVerified {
+		t.Fatal("Fail: expected the link to verify only the address it was sent to")
+	}
+}
+
+func (m *mockAuthDB) MarkEmailVerified(ctx context.Context, arg database.MarkEmailVerifiedParams) (int64, error) {
+	for i, u := range m.users {
+		if u.ID == arg.ID && u.Email == arg.Email {
+			m.users[i].EmailVerified = true
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
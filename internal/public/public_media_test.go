@@ -0,0 +1,267 @@
+package public
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/blob"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (m *mockChirpDB) DeleteChirp(ctx context.Context, id uuid.UUID) error {
+	m.chirps = slices.DeleteFunc(m.chirps, func(c database.Chirp) bool { return c.ID == id })
+	for i := range m.media {
+		if m.media[i].ChirpID.UUID == id {
+			m.media[i].ChirpID = uuid.NullUUID{}
+		}
+	}
+	return nil
+}
+
+func (m *mockChirpDB) FetchChirpByID(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	for _, chirp := range m.chirps {
+		if chirp.ID == id {
+			return chirp, nil
+		}
+	}
+	return database.Chirp{}, errors.New("chirp not found")
+}
+
+func (m *mockChirpDB) FetchChirpsWithOptionalParams(ctx context.Context, arg database.FetchChirpsWithOptionalParamsParams) ([]database.Chirp, error) {
+	hidden, err := loadRelations(ctx, m, arg.ViewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	var chirps []database.Chirp
+	for _, chirp := range m.chirps {
+		if arg.Column1 != uuid.Nil && chirp.UserID != arg.Column1 {
+			continue
+		}
+		if hidden.blocked[chirp.UserID] || (hidden.muted[chirp.UserID] && chirp.UserID != arg.Column1) {
+			continue
+		}
+		chirps = append(chirps, chirp)
+	}
+	chirps = chirps[min(int(arg.Offset), len(chirps)):]
+	if arg.Limit.Valid {
+		chirps = chirps[:min(int(arg.Limit.Int32), len(chirps))]
+	}
+	return chirps, nil
+}
+
+func (m *mockChirpDB) CreateMediaAttachment(ctx context.Context, arg database.CreateMediaAttachmentParams) (database.MediaAttachment, error) {
+	media := database.MediaAttachment{
+		ID:                   arg.ID,
+		CreatedAt:            time.Now(),
+		UserID:               arg.UserID,
+		ContentType:          arg.ContentType,
+		Width:                arg.Width,
+		Height:               arg.Height,
+		OriginalKey:          arg.OriginalKey,
+		ThumbnailKey:         arg.ThumbnailKey,
+		ThumbnailContentType: arg.ThumbnailContentType,
+	}
+	m.media = append(m.media, media)
+	return media, nil
+}
+
+func (m *mockChirpDB) GetMediaAttachment(ctx context.Context, id uuid.UUID) (database.MediaAttachment, error) {
+	for _, media := range m.media {
+		if media.ID == id {
+			return media, nil
+		}
+	}
+	return database.MediaAttachment{}, errors.New("media not found")
+}
+
+func (m *mockChirpDB) AttachMediaToChirp(ctx context.Context, arg database.AttachMediaToChirpParams) (int64, error) {
+	for i, media := range m.media {
+		if media.ID == arg.ID && media.UserID == arg.UserID && !media.ChirpID.Valid {
+			m.media[i].ChirpID = arg.ChirpID
+			m.media[i].Position = arg.Position
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (m *mockChirpDB) ListMediaAttachmentsForChirps(ctx context.Context, chirpIds []uuid.UUID) ([]database.MediaAttachment, error) {
+	var attached []database.MediaAttachment
+	for _, media := range m.media {
+		if media.ChirpID.Valid && slices.Contains(chirpIds, media.ChirpID.UUID) {
+			attached = append(attached, media)
+		}
+	}
+	slices.SortFunc(attached, func(a, b database.MediaAttachment) int { return int(a.Position - b.Position) })
+	return attached, nil
+}
+
+func upload(t *testing.T, handler http.HandlerFunc, token string, data []byte, expectStatus int) apiMedia {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", "photo.png")
+	_, _ = part.Write(data)
+	_ = form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/media", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	if w.Code != expectStatus {
+		t.Fatalf("Fail: expected upload status %d but received %d with message: \n%s", expectStatus, w.Code, w.Body.String())
+	}
+
+	var media apiMedia
+	if w.Code == http.StatusCreated {
+		if err := json.Unmarshal(w.Body.Bytes(), &media); err != nil {
+			t.Fatalf("Error: could not unmarshal upload response: %v", err)
+		}
+	}
+	return media
+}
+
+func postChirp(t *testing.T, handler http.HandlerFunc, token string, params chirpParams, expectStatus int) apiChirp {
+	t.Helper()
+
+	reqBody, _ := json.Marshal(params)
+	req := httptest.NewRequest(http.MethodPost, "/api/chirps", bytes.NewReader(reqBody))
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	if w.Code != expectStatus {
+		t.Fatalf("Fail: expected chirp status %d but received %d with message: \n%s", expectStatus, w.Code, w.Body.String())
+	}
+
+	var chirp apiChirp
+	if w.Code == http.StatusCreated {
+		if err := json.Unmarshal(w.Body.Bytes(), &chirp); err != nil {
+			t.Fatalf("Error: could not unmarshal chirp response: %v", err)
+		}
+	}
+	return chirp
+}
+
+func TestMediaAttachments(t *testing.T) {
+	const secret = "abcd"
+	mock := &mockChirpDB{}
+	blobs, err := blob.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Error: could not create blob store: %v", err)
+	}
+
+	uploadHandler := HandlerUploadMedia(mock, blobs, secret)
+	postHandler := HandlerPostChirp(mock, secret, ChirpPolicy{MaxMedia: 2})
+	serveHandler := HandlerServeMedia(mock, blobs, secret)
+
+	author, other := uuid.New(), uuid.New()
+	token, _ := auth.MakeJWT(author, secret)
+	otherToken, _ := auth.MakeJWT(other, secret)
+
+	var pngBuf bytes.Buffer
+	_ = png.Encode(&pngBuf, image.NewRGBA(image.Rect(0, 0, 800, 400)))
+
+	upload(t, uploadHandler, token, []byte("<svg onload=alert(1)></svg>"), http.StatusUnsupportedMediaType)
+
+	first := upload(t, uploadHandler, token, pngBuf.Bytes(), http.StatusCreated)
+	second := upload(t, uploadHandler, token, pngBuf.Bytes(), http.StatusCreated)
+	third := upload(t, uploadHandler, token, pngBuf.Bytes(), http.StatusCreated)
+	if first.ContentType != "image/png" || first.Width != 800 || first.Height != 400 {
+		t.Fatalf("Fail: unexpected upload %+v", first)
+	}
+
+	postChirp(t, postHandler, token, chirpParams{Body: "too many", MediaIDs: []uuid.UUID{first.ID, second.ID, third.ID}}, http.StatusBadRequest)
+	postChirp(t, postHandler, token, chirpParams{Body: "twice", MediaIDs: []uuid.UUID{first.ID, first.ID}}, http.StatusBadRequest)
+	postChirp(t, postHandler, otherToken, chirpParams{Body: "not mine", MediaIDs: []uuid.UUID{first.ID}}, http.StatusBadRequest)
+
+	chirp := postChirp(t, postHandler, token, chirpParams{Body: "holiday photos", MediaIDs: []uuid.UUID{second.ID, first.ID}}, http.StatusCreated)
+	if len(chirp.Media) != 2 || chirp.Media[0].ID != second.ID || chirp.Media[1].ID != first.ID {
+		t.Fatalf("Fail: expected both uploads in order on the chirp, got %+v", chirp.Media)
+	}
+
+	postChirp(t, postHandler, token, chirpParams{Body: "reused", MediaIDs: []uuid.UUID{first.ID}}, http.StatusBadRequest)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/chirps/"+chirp.ID.String(), nil)
+	req.SetPathValue("chirpID", chirp.ID.String())
+	w := httptest.NewRecorder()
+	HandlerFetchChirpByID(mock, secret, nil)(w, req)
+	var fetched apiChirp
+	_ = json.Unmarshal(w.Body.Bytes(), &fetched)
+	if len(fetched.Media) != 2 || fetched.Media[0].ThumbnailURL != "/api/media/"+second.ID.String()+"/thumbnail" {
+		t.Fatalf("Fail: fetched chirp is missing its media: %s", w.Body.String())
+	}
+
+	serveAs := func(mediaID uuid.UUID, token, variant, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/media/"+mediaID.String()+"/"+variant, nil)
+		req.SetPathValue("mediaID", mediaID.String())
+		req.SetPathValue("variant", variant)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		serveHandler(w, req)
+		return w
+	}
+	serve := func(variant, etag string) *httptest.ResponseRecorder {
+		return serveAs(first.ID, "", variant, etag)
+	}
+
+	w = serve("thumbnail", "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/png" || w.Header().Get("Cache-Control") != mediaCacheControl {
+		t.Fatalf("Fail: unexpected thumbnail response %d %v", w.Code, w.Header())
+	}
+	thumb, err := png.DecodeConfig(w.Body)
+	if err != nil || thumb.Width != 320 || thumb.Height != 160 {
+		t.Fatalf("Fail: expected a 320x160 thumbnail, got %+v (%v)", thumb, err)
+	}
+
+	if w := serve("thumbnail", w.Header().Get("ETag")); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Fatalf("Fail: expected 304 for a matching ETag but received %d", w.Code)
+	}
+	if w := serve("exif", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Fail: expected 404 for an unknown variant but received %d", w.Code)
+	}
+
+	// an upload not yet posted is only for its uploader
+	if w := serveAs(third.ID, otherToken, "original", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Fail: expected 404 for someone else's unposted upload but received %d", w.Code)
+	}
+	if w := serveAs(third.ID, token, "original", ""); w.Code != http.StatusOK {
+		t.Fatalf("Fail: expected the uploader to see their unposted upload but received %d", w.Code)
+	}
+
+	// blocked viewers cannot see the media, even with a cached ETag
+	mock.blocks = append(mock.blocks, database.UserBlock{BlockerID: author, BlockedID: other})
+	if w := serveAs(first.ID, otherToken, "thumbnail", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Fail: expected 404 for a blocked viewer but received %d", w.Code)
+	}
+	if w := serveAs(first.ID, otherToken, "thumbnail", `"`+first.ID.String()+`-thumbnail"`); w.Code != http.StatusNotFound {
+		t.Fatalf("Fail: expected 404 for a blocked viewer with an ETag but received %d", w.Code)
+	}
+
+	// once the chirp is deleted its media is no longer public
+	_ = mock.DeleteChirp(context.Background(), chirp.ID)
+	if w := serve("original", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("Fail: expected 404 for media of a deleted chirp but received %d", w.Code)
+	}
+}
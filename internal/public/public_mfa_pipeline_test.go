@@ -0,0 +1,203 @@
+package public
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// --- integration test ---
+
+func TestMFAPipeline(t *testing.T) {
+	const (
+		email    = "mfa@test.com"
+		password = "pa$$word"
+		secret   = "abcd"
+	)
+
+	ctx := authTestCtx{
+		t:      t,
+		db:     &mockAuthDB{},
+		secret: secret,
+	}
+
+	seedUser(ctx, email, password)
+	loginResp := login(ctx, email, password, "/api/login", http.StatusOK)
+
+	var enrollment totpEnrollment
+	postJSON(ctx, HandlerEnrollTOTP(ctx.db, secret), loginResp.Token, nil, http.StatusOK, &enrollment)
+
+	// confirm with the previous step's code so the login below can use the current one
+	confirmCode := totpCodeAt(t, enrollment.Secret, time.Now().Add(-30*time.Second))
+	var codes recoveryCodes
+	postJSON(ctx, HandlerConfirmTOTP(ctx.db, secret), loginResp.Token, totpCodeParams{Code: confirmCode}, http.StatusOK, &codes)
+	if len(codes.RecoveryCodes) == 0 {
+		t.Fatal("Fail: expected recovery codes after confirming totp")
+	}
+
+	challenge := mfaLogin(ctx, email, password)
+
+	mfa := HandlerLoginMFA(ctx.db, secret, SessionConfig{})
+	code := totpCodeAt(t, enrollment.Secret, time.Now())
+	postJSON(ctx, mfa, "", mfaLoginParams{MFAToken: challenge.MFAToken, Code: code}, http.StatusOK, nil)
+	postJSON(ctx, mfa, "", mfaLoginParams{MFAToken: challenge.MFAToken, Code: code}, http.StatusUnauthorized, nil)
+
+	recovery := mfaLoginParams{MFAToken: challenge.MFAToken, RecoveryCode: codes.RecoveryCodes[0]}
+	postJSON(ctx, mfa, "", recovery, http.StatusOK, nil)
+	postJSON(ctx, mfa, "", recovery, http.StatusUnauthorized, nil)
+
+	// recovery codes are accepted without the hyphen and in any case
+	typed := strings.ToUpper(strings.ReplaceAll(codes.RecoveryCodes[1], "-", ""))
+	postJSON(ctx, mfa, "", mfaLoginParams{MFAToken: challenge.MFAToken, RecoveryCode: typed}, http.StatusOK, nil)
+}
+
+// --- totp ---
+
+func (m *mockAuthDB) GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error) {
+	for _, u := range m.users {
+		if u.ID == id {
+			return u, nil
+		}
+	}
+	return database.User{}, errors.New("user not found")
+}
+
+func (m *mockAuthDB) SetTOTPSecret(ctx context.Context, arg database.SetTOTPSecretParams) error {
+	return m.updateUser(arg.ID, func(u *database.User) {
+		u.TotpSecret = arg.TotpSecret
+		u.TotpEnabled = false
+	})
+}
+
+func (m *mockAuthDB) EnableTOTP(ctx context.Context, id uuid.UUID) error {
+	return m.updateUser(id, func(u *database.User) { u.TotpEnabled = true })
+}
+
+func (m *mockAuthDB) AdvanceTOTPStep(ctx context.Context, arg database.AdvanceTOTPStepParams) (int64, error) {
+	var advanced int64
+	err := m.updateUser(arg.ID, func(u *database.User) {
+		if u.TotpLastStep < arg.TotpLastStep {
+			u.TotpLastStep = arg.TotpLastStep
+			advanced = 1
+		}
+	})
+	return advanced, err
+}
+
+func (m *mockAuthDB) updateUser(id uuid.UUID, update func(*database.User)) error {
+	for i := range m.users {
+		if m.users[i].ID == id {
+			update(&m.users[i])
+			return nil
+		}
+	}
+	return errors.New("user not found")
+}
+
+// --- recovery codes ---
+
+func (m *mockAuthDB) CreateRecoveryCode(ctx context.Context, arg database.CreateRecoveryCodeParams) error {
+	m.recoveryCodes = append(m.recoveryCodes, database.RecoveryCode{
+		ID:       uuid.New(),
+		UserID:   arg.UserID,
+		CodeHash: arg.CodeHash,
+	})
+	return nil
+}
+
+func (m *mockAuthDB) DeleteRecoveryCodes(ctx context.Context, userID uuid.UUID) error {
+	kept := m.recoveryCodes[:0]
+	for _, rc := range m.recoveryCodes {
+		if rc.UserID != userID {
+			kept = append(kept, rc)
+		}
+	}
+	m.recoveryCodes = kept
+	return nil
+}
+
+func (m *mockAuthDB) UseRecoveryCode(ctx context.Context, arg database.UseRecoveryCodeParams) (int64, error) {
+	for i, rc := range m.recoveryCodes {
+		if rc.UserID == arg.UserID && rc.CodeHash == arg.CodeHash && !rc.UsedAt.Valid {
+			m.recoveryCodes[i].UsedAt = sql.NullTime{Time: time.Now(), Valid: true}
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// --- test helpers ---
+
+func totpCodeAt(t *testing.T, secret string, at time.Time) string {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatalf("Error: could not decode totp secret: %v", err)
+	}
+	return auth.GenerateTOTP(key, at, 30, 6, sha1.New)
+}
+
+func mfaLogin(ctx authTestCtx, email, password string) mfaChallenge {
+	body, _ := json.Marshal(map[string]string{
+		"email":    email,
+		"password": password,
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/login", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+
+	HandlerLogin(ctx.db, ctx.secret, SessionConfig{})(rec, req)
+
+	if rec.Code != http.StatusOK {
+		ctx.t.Fatalf("login expected %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var resp struct {
+		mfaChallenge
+		Token string `json:"token"`
+	}
+	_ = json.NewDecoder(rec.Body).Decode(&resp)
+	if !resp.MFARequired || resp.Token != "" {
+		ctx.t.Fatal("login did not require a second factor")
+	}
+	return resp.mfaChallenge
+}
+
+func postJSON(
+	ctx authTestCtx,
+	handler http.HandlerFunc,
+	token string,
+	payload any,
+	expectStatus int,
+	out any,
+) {
+	body, _ := json.Marshal(payload)
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+
+	handler(rec, req)
+
+	if rec.Code != expectStatus {
+		ctx.t.Fatalf("expected %d, got %d: %s", expectStatus, rec.Code, rec.Body.String())
+	}
+
+	if out != nil {
+		_ = json.NewDecoder(rec.Body).Decode(out)
+	}
+}
@@ -0,0 +1,318 @@
+package public
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// --- integration test ---
+
+func TestOAuthPipeline(t *testing.T) {
+	const (
+		email       = "oauth@test.com"
+		password    = "pa$$word"
+		secret      = "abcd"
+		redirectURI = "https://app.example.com/callback"
+		verifier    = "dBjftJeZ4CVP-mJ92K9TnDZ6ca7mxlPR3vQ2YpCJv8aF"
+	)
+
+	ctx := authTestCtx{
+		t:      t,
+		db:     &mockAuthDB{},
+		secret: secret,
+	}
+
+	seedUser(ctx, email, password)
+	loginResp := login(ctx, email, password, "/api/login", http.StatusOK)
+
+	var client apiOAuthClient
+	postJSON(ctx, HandlerRegisterOAuthClient(ctx.db, secret), loginResp.Token, oauthClientParams{
+		Name:         "Test App",
+		RedirectURIs: []string{redirectURI},
+		Scopes:       []string{auth.ScopeChirpsRead, auth.ScopeChirpsWrite},
+	}, http.StatusCreated, &client)
+	if client.ClientSecret != "" {
+		t.Fatal("Fail: public clients must not be given a secret")
+	}
+
+	authorize := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {client.ClientID.String()},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {auth.ScopeChirpsRead},
+		"state":                 {"xyz"},
+		"code_challenge":        {auth.PKCEChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/oauth/authorize?"+authorize.Encode(), nil)
+	rec := httptest.NewRecorder()
+	HandlerOAuthAuthorize(ctx.db)(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Test App") {
+		t.Fatalf("Fail: expected consent page, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	denied := approve(ctx, authorize, "deny", email, password, http.StatusSeeOther)
+	if denied.Get("error") != "access_denied" || denied.Get("state") != "xyz" {
+		t.Fatalf("Fail: expected access_denied redirect with state, got %v", denied)
+	}
+
+	approve(ctx, authorize, "approve", email, "wrong", http.StatusUnauthorized)
+
+	code := approve(ctx, authorize, "approve", email, password, http.StatusSeeOther).Get("code")
+	tokenRequest(ctx, client.ClientID, url.Values{
+		"grant_type":    {grantAuthorizationCode},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {"not-the-verifier-not-the-verifier-not-the-verifier"},
+	}, http.StatusBadRequest, nil)
+
+	// a code is spent by any attempt to use it, so the right verifier is now too late
+	tokenRequest(ctx, client.ClientID, url.Values{
+		"grant_type":    {grantAuthorizationCode},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+	}, http.StatusBadRequest, nil)
+
+	code = approve(ctx, authorize, "approve", email, password, http.StatusSeeOther).Get("code")
+	var tokens oauthTokenResponse
+	tokenRequest(ctx, client.ClientID, url.Values{
+		"grant_type":    {grantAuthorizationCode},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+	}, http.StatusOK, &tokens)
+
+	accessToken, err := auth.ParseAccessToken(tokens.AccessToken, secret)
+	if err != nil || accessToken.ClientID != client.ClientID || len(accessToken.Scopes) != 1 || accessToken.Scopes[0] != auth.ScopeChirpsRead {
+		t.Fatalf("Fail: access token does not carry the granted scope: %+v, %v", accessToken, err)
+	}
+
+	// a third-party token must not unlock first-party account management
+	postJSON(ctx, HandlerEnrollTOTP(ctx.db, secret), tokens.AccessToken, nil, http.StatusUnauthorized, nil)
+
+	var introspection introspectionResponse
+	tokenRequestTo(ctx, HandlerOAuthIntrospect(ctx.db, secret), client.ClientID, url.Values{
+		"token": {tokens.AccessToken},
+	}, http.StatusOK, &introspection)
+	if !introspection.Active || introspection.Scope != auth.ScopeChirpsRead {
+		t.Fatalf("Fail: expected active access token, got %+v", introspection)
+	}
+
+	var refreshed oauthTokenResponse
+	refreshGrant := url.Values{"grant_type": {grantRefreshToken}, "refresh_token": {tokens.RefreshToken}}
+	tokenRequest(ctx, client.ClientID, refreshGrant, http.StatusOK, &refreshed)
+	tokenRequest(ctx, client.ClientID, refreshGrant, http.StatusBadRequest, nil)
+
+	tokenRequestTo(ctx, HandlerOAuthRevoke(ctx.db), client.ClientID, url.Values{
+		"token": {refreshed.RefreshToken},
+	}, http.StatusOK, nil)
+	tokenRequestTo(ctx, HandlerOAuthIntrospect(ctx.db, secret), client.ClientID, url.Values{
+		"token": {refreshed.RefreshToken},
+	}, http.StatusOK, &introspection)
+	if introspection.Active {
+		t.Fatal("Fail: revoked refresh token is still active")
+	}
+
+	tokenRequest(ctx, client.ClientID, url.Values{"grant_type": {grantClientCredentials}}, http.StatusBadRequest, nil)
+}
+
+func TestOAuthClientCredentials(t *testing.T) {
+	const secret = "abcd"
+
+	ctx := authTestCtx{
+		t:      t,
+		db:     &mockAuthDB{},
+		secret: secret,
+	}
+
+	seedUser(ctx, "owner@test.com", "pa$$word")
+	loginResp := login(ctx, "owner@test.com", "pa$$word", "/api/login", http.StatusOK)
+
+	var client apiOAuthClient
+	postJSON(ctx, HandlerRegisterOAuthClient(ctx.db, secret), loginResp.Token, oauthClientParams{
+		Name:         "Server App",
+		RedirectURIs: []string{"https://server.example.com/callback"},
+		Scopes:       []string{auth.ScopeChirpsWrite},
+		Confidential: true,
+	}, http.StatusCreated, &client)
+
+	grant := url.Values{"grant_type": {grantClientCredentials}}
+
+	form := url.Values{"client_id": {client.ClientID.String()}, "client_secret": {"wrong"}}
+	for k, v := range grant {
+		form[k] = v
+	}
+	postForm(ctx, HandlerOAuthToken(ctx.db, secret), form, http.StatusUnauthorized, nil)
+
+	form.Set("client_secret", client.ClientSecret)
+	var tokens oauthTokenResponse
+	postForm(ctx, HandlerOAuthToken(ctx.db, secret), form, http.StatusOK, &tokens)
+	if tokens.RefreshToken != "" || tokens.Scope != auth.ScopeChirpsWrite {
+		t.Fatalf("Fail: unexpected client_credentials response %+v", tokens)
+	}
+
+	form.Set("scope", auth.ScopeProfileWrite)
+	postForm(ctx, HandlerOAuthToken(ctx.db, secret), form, http.StatusBadRequest, nil)
+}
+
+// --- oauth ---
+
+func (m *mockAuthDB) CreateOAuthClient(ctx context.Context, arg database.CreateOAuthClientParams) (database.OauthClient, error) {
+	client := database.OauthClient{
+		ID:           uuid.New(),
+		CreatedAt:    time.Now(),
+		OwnerID:      arg.OwnerID,
+		Name:         arg.Name,
+		SecretHash:   arg.SecretHash,
+		RedirectUris: arg.RedirectUris,
+		Scopes:       arg.Scopes,
+	}
+	m.oauthClients = append(m.oauthClients, client)
+	return client, nil
+}
+
+func (m *mockAuthDB) ListOAuthClients(ctx context.Context, ownerID uuid.UUID) ([]database.OauthClient, error) {
+	var clients []database.OauthClient
+	for _, c := range m.oauthClients {
+		if c.OwnerID == ownerID {
+			clients = append(clients, c)
+		}
+	}
+	return clients, nil
+}
+
+func (m *mockAuthDB) DeleteOAuthClient(ctx context.Context, arg database.DeleteOAuthClientParams) (int64, error) {
+	for i, c := range m.oauthClients {
+		if c.ID == arg.ID && c.OwnerID == arg.OwnerID {
+			m.oauthClients = append(m.oauthClients[:i], m.oauthClients[i+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (m *mockAuthDB) GetOAuthClient(ctx context.Context, id uuid.UUID) (database.OauthClient, error) {
+	for _, c := range m.oauthClients {
+		if c.ID == id {
+			return c, nil
+		}
+	}
+	return database.OauthClient{}, errors.New("client not found")
+}
+
+func (m *mockAuthDB) CreateOAuthAuthorizationCode(ctx context.Context, arg database.CreateOAuthAuthorizationCodeParams) error {
+	m.oauthCodes = append(m.oauthCodes, database.OauthAuthorizationCode{
+		CodeHash:      arg.CodeHash,
+		CreatedAt:     time.Now(),
+		ClientID:      arg.ClientID,
+		UserID:        arg.UserID,
+		RedirectUri:   arg.RedirectUri,
+		Scopes:        arg.Scopes,
+		CodeChallenge: arg.CodeChallenge,
+		ExpiresAt:     arg.ExpiresAt,
+	})
+	return nil
+}
+
+func (m *mockAuthDB) ConsumeOAuthAuthorizationCode(
+	ctx context.Context,
+	arg database.ConsumeOAuthAuthorizationCodeParams,
+) (database.OauthAuthorizationCode, error) {
+	for i, c := range m.oauthCodes {
+		if c.CodeHash == arg.CodeHash && c.ClientID == arg.ClientID && !c.UsedAt.Valid && c.ExpiresAt.After(time.Now()) {
+			m.oauthCodes[i].UsedAt = sql.NullTime{Time: time.Now(), Valid: true}
+			return c, nil
+		}
+	}
+	return database.OauthAuthorizationCode{}, errors.New("code not found")
+}
+
+func (m *mockAuthDB) CreateClientRefreshToken(
+	ctx context.Context,
+	arg database.CreateClientRefreshTokenParams,
+) (database.RefreshToken, error) {
+	token := database.RefreshToken{
+		Token:     arg.Token,
+		UserID:    arg.UserID,
+		ExpiresAt: arg.ExpiresAt,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		ClientID:  arg.ClientID,
+		Scopes:    arg.Scopes,
+	}
+
+	m.refreshTokens = append(m.refreshTokens, token)
+	return token, nil
+}
+
+func (m *mockAuthDB) RevokeClientRefreshToken(ctx context.Context, arg database.RevokeClientRefreshTokenParams) (int64, error) {
+	for i, rt := range m.refreshTokens {
+		if rt.Token == arg.Token && rt.ClientID == arg.ClientID && !rt.RevokedAt.Valid {
+			m.refreshTokens[i].RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// --- test helpers ---
+
+// approve submits the consent form and returns the query of the redirect back to the client
+func approve(ctx authTestCtx, authorize url.Values, decision, email, password string, expectStatus int) url.Values {
+	form := url.Values{"decision": {decision}, "email": {email}, "password": {password}}
+	for k, v := range authorize {
+		form[k] = v
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/oauth/authorize", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+
+	HandlerOAuthApprove(ctx.db)(rec, req)
+
+	if rec.Code != expectStatus {
+		ctx.t.Fatalf("consent expected %d, got %d: %s", expectStatus, rec.Code, rec.Body.String())
+	}
+
+	location, _ := url.Parse(rec.Header().Get("Location"))
+	return location.Query()
+}
+
+func tokenRequest(ctx authTestCtx, clientID uuid.UUID, form url.Values, expectStatus int, out any) {
+	tokenRequestTo(ctx, HandlerOAuthToken(ctx.db, ctx.secret), clientID, form, expectStatus, out)
+}
+
+func tokenRequestTo(ctx authTestCtx, handler http.HandlerFunc, clientID uuid.UUID, form url.Values, expectStatus int, out any) {
+	form.Set("client_id", clientID.String())
+	postForm(ctx, handler, form, expectStatus, out)
+}
+
+func postForm(ctx authTestCtx, handler http.HandlerFunc, form url.Values, expectStatus int, out any) {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+
+	handler(rec, req)
+
+	if rec.Code != expectStatus {
+		ctx.t.Fatalf("expected %d, got %d: %s", expectStatus, rec.Code, rec.Body.String())
+	}
+
+	if out != nil {
+		_ = json.NewDecoder(rec.Body).Decode(out)
+	}
+}
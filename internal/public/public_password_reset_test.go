@@ -0,0 +1,185 @@
+package public
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/mailer"
+	"github.com/bailey4770/chirpy/internal/password"
+	"github.com/bailey4770/chirpy/internal/problem"
+	"github.com/google/uuid"
+)
+
+type captureMailer struct {
+	sent []mailer.Message
+}
+
+func (m *captureMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// --- integration test ---
+
+func TestPasswordResetPipeline(t *testing.T) {
+	const (
+		email       = "reset@test.com"
+		oldPassword = "pa$$word"
+		newPassword = "newpa$$word"
+		secret      = "abcd"
+	)
+
+	ctx := authTestCtx{
+		t:      t,
+		db:     &mockAuthDB{},
+		secret: secret,
+	}
+	outbox := &captureMailer{}
+	mail := MailConfig{Mailer: outbox, AppBaseURL: "http://chirpy.test"}
+
+	seedUser(ctx, email, oldPassword)
+	session := login(ctx, email, oldPassword, "/api/login", http.StatusOK)
+
+	postJSON(ctx, HandlerRequestPasswordReset(ctx.db, mail), "", passwordResetRequestParams{Email: "nobody@test.com"}, http.StatusAccepted, nil)
+	if len(outbox.sent) != 0 {
+		t.Fatal("Fail: reset email sent for an unknown address")
+	}
+
+	postJSON(ctx, HandlerRequestPasswordReset(ctx.db, mail), "", passwordResetRequestParams{Email: email}, http.StatusAccepted, nil)
+	if len(outbox.sent) != 1 {
+		t.Fatalf("Fail: expected 1 reset email but %d were sent", len(outbox.sent))
+	}
+
+	token := regexp.MustCompile(`token=([0-9a-f]+)`).FindStringSubmatch(outbox.sent[0].Body)[1]
+	reset := passwordResetParams{Token: token, Password: newPassword}
+
+	// a password rejected by policy leaves the token usable
+	var policyErr problem.Details
+	weak := passwordResetParams{Token: token, Password: "password"}
+	postJSON(ctx, HandlerResetPassword(ctx.db, password.DefaultPolicy()), "", weak, http.StatusBadRequest, &policyErr)
+	if policyErr.Code != problem.CodeValidation || len(policyErr.Errors) == 0 || policyErr.Errors[0].Field != "password" {
+		t.Fatalf("Fail: expected password policy violations in response, got %+v", policyErr)
+	}
+
+	postJSON(ctx, HandlerResetPassword(ctx.db, password.Policy{}), "", reset, http.StatusNoContent, nil)
+	postJSON(ctx, HandlerResetPassword(ctx.db, password.Policy{}), "", reset, http.StatusBadRequest, nil)
+
+	login(ctx, email, oldPassword, "/api/login", http.StatusUnauthorized)
+	login(ctx, email, newPassword, "/api/login", http.StatusOK)
+	refresh(ctx, session.RefreshToken, "/api/refresh", http.StatusUnauthorized)
+}
+
+func TestEmailVerificationFollowsEmailChanges(t *testing.T) {
+	const (
+		email    = "verify@test.com"
+		newEmail = "moved@test.com"
+		pw       = "pa$$word"
+		secret   = "abcd"
+	)
+
+	ctx := authTestCtx{
+		t:      t,
+		db:     &mockAuthDB{},
+		secret: secret,
+	}
+	outbox := &captureMailer{}
+	mail := MailConfig{Mailer: outbox, AppBaseURL: "http://chirpy.test"}
+	requestLink := HandlerRequestEmailVerification(ctx.db, secret, mail)
+	verify := HandlerVerifyEmail(ctx.db)
+
+	seedUser(ctx, email, pw)
+	session := login(ctx, email, pw, "/api/login", http.StatusOK)
+
+	lastToken := func() string {
+		t.Helper()
+		return regexp.MustCompile(`token=([0-9a-f]+)`).FindStringSubmatch(outbox.sent[len(outbox.sent)-1].Body)[1]
+	}
+
+	// a link sent before the email changed no longer works
+	postJSON(ctx, requestLink, session.Token, nil, http.StatusAccepted, nil)
+	oldLink := lastToken()
+	postJSON(ctx, HandlerUpdateEmailAndPassword(ctx.db, secret, password.Policy{}), session.Token, userRequestParams{Email: newEmail, Password: pw}, http.StatusOK, nil)
+	postJSON(ctx, verify, "", emailTokenParams{Token: oldLink}, http.StatusBadRequest, nil)
+	if ctx.db.users[0].EmailVerified {
+		t.Fatal("Fail: expected a link to the old address not to verify the new one")
+	}
+
+	// nor does one whose address changed between following it and marking the email verified
+	postJSON(ctx, requestLink, session.Token, nil, http.StatusAccepted, nil)
+	racedLink := lastToken()
+	_ = ctx.db.updateUser(ctx.db.users[0].ID, func(u *database.User) { u.Email = email })
+	postJSON(ctx, verify, "", emailTokenParams{Token: racedLink}, http.StatusBadRequest, nil)
+	if ctx.db.users[0].EmailVerified {
+		t.Fatal("Fail: expected the link to verify only the address it was sent to")
+	}
+
+	postJSON(ctx, requestLink, session.Token, nil, http.StatusAccepted, nil)
+	postJSON(ctx, verify, "", emailTokenParams{Token: lastToken()}, http.StatusNoContent, nil)
+	if !ctx.db.users[0].EmailVerified {
+		t.Fatal("Fail: expected a link to the current address to verify it")
+	}
+}
+
+// --- user tokens ---
+
+func (m *mockAuthDB) CreateUserToken(ctx context.Context, arg database.CreateUserTokenParams) error {
+	m.userTokens = append(m.userTokens, database.UserToken{
+		TokenHash: arg.TokenHash,
+		UserID:    arg.UserID,
+		Purpose:   arg.Purpose,
+		Email:     arg.Email,
+		ExpiresAt: arg.ExpiresAt,
+	})
+	return nil
+}
+
+func (m *mockAuthDB) DeleteUserTokens(ctx context.Context, arg database.DeleteUserTokensParams) error {
+	kept := m.userTokens[:0]
+	for _, ut := range m.userTokens {
+		if ut.UserID != arg.UserID || ut.Purpose != arg.Purpose {
+			kept = append(kept, ut)
+		}
+	}
+	m.userTokens = kept
+	return nil
+}
+
+func (m *mockAuthDB) GetValidUserToken(ctx context.Context, arg database.GetValidUserTokenParams) (uuid.UUID, error) {
+	for _, ut := range m.userTokens {
+		if ut.TokenHash == arg.TokenHash && ut.Purpose == arg.Purpose && !ut.UsedAt.Valid && ut.ExpiresAt.After(time.Now()) {
+			return ut.UserID, nil
+		}
+	}
+	return uuid.UUID{}, errors.New("token not found")
+}
+
+func (m *mockAuthDB) ConsumeUserToken(ctx context.Context, arg database.ConsumeUserTokenParams) (database.ConsumeUserTokenRow, error) {
+	for i, ut := range m.userTokens {
+		if ut.TokenHash == arg.TokenHash && ut.Purpose == arg.Purpose && !ut.UsedAt.Valid && ut.ExpiresAt.After(time.Now()) {
+			m.userTokens[i].UsedAt = sql.NullTime{Time: time.Now(), Valid: true}
+			return database.ConsumeUserTokenRow{UserID: ut.UserID, Email: ut.Email}, nil
+		}
+	}
+	return database.ConsumeUserTokenRow{}, errors.New("token not found")
+}
+
+// --- passwords and sessions ---
+
+func (m *mockAuthDB) UpdatePassword(ctx context.Context, arg database.UpdatePasswordParams) error {
+	return m.updateUser(arg.ID, func(u *database.User) { u.HashedPassword = arg.HashedPassword })
+}
+
+func (m *mockAuthDB) RevokeAllRefreshTokensForUser(ctx context.Context, userID uuid.UUID) error {
+	for i, rt := range m.refreshTokens {
+		if rt.UserID == userID && !rt.RevokedAt.Valid {
+			m.refreshTokens[i].RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		}
+	}
+	return nil
+}
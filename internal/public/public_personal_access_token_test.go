@@ -0,0 +1,108 @@
+package public
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (m *mockAuthDB) CreatePersonalAccessToken(ctx context.Context, arg database.CreatePersonalAccessTokenParams) (database.PersonalAccessToken, error) {
+	pat := database.PersonalAccessToken{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UserID:    arg.UserID,
+		Name:      arg.Name,
+		TokenHash: arg.TokenHash,
+		Scopes:    arg.Scopes,
+		ExpiresAt: arg.ExpiresAt,
+	}
+	m.pats = append(m.pats, pat)
+	return pat, nil
+}
+
+func (m *mockAuthDB) RevokePersonalAccessToken(ctx context.Context, arg database.RevokePersonalAccessTokenParams) (int64, error) {
+	for i, pat := range m.pats {
+		if pat.ID == arg.ID && pat.UserID == arg.UserID && !pat.RevokedAt.Valid {
+			m.pats[i].RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func TestPostChirpWithPersonalAccessToken(t *testing.T) {
+	const tokenSecret = "abcd"
+
+	type testCase struct {
+		name               string
+		scopes             []string
+		expiresAt          sql.NullTime
+		revokedAt          sql.NullTime
+		expectedStatusCode int
+	}
+
+	testCases := []testCase{
+		{
+			name:               "write scope",
+			scopes:             []string{auth.ScopeChirpsRead, auth.ScopeChirpsWrite},
+			expectedStatusCode: http.StatusCreated,
+		},
+		{
+			name:               "read only scope",
+			scopes:             []string{auth.ScopeChirpsRead},
+			expectedStatusCode: http.StatusForbidden,
+		},
+		{
+			name:               "expired token",
+			scopes:             []string{auth.ScopeChirpsWrite},
+			expiresAt:          sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true},
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:               "revoked token",
+			scopes:             []string{auth.ScopeChirpsWrite},
+			revokedAt:          sql.NullTime{Time: time.Now(), Valid: true},
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rawToken := auth.MakePersonalAccessToken()
+			mock := &mockChirpDB{
+				pats: []database.PersonalAccessToken{{
+					ID:        uuid.New(),
+					UserID:    uuid.New(),
+					TokenHash: auth.HashToken(rawToken),
+					Scopes:    tc.scopes,
+					ExpiresAt: tc.expiresAt,
+					RevokedAt: tc.revokedAt,
+				}},
+			}
+
+			reqBody, _ := json.Marshal(chirpParams{Body: "posted by a bot"})
+			req := httptest.NewRequest(http.MethodPost, "/api/chirps", bytes.NewReader(reqBody))
+			req.Header.Set("Authorization", "Bearer "+rawToken)
+			w := httptest.NewRecorder()
+
+			HandlerPostChirp(mock, tokenSecret, ChirpPolicy{})(w, req)
+
+			if w.Code != tc.expectedStatusCode {
+				t.Fatalf("Fail: expected response status code %d but received %d with message: \n%s", tc.expectedStatusCode, w.Code, w.Body.String())
+			}
+
+			if w.Code == http.StatusCreated && mock.chirps[0].UserID != mock.pats[0].UserID {
+				t.Fatal("Fail: chirp was not posted as the token's owner")
+			}
+		})
+	}
+}
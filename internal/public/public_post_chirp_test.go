@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,13 +12,24 @@ import (
 	"testing"
 	"time"
 
+	"github.com/bailey4770/chirpy/internal/audit"
 	"github.com/bailey4770/chirpy/internal/auth"
 	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/filter"
 	"github.com/google/uuid"
 )
 
 type mockChirpDB struct {
-	chirps []database.Chirp
+	chirps  []database.Chirp
+	pats    []database.PersonalAccessToken
+	media   []database.MediaAttachment
+	blocks  []database.UserBlock
+	mutes   []database.UserMute
+	cases   []database.ModerationCase
+	reports []database.ChirpReport
+	events  []audit.Event
+	// users holds users with more than an ID, such as suspended ones
+	users map[uuid.UUID]database.User
 }
 
 func (m *mockChirpDB) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
@@ -32,6 +44,26 @@ func (m *mockChirpDB) CreateChirp(ctx context.Context, arg database.CreateChirpP
 	return chirp, nil
 }
 
+func (m *mockChirpDB) GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error) {
+	if u, ok := m.users[id]; ok {
+		return u, nil
+	}
+	return database.User{ID: id, EmailVerified: true}, nil
+}
+
+func (m *mockChirpDB) GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (database.PersonalAccessToken, error) {
+	for _, pat := range m.pats {
+		if pat.TokenHash == tokenHash {
+			return pat, nil
+		}
+	}
+	return database.PersonalAccessToken{}, errors.New("token not found")
+}
+
+func (m *mockChirpDB) TouchPersonalAccessToken(ctx context.Context, id uuid.UUID) error {
+	return nil
+}
+
 func TestHandleCreateChirp(t *testing.T) {
 	type chirpTestCase struct {
 		name               string
@@ -102,7 +134,7 @@ func TestHandleCreateChirp(t *testing.T) {
 
 			w := httptest.NewRecorder()
 
-			handler := HandlerPostChirp(mock, tokenSecret)
+			handler := HandlerPostChirp(mock, tokenSecret, ChirpPolicy{})
 			handler(w, req)
 
 			resp := w.Result()
@@ -128,3 +160,36 @@ func TestHandleCreateChirp(t *testing.T) {
 		})
 	}
 }
+
+func TestChirpContentFilter(t *testing.T) {
+	const secret = "abcd"
+	mock := &mockChirpDB{}
+	engine := filter.NewEngine([]filter.Rule{
+		{Pattern: "kerfuffle", Severity: filter.SeverityLow, Action: filter.ActionMask},
+		{Pattern: "fornax", Severity: filter.SeverityHigh, Action: filter.ActionReject},
+		{Pattern: "buy followers", Severity: filter.SeverityMedium, Action: filter.ActionFlag},
+	})
+	handler := HandlerPostChirp(mock, secret, ChirpPolicy{Filter: engine})
+	token, _ := auth.MakeJWT(uuid.New(), secret)
+
+	chirp := postChirp(t, handler, token, chirpParams{Body: "what a k\u0435rfuffl\u0435, nothing classic about it"}, http.StatusCreated)
+	if chirp.Body != "what a ****, nothing classic about it" {
+		t.Errorf("Fail: expected disguised word to be masked but received %q", chirp.Body)
+	}
+
+	postChirp(t, handler, token, chirpParams{Body: "f 0 r n a x"}, http.StatusBadRequest)
+	if len(mock.chirps) != 1 {
+		t.Fatalf("Fail: expected rejected chirp not to be saved, have %d chirps", len(mock.chirps))
+	}
+
+	flagged := postChirp(t, handler, token, chirpParams{Body: "Buy followers here"}, http.StatusCreated)
+	if len(mock.cases) != 1 || mock.cases[0].ChirpID != flagged.ID {
+		t.Fatalf("Fail: expected flagged chirp to open a moderation case, have %v", mock.cases)
+	}
+	if len(mock.reports) != 1 || mock.reports[0].ReporterID.Valid || mock.reports[0].Category != filterReportCategory {
+		t.Fatalf("Fail: expected one report from the filter, have %v", mock.reports)
+	}
+
+	engine.Set(nil)
+	postChirp(t, handler, token, chirpParams{Body: "fornax"}, http.StatusCreated)
+}
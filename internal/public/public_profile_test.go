@@ -0,0 +1,120 @@
+package public
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestProfile(t *testing.T) {
+	const (
+		email  = "profile@test.com"
+		secret = "abcd"
+	)
+
+	ctx := authTestCtx{
+		t:      t,
+		db:     &mockAuthDB{},
+		secret: secret,
+	}
+	update := HandlerUpdateProfile(ctx.db, secret)
+
+	seedUser(ctx, email, "pa$$word")
+	session := login(ctx, email, "pa$$word", "/api/login", http.StatusOK)
+
+	patch := func(token string, body string, expectStatus int) apiProfile {
+		req := httptest.NewRequest(http.MethodPatch, "/api/users/me", bytes.NewReader([]byte(body)))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		update(rec, req)
+
+		if rec.Code != expectStatus {
+			t.Fatalf("update expected %d, got %d: %s", expectStatus, rec.Code, rec.Body.String())
+		}
+
+		var resp apiProfile
+		_ = json.NewDecoder(rec.Body).Decode(&resp)
+		return resp
+	}
+
+	updated := patch(session.Token, `{"display_name": "  Chirpy   Fan ", "website": "https://example.com"}`, http.StatusOK)
+	if updated.DisplayName != "Chirpy Fan" || updated.Website != "https://example.com" {
+		t.Fatalf("Fail: expected cleaned profile fields, got %+v", updated)
+	}
+
+	// fields left out of the request are kept
+	updated = patch(session.Token, `{"bio": "hello"}`, http.StatusOK)
+	if updated.DisplayName != "Chirpy Fan" || updated.Bio != "hello" {
+		t.Fatalf("Fail: expected partial update to keep other fields, got %+v", updated)
+	}
+
+	patch(session.Token, `{"avatar_url": "javascript:alert(1)"}`, http.StatusBadRequest)
+
+	readOnly := ctx.db.seedPAT(session.ID, auth.ScopeChirpsRead)
+	patch(readOnly, `{"bio": "from a bot"}`, http.StatusForbidden)
+	writer := ctx.db.seedPAT(session.ID, auth.ScopeProfileWrite)
+	patch(writer, `{"bio": "from a bot"}`, http.StatusOK)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/"+session.ID.String(), nil)
+	req.SetPathValue("userID", session.ID.String())
+	rec := httptest.NewRecorder()
+	HandlerGetProfile(ctx.db)(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("get profile expected 200, got %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), email) || strings.Contains(rec.Body.String(), `"email"`) {
+		t.Fatalf("Fail: public profile leaked the email address: %s", rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "from a bot") {
+		t.Fatalf("Fail: expected the latest bio, got %s", rec.Body.String())
+	}
+}
+
+// --- profiles ---
+
+func (m *mockAuthDB) UpdateProfile(ctx context.Context, arg database.UpdateProfileParams) (database.User, error) {
+	if err := m.updateUser(arg.ID, func(u *database.User) {
+		u.DisplayName = arg.DisplayName
+		u.Bio = arg.Bio
+		u.Location = arg.Location
+		u.Website = arg.Website
+		u.AvatarUrl = arg.AvatarUrl
+	}); err != nil {
+		return database.User{}, err
+	}
+	return m.GetUserByID(ctx, arg.ID)
+}
+
+func (m *mockAuthDB) seedPAT(userID uuid.UUID, scopes ...string) string {
+	token := auth.MakePersonalAccessToken()
+	m.pats = append(m.pats, database.PersonalAccessToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		TokenHash: auth.HashToken(token),
+		Scopes:    scopes,
+	})
+	return token
+}
+
+func (m *mockAuthDB) GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (database.PersonalAccessToken, error) {
+	for _, pat := range m.pats {
+		if pat.TokenHash == tokenHash {
+			return pat, nil
+		}
+	}
+	return database.PersonalAccessToken{}, errors.New("token not found")
+}
+
+func (m *mockAuthDB) TouchPersonalAccessToken(ctx context.Context, id uuid.UUID) error {
+	return nil
+}
@@ -0,0 +1,196 @@
+package public
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (m *mockChirpDB) BlockUser(ctx context.Context, arg database.BlockUserParams) error {
+	if !slices.ContainsFunc(m.blocks, func(b database.UserBlock) bool { return b.BlockerID == arg.BlockerID && b.BlockedID == arg.BlockedID }) {
+		m.blocks = append(m.blocks, database.UserBlock{BlockerID: arg.BlockerID, BlockedID: arg.BlockedID, CreatedAt: time.Now()})
+	}
+	return nil
+}
+
+func (m *mockChirpDB) UnblockUser(ctx context.Context, arg database.UnblockUserParams) (int64, error) {
+	before := len(m.blocks)
+	m.blocks = slices.DeleteFunc(m.blocks, func(b database.UserBlock) bool { return b.BlockerID == arg.BlockerID && b.BlockedID == arg.BlockedID })
+	return int64(before - len(m.blocks)), nil
+}
+
+func (m *mockChirpDB) ListBlockedUsers(ctx context.Context, blockerID uuid.UUID) ([]database.UserBlock, error) {
+	var blocks []database.UserBlock
+	for _, b := range m.blocks {
+		if b.BlockerID == blockerID {
+			blocks = append(blocks, b)
+		}
+	}
+	return blocks, nil
+}
+
+func (m *mockChirpDB) MuteUser(ctx context.Context, arg database.MuteUserParams) error {
+	if !slices.ContainsFunc(m.mutes, func(mu database.UserMute) bool { return mu.MuterID == arg.MuterID && mu.MutedID == arg.MutedID }) {
+		m.mutes = append(m.mutes, database.UserMute{MuterID: arg.MuterID, MutedID: arg.MutedID, CreatedAt: time.Now()})
+	}
+	return nil
+}
+
+func (m *mockChirpDB) UnmuteUser(ctx context.Context, arg database.UnmuteUserParams) (int64, error) {
+	before := len(m.mutes)
+	m.mutes = slices.DeleteFunc(m.mutes, func(mu database.UserMute) bool { return mu.MuterID == arg.MuterID && mu.MutedID == arg.MutedID })
+	return int64(before - len(m.mutes)), nil
+}
+
+func (m *mockChirpDB) ListMutedUsers(ctx context.Context, muterID uuid.UUID) ([]database.UserMute, error) {
+	var mutes []database.UserMute
+	for _, mu := range m.mutes {
+		if mu.MuterID == muterID {
+			mutes = append(mutes, mu)
+		}
+	}
+	return mutes, nil
+}
+
+func (m *mockChirpDB) ListHiddenAuthors(ctx context.Context, blockerID uuid.UUID) ([]database.ListHiddenAuthorsRow, error) {
+	var rows []database.ListHiddenAuthorsRow
+	for _, b := range m.blocks {
+		if b.BlockerID == blockerID {
+			rows = append(rows, database.ListHiddenAuthorsRow{UserID: b.BlockedID, Blocked: true})
+		}
+		if b.BlockedID == blockerID {
+			rows = append(rows, database.ListHiddenAuthorsRow{UserID: b.BlockerID, Blocked: true})
+		}
+	}
+	for _, mu := range m.mutes {
+		if mu.MuterID == blockerID {
+			rows = append(rows, database.ListHiddenAuthorsRow{UserID: mu.MutedID, Blocked: false})
+		}
+	}
+	for _, u := range m.users {
+		kind := auth.ActiveSuspension(u.SuspensionKind, u.SuspendedAt, u.SuspendedUntil, time.Now())
+		if u.ID != blockerID && (kind == auth.SuspensionFull || kind == auth.SuspensionShadowBan) {
+			rows = append(rows, database.ListHiddenAuthorsRow{UserID: u.ID, Blocked: true})
+		}
+	}
+	return rows, nil
+}
+
+func TestBlockAndMute(t *testing.T) {
+	const secret = "abcd"
+	alice, bob, carol := uuid.New(), uuid.New(), uuid.New()
+	mock := &mockChirpDB{}
+	for _, author := range []uuid.UUID{alice, bob, carol} {
+		_, _ = mock.CreateChirp(context.Background(), database.CreateChirpParams{Body: "hello", UserID: author})
+	}
+	aliceChirp := mock.chirps[0]
+	carolChirp := mock.chirps[2]
+
+	tokens := map[uuid.UUID]string{}
+	for _, id := range []uuid.UUID{alice, bob, carol} {
+		tokens[id], _ = auth.MakeJWT(id, secret)
+	}
+
+	relate := func(handler func(http.ResponseWriter, *http.Request), caller, target uuid.UUID, expectStatus int) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPut, "/api/users/me/blocks/"+target.String(), nil)
+		req.SetPathValue("userID", target.String())
+		req.Header.Set("Authorization", "Bearer "+tokens[caller])
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if w.Code != expectStatus {
+			t.Fatalf("Fail: expected status %d but received %d with message: \n%s", expectStatus, w.Code, w.Body.String())
+		}
+	}
+
+	// listAuthors returns the authors of the chirps viewer is shown, in posting order
+	listAuthors := func(viewer uuid.UUID, query string) []uuid.UUID {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/chirps"+query, nil)
+		if viewer != uuid.Nil {
+			req.Header.Set("Authorization", "Bearer "+tokens[viewer])
+		}
+		w := httptest.NewRecorder()
+		HandlerFetchChirpsByAge(mock, secret, nil)(w, req)
+
+		var chirps []apiChirp
+		if err := json.Unmarshal(w.Body.Bytes(), &chirps); err != nil {
+			t.Fatalf("Error: could not unmarshal chirps: %v", err)
+		}
+		authors := []uuid.UUID{}
+		for _, c := range chirps {
+			authors = append(authors, c.UserID)
+		}
+		return authors
+	}
+
+	fetch := func(viewer uuid.UUID, chirp database.Chirp) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/chirps/"+chirp.ID.String(), nil)
+		req.SetPathValue("chirpID", chirp.ID.String())
+		req.Header.Set("Authorization", "Bearer "+tokens[viewer])
+		w := httptest.NewRecorder()
+		HandlerFetchChirpByID(mock, secret, nil)(w, req)
+		return w.Code
+	}
+
+	relate(HandlerBlockUser(mock, secret), alice, alice, http.StatusBadRequest)
+	relate(HandlerBlockUser(mock, secret), alice, bob, http.StatusNoContent)
+	relate(HandlerBlockUser(mock, secret), alice, bob, http.StatusNoContent)
+	relate(HandlerMuteUser(mock, secret), alice, carol, http.StatusNoContent)
+
+	if len(mock.blocks) != 1 {
+		t.Fatalf("Fail: expected blocking twice to store one block, got %d", len(mock.blocks))
+	}
+
+	type listCase struct {
+		name     string
+		viewer   uuid.UUID
+		query    string
+		expected []uuid.UUID
+	}
+
+	listCases := []listCase{
+		{"anonymous viewers see everything", uuid.Nil, "", []uuid.UUID{alice, bob, carol}},
+		{"blocker hides blocked and muted users", alice, "", []uuid.UUID{alice}},
+		{"muted author shown when asked for", alice, "?author_id=" + carol.String(), []uuid.UUID{carol}},
+		{"blocked author hidden even when asked for", alice, "?author_id=" + bob.String(), []uuid.UUID{}},
+		{"blocked user cannot see the blocker", bob, "", []uuid.UUID{bob, carol}},
+		{"mutes are private to the muter", carol, "", []uuid.UUID{alice, bob, carol}},
+		{"hidden authors do not shorten a page", bob, "?limit=2", []uuid.UUID{bob, carol}},
+		{"hidden authors do not count towards the offset", bob, "?limit=1&offset=1", []uuid.UUID{carol}},
+	}
+
+	for _, tc := range listCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := listAuthors(tc.viewer, tc.query); !slices.Equal(got, tc.expected) {
+				t.Fatalf("Fail: expected authors %v but received %v", tc.expected, got)
+			}
+		})
+	}
+
+	if code := fetch(bob, aliceChirp); code != http.StatusNotFound {
+		t.Fatalf("Fail: expected blocked user to get 404 for the blocker's chirp, got %d", code)
+	}
+	if code := fetch(alice, carolChirp); code != http.StatusOK {
+		t.Fatalf("Fail: expected a muted user's chirp to be fetchable by ID, got %d", code)
+	}
+
+	relate(HandlerUnblockUser(mock, secret), alice, bob, http.StatusNoContent)
+	relate(HandlerUnblockUser(mock, secret), alice, bob, http.StatusNotFound)
+	relate(HandlerUnmuteUser(mock, secret), alice, carol, http.StatusNoContent)
+
+	if got := listAuthors(bob, ""); len(got) != 3 {
+		t.Fatalf("Fail: expected all chirps after unblocking, got %v", got)
+	}
+	if code := fetch(bob, aliceChirp); code != http.StatusOK {
+		t.Fatalf("Fail: expected chirp to be visible after unblocking, got %d", code)
+	}
+}
@@ -0,0 +1,105 @@
+package public
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (m *mockChirpDB) OpenModerationCase(ctx context.Context, arg database.OpenModerationCaseParams) (database.ModerationCase, error) {
+	for _, c := range m.cases {
+		if c.ChirpID == arg.ChirpID && c.Status == "open" {
+			return c, nil
+		}
+	}
+	c := database.ModerationCase{
+		ID:            uuid.New(),
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+		ChirpID:       arg.ChirpID,
+		ChirpAuthorID: arg.ChirpAuthorID,
+		ChirpBody:     arg.ChirpBody,
+		Status:        "open",
+	}
+	m.cases = append(m.cases, c)
+	return c, nil
+}
+
+func (m *mockChirpDB) CreateChirpReport(ctx context.Context, arg database.CreateChirpReportParams) (int64, error) {
+	if slices.ContainsFunc(m.reports, func(r database.ChirpReport) bool {
+		return r.CaseID == arg.CaseID && r.ReporterID.Valid && r.ReporterID == arg.ReporterID
+	}) {
+		return 0, nil
+	}
+	m.reports = append(m.reports, database.ChirpReport{
+		ID:         uuid.New(),
+		CreatedAt:  time.Now(),
+		CaseID:     arg.CaseID,
+		ReporterID: arg.ReporterID,
+		Category:   arg.Category,
+		Comment:    arg.Comment,
+	})
+	return 1, nil
+}
+
+func TestReportChirp(t *testing.T) {
+	const secret = "abcd"
+	author, reporter, other := uuid.New(), uuid.New(), uuid.New()
+	mock := &mockChirpDB{}
+	chirp, _ := mock.CreateChirp(context.Background(), database.CreateChirpParams{Body: "something nasty", UserID: author})
+
+	type reportTestCase struct {
+		name         string
+		caller       uuid.UUID
+		chirpID      uuid.UUID
+		params       reportParams
+		expectStatus int
+	}
+
+	testCases := []reportTestCase{
+		{"unknown category", reporter, chirp.ID, reportParams{Category: "rude"}, http.StatusBadRequest},
+		{"comment too long", reporter, chirp.ID, reportParams{Category: "spam", Comment: strings.Repeat("a", maxReportCommentLength+1)}, http.StatusBadRequest},
+		{"missing chirp", reporter, uuid.New(), reportParams{Category: "spam"}, http.StatusNotFound},
+		{"own chirp", author, chirp.ID, reportParams{Category: "spam"}, http.StatusBadRequest},
+		{"valid report", reporter, chirp.ID, reportParams{Category: "harassment", Comment: "aimed at me"}, http.StatusAccepted},
+		{"repeated report", reporter, chirp.ID, reportParams{Category: "spam"}, http.StatusAccepted},
+		{"second reporter", other, chirp.ID, reportParams{Category: "hate"}, http.StatusAccepted},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			token, _ := auth.MakeJWT(tc.caller, secret)
+			body, _ := json.Marshal(tc.params)
+			req := httptest.NewRequest(http.MethodPost, "/api/chirps/"+tc.chirpID.String()+"/report", bytes.NewReader(body))
+			req.SetPathValue("chirpID", tc.chirpID.String())
+			req.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+
+			HandlerReportChirp(mock, secret)(w, req)
+
+			if w.Code != tc.expectStatus {
+				t.Fatalf("Fail: expected response status code %d but received %d with message: \n%s", tc.expectStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	if len(mock.cases) != 1 {
+		t.Fatalf("Fail: expected reports about one chirp to share a single case, got %d", len(mock.cases))
+	}
+	if len(mock.reports) != 2 {
+		t.Fatalf("Fail: expected one report per reporter, got %d", len(mock.reports))
+	}
+	if mock.reports[0].Category != "harassment" || mock.cases[0].ChirpBody != chirp.Body {
+		t.Fatalf("Fail: expected the first report and a copy of the chirp to be kept, got %+v and %+v", mock.reports[0], mock.cases[0])
+	}
+}
@@ -0,0 +1,231 @@
+package public
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/password"
+	"github.com/bailey4770/chirpy/internal/problem"
+	"github.com/google/uuid"
+)
+
+func TestSuspensions(t *testing.T) {
+	const secret = "abcd"
+	viewer, full, readOnly, shadow, expired := uuid.New(), uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	everyone := []uuid.UUID{viewer, full, readOnly, shadow, expired}
+
+	now := time.Now()
+	suspended := func(id uuid.UUID, kind string, until sql.NullTime) database.User {
+		return database.User{
+			ID:             id,
+			EmailVerified:  true,
+			SuspendedAt:    sql.NullTime{Time: now.Add(-time.Hour), Valid: true},
+			SuspensionKind: kind,
+			SuspendedUntil: until,
+		}
+	}
+	mock := &mockChirpDB{users: map[uuid.UUID]database.User{
+		full:     suspended(full, auth.SuspensionFull, sql.NullTime{}),
+		readOnly: suspended(readOnly, auth.SuspensionReadOnly, sql.NullTime{Time: now.Add(time.Hour), Valid: true}),
+		shadow:   suspended(shadow, auth.SuspensionShadowBan, sql.NullTime{}),
+		expired:  suspended(expired, auth.SuspensionFull, sql.NullTime{Time: now.Add(-time.Minute), Valid: true}),
+	}}
+	for _, author := range everyone {
+		_, _ = mock.CreateChirp(context.Background(), database.CreateChirpParams{Body: "hello", UserID: author})
+	}
+	shadowChirp := mock.chirps[3]
+
+	tokens := map[uuid.UUID]string{}
+	for _, id := range everyone {
+		tokens[id], _ = auth.MakeJWT(id, secret)
+	}
+
+	post := HandlerPostChirp(mock, secret, ChirpPolicy{})
+	postChirp(t, post, tokens[full], chirpParams{Body: "let me back in"}, http.StatusForbidden)
+	postChirp(t, post, tokens[readOnly], chirpParams{Body: "can I post?"}, http.StatusForbidden)
+	postChirp(t, post, tokens[shadow], chirpParams{Body: "nobody will see this"}, http.StatusCreated)
+	postChirp(t, post, tokens[expired], chirpParams{Body: "I served my time"}, http.StatusCreated)
+
+	t.Run("read-only users can still block", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPut, "/api/users/me/blocks/"+viewer.String(), nil)
+		req.SetPathValue("userID", viewer.String())
+		req.Header.Set("Authorization", "Bearer "+tokens[readOnly])
+		w := httptest.NewRecorder()
+		HandlerBlockUser(mock, secret)(w, req)
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("Fail: expected status 204 but received %d with message: \n%s", w.Code, w.Body.String())
+		}
+		mock.blocks = nil
+	})
+
+	listAuthors := func(caller uuid.UUID) ([]uuid.UUID, int) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/chirps", nil)
+		if caller != uuid.Nil {
+			req.Header.Set("Authorization", "Bearer "+tokens[caller])
+		}
+		w := httptest.NewRecorder()
+		HandlerFetchChirpsByAge(mock, secret, nil)(w, req)
+
+		var chirps []apiChirp
+		_ = json.Unmarshal(w.Body.Bytes(), &chirps)
+		authors := []uuid.UUID{}
+		for _, c := range chirps {
+			if !slices.Contains(authors, c.UserID) {
+				authors = append(authors, c.UserID)
+			}
+		}
+		return authors, w.Code
+	}
+
+	type listCase struct {
+		name           string
+		caller         uuid.UUID
+		expectStatus   int
+		expectedAuthor []uuid.UUID
+	}
+
+	listCases := []listCase{
+		{"anonymous viewers do not see suspended or shadow-banned users", uuid.Nil, http.StatusOK, []uuid.UUID{viewer, readOnly, expired}},
+		{"others do not see suspended or shadow-banned users", viewer, http.StatusOK, []uuid.UUID{viewer, readOnly, expired}},
+		{"shadow-banned users see their own chirps", shadow, http.StatusOK, []uuid.UUID{viewer, readOnly, shadow, expired}},
+		{"read-only users can read", readOnly, http.StatusOK, []uuid.UUID{viewer, readOnly, expired}},
+		{"fully suspended users cannot read", full, http.StatusForbidden, []uuid.UUID{}},
+	}
+
+	for _, tc := range listCases {
+		t.Run(tc.name, func(t *testing.T) {
+			authors, code := listAuthors(tc.caller)
+			if code != tc.expectStatus {
+				t.Fatalf("Fail: expected status %d but received %d", tc.expectStatus, code)
+			}
+			if !slices.Equal(authors, tc.expectedAuthor) {
+				t.Fatalf("Fail: expected authors %v but received %v", tc.expectedAuthor, authors)
+			}
+		})
+	}
+
+	fetch := func(caller uuid.UUID) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/chirps/"+shadowChirp.ID.String(), nil)
+		req.SetPathValue("chirpID", shadowChirp.ID.String())
+		req.Header.Set("Authorization", "Bearer "+tokens[caller])
+		w := httptest.NewRecorder()
+		HandlerFetchChirpByID(mock, secret, nil)(w, req)
+		return w.Code
+	}
+	if code := fetch(viewer); code != http.StatusNotFound {
+		t.Fatalf("Fail: expected a shadow-banned chirp to be hidden from others, got %d", code)
+	}
+	if code := fetch(shadow); code != http.StatusOK {
+		t.Fatalf("Fail: expected a shadow-banned user to see their own chirp, got %d", code)
+	}
+}
+
+func TestMiddlewareSuspension(t *testing.T) {
+	const secret = "abcd"
+	active, suspended := uuid.New(), uuid.New()
+	mock := &mockChirpDB{users: map[uuid.UUID]database.User{
+		suspended: {ID: suspended, SuspendedAt: sql.NullTime{Time: time.Now(), Valid: true}, SuspensionKind: auth.SuspensionFull},
+	}}
+
+	handler := MiddlewareSuspension(mock, secret, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	activeToken, _ := auth.MakeJWT(active, secret)
+	suspendedToken, _ := auth.MakeJWT(suspended, secret)
+
+	type middlewareCase struct {
+		name         string
+		header       string
+		expectStatus int
+	}
+
+	testCases := []middlewareCase{
+		{"no token", "", http.StatusNoContent},
+		{"refresh token", "Bearer 0123456789abcdef", http.StatusNoContent},
+		{"active user", "Bearer " + activeToken, http.StatusNoContent},
+		{"suspended user", "Bearer " + suspendedToken, http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/users/me/totp", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tc.expectStatus {
+				t.Fatalf("Fail: expected status %d but received %d", tc.expectStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestReadOnlyAccountChanges(t *testing.T) {
+	const secret = "abcd"
+	readOnly, shadow := uuid.New(), uuid.New()
+	suspendedAt := sql.NullTime{Time: time.Now(), Valid: true}
+	mock := &mockAuthDB{users: []database.User{
+		{ID: readOnly, Email: "readonly@test.com", SuspendedAt: suspendedAt, SuspensionKind: auth.SuspensionReadOnly},
+		{ID: shadow, Email: "shadow@test.com", SuspendedAt: suspendedAt, SuspensionKind: auth.SuspensionShadowBan},
+	}}
+
+	handlers := map[string]http.HandlerFunc{
+		"update email and password":    HandlerUpdateEmailAndPassword(mock, secret, password.Policy{}),
+		"enrol two-factor":             HandlerEnrollTOTP(mock, secret),
+		"confirm two-factor":           HandlerConfirmTOTP(mock, secret),
+		"create personal access token": HandlerCreatePersonalAccessToken(mock, secret),
+		"register OAuth client":        HandlerRegisterOAuthClient(mock, secret),
+	}
+
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			for _, caller := range []uuid.UUID{readOnly, shadow} {
+				token, _ := auth.MakeJWT(caller, secret)
+				req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}"))
+				req.Header.Set("Authorization", "Bearer "+token)
+				w := httptest.NewRecorder()
+				handler(w, req)
+
+				var d problem.Details
+				_ = json.Unmarshal(w.Body.Bytes(), &d)
+				refused := w.Code == http.StatusForbidden && d.Code == problem.CodeSuspended
+				if refused != (caller == readOnly) {
+					t.Fatalf("Fail: expected only the read-only user to be refused, got status %d for %v with message: \n%s", w.Code, caller, w.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestSuspendedUserCannotLogIn(t *testing.T) {
+	const (
+		email    = "suspended@test.com"
+		password = "pa$$word"
+	)
+
+	ctx := authTestCtx{
+		t:      t,
+		db:     &mockAuthDB{},
+		secret: "abcd",
+	}
+
+	seedUser(ctx, email, password)
+	login(ctx, email, password, "/api/login", http.StatusOK)
+
+	_ = ctx.db.updateUser(ctx.db.users[0].ID, func(u *database.User) {
+		u.SuspendedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	})
+	login(ctx, email, password, "/api/login", http.StatusForbidden)
+}
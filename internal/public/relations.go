@@ -0,0 +1,219 @@
+package public
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/problem"
+	"github.com/google/uuid"
+)
+
+type apiRelation struct {
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// relations holds the authors a viewer must not be shown. A block hides the two users from each
+// other, whichever of them made it. A mute only hides the muted user from the muter's listings.
+// Users who are fully suspended or shadow-banned are treated as blocked by everyone but themselves.
+type relations struct {
+	blocked map[uuid.UUID]bool
+	muted   map[uuid.UUID]bool
+}
+
+type relationReader interface {
+	ListHiddenAuthors(ctx context.Context, blockerID uuid.UUID) ([]database.ListHiddenAuthorsRow, error)
+}
+
+// loadRelations returns the relations of viewer, which is uuid.Nil for anonymous requests
+func loadRelations(ctx context.Context, db relationReader, viewer uuid.UUID) (relations, error) {
+	r := relations{blocked: map[uuid.UUID]bool{}, muted: map[uuid.UUID]bool{}}
+
+	rows, err := db.ListHiddenAuthors(ctx, viewer)
+	if err != nil {
+		return relations{}, err
+	}
+
+	for _, row := range rows {
+		if row.Blocked {
+			r.blocked[row.UserID] = true
+		} else {
+			r.muted[row.UserID] = true
+		}
+	}
+	return r, nil
+}
+
+type relationStore interface {
+	GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error)
+	BlockUser(ctx context.Context, arg database.BlockUserParams) error
+	UnblockUser(ctx context.Context, arg database.UnblockUserParams) (int64, error)
+	ListBlockedUsers(ctx context.Context, blockerID uuid.UUID) ([]database.UserBlock, error)
+	MuteUser(ctx context.Context, arg database.MuteUserParams) error
+	UnmuteUser(ctx context.Context, arg database.UnmuteUserParams) (int64, error)
+	ListMutedUsers(ctx context.Context, muterID uuid.UUID) ([]database.UserMute, error)
+	tokenAuthenticator
+}
+
+// relationTarget authenticates the caller and resolves the user named in the path, who must
+// exist and must not be the caller
+func relationTarget(w http.ResponseWriter, req *http.Request, db relationStore, secret string) (caller, target uuid.UUID, ok bool) {
+	p, ok := requireAuth(w, req, db, secret, auth.ScopeRelationsWrite)
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	target, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		problem.Error(w, "could not parse user ID to uuid", http.StatusBadRequest)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	if target == p.UserID {
+		problem.Error(w, "you cannot block or mute yourself", http.StatusBadRequest)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	if _, err := db.GetUserByID(req.Context(), target); err != nil {
+		problem.Error(w, "user not found", http.StatusNotFound)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return p.UserID, target, true
+}
+
+// HandlerBlockUser blocks the user in the path. Blocking someone already blocked does nothing.
+func HandlerBlockUser(db relationStore, secret string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		caller, target, ok := relationTarget(w, req, db, secret)
+		if !ok {
+			return
+		}
+
+		if err := db.BlockUser(req.Context(), database.BlockUserParams{BlockerID: caller, BlockedID: target}); err != nil {
+			log.Printf("Error: could not save block of %v by %v: %v", target, caller, err)
+			problem.Error(w, "could not block user", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("User %v blocked %v", caller, target)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func HandlerUnblockUser(db relationStore, secret string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		caller, target, ok := relationTarget(w, req, db, secret)
+		if !ok {
+			return
+		}
+
+		removed, err := db.UnblockUser(req.Context(), database.UnblockUserParams{BlockerID: caller, BlockedID: target})
+		if err != nil {
+			log.Printf("Error: could not remove block of %v by %v: %v", target, caller, err)
+			problem.Error(w, "could not unblock user", http.StatusInternalServerError)
+			return
+		}
+		if removed == 0 {
+			problem.Error(w, "user is not blocked", http.StatusNotFound)
+			return
+		}
+
+		log.Printf("User %v unblocked %v", caller, target)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func HandlerListBlocks(db relationStore, secret string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		caller, ok := requireAuth(w, req, db, secret, auth.ScopeRelationsWrite)
+		if !ok {
+			return
+		}
+
+		blocks, err := db.ListBlockedUsers(req.Context(), caller.UserID)
+		if err != nil {
+			log.Printf("Error: could not list blocks of %v: %v", caller.UserID, err)
+			problem.Error(w, "could not list blocked users", http.StatusInternalServerError)
+			return
+		}
+
+		resp := []apiRelation{}
+		for _, b := range blocks {
+			resp = append(resp, apiRelation{UserID: b.BlockedID, CreatedAt: b.CreatedAt})
+		}
+
+		w.WriteHeader(http.StatusOK)
+		writeResponse(resp, w)
+	}
+}
+
+// HandlerMuteUser mutes the user in the path. Muting someone already muted does nothing.
+func HandlerMuteUser(db relationStore, secret string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		caller, target, ok := relationTarget(w, req, db, secret)
+		if !ok {
+			return
+		}
+
+		if err := db.MuteUser(req.Context(), database.MuteUserParams{MuterID: caller, MutedID: target}); err != nil {
+			log.Printf("Error: could not save mute of %v by %v: %v", target, caller, err)
+			problem.Error(w, "could not mute user", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("User %v muted %v", caller, target)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func HandlerUnmuteUser(db relationStore, secret string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		caller, target, ok := relationTarget(w, req, db, secret)
+		if !ok {
+			return
+		}
+
+		removed, err := db.UnmuteUser(req.Context(), database.UnmuteUserParams{MuterID: caller, MutedID: target})
+		if err != nil {
+			log.Printf("Error: could not remove mute of %v by %v: %v", target, caller, err)
+			problem.Error(w, "could not unmute user", http.StatusInternalServerError)
+			return
+		}
+		if removed == 0 {
+			problem.Error(w, "user is not muted", http.StatusNotFound)
+			return
+		}
+
+		log.Printf("User %v unmuted %v", caller, target)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func HandlerListMutes(db relationStore, secret string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		caller, ok := requireAuth(w, req, db, secret, auth.ScopeRelationsWrite)
+		if !ok {
+			return
+		}
+
+		mutes, err := db.ListMutedUsers(req.Context(), caller.UserID)
+		if err != nil {
+			log.Printf("Error: could not list mutes of %v: %v", caller.UserID, err)
+			problem.Error(w, "could not list muted users", http.StatusInternalServerError)
+			return
+		}
+
+		resp := []apiRelation{}
+		for _, m := range mutes {
+			resp = append(resp, apiRelation{UserID: m.MutedID, CreatedAt: m.CreatedAt})
+		}
+
+		w.WriteHeader(http.StatusOK)
+		writeResponse(resp, w)
+	}
+}
@@ -0,0 +1,114 @@
+package public
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/problem"
+	"github.com/google/uuid"
+)
+
+const (
+	maxReportCommentLength = 500
+
+	// filterReportCategory is used for reports filed by the content filter rather than a user
+	filterReportCategory = "filter"
+)
+
+// reportCategories are the reasons a chirp can be reported for
+var reportCategories = []string{"spam", "harassment", "hate", "violence", "sexual", "self_harm", "misinformation", "other"}
+
+type reportParams struct {
+	Category string `json:"category"`
+	Comment  string `json:"comment"`
+}
+
+type reportStore interface {
+	FetchChirpByID(ctx context.Context, id uuid.UUID) (database.Chirp, error)
+	OpenModerationCase(ctx context.Context, arg database.OpenModerationCaseParams) (database.ModerationCase, error)
+	CreateChirpReport(ctx context.Context, arg database.CreateChirpReportParams) (int64, error)
+	tokenAuthenticator
+}
+
+// HandlerReportChirp files a report about a chirp. Reports about the same chirp join a single open case in the
+// moderation queue, and a user reporting a chirp again while its case is open changes nothing.
+func HandlerReportChirp(db reportStore, secret string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		caller, ok := requireAuth(w, req, db, secret, auth.ScopeChirpsWrite)
+		if !ok {
+			return
+		}
+		userID := caller.UserID
+
+		chirpID, err := uuid.Parse(req.PathValue("chirpID"))
+		if err != nil {
+			problem.Error(w, "could not parse chirp ID to uuid", http.StatusBadRequest)
+			return
+		}
+
+		var params reportParams
+		if err := json.NewDecoder(req.Body).Decode(&params); err != nil {
+			problem.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if !slices.Contains(reportCategories, params.Category) {
+			problem.Error(w, fmt.Sprintf("category must be one of: %s", strings.Join(reportCategories, ", ")), http.StatusBadRequest)
+			return
+		}
+
+		params.Comment = strings.TrimSpace(params.Comment)
+		if utf8.RuneCountInString(params.Comment) > maxReportCommentLength {
+			problem.Error(w, fmt.Sprintf("comment must be at most %d characters", maxReportCommentLength), http.StatusBadRequest)
+			return
+		}
+
+		dbChirp, err := db.FetchChirpByID(req.Context(), chirpID)
+		if err != nil {
+			problem.Error(w, "could not fetch requested chirp", http.StatusNotFound)
+			return
+		}
+
+		if dbChirp.UserID == userID {
+			problem.Error(w, "you cannot report your own chirp", http.StatusBadRequest)
+			return
+		}
+
+		// the body is copied so moderators see what was reported even if the chirp is deleted first
+		modCase, err := db.OpenModerationCase(req.Context(), database.OpenModerationCaseParams{
+			ChirpID:       dbChirp.ID,
+			ChirpAuthorID: dbChirp.UserID,
+			ChirpBody:     dbChirp.Body,
+		})
+		if err != nil {
+			log.Printf("Error: could not open moderation case for chirp %v: %v", chirpID, err)
+			problem.Error(w, "could not save report", http.StatusInternalServerError)
+			return
+		}
+
+		added, err := db.CreateChirpReport(req.Context(), database.CreateChirpReportParams{
+			CaseID:     modCase.ID,
+			ReporterID: uuid.NullUUID{UUID: userID, Valid: true},
+			Category:   params.Category,
+			Comment:    params.Comment,
+		})
+		if err != nil {
+			log.Printf("Error: could not save report of chirp %v by %v: %v", chirpID, userID, err)
+			problem.Error(w, "could not save report", http.StatusInternalServerError)
+			return
+		}
+
+		if added > 0 {
+			log.Printf("User %v reported chirp %v for %s", userID, chirpID, params.Category)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
@@ -0,0 +1,141 @@
+package public
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/audit"
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/problem"
+)
+
+const (
+	sessionModeCookie = "cookie"
+
+	accessCookieName  = "chirpy_access"
+	refreshCookieName = "chirpy_refresh"
+	csrfCookieName    = "chirpy_csrf"
+	csrfHeaderName    = "X-CSRF-Token"
+
+	refreshTokenTTL = 60 * 24 * time.Hour
+)
+
+// SessionConfig controls the cookies set when a browser logs in with cookie sessions
+type SessionConfig struct {
+	// Secure should only be turned off for local development over plain http
+	Secure bool
+}
+
+func (s SessionConfig) cookie(name, value string, maxAge time.Duration, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: httpOnly,
+		Secure:   s.Secure,
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+// setSessionCookies stores the tokens where page scripts cannot read them. The CSRF token is the
+// exception: the app must read it to echo it back in the X-CSRF-Token header.
+func (s SessionConfig) setSessionCookies(w http.ResponseWriter, accessToken, refreshToken, secret string) {
+	http.SetCookie(w, s.cookie(accessCookieName, accessToken, auth.AccessTokenTTL, true))
+	http.SetCookie(w, s.cookie(refreshCookieName, refreshToken, refreshTokenTTL, true))
+	http.SetCookie(w, s.cookie(csrfCookieName, auth.MakeCSRFToken(refreshToken, secret), refreshTokenTTL, false))
+}
+
+func (s SessionConfig) clearSessionCookies(w http.ResponseWriter) {
+	for _, name := range []string{accessCookieName, refreshCookieName, csrfCookieName} {
+		cookie := s.cookie(name, "", 0, name != csrfCookieName)
+		cookie.MaxAge = -1
+		http.SetCookie(w, cookie)
+	}
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+type sessionStore interface {
+	GetRefreshToken(ctx context.Context, token string) (database.RefreshToken, error)
+}
+
+// MiddlewareCookieSession lets browsers authenticate to the API and admin pages with session cookies instead
+// of an Authorization header. It checks the CSRF token on state-changing requests, silently refreshes an
+// expired access token, and hands the request on with the access token as a bearer token, so
+// handlers never need to know which kind of session they are serving.
+func MiddlewareCookieSession(db sessionStore, secret string, sessions SessionConfig, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		cookiePath := strings.HasPrefix(req.URL.Path, "/api/") || strings.HasPrefix(req.URL.Path, "/admin/")
+		if !cookiePath || req.Header.Get("Authorization") != "" {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		refreshCookie, err := req.Cookie(refreshCookieName)
+		if err != nil {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		if !isSafeMethod(req.Method) {
+			csrfCookie, err := req.Cookie(csrfCookieName)
+			header := req.Header.Get(csrfHeaderName)
+			if err != nil || header == "" || header != csrfCookie.Value ||
+				!auth.ValidateCSRFToken(header, refreshCookie.Value, secret) {
+				problem.Write(w, problem.New(http.StatusForbidden, problem.CodeInvalidCSRF, "missing or invalid CSRF token"))
+				return
+			}
+		}
+
+		var accessToken string
+		if accessCookie, err := req.Cookie(accessCookieName); err == nil {
+			if _, err := auth.ValidateJWT(accessCookie.Value, secret); err == nil {
+				accessToken = accessCookie.Value
+			}
+		}
+
+		if accessToken == "" {
+			refreshToken, err := db.GetRefreshToken(req.Context(), refreshCookie.Value)
+			if err != nil || refreshToken.RevokedAt.Valid || refreshToken.ClientID.Valid || refreshToken.ExpiresAt.Before(time.Now()) {
+				sessions.clearSessionCookies(w)
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			accessToken, err = auth.MakeJWT(refreshToken.UserID, secret)
+			if err != nil {
+				log.Printf("Error: could not make JWT: %v", err)
+				problem.Error(w, "could not refresh session", http.StatusInternalServerError)
+				return
+			}
+			http.SetCookie(w, sessions.cookie(accessCookieName, accessToken, auth.AccessTokenTTL, true))
+		}
+
+		authed := req.Clone(req.Context())
+		authed.Header.Set("Authorization", "Bearer "+accessToken)
+		next.ServeHTTP(w, authed)
+	})
+}
+
+// HandlerLogout ends a cookie session, revoking its refresh token and clearing the cookies
+func HandlerLogout(db refreshTokenRevoker, sessions SessionConfig) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if refreshCookie, err := req.Cookie(refreshCookieName); err == nil {
+			if err := revokeRefreshToken(req.Context(), db, refreshCookie.Value, audit.ActionLogout); err != nil {
+				log.Printf("Error: could not revoke session refresh token: %v", err)
+				problem.Error(w, "could not revoke session", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		sessions.clearSessionCookies(w)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,93 @@
+package public
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/clientip"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/problem"
+)
+
+const lockedOutMsg = "too many failed attempts, try again later"
+
+// throttleStore persists failure counts in the database so lockouts hold across every server instance
+type throttleStore interface {
+	GetAuthThrottle(ctx context.Context, key string) (database.AuthThrottle, error)
+	RecordAuthFailure(ctx context.Context, key string) (int32, error)
+	LockAuthThrottle(ctx context.Context, arg database.LockAuthThrottleParams) error
+	ClearAuthThrottle(ctx context.Context, key string) error
+}
+
+type throttleKey struct {
+	key    string
+	policy auth.LockoutPolicy
+}
+
+func loginThrottleKeys(req *http.Request, email string) []throttleKey {
+	return []throttleKey{
+		{auth.LoginAccountThrottleKey(email), auth.AccountLockoutPolicy},
+		{auth.LoginIPThrottleKey(clientip.FromRequest(req)), auth.IPLockoutPolicy},
+	}
+}
+
+func magicLinkThrottleKeys(req *http.Request, email string) []throttleKey {
+	return []throttleKey{
+		{auth.MagicLinkEmailThrottleKey(email), auth.MagicLinkEmailPolicy},
+		{auth.MagicLinkIPThrottleKey(clientip.FromRequest(req)), auth.MagicLinkIPPolicy},
+	}
+}
+
+// lockedUntil reports the latest lock expiry across keys, if any of them is currently locked
+func lockedUntil(ctx context.Context, db throttleStore, keys []throttleKey) (time.Time, bool) {
+	var until time.Time
+	for _, k := range keys {
+		throttle, err := db.GetAuthThrottle(ctx, k.key)
+		if err != nil {
+			continue
+		}
+
+		if throttle.LockedUntil.Valid && throttle.LockedUntil.Time.After(until) {
+			until = throttle.LockedUntil.Time
+		}
+	}
+
+	return until, until.After(time.Now())
+}
+
+func recordFailure(ctx context.Context, db throttleStore, keys []throttleKey) {
+	for _, k := range keys {
+		failures, err := db.RecordAuthFailure(ctx, k.key)
+		if err != nil {
+			log.Printf("Error: could not record auth failure for %s: %v", k.key, err)
+			continue
+		}
+
+		lock := k.policy.LockDuration(int(failures))
+		if lock == 0 {
+			continue
+		}
+
+		if err := db.LockAuthThrottle(ctx, database.LockAuthThrottleParams{
+			Key:         k.key,
+			LockedUntil: sql.NullTime{Time: time.Now().Add(lock), Valid: true},
+		}); err != nil {
+			log.Printf("Error: could not lock %s: %v", k.key, err)
+			continue
+		}
+
+		log.Printf("Warning: %s locked for %v after %d failed attempts", k.key, lock, failures)
+	}
+}
+
+func writeLockedOut(w http.ResponseWriter, until time.Time) {
+	retryAfter := int(math.Ceil(time.Until(until).Seconds()))
+	w.Header().Set("Retry-After", fmt.Sprint(retryAfter))
+	problem.Write(w, problem.New(http.StatusTooManyRequests, problem.CodeLockedOut, lockedOutMsg))
+}
@@ -0,0 +1,219 @@
+package public
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/audit"
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/problem"
+	"github.com/google/uuid"
+)
+
+const maxTokenNameLength = 100
+
+type personalAccessTokenParams struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+type apiPersonalAccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	// Token is only ever returned once, when the token is created
+	Token string `json:"token,omitempty"`
+}
+
+func dbTokenToAPIToken(pat database.PersonalAccessToken) apiPersonalAccessToken {
+	return apiPersonalAccessToken{
+		ID:         pat.ID,
+		Name:       pat.Name,
+		Scopes:     pat.Scopes,
+		CreatedAt:  pat.CreatedAt,
+		ExpiresAt:  nullTimePtr(pat.ExpiresAt),
+		LastUsedAt: nullTimePtr(pat.LastUsedAt),
+		RevokedAt:  nullTimePtr(pat.RevokedAt),
+	}
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+type personalAccessTokenStore interface {
+	CreatePersonalAccessToken(ctx context.Context, arg database.CreatePersonalAccessTokenParams) (database.PersonalAccessToken, error)
+	ListPersonalAccessTokens(ctx context.Context, userID uuid.UUID) ([]database.PersonalAccessToken, error)
+	RevokePersonalAccessToken(ctx context.Context, arg database.RevokePersonalAccessTokenParams) (int64, error)
+	auditRecorder
+	userGetter
+}
+
+// HandlerCreatePersonalAccessToken, like the other token management handlers, only accepts a JWT from a real
+// login session. A personal access token can never be used to mint or revoke tokens.
+func HandlerCreatePersonalAccessToken(db personalAccessTokenStore, secret string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		token, err := auth.GetBearerToken(req.Header)
+		if err != nil {
+			problem.Error(w, "could not get bearer token from header", http.StatusUnauthorized)
+			return
+		}
+
+		userID, err := auth.ValidateJWT(token, secret)
+		if err != nil {
+			log.Printf("Error: could not validate JWT: %v", err)
+			problem.Error(w, "could not validate JWT", http.StatusUnauthorized)
+			return
+		}
+
+		if !requireUnrestricted(w, req, db, userID) {
+			return
+		}
+
+		var patReq personalAccessTokenParams
+		if err := json.NewDecoder(req.Body).Decode(&patReq); err != nil {
+			problem.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if patReq.Name == "" || len(patReq.Name) > maxTokenNameLength {
+			problem.Error(w, "token name must be between 1 and 100 characters", http.StatusBadRequest)
+			return
+		}
+
+		if len(patReq.Scopes) == 0 {
+			problem.Error(w, "at least one scope is required", http.StatusBadRequest)
+			return
+		}
+
+		for _, scope := range patReq.Scopes {
+			if !auth.ValidScope(scope) {
+				problem.Error(w, "unknown scope "+scope, http.StatusBadRequest)
+				return
+			}
+		}
+
+		if patReq.ExpiresInDays < 0 {
+			problem.Error(w, "expires_in_days cannot be negative", http.StatusBadRequest)
+			return
+		}
+
+		var expiresAt sql.NullTime
+		if patReq.ExpiresInDays > 0 {
+			expiresAt = sql.NullTime{Time: time.Now().AddDate(0, 0, patReq.ExpiresInDays), Valid: true}
+		}
+
+		rawToken := auth.MakePersonalAccessToken()
+		pat, err := db.CreatePersonalAccessToken(req.Context(), database.CreatePersonalAccessTokenParams{
+			UserID:    userID,
+			Name:      patReq.Name,
+			TokenHash: auth.HashToken(rawToken),
+			Scopes:    patReq.Scopes,
+			ExpiresAt: expiresAt,
+		})
+		if err != nil {
+			log.Printf("Error: could not create personal access token for user %v: %v", userID, err)
+			problem.Error(w, "could not create personal access token", http.StatusInternalServerError)
+			return
+		}
+
+		created := dbTokenToAPIToken(pat)
+		created.Token = rawToken
+
+		log.Printf("User %v created personal access token %v", userID, pat.ID)
+		w.WriteHeader(http.StatusCreated)
+		writeResponse(created, w)
+	}
+}
+
+func HandlerListPersonalAccessTokens(db personalAccessTokenStore, secret string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		token, err := auth.GetBearerToken(req.Header)
+		if err != nil {
+			problem.Error(w, "could not get bearer token from header", http.StatusUnauthorized)
+			return
+		}
+
+		userID, err := auth.ValidateJWT(token, secret)
+		if err != nil {
+			log.Printf("Error: could not validate JWT: %v", err)
+			problem.Error(w, "could not validate JWT", http.StatusUnauthorized)
+			return
+		}
+
+		dbTokens, err := db.ListPersonalAccessTokens(req.Context(), userID)
+		if err != nil {
+			log.Printf("Error: could not list personal access tokens for user %v: %v", userID, err)
+			problem.Error(w, "could not list personal access tokens", http.StatusInternalServerError)
+			return
+		}
+
+		tokens := []apiPersonalAccessToken{}
+		for _, pat := range dbTokens {
+			tokens = append(tokens, dbTokenToAPIToken(pat))
+		}
+
+		w.WriteHeader(http.StatusOK)
+		writeResponse(tokens, w)
+	}
+}
+
+func HandlerRevokePersonalAccessToken(db personalAccessTokenStore, secret string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		token, err := auth.GetBearerToken(req.Header)
+		if err != nil {
+			problem.Error(w, "could not get bearer token from header", http.StatusUnauthorized)
+			return
+		}
+
+		userID, err := auth.ValidateJWT(token, secret)
+		if err != nil {
+			log.Printf("Error: could not validate JWT: %v", err)
+			problem.Error(w, "could not validate JWT", http.StatusUnauthorized)
+			return
+		}
+
+		tokenID, err := uuid.Parse(req.PathValue("tokenID"))
+		if err != nil {
+			problem.Error(w, "could not parse token ID to uuid", http.StatusBadRequest)
+			return
+		}
+
+		event := audit.Event{ActorID: userID, Action: audit.ActionTokenRevoke, TargetType: audit.TargetPersonalToken, TargetID: tokenID.String()}
+		err = db.RecordAudit(req.Context(), event, func(ctx context.Context) error {
+			revoked, err := db.RevokePersonalAccessToken(ctx, database.RevokePersonalAccessTokenParams{
+				ID:     tokenID,
+				UserID: userID,
+			})
+			if err == nil && revoked == 0 {
+				return errNothingChanged
+			}
+			return err
+		})
+		if errors.Is(err, errNothingChanged) {
+			problem.Error(w, "could not find active personal access token", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error: could not revoke personal access token %v: %v", tokenID, err)
+			problem.Error(w, "could not revoke personal access token", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("User %v revoked personal access token %v", userID, tokenID)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,90 @@
+// Package ratelimit limits how often each user or client IP address can call a route, with a token
+// bucket per policy and caller
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/clientip"
+	"github.com/bailey4770/chirpy/internal/problem"
+)
+
+// Policy is the limit on one route or group of routes. A caller may make Limit requests at once, and
+// gets their tokens back evenly over Window.
+type Policy struct {
+	// Name keeps the buckets of different policies apart, so it must be unique
+	Name   string
+	Limit  int
+	Window time.Duration
+	// PerUser keys the bucket on the logged-in user, so users behind one address do not share a limit.
+	// Requests without a valid access token are keyed on their IP address, as every request is otherwise.
+	PerUser bool
+}
+
+// rate is the number of tokens returned to a bucket per second
+func (p Policy) rate() float64 {
+	return float64(p.Limit) / p.Window.Seconds()
+}
+
+// Store holds the buckets. Take refills the bucket for key, takes a token if a whole one is left, and
+// returns the tokens remaining.
+type Store interface {
+	Take(ctx context.Context, key string, p Policy) (tokens float64, allowed bool, err error)
+}
+
+// Limiter applies policies to requests
+type Limiter struct {
+	store  Store
+	secret string
+}
+
+func NewLimiter(store Store, secret string) *Limiter {
+	return &Limiter{store: store, secret: secret}
+}
+
+// key is the bucket a request draws from under p
+func (l *Limiter) key(req *http.Request, p Policy) string {
+	if p.PerUser {
+		if token, err := auth.GetBearerToken(req.Header); err == nil {
+			if accessToken, err := auth.ParseAccessToken(token, l.secret); err == nil {
+				return p.Name + ":user:" + accessToken.UserID.String()
+			}
+		}
+	}
+	return p.Name + ":ip:" + clientip.FromRequest(req)
+}
+
+// Middleware refuses requests to f beyond p with 429 Too Many Requests. Every response says how much
+// of the limit is left with the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers. If the
+// store fails, requests are let through rather than taking the route down with it.
+func (l *Limiter) Middleware(p Policy, f http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		tokens, allowed, err := l.store.Take(req.Context(), l.key(req, p), p)
+		if err != nil {
+			log.Printf("Error: could not check rate limit %s: %v", p.Name, err)
+			f(w, req)
+			return
+		}
+
+		// RateLimit-Reset is when the bucket will be full again
+		reset := math.Ceil((float64(p.Limit) - tokens) / p.rate())
+		w.Header().Set("RateLimit-Limit", fmt.Sprint(p.Limit))
+		w.Header().Set("RateLimit-Remaining", fmt.Sprint(int(math.Max(tokens, 0))))
+		w.Header().Set("RateLimit-Reset", fmt.Sprint(int(reset)))
+
+		if !allowed {
+			retryAfter := math.Ceil((1 - tokens) / p.rate())
+			w.Header().Set("Retry-After", fmt.Sprint(int(retryAfter)))
+			problem.Write(w, problem.New(http.StatusTooManyRequests, problem.CodeRateLimited, "too many requests, try again later"))
+			return
+		}
+
+		f(w, req)
+	})
+}
@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/problem"
+	"github.com/google/uuid"
+)
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	m := NewMemoryStore()
+	m.now = func() time.Time { return now }
+	p := Policy{Name: "test", Limit: 3, Window: 3 * time.Second}
+
+	for i := range 3 {
+		if _, allowed, _ := m.Take(context.Background(), "k", p); !allowed {
+			t.Fatalf("Fail: expected request %d of the burst to be allowed", i+1)
+		}
+	}
+	if tokens, allowed, _ := m.Take(context.Background(), "k", p); allowed || tokens != 0 {
+		t.Fatalf("Fail: expected an empty bucket to refuse, got %v tokens and allowed %v", tokens, allowed)
+	}
+	if _, allowed, _ := m.Take(context.Background(), "other", p); !allowed {
+		t.Fatal("Fail: expected another key to have its own bucket")
+	}
+
+	// one token comes back each second
+	now = now.Add(1500 * time.Millisecond)
+	if tokens, allowed, _ := m.Take(context.Background(), "k", p); !allowed || tokens != 0.5 {
+		t.Fatalf("Fail: expected a refilled token to be taken leaving 0.5, got %v tokens and allowed %v", tokens, allowed)
+	}
+
+	// buckets that have filled up again are forgotten
+	now = now.Add(time.Hour)
+	_, _, _ = m.Take(context.Background(), "k", p)
+	if len(m.buckets) != 1 {
+		t.Fatalf("Fail: expected idle buckets to be swept, have %d", len(m.buckets))
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, p Policy) (float64, bool, error) {
+	return 0, false, errors.New("connection refused")
+}
+
+func TestMiddleware(t *testing.T) {
+	const secret = "abcd"
+	p := Policy{Name: "chirps", Limit: 2, Window: time.Minute, PerUser: true}
+	l := NewLimiter(NewMemoryStore(), secret)
+	handler := l.Middleware(p, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	alice, bob := uuid.New(), uuid.New()
+	aliceToken, _ := auth.MakeJWT(alice, secret)
+	bobToken, _ := auth.MakeJWT(bob, secret)
+
+	send := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/chirps", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send(aliceToken); w.Code != http.StatusCreated || w.Header().Get("RateLimit-Remaining") != "1" || w.Header().Get("RateLimit-Limit") != "2" {
+		t.Fatalf("Fail: expected the first request through with 1 remaining, got %d and headers %v", w.Code, w.Header())
+	}
+	send(aliceToken)
+
+	w := send(aliceToken)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Fail: expected status 429 but received %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "30" || w.Header().Get("RateLimit-Reset") != "60" {
+		t.Fatalf("Fail: expected to retry after 30s and be full after 60s, got headers %v", w.Header())
+	}
+	var d problem.Details
+	if err := json.Unmarshal(w.Body.Bytes(), &d); err != nil || d.Code != problem.CodeRateLimited {
+		t.Fatalf("Fail: expected a %s problem, got %s", problem.CodeRateLimited, w.Body.String())
+	}
+
+	// users behind the same address have their own limits
+	if w := send(bobToken); w.Code != http.StatusCreated {
+		t.Fatalf("Fail: expected another user through, got %d", w.Code)
+	}
+
+	// without a valid token the address is limited, and a forged token does not escape it
+	send("")
+	send("")
+	if w := send("not-a-jwt"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Fail: expected an invalid token to share the address's limit, got %d", w.Code)
+	}
+
+	// a broken store lets requests through rather than failing them
+	w = httptest.NewRecorder()
+	NewLimiter(failingStore{}, secret).Middleware(p, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/chirps", nil))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Fail: expected requests through when the store fails, got %d", w.Code)
+	}
+}
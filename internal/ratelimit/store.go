@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/database"
+)
+
+// sweepInterval is how often MemoryStore forgets buckets that have filled up again
+const sweepInterval = time.Minute
+
+// take refills a bucket holding tokens for elapsed, then takes a token if a whole one is left
+func take(tokens float64, elapsed time.Duration, p Policy) (float64, bool) {
+	tokens = min(float64(p.Limit), tokens+elapsed.Seconds()*p.rate())
+	if tokens < 1 {
+		return tokens, false
+	}
+	return tokens - 1, true
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+	// fullAt is when the bucket will have refilled, after which it is the same as having none
+	fullAt time.Time
+}
+
+// MemoryStore keeps buckets in this process. Each replica of the server has its own, so a client
+// spread across several gets the limit from each.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+func (m *MemoryStore) Take(ctx context.Context, key string, p Policy) (float64, bool, error) {
+	now := m.now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.lastSweep) > sweepInterval {
+		for k, b := range m.buckets {
+			if now.After(b.fullAt) {
+				delete(m.buckets, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(p.Limit), updatedAt: now}
+		m.buckets[key] = b
+	}
+
+	tokens, allowed := take(b.tokens, now.Sub(b.updatedAt), p)
+	b.tokens, b.updatedAt = tokens, now
+	b.fullAt = now.Add(time.Duration((float64(p.Limit) - tokens) / p.rate() * float64(time.Second)))
+	return tokens, allowed, nil
+}
+
+type bucketTaker interface {
+	TakeRateLimitToken(ctx context.Context, arg database.TakeRateLimitTokenParams) (database.TakeRateLimitTokenRow, error)
+}
+
+// PostgresStore keeps buckets in the database, so every replica of the server shares them. Each request
+// costs one upsert.
+type PostgresStore struct {
+	db bucketTaker
+}
+
+func NewPostgresStore(db bucketTaker) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, p Policy) (float64, bool, error) {
+	row, err := s.db.TakeRateLimitToken(ctx, database.TakeRateLimitTokenParams{
+		Key:      key,
+		Capacity: float64(p.Limit),
+		Rate:     p.rate(),
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	return row.Tokens, row.Allowed, nil
+}
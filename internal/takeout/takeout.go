@@ -0,0 +1,301 @@
+// Package takeout builds the archive a user downloads when they ask for a copy of their data
+package takeout
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type Profile struct {
+	ID               uuid.UUID  `json:"id"`
+	Email            string     `json:"email"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	EmailVerified    bool       `json:"email_verified"`
+	IsChirpyRed      bool       `json:"is_chirpy_red"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	DeleteAfter      *time.Time `json:"delete_after,omitempty"`
+	DisplayName      string     `json:"display_name"`
+	Bio              string     `json:"bio"`
+	Location         string     `json:"location"`
+	Website          string     `json:"website"`
+	AvatarURL        string     `json:"avatar_url"`
+}
+
+type Chirp struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Body      string    `json:"body"`
+}
+
+// Session is a refresh token, without the token itself
+type Session struct {
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	ClientID  *uuid.UUID `json:"client_id,omitempty"`
+	Scopes    []string   `json:"scopes,omitempty"`
+}
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+type OAuthClient struct {
+	ID           uuid.UUID `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// SubscriptionEvent is a payment provider webhook about the user, such as a Chirpy Red upgrade
+type SubscriptionEvent struct {
+	ReceivedAt time.Time `json:"received_at"`
+	Source     string    `json:"source"`
+	Event      string    `json:"event"`
+	// StatusCode is how Chirpy answered, so an event that was not applied can be told apart
+	StatusCode int32  `json:"status_code"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Data is everything Chirpy holds about one user. Password hashes, TOTP secrets
+// and token values are deliberately left out.
+type Data struct {
+	GeneratedAt          time.Time
+	Profile              Profile
+	Chirps               []Chirp
+	Sessions             []Session
+	PersonalAccessTokens []PersonalAccessToken
+	OAuthClients         []OAuthClient
+	SubscriptionEvents   []SubscriptionEvent
+}
+
+type dataSource interface {
+	GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error)
+	ListChirpsForUser(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error)
+	ListRefreshTokensForUser(ctx context.Context, userID uuid.UUID) ([]database.RefreshToken, error)
+	ListPersonalAccessTokens(ctx context.Context, userID uuid.UUID) ([]database.PersonalAccessToken, error)
+	ListOAuthClients(ctx context.Context, ownerID uuid.UUID) ([]database.OauthClient, error)
+	ListWebhookDeliveriesForUser(ctx context.Context, userID uuid.NullUUID) ([]database.WebhookDelivery, error)
+}
+
+// Collect gathers a user's data, including chirps hidden while the account is pending deletion
+func Collect(ctx context.Context, db dataSource, userID uuid.UUID) (Data, error) {
+	dbUser, err := db.GetUserByID(ctx, userID)
+	if err != nil {
+		return Data{}, fmt.Errorf("could not get user: %v", err)
+	}
+
+	data := Data{
+		GeneratedAt: time.Now().UTC(),
+		Profile: Profile{
+			ID:               dbUser.ID,
+			Email:            dbUser.Email,
+			CreatedAt:        dbUser.CreatedAt,
+			UpdatedAt:        dbUser.UpdatedAt,
+			EmailVerified:    dbUser.EmailVerified,
+			IsChirpyRed:      dbUser.IsChirpyRed,
+			TwoFactorEnabled: dbUser.TotpEnabled,
+			DeleteAfter:      timePtr(dbUser.DeleteAfter),
+			DisplayName:      dbUser.DisplayName,
+			Bio:              dbUser.Bio,
+			Location:         dbUser.Location,
+			Website:          dbUser.Website,
+			AvatarURL:        dbUser.AvatarUrl,
+		},
+		Chirps:               []Chirp{},
+		Sessions:             []Session{},
+		PersonalAccessTokens: []PersonalAccessToken{},
+		OAuthClients:         []OAuthClient{},
+		SubscriptionEvents:   []SubscriptionEvent{},
+	}
+
+	chirps, err := db.ListChirpsForUser(ctx, userID)
+	if err != nil {
+		return Data{}, fmt.Errorf("could not list chirps: %v", err)
+	}
+	for _, c := range chirps {
+		data.Chirps = append(data.Chirps, Chirp{ID: c.ID, CreatedAt: c.CreatedAt, UpdatedAt: c.UpdatedAt, Body: c.Body})
+	}
+
+	refreshTokens, err := db.ListRefreshTokensForUser(ctx, userID)
+	if err != nil {
+		return Data{}, fmt.Errorf("could not list sessions: %v", err)
+	}
+	for _, rt := range refreshTokens {
+		session := Session{CreatedAt: rt.CreatedAt, ExpiresAt: rt.ExpiresAt, RevokedAt: timePtr(rt.RevokedAt), Scopes: rt.Scopes}
+		if rt.ClientID.Valid {
+			session.ClientID = &rt.ClientID.UUID
+		}
+		data.Sessions = append(data.Sessions, session)
+	}
+
+	pats, err := db.ListPersonalAccessTokens(ctx, userID)
+	if err != nil {
+		return Data{}, fmt.Errorf("could not list personal access tokens: %v", err)
+	}
+	for _, pat := range pats {
+		data.PersonalAccessTokens = append(data.PersonalAccessTokens, PersonalAccessToken{
+			ID:         pat.ID,
+			Name:       pat.Name,
+			Scopes:     pat.Scopes,
+			CreatedAt:  pat.CreatedAt,
+			ExpiresAt:  timePtr(pat.ExpiresAt),
+			LastUsedAt: timePtr(pat.LastUsedAt),
+			RevokedAt:  timePtr(pat.RevokedAt),
+		})
+	}
+
+	clients, err := db.ListOAuthClients(ctx, userID)
+	if err != nil {
+		return Data{}, fmt.Errorf("could not list oauth clients: %v", err)
+	}
+	for _, client := range clients {
+		data.OAuthClients = append(data.OAuthClients, OAuthClient{
+			ID:           client.ID,
+			Name:         client.Name,
+			RedirectURIs: client.RedirectUris,
+			Scopes:       client.Scopes,
+			CreatedAt:    client.CreatedAt,
+		})
+	}
+
+	deliveries, err := db.ListWebhookDeliveriesForUser(ctx, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		return Data{}, fmt.Errorf("could not list subscription events: %v", err)
+	}
+	for _, d := range deliveries {
+		data.SubscriptionEvents = append(data.SubscriptionEvents, SubscriptionEvent{
+			ReceivedAt: d.ReceivedAt,
+			Source:     d.Source,
+			Event:      d.Event,
+			StatusCode: d.StatusCode,
+			Error:      d.Error,
+		})
+	}
+
+	return data, nil
+}
+
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+var indexPage = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+  <head><meta charset="utf-8"><title>Your Chirpy data</title></head>
+  <body>
+    <h1>Your Chirpy data</h1>
+    <p>Exported {{.GeneratedAt.Format "2 January 2006 15:04 MST"}}. The JSON files in this archive hold the same data in machine-readable form.</p>
+
+    <h2>Profile</h2>
+    <table>
+      <tr><th>Email</th><td>{{.Profile.Email}}</td></tr>
+      <tr><th>Display name</th><td>{{.Profile.DisplayName}}</td></tr>
+      <tr><th>Bio</th><td>{{.Profile.Bio}}</td></tr>
+      <tr><th>Location</th><td>{{.Profile.Location}}</td></tr>
+      <tr><th>Website</th><td>{{.Profile.Website}}</td></tr>
+      <tr><th>Avatar</th><td>{{.Profile.AvatarURL}}</td></tr>
+      <tr><th>Joined</th><td>{{.Profile.CreatedAt.Format "2 January 2006"}}</td></tr>
+      <tr><th>Email verified</th><td>{{.Profile.EmailVerified}}</td></tr>
+      <tr><th>Chirpy Red</th><td>{{.Profile.IsChirpyRed}}</td></tr>
+      <tr><th>Two-factor authentication</th><td>{{.Profile.TwoFactorEnabled}}</td></tr>
+      {{with .Profile.DeleteAfter}}<tr><th>Scheduled for deletion</th><td>{{.Format "2 January 2006"}}</td></tr>{{end}}
+    </table>
+
+    <h2>Chirps ({{len .Chirps}}) <small><a href="chirps.json">chirps.json</a></small></h2>
+    {{range .Chirps}}<p><time>{{.CreatedAt.Format "2006-01-02 15:04"}}</time> {{.Body}}</p>
+    {{else}}<p>No chirps.</p>{{end}}
+
+    <h2>Sessions ({{len .Sessions}}) <small><a href="sessions.json">sessions.json</a></small></h2>
+    <table>
+      <tr><th>Started</th><th>Expires</th><th>Revoked</th><th>App</th></tr>
+      {{range .Sessions}}<tr><td>{{.CreatedAt.Format "2006-01-02 15:04"}}</td><td>{{.ExpiresAt.Format "2006-01-02 15:04"}}</td><td>{{with .RevokedAt}}{{.Format "2006-01-02 15:04"}}{{end}}</td><td>{{with .ClientID}}{{.}}{{else}}Chirpy{{end}}</td></tr>
+      {{end}}
+    </table>
+
+    <h2>Personal access tokens ({{len .PersonalAccessTokens}}) <small><a href="personal_access_tokens.json">personal_access_tokens.json</a></small></h2>
+    <ul>
+      {{range .PersonalAccessTokens}}<li>{{.Name}} ({{range $i, $s := .Scopes}}{{if $i}}, {{end}}{{$s}}{{end}}), created {{.CreatedAt.Format "2006-01-02"}}{{with .RevokedAt}}, revoked {{.Format "2006-01-02"}}{{end}}</li>
+      {{end}}
+    </ul>
+
+    <h2>OAuth apps you registered ({{len .OAuthClients}}) <small><a href="oauth_clients.json">oauth_clients.json</a></small></h2>
+    <ul>
+      {{range .OAuthClients}}<li>{{.Name}}, created {{.CreatedAt.Format "2006-01-02"}}</li>
+      {{end}}
+    </ul>
+
+    <h2>Subscription events ({{len .SubscriptionEvents}}) <small><a href="subscription_events.json">subscription_events.json</a></small></h2>
+    <table>
+      <tr><th>Received</th><th>From</th><th>Event</th><th>Status</th></tr>
+      {{range .SubscriptionEvents}}<tr><td>{{.ReceivedAt.Format "2006-01-02 15:04"}}</td><td>{{.Source}}</td><td>{{.Event}}</td><td>{{.StatusCode}}{{with .Error}} ({{.}}){{end}}</td></tr>
+      {{end}}
+    </table>
+  </body>
+</html>
+`))
+
+// Build writes data as a ZIP of JSON files with an index.html that can be opened in a browser
+func Build(data Data) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	files := []struct {
+		name string
+		v    any
+	}{
+		{"profile.json", data.Profile},
+		{"chirps.json", data.Chirps},
+		{"sessions.json", data.Sessions},
+		{"personal_access_tokens.json", data.PersonalAccessTokens},
+		{"oauth_clients.json", data.OAuthClients},
+		{"subscription_events.json", data.SubscriptionEvents},
+	}
+
+	for _, file := range files {
+		f, err := zw.Create(file.name)
+		if err != nil {
+			return nil, fmt.Errorf("could not add %s to archive: %v", file.name, err)
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(file.v); err != nil {
+			return nil, fmt.Errorf("could not write %s: %v", file.name, err)
+		}
+	}
+
+	f, err := zw.Create("index.html")
+	if err != nil {
+		return nil, fmt.Errorf("could not add index.html to archive: %v", err)
+	}
+	if err := indexPage.Execute(f, data); err != nil {
+		return nil, fmt.Errorf("could not render index.html: %v", err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("could not finish archive: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
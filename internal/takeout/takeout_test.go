@@ -0,0 +1,127 @@
+package takeout
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestBuild(t *testing.T) {
+	data := Data{
+		GeneratedAt: time.Now(),
+		Profile:     Profile{ID: uuid.New(), Email: "user@test.com", CreatedAt: time.Now()},
+		Chirps: []Chirp{
+			{ID: uuid.New(), CreatedAt: time.Now(), Body: "hello world"},
+			{ID: uuid.New(), CreatedAt: time.Now(), Body: "<script>alert(1)</script>"},
+		},
+		Sessions:             []Session{{CreatedAt: time.Now(), ExpiresAt: time.Now()}},
+		PersonalAccessTokens: []PersonalAccessToken{},
+		OAuthClients:         []OAuthClient{},
+		SubscriptionEvents:   []SubscriptionEvent{{ReceivedAt: time.Now(), Source: "polka", Event: "user.upgraded", StatusCode: 204}},
+	}
+
+	archive, err := Build(data)
+	if err != nil {
+		t.Fatalf("Error: could not build archive: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("Fail: archive is not a valid zip: %v", err)
+	}
+
+	contents := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Error: could not open %s: %v", f.Name, err)
+		}
+		b, _ := io.ReadAll(rc)
+		_ = rc.Close()
+		contents[f.Name] = string(b)
+	}
+
+	for _, name := range []string{"index.html", "profile.json", "chirps.json", "sessions.json", "personal_access_tokens.json", "oauth_clients.json", "subscription_events.json"} {
+		if _, ok := contents[name]; !ok {
+			t.Fatalf("Fail: archive is missing %s", name)
+		}
+	}
+
+	var chirps []Chirp
+	if err := json.Unmarshal([]byte(contents["chirps.json"]), &chirps); err != nil || len(chirps) != 2 {
+		t.Fatalf("Fail: expected 2 chirps in chirps.json, got %d: %v", len(chirps), err)
+	}
+
+	index := contents["index.html"]
+	if !strings.Contains(index, "hello world") || !strings.Contains(index, "user@test.com") || !strings.Contains(index, "user.upgraded") {
+		t.Fatal("Fail: index.html is missing the user's data")
+	}
+	if strings.Contains(index, "<script>") {
+		t.Fatal("Fail: chirp bodies must be escaped in index.html")
+	}
+}
+
+type mockDataSource struct {
+	user       database.User
+	deliveries []database.WebhookDelivery
+}
+
+func (m *mockDataSource) GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error) {
+	return m.user, nil
+}
+
+func (m *mockDataSource) ListChirpsForUser(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error) {
+	return nil, nil
+}
+
+func (m *mockDataSource) ListRefreshTokensForUser(ctx context.Context, userID uuid.UUID) ([]database.RefreshToken, error) {
+	return nil, nil
+}
+
+func (m *mockDataSource) ListPersonalAccessTokens(ctx context.Context, userID uuid.UUID) ([]database.PersonalAccessToken, error) {
+	return nil, nil
+}
+
+func (m *mockDataSource) ListOAuthClients(ctx context.Context, ownerID uuid.UUID) ([]database.OauthClient, error) {
+	return nil, nil
+}
+
+func (m *mockDataSource) ListWebhookDeliveriesForUser(ctx context.Context, userID uuid.NullUUID) ([]database.WebhookDelivery, error) {
+	var deliveries []database.WebhookDelivery
+	for _, d := range m.deliveries {
+		if d.UserID == userID {
+			deliveries = append(deliveries, d)
+		}
+	}
+	return deliveries, nil
+}
+
+func TestCollectSubscriptionEvents(t *testing.T) {
+	user := database.User{ID: uuid.New(), Email: "user@test.com", IsChirpyRed: true}
+	db := &mockDataSource{
+		user: user,
+		deliveries: []database.WebhookDelivery{
+			{ReceivedAt: time.Now(), Source: "polka", Event: "user.upgraded", UserID: uuid.NullUUID{UUID: user.ID, Valid: true}, StatusCode: 204},
+			{ReceivedAt: time.Now(), Source: "polka", Event: "user.upgraded", UserID: uuid.NullUUID{UUID: uuid.New(), Valid: true}, StatusCode: 204},
+			{ReceivedAt: time.Now(), Source: "polka", Event: "user.upgraded", StatusCode: 404, Error: "no such user"},
+		},
+	}
+
+	data, err := Collect(context.Background(), db, user.ID)
+	if err != nil {
+		t.Fatalf("Error: could not collect data: %v", err)
+	}
+
+	expected := []SubscriptionEvent{{ReceivedAt: db.deliveries[0].ReceivedAt, Source: "polka", Event: "user.upgraded", StatusCode: 204}}
+	if len(data.SubscriptionEvents) != 1 || data.SubscriptionEvents[0] != expected[0] {
+		t.Fatalf("Fail: expected only the user's own subscription events %+v, got %+v", expected, data.SubscriptionEvents)
+	}
+}
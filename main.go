@@ -1,16 +1,33 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/alexedwards/argon2id"
 	"github.com/bailey4770/chirpy/internal/admin"
+	"github.com/bailey4770/chirpy/internal/analytics"
+	"github.com/bailey4770/chirpy/internal/audit"
+	"github.com/bailey4770/chirpy/internal/auth"
+	"github.com/bailey4770/chirpy/internal/blob"
+	"github.com/bailey4770/chirpy/internal/clientip"
 	"github.com/bailey4770/chirpy/internal/config"
-	"github.com/bailey4770/chirpy/internal/database"
+	"github.com/bailey4770/chirpy/internal/filter"
+	"github.com/bailey4770/chirpy/internal/jobs"
+	"github.com/bailey4770/chirpy/internal/mailer"
+	"github.com/bailey4770/chirpy/internal/password"
 	"github.com/bailey4770/chirpy/internal/public"
+	"github.com/bailey4770/chirpy/internal/ratelimit"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
@@ -18,29 +35,115 @@ import (
 const (
 	filepathRoot = "./static/"
 	port         = "8080"
+
+	purgeInterval = time.Hour
+	// uploads not attached to a chirp within this long are deleted
+	detachedMediaMaxAge = 24 * time.Hour
+	// how soon a filter rule changed through another instance applies to this one
+	filterReloadInterval = 30 * time.Second
+
+	// page views and API requests are counted in memory and written this often
+	analyticsFlushInterval   = 10 * time.Second
+	minuteAnalyticsRetention = 48 * time.Hour
+	hourAnalyticsRetention   = 90 * 24 * time.Hour
+	// how long requests in flight, and the last analytics flush, have to finish on shutdown
+	shutdownTimeout = 10 * time.Second
+	// longer than any rate limit window, so a bucket unused this long is full and can be forgotten
+	rateLimitBucketMaxIdle = 24 * time.Hour
+)
+
+// rate limits. Policies with the same name share a bucket, so the login routes draw from one limit.
+var (
+	loginLimit  = ratelimit.Policy{Name: "login", Limit: 10, Window: time.Minute}
+	signupLimit = ratelimit.Policy{Name: "signup", Limit: 5, Window: time.Hour}
+	// routes that send email
+	emailLimit  = ratelimit.Policy{Name: "email", Limit: 5, Window: time.Hour, PerUser: true}
+	tokenLimit  = ratelimit.Policy{Name: "tokens", Limit: 30, Window: time.Minute}
+	chirpLimit  = ratelimit.Policy{Name: "chirps", Limit: 30, Window: time.Minute, PerUser: true}
+	uploadLimit = ratelimit.Policy{Name: "uploads", Limit: 20, Window: time.Minute, PerUser: true}
+	reportLimit = ratelimit.Policy{Name: "reports", Limit: 10, Window: time.Minute, PerUser: true}
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "calibrate-hash" {
+		if err := calibrateHash(); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		return
+	}
+
 	db, err := connectDB()
 	if err != nil {
 		log.Fatalf("Error: %v", err)
 	}
 	defer func() { _ = db.Close() }()
 
-	cfg, adminState := loadConfigs(db)
+	cfg, adminState, err := loadConfigs(db)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	go jobs.PurgeDeletedAccounts(context.Background(), cfg.DB, cfg.Blobs, purgeInterval)
+	go jobs.PurgeExpiredExports(context.Background(), cfg.DB, purgeInterval)
+	go jobs.PurgeDetachedMedia(context.Background(), cfg.DB, cfg.Blobs, detachedMediaMaxAge, purgeInterval)
+	go jobs.ReloadFilterRules(context.Background(), cfg.DB, cfg.Filter, filterReloadInterval)
+	go jobs.PruneAnalytics(context.Background(), cfg.DB, minuteAnalyticsRetention, hourAnalyticsRetention, purgeInterval)
+	go jobs.PruneRateLimitBuckets(context.Background(), cfg.DB, rateLimitBucketMaxIdle, purgeInterval)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	recorder := analytics.NewRecorder(cfg.DB)
+	go recorder.Run(ctx, analyticsFlushInterval)
+	impressions := analytics.NewImpressions(cfg.DB)
+	go impressions.Run(ctx, analyticsFlushInterval)
+	background := jobs.NewBackground(ctx)
+	adminState.Background = background
 
 	mux := http.NewServeMux()
-	registerRoutes(mux, cfg, adminState)
+	registerRoutes(mux, cfg, adminState, recorder, impressions, background)
 
 	server := &http.Server{
-		Handler: mux,
-		Addr:    ":" + port,
+		Handler: clientip.Middleware(cfg.ClientIPs,
+			audit.MiddlewareRequestID(
+				public.MiddlewareCookieSession(cfg.DB, cfg.Secret, sessionConfig(cfg),
+					public.MiddlewareSuspension(cfg.DB, cfg.Secret,
+						public.MiddlewareImpersonation(cfg.DB, cfg.Secret,
+							analytics.MiddlewareAPIUsage(recorder, mux),
+						),
+					),
+				),
+			),
+		),
+		Addr: ":" + port,
 	}
 
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Error: could not shut down gracefully: %v", err)
+		}
+	}()
+
 	log.Printf("Serving files from %s on port %s\n", filepathRoot, port)
-	if err := server.ListenAndServe(); err != nil {
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("Error: could not start listen and serve: %v", err)
 	}
+
+	// counts recorded since the last flush would otherwise be lost
+	flushCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := recorder.Flush(flushCtx); err != nil {
+		log.Printf("Error: could not flush analytics on shutdown: %v", err)
+	}
+	if err := impressions.Flush(flushCtx); err != nil {
+		log.Printf("Error: could not flush chirp impressions on shutdown: %v", err)
+	}
+	if err := background.Wait(flushCtx); err != nil {
+		log.Printf("Error: background tasks did not finish on shutdown: %v", err)
+	}
 }
 
 func connectDB() (*sql.DB, error) {
@@ -51,7 +154,7 @@ func connectDB() (*sql.DB, error) {
 	dbURL := os.Getenv("DB_URL")
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
-		return nil, fmt.Errorf("could not open SQL databse: %v", err)
+		return nil, fmt.Errorf("could not open SQL database: %v", err)
 	}
 
 	if err := db.Ping(); err != nil {
@@ -61,42 +164,286 @@ func connectDB() (*sql.DB, error) {
 	return db, nil
 }
 
-func loadConfigs(db *sql.DB) (*config.APIConfig, *admin.State) {
-	dbQueries := database.New(db)
+func loadConfigs(db *sql.DB) (*config.APIConfig, *admin.State, error) {
+	store := audit.NewStore(db)
 
-	cfg := &config.APIConfig{DB: dbQueries}
+	cfg := &config.APIConfig{DB: store}
 	cfg.Secret = os.Getenv("SECRET")
 	cfg.PolkaKey = os.Getenv("POLKA_KEY")
+	cfg.RequireVerifiedEmail = os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true"
+	cfg.SecureCookies = os.Getenv("COOKIE_SECURE") != "false"
+
+	cfg.AppBaseURL = os.Getenv("APP_BASE_URL")
+	if cfg.AppBaseURL == "" {
+		cfg.AppBaseURL = "http://localhost:" + port + "/app"
+	}
+
+	cfg.APIBaseURL = os.Getenv("API_BASE_URL")
+	if cfg.APIBaseURL == "" {
+		cfg.APIBaseURL = "http://localhost:" + port
+	}
+
+	mail, err := mailer.New(
+		os.Getenv("MAILER"),
+		mailer.SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		},
+		os.Getenv("MAIL_DIR"),
+		os.Getenv("MAIL_FROM"),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not configure mailer: %v", err)
+	}
+	cfg.Mailer = mail
 
-	adminState := &admin.State{DB: dbQueries}
-	if os.Getenv("PLATFORM") == "dev" {
+	cfg.AccountDeletionGrace = 30 * 24 * time.Hour
+	if v := os.Getenv("ACCOUNT_DELETION_GRACE_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 {
+			return nil, nil, fmt.Errorf("invalid ACCOUNT_DELETION_GRACE_DAYS: %q", v)
+		}
+		cfg.AccountDeletionGrace = time.Duration(days) * 24 * time.Hour
+	}
+
+	mediaDir := os.Getenv("MEDIA_DIR")
+	if mediaDir == "" {
+		mediaDir = "./media"
+	}
+	if cfg.Blobs, err = blob.NewLocalStore(mediaDir); err != nil {
+		return nil, nil, err
+	}
+
+	cfg.MaxChirpMedia = 4
+	if v := os.Getenv("CHIRP_MAX_MEDIA"); v != "" {
+		if cfg.MaxChirpMedia, err = strconv.Atoi(v); err != nil || cfg.MaxChirpMedia < 0 {
+			return nil, nil, fmt.Errorf("invalid CHIRP_MAX_MEDIA: %q", v)
+		}
+	}
+
+	cfg.Filter = filter.NewEngine(filter.DefaultRules)
+
+	proxies, err := clientip.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg.ClientIPs = clientip.NewResolver(proxies)
+
+	var rateLimitStore ratelimit.Store
+	switch v := os.Getenv("RATE_LIMIT_STORE"); v {
+	case "", "memory":
+		rateLimitStore = ratelimit.NewMemoryStore()
+	case "postgres":
+		rateLimitStore = ratelimit.NewPostgresStore(store)
+	default:
+		return nil, nil, fmt.Errorf("invalid RATE_LIMIT_STORE: %q", v)
+	}
+	cfg.RateLimiter = ratelimit.NewLimiter(rateLimitStore, cfg.Secret)
+
+	if err := loadHashParams(); err != nil {
+		return nil, nil, err
+	}
+
+	cfg.PasswordPolicy = password.DefaultPolicy()
+	if v := os.Getenv("PASSWORD_MIN_LENGTH"); v != "" {
+		if cfg.PasswordPolicy.MinLength, err = strconv.Atoi(v); err != nil {
+			return nil, nil, fmt.Errorf("invalid PASSWORD_MIN_LENGTH: %v", err)
+		}
+	}
+	if v := os.Getenv("PASSWORD_MIN_SCORE"); v != "" {
+		if cfg.PasswordPolicy.MinScore, err = strconv.Atoi(v); err != nil {
+			return nil, nil, fmt.Errorf("invalid PASSWORD_MIN_SCORE: %v", err)
+		}
+	}
+	if os.Getenv("PASSWORD_CHECK_BREACHED") == "false" {
+		cfg.PasswordPolicy.Breached = nil
+	}
+
+	adminState := &admin.State{DB: store, Secret: cfg.Secret, Mailer: cfg.Mailer, Filter: cfg.Filter, Blobs: cfg.Blobs}
+	adminState.Platform = os.Getenv("PLATFORM")
+	for domain := range strings.SplitSeq(os.Getenv("TEST_TENANT_DOMAINS"), ",") {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			adminState.TestTenantDomains = append(adminState.TestTenantDomains, domain)
+		}
+	}
+	if adminState.Platform == admin.PlatformDev {
 		adminState.IsAdmin = true
 	}
 
-	return cfg, adminState
+	return cfg, adminState, nil
 }
 
-func registerRoutes(mux *http.ServeMux, cfg *config.APIConfig, adminState *admin.State) {
+// hashParamsFromEnv reads argon2id cost settings from the environment, starting from the defaults
+func hashParamsFromEnv() (argon2id.Params, error) {
+	params := *argon2id.DefaultParams
+
+	envUint := func(name string, bits int, dst func(uint64)) error {
+		v := os.Getenv(name)
+		if v == "" {
+			return nil
+		}
+		n, err := strconv.ParseUint(v, 10, bits)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", name, err)
+		}
+		// argon2 panics on a zero cost
+		if n == 0 {
+			return fmt.Errorf("invalid %s: must be at least 1", name)
+		}
+		dst(n)
+		return nil
+	}
+
+	if err := envUint("ARGON2_MEMORY_KIB", 32, func(n uint64) { params.Memory = uint32(n) }); err != nil {
+		return params, err
+	}
+	if err := envUint("ARGON2_ITERATIONS", 32, func(n uint64) { params.Iterations = uint32(n) }); err != nil {
+		return params, err
+	}
+	if err := envUint("ARGON2_PARALLELISM", 8, func(n uint64) { params.Parallelism = uint8(n) }); err != nil {
+		return params, err
+	}
+	return params, nil
+}
+
+// loadHashParams applies argon2id cost settings from the environment. The iteration count is never
+// calibrated at startup, since replicas on different machines would pick different ones and rehash
+// each other's users on every login. Run calibrate-hash once and pin the result instead.
+func loadHashParams() error {
+	params, err := hashParamsFromEnv()
+	if err != nil {
+		return err
+	}
+
+	if os.Getenv("ARGON2_TARGET_MS") != "" {
+		log.Printf("Warning: ARGON2_TARGET_MS is ignored by the server; run calibrate-hash and set ARGON2_ITERATIONS")
+	}
+
+	log.Printf("Hashing passwords with argon2id m=%d t=%d p=%d", params.Memory, params.Iterations, params.Parallelism)
+	auth.SetHashParams(&params)
+	return nil
+}
+
+// calibrateHash benchmarks argon2id on this machine at ARGON2_MEMORY_KIB and ARGON2_PARALLELISM, and
+// prints the iteration count that makes one hash take at least ARGON2_TARGET_MS
+func calibrateHash() error {
+	_ = godotenv.Load()
+
+	params, err := hashParamsFromEnv()
+	if err != nil {
+		return err
+	}
+
+	targetMS, err := strconv.ParseUint(os.Getenv("ARGON2_TARGET_MS"), 10, 32)
+	if err != nil || targetMS == 0 {
+		return fmt.Errorf("invalid ARGON2_TARGET_MS: %q", os.Getenv("ARGON2_TARGET_MS"))
+	}
+
+	calibrated, err := auth.CalibrateHashParams(time.Duration(targetMS)*time.Millisecond, params.Memory, params.Parallelism)
+	if err != nil {
+		return fmt.Errorf("could not calibrate argon2id params: %v", err)
+	}
+
+	fmt.Printf("ARGON2_MEMORY_KIB=%d\nARGON2_ITERATIONS=%d\nARGON2_PARALLELISM=%d\n",
+		calibrated.Memory, calibrated.Iterations, calibrated.Parallelism)
+	return nil
+}
+
+func sessionConfig(cfg *config.APIConfig) public.SessionConfig {
+	return public.SessionConfig{Secure: cfg.SecureCookies}
+}
+
+func registerRoutes(mux *http.ServeMux, cfg *config.APIConfig, adminState *admin.State, recorder *analytics.Recorder, impressions *analytics.Impressions, background *jobs.Background) {
+	mail := public.MailConfig{Mailer: cfg.Mailer, AppBaseURL: cfg.AppBaseURL, APIBaseURL: cfg.APIBaseURL, Background: background}
+	sessions := sessionConfig(cfg)
+	chirpPolicy := public.ChirpPolicy{RequireVerifiedEmail: cfg.RequireVerifiedEmail, MaxMedia: cfg.MaxChirpMedia, Filter: cfg.Filter}
+	limit := cfg.RateLimiter.Middleware
+
 	mux.Handle("/app/",
-		adminState.MiddlewareMetricsInc(
+		analytics.MiddlewarePageViews(recorder,
 			http.StripPrefix("/app/", http.FileServer(http.Dir(filepathRoot))),
 		),
 	)
 
 	mux.HandleFunc("GET /api/healthz", public.HandlerHealth)
 
-	mux.HandleFunc("GET /api/chirps", public.HandlerFetchChirpsByAge(cfg.DB))
-	mux.HandleFunc("GET /api/chirps/{chirpID}", public.HandlerFetchChirpByID(cfg.DB))
-	mux.HandleFunc("POST /api/chirps", public.HandlerPostChirp(cfg.DB, cfg.Secret))
+	mux.HandleFunc("GET /api/chirps", public.HandlerFetchChirpsByAge(cfg.DB, cfg.Secret, impressions))
+	mux.HandleFunc("GET /api/chirps/{chirpID}", public.HandlerFetchChirpByID(cfg.DB, cfg.Secret, impressions))
+	mux.Handle("POST /api/chirps", limit(chirpLimit, public.HandlerPostChirp(cfg.DB, cfg.Secret, chirpPolicy)))
 	mux.HandleFunc("DELETE /api/chirps/{chirpID}", public.HandlerDeleteChirp(cfg.DB, cfg.Secret))
+	mux.Handle("POST /api/chirps/{chirpID}/report", limit(reportLimit, public.HandlerReportChirp(cfg.DB, cfg.Secret)))
+	mux.Handle("POST /api/media", limit(uploadLimit, public.HandlerUploadMedia(cfg.DB, cfg.Blobs, cfg.Secret)))
+	mux.HandleFunc("GET /api/media/{mediaID}/{variant}", public.HandlerServeMedia(cfg.DB, cfg.Blobs, cfg.Secret))
 
-	mux.HandleFunc("POST /api/users", public.HandlerCreateUser(cfg.DB))
-	mux.HandleFunc("PUT /api/users", public.HandlerUpdateEmailAndPassword(cfg.DB, cfg.Secret))
-	mux.HandleFunc("POST /api/login", public.HandlerLogin(cfg.DB, cfg.Secret))
-	mux.HandleFunc("POST /api/refresh", public.HandlerRefresh(cfg.DB, cfg.Secret))
+	mux.Handle("POST /api/users", limit(signupLimit, public.HandlerCreateUser(cfg.DB, mail, cfg.PasswordPolicy)))
+	mux.Handle("POST /api/users/me/verification", limit(emailLimit, public.HandlerRequestEmailVerification(cfg.DB, cfg.Secret, mail)))
+	mux.HandleFunc("POST /api/users/verify", public.HandlerVerifyEmail(cfg.DB))
+	mux.Handle("POST /api/password-reset/request", limit(emailLimit, public.HandlerRequestPasswordReset(cfg.DB, mail)))
+	mux.Handle("POST /api/password-reset", limit(loginLimit, public.HandlerResetPassword(cfg.DB, cfg.PasswordPolicy)))
+	mux.HandleFunc("PUT /api/users", public.HandlerUpdateEmailAndPassword(cfg.DB, cfg.Secret, cfg.PasswordPolicy))
+	mux.HandleFunc("GET /api/users/{userID}", public.HandlerGetProfile(cfg.DB))
+	mux.HandleFunc("PATCH /api/users/me", public.HandlerUpdateProfile(cfg.DB, cfg.Secret))
+	mux.HandleFunc("DELETE /api/users/me", public.HandlerDeleteAccount(cfg.DB, cfg.Secret, sessions, cfg.AccountDeletionGrace))
+	mux.HandleFunc("GET /api/users/me/analytics", public.HandlerGetMyAnalytics(cfg.DB, cfg.Secret))
+	mux.Handle("POST /api/users/me/exports", limit(emailLimit, public.HandlerRequestDataExport(cfg.DB, cfg.Secret, mail)))
+	mux.HandleFunc("GET /api/users/me/exports/{exportID}", public.HandlerGetDataExport(cfg.DB, cfg.Secret, mail))
+	mux.HandleFunc("GET /api/exports/{exportID}/download", public.HandlerDownloadDataExport(cfg.DB, cfg.Secret))
+	mux.HandleFunc("GET /api/users/me/blocks", public.HandlerListBlocks(cfg.DB, cfg.Secret))
+	mux.HandleFunc("PUT /api/users/me/blocks/{userID}", public.HandlerBlockUser(cfg.DB, cfg.Secret))
+	mux.HandleFunc("DELETE /api/users/me/blocks/{userID}", public.HandlerUnblockUser(cfg.DB, cfg.Secret))
+	mux.HandleFunc("GET /api/users/me/mutes", public.HandlerListMutes(cfg.DB, cfg.Secret))
+	mux.HandleFunc("PUT /api/users/me/mutes/{userID}", public.HandlerMuteUser(cfg.DB, cfg.Secret))
+	mux.HandleFunc("DELETE /api/users/me/mutes/{userID}", public.HandlerUnmuteUser(cfg.DB, cfg.Secret))
+	mux.HandleFunc("POST /api/users/me/tokens", public.HandlerCreatePersonalAccessToken(cfg.DB, cfg.Secret))
+	mux.HandleFunc("GET /api/users/me/tokens", public.HandlerListPersonalAccessTokens(cfg.DB, cfg.Secret))
+	mux.HandleFunc("DELETE /api/users/me/tokens/{tokenID}", public.HandlerRevokePersonalAccessToken(cfg.DB, cfg.Secret))
+	mux.HandleFunc("POST /api/oauth/clients", public.HandlerRegisterOAuthClient(cfg.DB, cfg.Secret))
+	mux.HandleFunc("GET /api/oauth/clients", public.HandlerListOAuthClients(cfg.DB, cfg.Secret))
+	mux.HandleFunc("DELETE /api/oauth/clients/{clientID}", public.HandlerDeleteOAuthClient(cfg.DB, cfg.Secret))
+	mux.Handle("POST /api/login", limit(loginLimit, public.HandlerLogin(cfg.DB, cfg.Secret, sessions)))
+	mux.Handle("POST /api/login/mfa", limit(loginLimit, public.HandlerLoginMFA(cfg.DB, cfg.Secret, sessions)))
+	mux.Handle("POST /api/login/magic", limit(emailLimit, public.HandlerRequestMagicLink(cfg.DB, mail, sessions)))
+	mux.Handle("POST /api/login/magic/verify", limit(loginLimit, public.HandlerVerifyMagicLink(cfg.DB, cfg.Secret, sessions)))
+	mux.HandleFunc("POST /api/logout", public.HandlerLogout(cfg.DB, sessions))
+	mux.HandleFunc("POST /api/users/me/totp", public.HandlerEnrollTOTP(cfg.DB, cfg.Secret))
+	mux.HandleFunc("POST /api/users/me/totp/confirm", public.HandlerConfirmTOTP(cfg.DB, cfg.Secret))
+	mux.Handle("POST /api/refresh", limit(tokenLimit, public.HandlerRefresh(cfg.DB, cfg.Secret)))
 	mux.HandleFunc("POST /api/revoke", public.HandlerRevoke(cfg.DB))
+	mux.HandleFunc("GET /oauth/authorize", public.HandlerOAuthAuthorize(cfg.DB))
+	mux.HandleFunc("POST /oauth/authorize", public.HandlerOAuthApprove(cfg.DB))
+	mux.Handle("POST /oauth/token", limit(tokenLimit, public.HandlerOAuthToken(cfg.DB, cfg.Secret)))
+	mux.HandleFunc("POST /oauth/introspect", public.HandlerOAuthIntrospect(cfg.DB, cfg.Secret))
+	mux.HandleFunc("POST /oauth/revoke", public.HandlerOAuthRevoke(cfg.DB))
 	mux.HandleFunc("POST /api/polka/webhooks", public.HandlerUpgradeUser(cfg.DB, cfg.PolkaKey))
 
 	mux.Handle("GET /admin/metrics", adminState.MiddlewareCheckAdminCreds(adminState.HandlerMetrics))
+	mux.HandleFunc("GET /admin/analytics", adminState.HandlerGetAnalytics)
+	mux.HandleFunc("GET /admin/dashboard", adminState.HandlerDashboardTraffic)
+	mux.HandleFunc("GET /admin/dashboard/signups", adminState.HandlerDashboardSignups)
+	mux.HandleFunc("GET /admin/dashboard/moderation", adminState.HandlerDashboardModeration)
+	mux.HandleFunc("GET /admin/dashboard/webhooks", adminState.HandlerDashboardWebhooks)
+	mux.HandleFunc("GET /admin/dashboard/health", adminState.HandlerDashboardHealth)
 	mux.Handle("POST /admin/reset", adminState.MiddlewareCheckAdminCreds(adminState.HandlerReset))
+	mux.HandleFunc("POST /admin/reset/test-tenants", adminState.HandlerResetTestTenants)
+	mux.HandleFunc("GET /admin/users", adminState.HandlerListUsers)
+	mux.HandleFunc("GET /admin/users/{userID}", adminState.HandlerGetUser)
+	mux.HandleFunc("POST /admin/users/{userID}/password-reset", adminState.HandlerForcePasswordReset)
+	mux.HandleFunc("DELETE /admin/users/{userID}/sessions", adminState.HandlerRevokeUserSessions)
+	mux.HandleFunc("PUT /admin/users/{userID}/chirpy-red", adminState.HandlerSetChirpyRed)
+	mux.HandleFunc("POST /admin/users/{userID}/impersonate", adminState.HandlerImpersonateUser)
+	mux.HandleFunc("POST /admin/users/{userID}/unlock", adminState.HandlerUnlockUser)
+	mux.HandleFunc("PUT /admin/users/{userID}/role", adminState.HandlerSetUserRole)
+	mux.HandleFunc("PUT /admin/users/{userID}/suspension", adminState.HandlerSuspendUser)
+	mux.HandleFunc("DELETE /admin/users/{userID}/suspension", adminState.HandlerLiftSuspension)
+	mux.HandleFunc("GET /admin/reports", adminState.HandlerListReports)
+	mux.HandleFunc("GET /admin/reports/{caseID}", adminState.HandlerGetReport)
+	mux.HandleFunc("POST /admin/reports/{caseID}/resolve", adminState.HandlerResolveReport)
+	mux.HandleFunc("GET /admin/filters", adminState.HandlerListFilterRules)
+	mux.HandleFunc("POST /admin/filters", adminState.HandlerCreateFilterRule)
+	mux.HandleFunc("DELETE /admin/filters/{ruleID}", adminState.HandlerDeleteFilterRule)
+	mux.HandleFunc("POST /admin/filters/test", adminState.HandlerTestFilter)
+	mux.HandleFunc("GET /admin/audit", adminState.HandlerListAuditEvents)
+	mux.HandleFunc("GET /admin/audit/verify", adminState.HandlerVerifyAuditLog)
 }
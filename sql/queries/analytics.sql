@@ -0,0 +1,38 @@
+-- name: AddAnalyticsCounts :exec
+-- adds each count to its minute, hour and day in one statement, so a batch is never half recorded. Rows
+-- are written in key order, so replicas flushing at once take their row locks in the same order.
+INSERT INTO analytics_counts (granularity, bucket, metric, key, count)
+SELECT g.granularity, date_trunc(g.granularity, to_timestamp(u.minute * 60) AT TIME ZONE 'UTC'), u.metric, u.key, sum(u.count)
+FROM unnest(sqlc.arg('minutes')::bigint[], sqlc.arg('metrics')::text[], sqlc.arg('keys')::text[], sqlc.arg('counts')::bigint[]) AS u(minute, metric, key, count)
+CROSS JOIN (VALUES ('minute'), ('hour'), ('day')) AS g(granularity)
+GROUP BY 1, 2, 3, 4
+ORDER BY 1, 2, 3, 4
+ON CONFLICT (granularity, metric, bucket, key) DO UPDATE SET count = analytics_counts.count + EXCLUDED.count;
+
+-- name: ListAnalyticsSeries :many
+SELECT bucket, sum(count)::bigint AS count FROM analytics_counts
+WHERE granularity = sqlc.arg('granularity')
+  AND metric = sqlc.arg('metric')
+  AND bucket >= sqlc.arg('from_bucket')
+  AND bucket < sqlc.arg('to_bucket')
+  AND (sqlc.narg('key')::text IS NULL OR key = sqlc.narg('key')::text)
+GROUP BY bucket
+ORDER BY bucket;
+
+-- name: ListTopAnalyticsKeys :many
+SELECT key, sum(count)::bigint AS count FROM analytics_counts
+WHERE granularity = sqlc.arg('granularity')
+  AND metric = sqlc.arg('metric')
+  AND bucket >= sqlc.arg('from_bucket')
+  AND bucket < sqlc.arg('to_bucket')
+GROUP BY key
+ORDER BY count DESC, key
+LIMIT sqlc.arg('page_size');
+
+-- name: GetAnalyticsTotal :one
+SELECT coalesce(sum(count), 0)::bigint FROM analytics_counts
+WHERE granularity = 'day' AND metric = $1;
+
+-- name: DeleteAnalyticsCountsBefore :execrows
+DELETE FROM analytics_counts
+WHERE granularity = $1 AND bucket < $2;
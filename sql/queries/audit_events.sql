@@ -0,0 +1,29 @@
+-- name: LockAuditLog :exec
+-- held until the end of the transaction, so events are appended to the chain one at a time
+SELECT pg_advisory_xact_lock(hashtext('audit_events'));
+
+-- name: GetLatestAuditEvent :one
+SELECT * FROM audit_events
+ORDER BY seq DESC
+LIMIT 1;
+
+-- name: InsertAuditEvent :exec
+INSERT INTO audit_events (seq, created_at, actor_id, action, target_type, target_id, ip, request_id, metadata, prev_hash, hash)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);
+
+-- name: ListAuditEvents :many
+SELECT * FROM audit_events
+WHERE (sqlc.narg('actor_id')::uuid IS NULL OR actor_id = sqlc.narg('actor_id')::uuid)
+  AND (sqlc.narg('action')::text IS NULL OR action = sqlc.narg('action')::text)
+  AND (sqlc.narg('target_id')::text IS NULL OR target_id = sqlc.narg('target_id')::text)
+  AND (sqlc.narg('since')::timestamp IS NULL OR created_at >= sqlc.narg('since')::timestamp)
+  AND (sqlc.narg('until')::timestamp IS NULL OR created_at < sqlc.narg('until')::timestamp)
+  AND (sqlc.narg('before_seq')::bigint IS NULL OR seq < sqlc.narg('before_seq')::bigint)
+ORDER BY seq DESC
+LIMIT sqlc.arg('page_size');
+
+-- name: ListAuditEventsAfter :many
+SELECT * FROM audit_events
+WHERE seq > $1
+ORDER BY seq ASC
+LIMIT $2;
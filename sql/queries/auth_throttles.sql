@@ -0,0 +1,23 @@
+-- name: GetAuthThrottle :one
+SELECT * FROM auth_throttles
+WHERE key = $1;
+
+-- name: RecordAuthFailure :one
+INSERT INTO auth_throttles (key, failures, last_failure_at)
+VALUES ($1, 1, NOW())
+ON CONFLICT (key) DO UPDATE
+SET failures = CASE
+      WHEN auth_throttles.last_failure_at < NOW() - INTERVAL '15 minutes' THEN 1
+      ELSE auth_throttles.failures + 1
+    END,
+    last_failure_at = NOW()
+RETURNING failures;
+
+-- name: LockAuthThrottle :exec
+UPDATE auth_throttles
+SET locked_until = $2
+WHERE key = $1;
+
+-- name: ClearAuthThrottle :exec
+DELETE FROM auth_throttles
+WHERE key = $1;
@@ -0,0 +1,31 @@
+-- name: AddChirpImpressions :exec
+-- records each viewer of each chirp once per hour, and adds the viewers not already recorded to the
+-- chirp's count for that hour. Impressions of chirps deleted since are dropped.
+WITH new_viewers AS (
+  INSERT INTO chirp_impression_viewers (chirp_id, window_start, viewer)
+  SELECT u.chirp_id, to_timestamp(u.hour * 3600) AT TIME ZONE 'UTC', u.viewer
+  FROM unnest(sqlc.arg('chirp_ids')::uuid[], sqlc.arg('hours')::bigint[], sqlc.arg('viewers')::text[]) AS u(chirp_id, hour, viewer)
+  JOIN chirps ON chirps.id = u.chirp_id
+  ORDER BY 1, 2, 3
+  ON CONFLICT DO NOTHING
+  RETURNING chirp_id, window_start
+)
+INSERT INTO chirp_impressions (chirp_id, bucket, count)
+SELECT chirp_id, window_start, count(*) FROM new_viewers
+GROUP BY 1, 2
+ORDER BY 1, 2
+ON CONFLICT (chirp_id, bucket) DO UPDATE SET count = chirp_impressions.count + EXCLUDED.count;
+
+-- name: ListChirpImpressionsForUser :many
+SELECT ci.chirp_id, date_trunc(sqlc.arg('granularity')::text, ci.bucket)::timestamp AS bucket, sum(ci.count)::bigint AS count
+FROM chirp_impressions ci
+JOIN chirps c ON c.id = ci.chirp_id
+WHERE c.user_id = sqlc.arg('user_id')
+  AND ci.bucket >= sqlc.arg('from_bucket')
+  AND ci.bucket < sqlc.arg('to_bucket')
+GROUP BY 1, 2
+ORDER BY 1, 2;
+
+-- name: DeleteChirpImpressionViewersBefore :execrows
+DELETE FROM chirp_impression_viewers
+WHERE window_start < $1;
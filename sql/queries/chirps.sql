@@ -4,17 +4,51 @@ VALUES (NOW(), NOW(), $1, $2)
 RETURNING *;
 
 -- name: FetchChirpsWithOptionalParams :many
-SELECT * FROM chirps
+SELECT chirps.* FROM chirps
+JOIN users ON users.id = chirps.user_id
 WHERE (NULLIF($1::uuid, '00000000-0000-0000-0000-000000000000') IS NULL
-       OR user_id = $1)
+       OR chirps.user_id = $1)
+  AND users.delete_after IS NULL
+  AND chirps.hidden_at IS NULL
+  -- authors hidden from the viewer, as listed by ListHiddenAuthors, are left out before paging so a
+  -- page is never cut short. A muted author's chirps still show when asked for by author.
+  AND chirps.user_id NOT IN (
+    SELECT blocked_id FROM user_blocks WHERE user_blocks.blocker_id = sqlc.arg('viewer_id')
+    UNION ALL
+    SELECT blocker_id FROM user_blocks WHERE user_blocks.blocked_id = sqlc.arg('viewer_id')
+    UNION ALL
+    SELECT muted_id FROM user_mutes WHERE user_mutes.muter_id = sqlc.arg('viewer_id') AND user_mutes.muted_id <> $1
+    UNION ALL
+    SELECT id FROM users AS suspended
+    WHERE suspended.id <> sqlc.arg('viewer_id')
+      AND suspended.suspension_kind IN ('full', 'shadow_ban')
+      AND suspended.suspended_at IS NOT NULL
+      AND (suspended.suspended_until IS NULL OR suspended.suspended_until > NOW())
+  )
 ORDER BY
-  CASE WHEN $2 = 'asc'  THEN created_at END ASC,
-  CASE WHEN $2 = 'desc' THEN created_at END DESC;
+  CASE WHEN $2 = 'asc'  THEN chirps.created_at END ASC,
+  CASE WHEN $2 = 'desc' THEN chirps.created_at END DESC
+LIMIT sqlc.narg('limit') OFFSET sqlc.arg('offset');
 
 -- name: FetchChirpByID :one
-SELECT * FROM chirps
-WHERE id = $1;
+SELECT chirps.* FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.id = $1 AND users.delete_after IS NULL AND chirps.hidden_at IS NULL;
 
 -- name: DeleteChirp :exec
 DELETE FROM chirps
 WHERE id = $1;
+
+-- name: HideChirp :execrows
+UPDATE chirps
+SET hidden_at = NOW()
+WHERE id = $1 AND hidden_at IS NULL;
+
+-- name: ListChirpsForUser :many
+SELECT * FROM chirps
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: CountChirpsForUser :one
+SELECT count(*) FROM chirps
+WHERE user_id = $1;
@@ -0,0 +1,13 @@
+-- name: CreateFilterRule :one
+INSERT INTO filter_rules (created_at, pattern, severity, action, created_by)
+VALUES (NOW(), $1, $2, $3, $4)
+ON CONFLICT (pattern) DO NOTHING
+RETURNING *;
+
+-- name: ListFilterRules :many
+SELECT * FROM filter_rules
+ORDER BY created_at ASC;
+
+-- name: DeleteFilterRule :execrows
+DELETE FROM filter_rules
+WHERE id = $1;
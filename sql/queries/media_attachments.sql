@@ -0,0 +1,34 @@
+-- name: CreateMediaAttachment :one
+INSERT INTO media_attachments (id, created_at, user_id, content_type, width, height, original_key, thumbnail_key, thumbnail_content_type)
+VALUES ($1, NOW(), $2, $3, $4, $5, $6, $7, $8)
+RETURNING *;
+
+-- name: GetMediaAttachment :one
+SELECT * FROM media_attachments
+WHERE id = $1;
+
+-- name: AttachMediaToChirp :execrows
+UPDATE media_attachments
+SET chirp_id = $3, position = $4
+WHERE id = $1 AND user_id = $2 AND chirp_id IS NULL;
+
+-- name: ListMediaAttachmentsForChirps :many
+SELECT * FROM media_attachments
+WHERE chirp_id = ANY(@chirp_ids::uuid[])
+ORDER BY chirp_id, position;
+
+-- name: ListDetachedMediaAttachments :many
+SELECT * FROM media_attachments
+WHERE chirp_id IS NULL AND created_at < $1;
+
+-- name: DeleteMediaAttachment :exec
+DELETE FROM media_attachments
+WHERE id = $1;
+
+-- name: ListMediaAttachments :many
+SELECT * FROM media_attachments;
+
+-- name: ListMediaAttachmentsByEmailDomain :many
+SELECT media_attachments.* FROM media_attachments
+JOIN users ON users.id = media_attachments.user_id
+WHERE lower(split_part(users.email, '@', 2)) = ANY(sqlc.arg('domains')::text[]);
@@ -0,0 +1,38 @@
+-- name: OpenModerationCase :one
+INSERT INTO moderation_cases (created_at, updated_at, chirp_id, chirp_author_id, chirp_body)
+VALUES (NOW(), NOW(), $1, $2, $3)
+ON CONFLICT (chirp_id) WHERE status = 'open' DO UPDATE SET updated_at = NOW()
+RETURNING *;
+
+-- name: CreateChirpReport :execrows
+INSERT INTO chirp_reports (created_at, case_id, reporter_id, category, comment)
+VALUES (NOW(), $1, $2, $3, $4)
+ON CONFLICT (case_id, reporter_id) DO NOTHING;
+
+-- name: ListModerationCases :many
+SELECT moderation_cases.*, COUNT(chirp_reports.id) AS report_count, array_agg(DISTINCT chirp_reports.category)::text[] AS categories
+FROM moderation_cases
+JOIN chirp_reports ON chirp_reports.case_id = moderation_cases.id
+WHERE moderation_cases.status = $1
+GROUP BY moderation_cases.id
+ORDER BY report_count DESC, moderation_cases.created_at ASC
+LIMIT $2 OFFSET $3;
+
+-- name: GetModerationCase :one
+SELECT * FROM moderation_cases
+WHERE id = $1;
+
+-- name: ListReportsForCase :many
+SELECT * FROM chirp_reports
+WHERE case_id = $1
+ORDER BY created_at ASC;
+
+-- name: ResolveModerationCase :execrows
+UPDATE moderation_cases
+SET status = 'resolved', action = $2, actor_id = $3, resolution_reason = $4, resolved_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND status = 'open';
+
+-- name: ListReporterEmailsForCase :many
+SELECT users.email FROM chirp_reports
+JOIN users ON users.id = chirp_reports.reporter_id
+WHERE chirp_reports.case_id = $1;
@@ -0,0 +1,18 @@
+-- name: TakeRateLimitToken :one
+-- refills the bucket for the time since it was last used, then takes a token if a whole one is left.
+-- The database clock is used, so replicas with skewed clocks agree.
+INSERT INTO rate_limit_buckets (key, tokens, updated_at, allowed)
+VALUES (sqlc.arg('key'), sqlc.arg('capacity')::float8 - 1, now() AT TIME ZONE 'UTC', true)
+ON CONFLICT (key) DO UPDATE SET
+  tokens = CASE
+    WHEN least(sqlc.arg('capacity')::float8, rate_limit_buckets.tokens + extract(epoch FROM (now() AT TIME ZONE 'UTC') - rate_limit_buckets.updated_at)::float8 * sqlc.arg('rate')::float8) >= 1
+    THEN least(sqlc.arg('capacity')::float8, rate_limit_buckets.tokens + extract(epoch FROM (now() AT TIME ZONE 'UTC') - rate_limit_buckets.updated_at)::float8 * sqlc.arg('rate')::float8) - 1
+    ELSE least(sqlc.arg('capacity')::float8, rate_limit_buckets.tokens + extract(epoch FROM (now() AT TIME ZONE 'UTC') - rate_limit_buckets.updated_at)::float8 * sqlc.arg('rate')::float8)
+  END,
+  allowed = least(sqlc.arg('capacity')::float8, rate_limit_buckets.tokens + extract(epoch FROM (now() AT TIME ZONE 'UTC') - rate_limit_buckets.updated_at)::float8 * sqlc.arg('rate')::float8) >= 1,
+  updated_at = now() AT TIME ZONE 'UTC'
+RETURNING tokens, allowed;
+
+-- name: DeleteIdleRateLimitBuckets :execrows
+DELETE FROM rate_limit_buckets
+WHERE updated_at < $1;
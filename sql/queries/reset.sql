@@ -0,0 +1,128 @@
+-- name: CountResettableRows :one
+SELECT
+  (SELECT count(*) FROM analytics_counts) AS analytics_counts,
+  (SELECT count(*) FROM auth_throttles) AS auth_throttles,
+  (SELECT count(*) FROM chirp_impression_viewers) AS chirp_impression_viewers,
+  (SELECT count(*) FROM chirp_impressions) AS chirp_impressions,
+  (SELECT count(*) FROM chirp_reports) AS chirp_reports,
+  (SELECT count(*) FROM chirps) AS chirps,
+  (SELECT count(*) FROM data_exports) AS data_exports,
+  (SELECT count(*) FROM filter_rules) AS filter_rules,
+  (SELECT count(*) FROM media_attachments) AS media_attachments,
+  (SELECT count(*) FROM moderation_cases) AS moderation_cases,
+  (SELECT count(*) FROM oauth_authorization_codes) AS oauth_authorization_codes,
+  (SELECT count(*) FROM oauth_clients) AS oauth_clients,
+  (SELECT count(*) FROM personal_access_tokens) AS personal_access_tokens,
+  (SELECT count(*) FROM rate_limit_buckets) AS rate_limit_buckets,
+  (SELECT count(*) FROM recovery_codes) AS recovery_codes,
+  (SELECT count(*) FROM refresh_tokens) AS refresh_tokens,
+  (SELECT count(*) FROM user_blocks) AS user_blocks,
+  (SELECT count(*) FROM user_mutes) AS user_mutes,
+  (SELECT count(*) FROM user_tokens) AS user_tokens,
+  (SELECT count(*) FROM users) AS users,
+  (SELECT count(*) FROM webhook_deliveries) AS webhook_deliveries;
+
+-- name: CountResettableRowsByEmailDomain :one
+-- the rows deleting the users in domains would remove, following every cascading foreign key
+WITH doomed_users AS (
+  SELECT id FROM users WHERE lower(split_part(email, '@', 2)) = ANY(sqlc.arg('domains')::text[])
+), doomed_chirps AS (
+  SELECT id FROM chirps WHERE user_id IN (SELECT id FROM doomed_users)
+), doomed_clients AS (
+  SELECT id FROM oauth_clients WHERE owner_id IN (SELECT id FROM doomed_users)
+), doomed_cases AS (
+  SELECT id FROM moderation_cases WHERE chirp_author_id IN (SELECT id FROM doomed_users)
+)
+SELECT
+  (SELECT count(*) FROM chirp_impression_viewers WHERE chirp_id IN (SELECT id FROM doomed_chirps)) AS chirp_impression_viewers,
+  (SELECT count(*) FROM chirp_impressions WHERE chirp_id IN (SELECT id FROM doomed_chirps)) AS chirp_impressions,
+  (SELECT count(*) FROM chirp_reports WHERE reporter_id IN (SELECT id FROM doomed_users) OR case_id IN (SELECT id FROM doomed_cases)) AS chirp_reports,
+  (SELECT count(*) FROM doomed_chirps) AS chirps,
+  (SELECT count(*) FROM data_exports WHERE user_id IN (SELECT id FROM doomed_users)) AS data_exports,
+  (SELECT count(*) FROM media_attachments WHERE user_id IN (SELECT id FROM doomed_users)) AS media_attachments,
+  (SELECT count(*) FROM doomed_cases) AS moderation_cases,
+  (SELECT count(*) FROM oauth_authorization_codes WHERE user_id IN (SELECT id FROM doomed_users) OR client_id IN (SELECT id FROM doomed_clients)) AS oauth_authorization_codes,
+  (SELECT count(*) FROM doomed_clients) AS oauth_clients,
+  (SELECT count(*) FROM personal_access_tokens WHERE user_id IN (SELECT id FROM doomed_users)) AS personal_access_tokens,
+  (SELECT count(*) FROM recovery_codes WHERE user_id IN (SELECT id FROM doomed_users)) AS recovery_codes,
+  (SELECT count(*) FROM refresh_tokens WHERE user_id IN (SELECT id FROM doomed_users) OR client_id IN (SELECT id FROM doomed_clients)) AS refresh_tokens,
+  (SELECT count(*) FROM user_blocks WHERE blocker_id IN (SELECT id FROM doomed_users) OR blocked_id IN (SELECT id FROM doomed_users)) AS user_blocks,
+  (SELECT count(*) FROM user_mutes WHERE muter_id IN (SELECT id FROM doomed_users) OR muted_id IN (SELECT id FROM doomed_users)) AS user_mutes,
+  (SELECT count(*) FROM user_tokens WHERE user_id IN (SELECT id FROM doomed_users)) AS user_tokens,
+  (SELECT count(*) FROM doomed_users) AS users;
+
+-- name: CountOAuthRefreshTokens :one
+-- refresh tokens issued to OAuth clients, which are deleted with the clients
+SELECT count(*) FROM refresh_tokens
+WHERE client_id IS NOT NULL;
+
+-- name: LockResettableTables :exec
+-- blocks writes by anyone else until the transaction ends, so counts taken before and after a reset only differ by what it deleted
+LOCK TABLE analytics_counts, auth_throttles, chirp_impression_viewers, chirp_impressions, chirp_reports, chirps, data_exports, filter_rules, media_attachments, moderation_cases, oauth_authorization_codes, oauth_clients, personal_access_tokens, rate_limit_buckets, recovery_codes, refresh_tokens, user_blocks, user_mutes, user_tokens, users, webhook_deliveries IN SHARE ROW EXCLUSIVE MODE;
+
+-- name: DeleteUsersByEmailDomain :execrows
+DELETE FROM users
+WHERE lower(split_part(email, '@', 2)) = ANY(sqlc.arg('domains')::text[]);
+
+-- name: ResetAnalyticsCounts :execrows
+DELETE FROM analytics_counts;
+
+-- name: ResetAuthThrottles :execrows
+DELETE FROM auth_throttles;
+
+-- name: ResetChirpImpressionViewers :execrows
+DELETE FROM chirp_impression_viewers;
+
+-- name: ResetChirpImpressions :execrows
+DELETE FROM chirp_impressions;
+
+-- name: ResetChirpReports :execrows
+DELETE FROM chirp_reports;
+
+-- name: ResetChirps :execrows
+DELETE FROM chirps;
+
+-- name: ResetDataExports :execrows
+DELETE FROM data_exports;
+
+-- name: ResetFilterRules :execrows
+DELETE FROM filter_rules;
+
+-- name: ResetMediaAttachments :execrows
+DELETE FROM media_attachments;
+
+-- name: ResetModerationCases :execrows
+DELETE FROM moderation_cases;
+
+-- name: ResetOAuthAuthorizationCodes :execrows
+DELETE FROM oauth_authorization_codes;
+
+-- name: ResetOAuthClients :execrows
+DELETE FROM oauth_clients;
+
+-- name: ResetPersonalAccessTokens :execrows
+DELETE FROM personal_access_tokens;
+
+-- name: ResetRateLimitBuckets :execrows
+DELETE FROM rate_limit_buckets;
+
+-- name: ResetRecoveryCodes :execrows
+DELETE FROM recovery_codes;
+
+-- name: ResetRefreshTokens :execrows
+DELETE FROM refresh_tokens;
+
+-- name: ResetUserBlocks :execrows
+DELETE FROM user_blocks;
+
+-- name: ResetUserMutes :execrows
+DELETE FROM user_mutes;
+
+-- name: ResetUserTokens :execrows
+DELETE FROM user_tokens;
+
+-- name: ResetUsers :execrows
+DELETE FROM users;
+
+-- name: ResetWebhookDeliveries :execrows
+DELETE FROM webhook_deliveries;
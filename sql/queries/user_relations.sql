@@ -0,0 +1,40 @@
+-- name: BlockUser :exec
+INSERT INTO user_blocks (blocker_id, blocked_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: UnblockUser :execrows
+DELETE FROM user_blocks
+WHERE blocker_id = $1 AND blocked_id = $2;
+
+-- name: ListBlockedUsers :many
+SELECT * FROM user_blocks
+WHERE blocker_id = $1
+ORDER BY created_at DESC;
+
+-- name: MuteUser :exec
+INSERT INTO user_mutes (muter_id, muted_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: UnmuteUser :execrows
+DELETE FROM user_mutes
+WHERE muter_id = $1 AND muted_id = $2;
+
+-- name: ListMutedUsers :many
+SELECT * FROM user_mutes
+WHERE muter_id = $1
+ORDER BY created_at DESC;
+
+-- name: ListHiddenAuthors :many
+SELECT blocked_id AS user_id, TRUE AS blocked FROM user_blocks WHERE user_blocks.blocker_id = $1
+UNION ALL
+SELECT blocker_id, TRUE FROM user_blocks WHERE user_blocks.blocked_id = $1
+UNION ALL
+SELECT muted_id, FALSE FROM user_mutes WHERE user_mutes.muter_id = $1
+UNION ALL
+SELECT id, TRUE FROM users
+WHERE users.id <> $1
+  AND users.suspension_kind IN ('full', 'shadow_ban')
+  AND users.suspended_at IS NOT NULL
+  AND (users.suspended_until IS NULL OR users.suspended_until > NOW());
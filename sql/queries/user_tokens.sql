@@ -0,0 +1,17 @@
+-- name: CreateUserToken :exec
+INSERT INTO user_tokens (token_hash, created_at, user_id, purpose, email, expires_at)
+VALUES ($1, NOW(), $2, $3, $4, $5);
+
+-- name: ConsumeUserToken :one
+UPDATE user_tokens
+SET used_at = NOW()
+WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+RETURNING user_id, email;
+
+-- name: DeleteUserTokens :exec
+DELETE FROM user_tokens
+WHERE user_id = $1 AND purpose = $2;
+
+-- name: GetValidUserToken :one
+SELECT user_id FROM user_tokens
+WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW();
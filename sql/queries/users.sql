@@ -3,16 +3,21 @@ INSERT INTO users (created_at, updated_at, email, hashed_password)
 VALUES (NOW(), NOW(), $1, $2)
 RETURNING id, created_at, updated_at, email, is_chirpy_red;
 
--- name: DeleteAllUsers :exec
-DELETE FROM users;
-
 -- name: GetUserByEmail :one
 SELECT * FROM users
 WHERE $1=email;
 
 -- name: UpdateEmailAndPassword :one
+-- verification and login links sent to the old address stop working once it changes
+WITH revoked_links AS (
+  DELETE FROM user_tokens
+  USING users
+  WHERE users.id = $1 AND users.email <> $2
+    AND user_tokens.user_id = users.id
+    AND user_tokens.purpose IN ('verify_email', 'magic_login')
+)
 UPDATE users
-SET email = $2, hashed_password = $3, updated_at = NOW()
+SET email = $2, hashed_password = $3, email_verified = email_verified AND email = $2, updated_at = NOW()
 WHERE id = $1
 RETURNING id, created_at, updated_at, email, is_chirpy_red;
 
@@ -20,3 +25,88 @@ RETURNING id, created_at, updated_at, email, is_chirpy_red;
 UPDATE users
 SET is_chirpy_red = TRUE
 WHERE id = $1;
+
+-- name: GetUserByID :one
+SELECT * FROM users
+WHERE id = $1;
+
+-- name: SetTOTPSecret :exec
+UPDATE users
+SET totp_secret = $2, totp_enabled = FALSE, updated_at = NOW()
+WHERE id = $1;
+
+-- name: EnableTOTP :exec
+UPDATE users
+SET totp_enabled = TRUE, updated_at = NOW()
+WHERE id = $1;
+
+-- name: AdvanceTOTPStep :execrows
+UPDATE users
+SET totp_last_step = $2
+WHERE id = $1 AND totp_last_step < $2;
+
+-- name: MarkEmailVerified :execrows
+UPDATE users
+SET email_verified = TRUE, updated_at = NOW()
+WHERE id = $1 AND email = $2;
+
+-- name: UpdatePassword :exec
+UPDATE users
+SET hashed_password = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: ScheduleAccountDeletion :exec
+UPDATE users
+SET delete_after = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: CancelAccountDeletion :execrows
+UPDATE users
+SET delete_after = NULL, updated_at = NOW()
+WHERE id = $1 AND delete_after IS NOT NULL;
+
+-- name: DeleteExpiredAccounts :many
+DELETE FROM users
+WHERE delete_after IS NOT NULL AND delete_after < NOW()
+RETURNING id;
+
+-- name: UpdateProfile :one
+UPDATE users
+SET display_name = $2, bio = $3, location = $4, website = $5, avatar_url = $6, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: SetUserRole :execrows
+UPDATE users
+SET role = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: SuspendUser :execrows
+UPDATE users
+SET suspended_at = NOW(), suspension_kind = $2, suspension_reason = $3, suspended_until = $4, updated_at = NOW()
+WHERE id = $1;
+
+-- name: LiftSuspension :execrows
+UPDATE users
+SET suspended_at = NULL, suspension_kind = '', suspension_reason = '', suspended_until = NULL, updated_at = NOW()
+WHERE id = $1 AND suspended_at IS NOT NULL;
+
+-- name: ListUsers :many
+SELECT * FROM users
+WHERE (sqlc.narg('search')::text IS NULL OR email ILIKE '%' || sqlc.narg('search')::text || '%' OR display_name ILIKE '%' || sqlc.narg('search')::text || '%')
+  AND (sqlc.narg('is_chirpy_red')::boolean IS NULL OR is_chirpy_red = sqlc.narg('is_chirpy_red')::boolean)
+  AND (sqlc.narg('role')::text IS NULL OR role = sqlc.narg('role')::text)
+  AND (sqlc.narg('suspended')::boolean IS NULL OR (suspended_at IS NOT NULL AND (suspended_until IS NULL OR suspended_until > NOW())) = sqlc.narg('suspended')::boolean)
+ORDER BY created_at DESC, id
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: SetChirpyRed :execrows
+UPDATE users
+SET is_chirpy_red = $2, updated_at = NOW()
+WHERE id = $1;
+
+-- name: ClearPassword :execrows
+-- puts back the placeholder a user without a password has, which never matches, so only a reset lets them log in with one
+UPDATE users
+SET hashed_password = 'unset', updated_at = NOW()
+WHERE id = $1;
@@ -0,0 +1,13 @@
+-- name: CreateWebhookDelivery :exec
+INSERT INTO webhook_deliveries (received_at, source, event, user_id, status_code, error)
+VALUES (NOW(), $1, $2, $3, $4, $5);
+
+-- name: ListWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+ORDER BY received_at DESC
+LIMIT $1;
+
+-- name: ListWebhookDeliveriesForUser :many
+SELECT * FROM webhook_deliveries
+WHERE user_id = $1
+ORDER BY received_at;
@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE user_tokens(
+  token_hash TEXT PRIMARY KEY NOT NULL,
+  created_at TIMESTAMP NOT NULL,
+  user_id UUID NOT NULL,
+  purpose TEXT NOT NULL,
+  -- the address the token was sent to, which may no longer be the user's
+  email TEXT NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  used_at TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE user_tokens;
+
+ALTER TABLE users
+DROP COLUMN email_verified;
@@ -0,0 +1,10 @@
+-- +goose Up
+CREATE TABLE auth_throttles(
+  key TEXT PRIMARY KEY NOT NULL,
+  failures INTEGER NOT NULL,
+  last_failure_at TIMESTAMP NOT NULL,
+  locked_until TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE auth_throttles;
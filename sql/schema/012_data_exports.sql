@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE data_exports(
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at TIMESTAMP NOT NULL,
+  user_id UUID NOT NULL,
+  status TEXT NOT NULL,
+  archive BYTEA,
+  completed_at TIMESTAMP,
+  expires_at TIMESTAMP,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE data_exports;
@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE media_attachments(
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  user_id UUID NOT NULL,
+  chirp_id UUID,
+  position INTEGER NOT NULL DEFAULT 0,
+  content_type TEXT NOT NULL,
+  width INTEGER NOT NULL,
+  height INTEGER NOT NULL,
+  original_key TEXT NOT NULL,
+  thumbnail_key TEXT NOT NULL,
+  thumbnail_content_type TEXT NOT NULL,
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+  -- detached media is purged along with its files by a background job
+  FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE SET NULL
+);
+
+CREATE INDEX media_attachments_chirp_id_idx ON media_attachments(chirp_id);
+
+-- +goose Down
+DROP TABLE media_attachments;
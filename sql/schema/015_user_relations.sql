@@ -0,0 +1,25 @@
+-- +goose Up
+CREATE TABLE user_blocks(
+  blocker_id UUID NOT NULL,
+  blocked_id UUID NOT NULL,
+  created_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (blocker_id, blocked_id),
+  FOREIGN KEY (blocker_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (blocked_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- blocks are also looked up from the blocked user's side
+CREATE INDEX user_blocks_blocked_id_idx ON user_blocks(blocked_id);
+
+CREATE TABLE user_mutes(
+  muter_id UUID NOT NULL,
+  muted_id UUID NOT NULL,
+  created_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (muter_id, muted_id),
+  FOREIGN KEY (muter_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (muted_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE user_mutes;
+DROP TABLE user_blocks;
@@ -0,0 +1,48 @@
+-- +goose Up
+ALTER TABLE users
+  ADD COLUMN role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'moderator', 'admin')),
+  ADD COLUMN suspended_at TIMESTAMP,
+  ADD COLUMN suspension_reason TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE chirps ADD COLUMN hidden_at TIMESTAMP;
+
+-- a case collects every report about one chirp, so moderators review each chirp once
+CREATE TABLE moderation_cases(
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  -- not a foreign key, as the case and its outcome outlive a deleted chirp
+  chirp_id UUID NOT NULL,
+  chirp_author_id UUID NOT NULL,
+  chirp_body TEXT NOT NULL,
+  status TEXT NOT NULL DEFAULT 'open',
+  action TEXT NOT NULL DEFAULT '',
+  actor_id UUID,
+  resolution_reason TEXT NOT NULL DEFAULT '',
+  resolved_at TIMESTAMP,
+  FOREIGN KEY (chirp_author_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE UNIQUE INDEX moderation_cases_open_chirp_idx ON moderation_cases(chirp_id) WHERE status = 'open';
+
+CREATE TABLE chirp_reports(
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at TIMESTAMP NOT NULL,
+  case_id UUID NOT NULL,
+  reporter_id UUID NOT NULL,
+  category TEXT NOT NULL,
+  comment TEXT NOT NULL DEFAULT '',
+  UNIQUE (case_id, reporter_id),
+  FOREIGN KEY (case_id) REFERENCES moderation_cases(id) ON DELETE CASCADE,
+  FOREIGN KEY (reporter_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE chirp_reports;
+DROP TABLE moderation_cases;
+ALTER TABLE chirps DROP COLUMN hidden_at;
+ALTER TABLE users
+  DROP COLUMN suspension_reason,
+  DROP COLUMN suspended_at,
+  DROP COLUMN role;
@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TABLE filter_rules(
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at TIMESTAMP NOT NULL,
+  pattern TEXT NOT NULL UNIQUE,
+  severity TEXT NOT NULL CHECK (severity IN ('low', 'medium', 'high')),
+  action TEXT NOT NULL CHECK (action IN ('mask', 'reject', 'flag')),
+  created_by UUID,
+  FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+INSERT INTO filter_rules (created_at, pattern, severity, action) VALUES
+  (NOW(), 'kerfuffle', 'low', 'mask'),
+  (NOW(), 'sharbert', 'low', 'mask'),
+  (NOW(), 'fornax', 'low', 'mask');
+
+-- chirps flagged by the filter are reported by no one
+ALTER TABLE chirp_reports ALTER COLUMN reporter_id DROP NOT NULL;
+
+-- +goose Down
+DELETE FROM chirp_reports WHERE reporter_id IS NULL;
+ALTER TABLE chirp_reports ALTER COLUMN reporter_id SET NOT NULL;
+DROP TABLE filter_rules;
@@ -0,0 +1,12 @@
+-- +goose Up
+ALTER TABLE users
+  ADD COLUMN suspension_kind TEXT NOT NULL DEFAULT '' CHECK (suspension_kind IN ('', 'full', 'read_only', 'shadow_ban')),
+  ADD COLUMN suspended_until TIMESTAMP;
+
+-- every suspension before this locked the user out entirely
+UPDATE users SET suspension_kind = 'full' WHERE suspended_at IS NOT NULL;
+
+-- +goose Down
+ALTER TABLE users
+  DROP COLUMN suspended_until,
+  DROP COLUMN suspension_kind;
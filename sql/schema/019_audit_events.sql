@@ -0,0 +1,36 @@
+-- +goose Up
+-- each event carries the hash of the one before it, so editing or removing an event breaks the chain
+CREATE TABLE audit_events(
+  seq BIGINT PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  -- not foreign keys, as the log must outlive the users and objects it mentions
+  actor_id UUID,
+  action TEXT NOT NULL,
+  target_type TEXT NOT NULL DEFAULT '',
+  target_id TEXT NOT NULL DEFAULT '',
+  ip TEXT NOT NULL DEFAULT '',
+  request_id TEXT NOT NULL DEFAULT '',
+  metadata JSONB NOT NULL DEFAULT '{}',
+  prev_hash TEXT NOT NULL,
+  hash TEXT NOT NULL
+);
+
+CREATE INDEX audit_events_actor_idx ON audit_events(actor_id, seq);
+CREATE INDEX audit_events_action_idx ON audit_events(action, seq);
+CREATE INDEX audit_events_target_idx ON audit_events(target_id, seq);
+
+-- +goose StatementBegin
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER audit_events_append_only
+BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_events
+FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
+
+-- +goose Down
+DROP TABLE audit_events;
+DROP FUNCTION audit_events_append_only;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- every authenticated webhook request and how it was answered, so failed deliveries can be traced
+CREATE TABLE webhook_deliveries(
+  id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+  received_at TIMESTAMP NOT NULL,
+  source TEXT NOT NULL,
+  event TEXT NOT NULL,
+  -- not a foreign key, so deliveries about unknown or deleted users are kept
+  user_id UUID,
+  status_code INTEGER NOT NULL,
+  error TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX webhook_deliveries_received_at_idx ON webhook_deliveries(received_at);
+-- a data export lists the deliveries about its user
+CREATE INDEX webhook_deliveries_user_id_idx ON webhook_deliveries(user_id, received_at);
+
+-- +goose Down
+DROP TABLE webhook_deliveries;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- counts of page views and API requests per minute, hour and day. Every replica adds its own counts to
+-- these rows, so each total covers all of them.
+CREATE TABLE analytics_counts(
+  granularity TEXT NOT NULL CHECK (granularity IN ('minute', 'hour', 'day')),
+  bucket TIMESTAMP NOT NULL,
+  metric TEXT NOT NULL,
+  key TEXT NOT NULL,
+  count BIGINT NOT NULL,
+  PRIMARY KEY (granularity, metric, bucket, key)
+);
+
+-- +goose Down
+DROP TABLE analytics_counts;
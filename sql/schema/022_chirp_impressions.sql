@@ -0,0 +1,24 @@
+-- +goose Up
+-- who has seen each chirp in each hour, so a viewer is counted once per hour however many times the
+-- chirp is shown to them. Only the current and previous hours are needed, and older rows are pruned.
+CREATE TABLE chirp_impression_viewers(
+  chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+  window_start TIMESTAMP NOT NULL,
+  -- a hash of the viewer's user ID, or of their IP address when logged out
+  viewer TEXT NOT NULL,
+  PRIMARY KEY (chirp_id, window_start, viewer)
+);
+
+CREATE INDEX chirp_impression_viewers_window_start_idx ON chirp_impression_viewers(window_start);
+
+-- distinct viewers of each chirp per hour
+CREATE TABLE chirp_impressions(
+  chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+  bucket TIMESTAMP NOT NULL,
+  count BIGINT NOT NULL,
+  PRIMARY KEY (chirp_id, bucket)
+);
+
+-- +goose Down
+DROP TABLE chirp_impressions;
+DROP TABLE chirp_impression_viewers;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- token buckets shared by every replica when RATE_LIMIT_STORE=postgres
+CREATE TABLE rate_limit_buckets(
+  key TEXT PRIMARY KEY,
+  tokens DOUBLE PRECISION NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  -- whether the last request took a token, so the upsert taking it can report the outcome
+  allowed BOOLEAN NOT NULL
+);
+
+CREATE INDEX rate_limit_buckets_updated_at_idx ON rate_limit_buckets(updated_at);
+
+-- +goose Down
+DROP TABLE rate_limit_buckets;